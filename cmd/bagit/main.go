@@ -0,0 +1,66 @@
+// Command bagit validates BagIt bags on disk, such as the preservation exports before their transfer.
+//
+//	bagit validate path...  check each bag, a directory or a zip or tar(.gz) archive
+//
+// It needs no configuration, so that bags can be checked away from the server.
+package main
+
+import (
+	"archiv-system/internal/bagit"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const usage = "usage: bagit validate path..."
+
+func main() {
+	args := os.Args[1:]
+	if len(args) < 2 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	invalid := false
+	for _, name := range args[1:] {
+		if !validate(name) {
+			invalid = true
+		}
+	}
+	if invalid {
+		os.Exit(1)
+	}
+}
+
+// validate checks a bag and prints the outcome, returning whether it is valid
+func validate(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return false
+	}
+	var bag *bagit.Bag
+	if info.IsDir() {
+		bag, err = bagit.ValidateDir(name)
+	} else {
+		bag, err = bagit.ValidateArchive(name)
+	}
+
+	var invalid *bagit.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		fmt.Printf("%s: invalid bag\n", name)
+		for _, problem := range invalid.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		if invalid.Omitted > 0 {
+			fmt.Printf("  and %d more problems\n", invalid.Omitted)
+		}
+		return false
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return false
+	}
+	fmt.Printf("%s: valid bag (BagIt %s), %d files, %d bytes\n", name, bag.Version, len(bag.Payload), bag.Size())
+	return true
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"archiv-system/internal/bagit"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	var out bytes.Buffer
+	bw := bagit.NewWriter(&out, "bag")
+	if _, err := bw.AddFile("minutes.txt", time.Now(), strings.NewReader("minutes of the board\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Close(nil); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "bag.zip")
+	if err := os.WriteFile(archive, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !validate(archive) {
+		t.Fatal("valid bag rejected")
+	}
+
+	// A directory declared as a bag whose payload is not in any manifest
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, bagit.DeclarationFile), []byte("BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, bagit.PayloadDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, bagit.PayloadDir, "minutes.txt"), []byte("minutes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if validate(dir) {
+		t.Fatal("invalid bag accepted")
+	}
+	if validate(filepath.Join(t.TempDir(), "missing.zip")) {
+		t.Fatal("missing bag accepted")
+	}
+}
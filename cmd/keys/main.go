@@ -0,0 +1,97 @@
+// Command keys manages the master keys of the encryption at rest.
+//
+//	keys [-config file] generate [id]  print a keyfile line holding a new master key, to append to the keyfile
+//	keys [-config file] rotate         rewrap the data key of every encrypted file with the last key of the keyfile
+//	keys [-config file] backfill       record the encryption of the files stored before it was recorded with them
+package main
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/encryption"
+	"archiv-system/internal/logging"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = "usage: keys [-config file] generate [id] | rotate | backfill"
+
+func main() {
+	// Load environment variables from .env when present
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Fatal("Error loading environment variables", "error", err)
+	}
+
+	cfg, args, err := config.LoadCommand("keys", os.Args[1:])
+	if err != nil {
+		logging.Fatal("Error loading configuration", "error", err)
+	}
+	logging.Init(cfg.Log)
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch args[0] {
+	case "generate":
+		id := time.Now().UTC().Format("20060102-150405")
+		if len(args) > 1 {
+			id = args[1]
+		}
+		line, err := encryption.GenerateKey(id)
+		if err != nil {
+			logging.Fatal("Error generating key", "error", err)
+		}
+		fmt.Println(line)
+	case "rotate":
+		store, files := open(cfg)
+		summary, err := store.RotateKeys(database.Unscoped(ctx), files)
+		if err != nil {
+			logging.Fatal("Key rotation failed", "error", err, "rewrapped", summary.Rewrapped)
+		}
+		fmt.Printf("Rewrapped %d of %d encrypted files with key %s\n",
+			summary.Rewrapped, summary.Encrypted, store.Keys().KeyID())
+		if summary.Missing > 0 {
+			fmt.Printf("%d encrypted files are missing from the storage\n", summary.Missing)
+		}
+	case "backfill":
+		store, files := open(cfg)
+		recorded, err := store.Backfill(database.Unscoped(ctx), files)
+		if err != nil {
+			logging.Fatal("Encryption backfill failed", "error", err, "recorded", recorded)
+		}
+		fmt.Printf("Recorded %d encrypted files\n", recorded)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// open returns the storage and the records of the stored files of every organization
+func open(cfg *config.Config) (*storage.Store, repository.StoredFileRepository) {
+	if cfg.Encryption.KeyFile == "" {
+		logging.Fatal("encryption.key_file (ENCRYPTION_KEY_FILE) is required to manage the encrypted files")
+	}
+	store, err := storage.New(cfg.Storage, cfg.Encryption)
+	if err != nil {
+		logging.Fatal("Error initializing storage", "error", err)
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		logging.Fatal("Error connecting to the database", "error", err)
+	}
+	return store, repository.NewGorm(db).Files
+}
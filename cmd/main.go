@@ -1,68 +1,221 @@
 package main
 
 import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
 	"archiv-system/internal/database"
+	"archiv-system/internal/fixity"
 	"archiv-system/internal/handler"
-	"archiv-system/internal/middleware"
-	"log"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/logging"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/preview"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/scan"
+	"archiv-system/internal/server"
+	"archiv-system/internal/services"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/tracing"
+	"archiv-system/internal/utils"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
 
-	// Load environment variables
-	err := godotenv.Load(".env")
+	// Load environment variables from .env when present
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Fatal("Error loading environment variables", "error", err)
+	}
+
+	// Load the configuration (file, environment and flags)
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Error loading environment variables: %v", err)
+		logging.Fatal("Error loading configuration", "error", err)
 	}
 
-	// Ensure the uploads directory exists
-	if err := os.MkdirAll("uploads", os.ModePerm); err != nil {
-		log.Fatalf("Error creating uploads directory: %v", err)
+	// Structured logging, with request IDs and redaction of secrets
+	logging.Init(cfg.Log)
+
+	// Storage directory, with the master keys of the encryption at rest
+	store, err := storage.New(cfg.Storage, cfg.Encryption)
+	if err != nil {
+		logging.Fatal("Error initializing storage", "error", err)
 	}
 
-	// Initialize Gin
-	r := gin.Default()
+	// Malware scanner, nil when scanning is disabled
+	scanner, err := scan.New(cfg.Scan)
+	if err != nil {
+		logging.Fatal("Error initializing malware scanner", "error", err)
+	}
 
-	// Initialize the database
-	database.InitDB()
+	tokens, err := utils.NewJWT(cfg.JWT)
+	if err != nil {
+		logging.Fatal("Error initializing JWT", "error", err)
+	}
 
-	// Public routes
-	r.POST("auth/register", handler.Register)
-	r.POST("auth/login", handler.Login)
+	// Initialize tracing before anything opens spans
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing, nil)
+	if err != nil {
+		logging.Fatal("Error initializing tracing", "error", err)
+	}
 
-	// Apply JWT middleware globally
-	r.Use(middleware.JWTAuthMiddleware())
+	// Initialize the database and the repositories on top of it
+	db := database.InitDB(cfg.Database, cfg.Admin)
+	if err := metrics.RegisterDB(db, store.Backend()); err != nil {
+		logging.Fatal("Error registering database metrics", "error", err)
+	}
+	repos := repository.NewGorm(db)
+	engine := authz.NewEngine(cfg.Authz, repos)
 
-	// Group for document routes
-	documentsGroup := r.Group("/documents")
-	{
-		documentsGroup.POST("/upload", middleware.AuthMiddleware("upload_document"), handler.UploadFile)
-		documentsGroup.GET("/viewlist", middleware.AuthMiddleware("read_document"), handler.ViewListDoc) // Permission to view list of documents
-		documentsGroup.PUT("/:id", middleware.AuthMiddleware("update_document"), middleware.OwnershipMiddleware(database.DB), handler.UpdateDocument)
-		documentsGroup.DELETE("/:id", middleware.AuthMiddleware("delete_document"), middleware.OwnershipMiddleware(database.DB), handler.DeleteDocument)
-		documentsGroup.GET("/user", middleware.AuthMiddleware("read_document"), handler.GetUserDocuments) // Permission to view user's own documents
-		documentsGroup.GET("/:id/check-update", handler.CheckDocumentUpdate)
+	// Initialize the notifier delivering password reset links
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		logging.Fatal("Error initializing notifier", "error", err)
 	}
 
-	// Group for admin routes
-	adminGroup := r.Group("/admin")
-	{
-		adminGroup.POST("/dashboard", middleware.AuthMiddleware("admin:create"), handler.AdminHandler)
+	// Initialize the authentication providers (local and LDAP), password policy and login lockout
+	authenticator, err := auth.NewAuthenticator(repos, engine, cfg)
+	if err != nil {
+		logging.Fatal("Error initializing authentication", "error", err)
+	}
+	// Background workers, stopped on shutdown
+	workers := jobs.NewRunner()
+	if ldapProvider := authenticator.LDAP(); ldapProvider != nil {
+		workers.Go("ldap-sync", ldapProvider.RunSync)
+	}
+	if cfg.Fixity.Enabled {
+		workers.Go("fixity", fixity.NewChecker(repos.Documents, repos.FixityEvents, store, notifier, cfg.Fixity).Run)
 	}
 
-	// Group for user routes
-	userGroup := r.Group("/user")
-	{
-		userGroup.GET("/dashboard", middleware.AuthMiddleware("user:read"), handler.UserHandler)
+	// Services, generating thumbnails, scanning uploads, importing, exporting and packaging on their own queues
+	svc := services.New(repos, services.Dependencies{
+		Store:     store,
+		Authz:     engine,
+		Passwords: authenticator.Policy(),
+		Notifier:  notifier,
+		Previews:  preview.NewGenerator(cfg.Preview),
+		Scanner:   scanner,
+		SHA512:    cfg.Fixity.SHA512,
+	})
+	svc.Documents.SetUploadRules(cfg.Upload)
+	svc.Passwords.SetResetURL(cfg.Password.ResetURL)
+	svc.Passwords.SetQueue(workers.NewQueue("notifications", 1, 100))
+	if cfg.Preview.Enabled {
+		svc.Previews.SetQueue(workers.NewQueue("previews", cfg.Preview.Workers, cfg.Preview.QueueSize), cfg.Preview.Timeout)
+	}
+	if cfg.Scan.Enabled {
+		svc.Scans.SetQueue(workers.NewQueue("scans", cfg.Scan.Workers, cfg.Scan.QueueSize), cfg.Scan.Timeout, cfg.Scan.OnInfected)
+		if queued, err := svc.Scans.RequeuePending(context.Background()); err != nil {
+			slog.Error("Failed to queue the pending scans", "error", err)
+		} else if queued > 0 {
+			slog.Info("Queued the scans left pending", "count", queued)
+		}
 	}
+	if cfg.Import.Enabled {
+		if err := svc.Imports.FailInterrupted(context.Background()); err != nil {
+			slog.Error("Failed to close interrupted imports", "error", err)
+		}
+		svc.Imports.SetQueue(workers.NewQueue("imports", cfg.Import.Workers, cfg.Import.QueueSize), cfg.Import)
+	}
+	if cfg.Export.Enabled {
+		if err := svc.Exports.FailInterrupted(context.Background()); err != nil {
+			slog.Error("Failed to close interrupted exports", "error", err)
+		}
+		svc.Exports.SetQueue(workers.NewQueue("exports", cfg.Export.Workers, cfg.Export.QueueSize), cfg.Export)
+		workers.Go("export-cleanup", svc.Exports.RunCleanup)
+	}
+	if cfg.Preservation.Enabled {
+		if err := svc.Preservation.FailInterrupted(context.Background()); err != nil {
+			slog.Error("Failed to close interrupted archival packages", "error", err)
+		}
+		svc.Preservation.SetQueue(workers.NewQueue("packages", cfg.Preservation.Workers, cfg.Preservation.QueueSize), cfg.Preservation)
+	}
+
+	// Routes, served by handlers built on the services
+	r := server.NewRouter(cfg, server.Dependencies{
+		Services:      svc,
+		Users:         repos.Users,
+		Authenticator: authenticator,
+		JWT:           tokens,
+		Authz:         engine,
+		Store:         store,
+		DB:            db,
+	})
 
 	// Start the server
-	err = r.Run(":8080")
-	if err != nil {
-		log.Fatalf("Error starting the server: %v", err)
+	srv := &http.Server{
+		Addr:              cfg.Server.Address,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("Listening", "address", cfg.Server.Address, "tls", cfg.Server.TLSEnabled())
+		if cfg.Server.TLSEnabled() {
+			serverErr <- srv.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			serverErr <- srv.ListenAndServe()
+		}
+	}()
+
+	// Metrics on their own listener, to be reachable by Prometheus only
+	var metricsSrv *http.Server
+	if cfg.Server.MetricsAddress != "" {
+		metricsSrv = &http.Server{
+			Addr:              cfg.Server.MetricsAddress,
+			Handler:           metrics.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("Serving metrics", "address", cfg.Server.MetricsAddress)
+			if err := metricsSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
+	// Wait for SIGINT / SIGTERM, or for the server to fail
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	select {
+	case err := <-serverErr:
+		logging.Fatal("Error starting the server", "error", err)
+	case <-stop.Done():
+	}
+
+	// Drain in-flight requests (uploads included), then the background workers
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+	handler.MarkShuttingDown()
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down the server", "error", err)
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down the metrics server", "error", err)
+		}
+	}
+	if err := workers.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping background workers", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
 	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,106 @@
+// Command migrate applies, rolls back and lists the database schema migrations.
+//
+//	migrate [-config file] up            apply every pending migration
+//	migrate [-config file] down [steps]  roll back the last steps migrations (1 by default)
+//	migrate [-config file] status        list the migrations and when they were applied
+package main
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/logging"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = "usage: migrate [-config file] up | down [steps] | status"
+
+func main() {
+	// Load environment variables from .env when present
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Fatal("Error loading environment variables", "error", err)
+	}
+
+	cfg, args, err := config.LoadCommand("migrate", os.Args[1:])
+	if err != nil {
+		logging.Fatal("Error loading configuration", "error", err)
+	}
+	logging.Init(cfg.Log)
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		logging.Fatal("Error opening the database", "error", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.Migrate(ctx, db)
+		if err != nil {
+			logging.Fatal("Migration failed", "error", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				logging.Fatal("Invalid number of steps", "steps", args[1])
+			}
+		}
+		reverted, err := database.Rollback(ctx, db, steps)
+		if err != nil {
+			logging.Fatal("Rollback failed", "error", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migration to roll back")
+		}
+		for _, migration := range reverted {
+			fmt.Printf("Rolled back %d_%s\n", migration.Version, migration.Name)
+		}
+	case "status":
+		statuses, err := database.Status(ctx, db)
+		if err != nil {
+			logging.Fatal("Error reading migration status", "error", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Unknown {
+				appliedAt += " (not in this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
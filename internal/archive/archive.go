@@ -0,0 +1,187 @@
+// Package archive reads the zip and tar archives of the bulk imports, and the manifest that may come with their
+// files. Entry paths are cleaned so that no entry can point outside the archive.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported archive format, expected zip, tar or tar.gz")
+	ErrUnsafePath        = errors.New("entry path leaves the archive")
+)
+
+// Archive formats
+const (
+	FormatZip     = "zip"
+	FormatTar     = "tar"
+	FormatTarGzip = "tar.gz"
+)
+
+// Entry is a file or directory of an archive
+type Entry struct {
+	Path    string // Cleaned, slash-separated and relative to the root of the archive
+	Size    int64
+	Dir     bool
+	Regular bool // false for links and devices, which are not imported
+	open    func() (io.ReadCloser, error)
+}
+
+// Open returns the content of a regular file. With tar archives it can only be read during the walk.
+func (e Entry) Open() (io.ReadCloser, error) {
+	if !e.Regular {
+		return nil, fmt.Errorf("%s is not a regular file", e.Path)
+	}
+	return e.open()
+}
+
+// DetectFormat returns the format of the archive at path from its first bytes
+func DetectFormat(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return FormatTarGzip, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return FormatTar, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Walk calls fn for each entry of the archive at name, in the order of the archive. Entries whose path is empty
+// once cleaned, such as the root directory, and the metadata directories of macOS are skipped.
+// An entry path leaving the archive stops the walk with ErrUnsafePath.
+func Walk(name string, fn func(Entry) error) error {
+	format, err := DetectFormat(name)
+	if err != nil {
+		return err
+	}
+	if format == FormatZip {
+		return walkZip(name, fn)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = bufio.NewReader(file)
+	if format == FormatTarGzip {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return walkTar(tar.NewReader(r), fn)
+}
+
+func walkZip(name string, fn func(Entry) error) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		entryPath, err := CleanPath(f.Name)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, f.Name)
+		}
+		if skipped(entryPath) {
+			continue
+		}
+		mode := f.Mode()
+		entry := Entry{
+			Path:    entryPath,
+			Size:    int64(f.UncompressedSize64),
+			Dir:     mode.IsDir(),
+			Regular: mode.IsRegular(),
+			open:    f.Open, // the zip reader fails past the declared size
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(tr *tar.Reader, fn func(Entry) error) error {
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		entryPath, err := CleanPath(header.Name)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, header.Name)
+		}
+		if skipped(entryPath) {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			continue
+		}
+		entry := Entry{
+			Path:    entryPath,
+			Size:    header.Size,
+			Dir:     header.Typeflag == tar.TypeDir,
+			Regular: header.Typeflag == tar.TypeReg,
+			open:    func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// CleanPath returns the slash-separated path of an entry relative to the root of the archive, or ErrUnsafePath
+// when it leaves the archive. Leading slashes and backslash separators are accepted.
+func CleanPath(name string) (string, error) {
+	if strings.Contains(name, "\x00") {
+		return "", ErrUnsafePath
+	}
+	name = strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/")
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", ErrUnsafePath
+	}
+	if name == "." {
+		return "", nil
+	}
+	return name, nil
+}
+
+// skipped tells whether an entry holds no content to import
+func skipped(entryPath string) bool {
+	return entryPath == "" || entryPath == "__MACOSX" || strings.HasPrefix(entryPath, "__MACOSX/") ||
+		path.Base(entryPath) == ".DS_Store"
+}
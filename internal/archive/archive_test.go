@@ -0,0 +1,233 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntry is an entry written by writeArchive: a directory when its name ends with a slash, a symbolic link
+// when link is set, a regular file otherwise
+type testEntry struct {
+	name, content, link string
+}
+
+// writeArchive writes the entries as an archive of the format and returns its path
+func writeArchive(t *testing.T, format string, entries []testEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	modified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	if format == FormatZip {
+		zw := zip.NewWriter(&buf)
+		for _, entry := range entries {
+			header := &zip.FileHeader{Name: entry.name, Modified: modified, Method: zip.Deflate}
+			content := entry.content
+			switch {
+			case strings.HasSuffix(entry.name, "/"):
+				header.SetMode(os.ModeDir | 0o755)
+			case entry.link != "":
+				header.SetMode(os.ModeSymlink | 0o777)
+				content = entry.link
+			default:
+				header.SetMode(0o644)
+			}
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		var w io.Writer = &buf
+		var gz *gzip.Writer
+		if format == FormatTarGzip {
+			gz = gzip.NewWriter(&buf)
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		for _, entry := range entries {
+			header := &tar.Header{Name: entry.name, ModTime: modified, Mode: 0o644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+			switch {
+			case strings.HasSuffix(entry.name, "/"):
+				header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0o755, 0
+			case entry.link != "":
+				header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, entry.link, 0
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if header.Typeflag == tar.TypeReg {
+				if _, err := io.WriteString(tw, entry.content); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	name := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name, want string
+		unsafe     bool
+	}{
+		{name: "reports/budget.csv", want: "reports/budget.csv"},
+		{name: "./reports//2024/../budget.csv", want: "reports/budget.csv"},
+		{name: "reports\\2024\\budget.csv", want: "reports/2024/budget.csv"},
+		{name: "/etc/passwd", want: "etc/passwd"},
+		{name: "//server/share/file.txt", want: "server/share/file.txt"},
+		{name: "/../etc/passwd", unsafe: true},
+		{name: "reports/", want: "reports"},
+		{name: "./", want: ""},
+		{name: "", want: ""},
+		{name: "..", unsafe: true},
+		{name: "../etc/passwd", unsafe: true},
+		{name: "reports/../../etc/passwd", unsafe: true},
+		{name: "..\\..\\windows\\system.ini", unsafe: true},
+		{name: "budget.csv\x00.pdf", unsafe: true},
+	}
+	for _, tt := range tests {
+		got, err := CleanPath(tt.name)
+		if tt.unsafe {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("CleanPath(%q) = %q, %v, want ErrUnsafePath", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CleanPath(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	entries := []testEntry{
+		{name: "./"},
+		{name: "reports/"},
+		{name: "reports/budget.csv", content: "year,amount\n2024,100\n"},
+		{name: "/minutes.txt", content: "minutes of the board\n"},
+		{name: "reports/latest", link: "budget.csv"},
+		{name: "__MACOSX/reports/._budget.csv", content: "resource fork"},
+		{name: "reports/.DS_Store", content: "finder"},
+	}
+	for _, format := range []string{FormatZip, FormatTar, FormatTarGzip} {
+		t.Run(format, func(t *testing.T) {
+			name := writeArchive(t, format, entries)
+			if detected, err := DetectFormat(name); err != nil || detected != format {
+				t.Fatalf("detected %s, %v", detected, err)
+			}
+
+			var walked []string
+			contents := map[string]string{}
+			err := Walk(name, func(entry Entry) error {
+				kind := "file"
+				switch {
+				case entry.Dir:
+					kind = "dir"
+				case !entry.Regular:
+					kind = "other"
+					if _, err := entry.Open(); err == nil {
+						t.Errorf("%s opened", entry.Path)
+					}
+				default:
+					content, err := entry.Open()
+					if err != nil {
+						return err
+					}
+					defer content.Close()
+					data, err := io.ReadAll(content)
+					if err != nil {
+						return err
+					}
+					if int64(len(data)) != entry.Size {
+						t.Errorf("%s: %d bytes read, %d declared", entry.Path, len(data), entry.Size)
+					}
+					contents[entry.Path] = string(data)
+				}
+				walked = append(walked, kind+" "+entry.Path)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "dir reports, file reports/budget.csv, file minutes.txt, other reports/latest"
+			if got := strings.Join(walked, ", "); got != want {
+				t.Errorf("walked %s, want %s", got, want)
+			}
+			if contents["reports/budget.csv"] != entries[2].content || contents["minutes.txt"] != entries[3].content {
+				t.Errorf("contents %q", contents)
+			}
+		})
+	}
+}
+
+func TestWalkRejectsUnsafePaths(t *testing.T) {
+	for _, format := range []string{FormatZip, FormatTar, FormatTarGzip} {
+		for _, unsafe := range []string{"../escape.txt", "reports/../../escape.txt"} {
+			name := writeArchive(t, format, []testEntry{{name: "minutes.txt", content: "minutes"}, {name: unsafe, content: "escape"}})
+			var walked int
+			err := Walk(name, func(Entry) error {
+				walked++
+				return nil
+			})
+			if !errors.Is(err, ErrUnsafePath) || !strings.Contains(err.Error(), unsafe) {
+				t.Errorf("%s %s: got %v, want ErrUnsafePath", format, unsafe, err)
+			}
+			if walked != 1 {
+				t.Errorf("%s %s: %d entries walked before the unsafe one", format, unsafe, walked)
+			}
+		}
+	}
+}
+
+func TestWalkStopsOnCallbackError(t *testing.T) {
+	name := writeArchive(t, FormatTar, []testEntry{{name: "a.txt", content: "a"}, {name: "b.txt", content: "b"}})
+	stop := errors.New("stop")
+	var walked int
+	if err := Walk(name, func(Entry) error {
+		walked++
+		return stop
+	}); !errors.Is(err, stop) || walked != 1 {
+		t.Fatalf("got %v after %d entries, want the error of the callback after the first one", err, walked)
+	}
+}
+
+func TestDetectFormatRejectsOtherFiles(t *testing.T) {
+	for _, content := range []string{"", "plain text, not an archive", "%PDF-1.7\n"} {
+		name := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DetectFormat(name); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%q: got %v, want ErrUnsupportedFormat", content, err)
+		}
+		if err := Walk(name, func(Entry) error { return nil }); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("walk %q: got %v, want ErrUnsupportedFormat", content, err)
+		}
+	}
+}
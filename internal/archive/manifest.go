@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidManifest reports a manifest that cannot be read
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// Names of the manifest at the root of an archive
+const (
+	ManifestCSV  = "manifest.csv"
+	ManifestJSON = "manifest.json"
+)
+
+// maxManifestSize bounds the manifest read in memory
+const maxManifestSize = 16 << 20
+
+// ManifestEntry describes a file of the archive. In CSV, the header names the columns: path is required, name,
+// tags (separated by commas) and content_type are optional. The other fields are written by the exports and
+// ignored by the imports, so that an export can be imported back.
+type ManifestEntry struct {
+	Path        string   `json:"path"`
+	Name        string   `json:"name"`         // Name of the document, the file name when empty
+	Tags        []string `json:"tags"`         // Tags of the document
+	ContentType string   `json:"content_type"` // Declared type, checked against the content
+
+	ID                uint       `json:"id,omitempty"`
+	Version           int        `json:"version,omitempty"`
+	PreviousVersionID uint       `json:"previous_version_id,omitempty"`
+	Size              int64      `json:"size,omitempty"`
+	SHA256            string     `json:"sha256,omitempty"`
+	SHA512            string     `json:"sha512,omitempty"`
+	CreatedAt         *time.Time `json:"created_at,omitempty"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+	Error             string     `json:"error,omitempty"` // Why the file is missing from the archive
+}
+
+// csvColumns are the columns of a CSV manifest, in the order they are written
+var csvColumns = []string{"path", "name", "tags", "content_type", "id", "version", "previous_version_id", "size",
+	"sha256", "sha512", "created_at", "updated_at", "error"}
+
+// Manifest holds the entries of a manifest by cleaned path
+type Manifest map[string]ManifestEntry
+
+// IsManifest tells whether an entry path is the manifest of the archive
+func IsManifest(entryPath string) bool {
+	return entryPath == ManifestCSV || entryPath == ManifestJSON
+}
+
+// ParseManifest reads the manifest of an archive, in CSV or JSON as its path says
+func ParseManifest(r io.Reader, entryPath string) (Manifest, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%w: larger than %d MiB", ErrInvalidManifest, maxManifestSize>>20)
+	}
+	var entries []ManifestEntry
+	if entryPath == ManifestJSON {
+		entries, err = parseJSON(bytes.NewReader(data))
+	} else {
+		entries, err = parseCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(Manifest, len(entries))
+	for i, entry := range entries {
+		cleaned, err := CleanPath(entry.Path)
+		if err != nil || cleaned == "" {
+			return nil, fmt.Errorf("%w: entry %d: invalid path '%s'", ErrInvalidManifest, i+1, entry.Path)
+		}
+		if _, exists := manifest[cleaned]; exists {
+			return nil, fmt.Errorf("%w: entry %d: duplicate path '%s'", ErrInvalidManifest, i+1, entry.Path)
+		}
+		entry.Path = cleaned
+		manifest[cleaned] = entry
+	}
+	return manifest, nil
+}
+
+func parseJSON(r io.Reader) ([]ManifestEntry, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var entries []ManifestEntry
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	return entries, nil
+}
+
+func parseCSV(r io.Reader) ([]ManifestEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header: %v", ErrInvalidManifest, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("%w: unknown column '%s'", ErrInvalidManifest, name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return nil, fmt.Errorf("%w: missing path column", ErrInvalidManifest)
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var entries []ManifestEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+		}
+		entry := ManifestEntry{
+			Path:        field(record, "path"),
+			Name:        field(record, "name"),
+			ContentType: field(record, "content_type"),
+		}
+		for _, tag := range strings.Split(field(record, "tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// WriteManifest writes the entries of an export as a manifest, in CSV or JSON as its path says
+func WriteManifest(w io.Writer, entryPath string, entries []ManifestEntry) error {
+	if entryPath == ManifestJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if entries == nil {
+			entries = []ManifestEntry{}
+		}
+		return encoder.Encode(entries)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	formatUint := func(n uint) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(n), 10)
+	}
+	for _, entry := range entries {
+		record := []string{
+			entry.Path, entry.Name, strings.Join(entry.Tags, ","), entry.ContentType,
+			formatUint(entry.ID), strconv.Itoa(entry.Version), formatUint(entry.PreviousVersionID),
+			strconv.FormatInt(entry.Size, 10), entry.SHA256, entry.SHA512,
+			formatTime(entry.CreatedAt), formatTime(entry.UpdatedAt), entry.Error,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
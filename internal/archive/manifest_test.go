@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		entryPath, content string
+	}{
+		{ManifestCSV, "\ufeffPath, Name, Tags, Content_Type\n" +
+			"./reports/budget.csv, Budget 2024, \"finance, 2024,,\", text/csv\n" +
+			"minutes.txt,,,\n" +
+			"\\archives\\letter.pdf,,legal,\n"},
+		{ManifestCSV, "tags,path\n\"finance,2024\",reports/budget.csv\n,minutes.txt\nlegal,/archives/letter.pdf\n"},
+		{ManifestJSON, `[
+			{"path": "reports//budget.csv", "tags": ["finance", "2024"]},
+			{"path": "minutes.txt"},
+			{"path": "archives/letter.pdf", "tags": ["legal"]}
+		]`},
+	}
+	for _, tt := range tests {
+		manifest, err := ParseManifest(strings.NewReader(tt.content), tt.entryPath)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.entryPath, err)
+		}
+		if len(manifest) != 3 {
+			t.Fatalf("%s: %d entries, want 3", tt.entryPath, len(manifest))
+		}
+		budget, ok := manifest["reports/budget.csv"]
+		if !ok || budget.Path != "reports/budget.csv" || !slices.Equal(budget.Tags, []string{"finance", "2024"}) {
+			t.Errorf("%s: budget %+v", tt.entryPath, budget)
+		}
+		if minutes := manifest["minutes.txt"]; minutes.Name != "" || len(minutes.Tags) != 0 || minutes.ContentType != "" {
+			t.Errorf("%s: minutes %+v", tt.entryPath, minutes)
+		}
+		if letter := manifest["archives/letter.pdf"]; !slices.Equal(letter.Tags, []string{"legal"}) {
+			t.Errorf("%s: letter %+v", tt.entryPath, letter)
+		}
+	}
+
+	manifest, err := ParseManifest(strings.NewReader(tests[0].content), ManifestCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget := manifest["reports/budget.csv"]; budget.Name != "Budget 2024" || budget.ContentType != "text/csv" {
+		t.Errorf("budget %+v", budget)
+	}
+}
+
+func TestParseManifestRejectsInvalidManifests(t *testing.T) {
+	tests := []struct {
+		name, entryPath, content, want string
+	}{
+		{"empty CSV", ManifestCSV, "", "missing header"},
+		{"unknown column", ManifestCSV, "path,owner\nminutes.txt,alice\n", "unknown column 'owner'"},
+		{"no path column", ManifestCSV, "name,tags\nMinutes,board\n", "missing path column"},
+		{"short record", ManifestCSV, "path,name\nminutes.txt\n", "wrong number of fields"},
+		{"empty path", ManifestCSV, "path,name\n,Minutes\n", "entry 1: invalid path ''"},
+		{"path leaving the archive", ManifestCSV, "path\nminutes.txt\n../etc/passwd\n", "entry 2: invalid path '../etc/passwd'"},
+		{"duplicate path", ManifestCSV, "path\nreports/budget.csv\n./reports/budget.csv\n", "entry 2: duplicate path './reports/budget.csv'"},
+		{"unknown JSON field", ManifestJSON, `[{"path": "minutes.txt", "owner": "alice"}]`, `unknown field "owner"`},
+		{"not a JSON list", ManifestJSON, `{"path": "minutes.txt"}`, "cannot unmarshal"},
+		{"too large", ManifestCSV, "path\n" + strings.Repeat("a", maxManifestSize), "larger than 16 MiB"},
+	}
+	for _, tt := range tests {
+		_, err := ParseManifest(strings.NewReader(tt.content), tt.entryPath)
+		if !errors.Is(err, ErrInvalidManifest) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want ErrInvalidManifest with %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestWriteManifestReadsBack(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	entries := []ManifestEntry{
+		{Path: "reports/budget.csv", Name: "Budget, 2024", Tags: []string{"finance", "2024"}, ContentType: "text/csv",
+			ID: 4, Version: 2, PreviousVersionID: 1, Size: 21, SHA256: "aa11", CreatedAt: &created},
+		{Path: "minutes.txt", Name: "minutes.txt", Error: "file missing from the storage"},
+	}
+	for _, entryPath := range []string{ManifestCSV, ManifestJSON} {
+		var out bytes.Buffer
+		if err := WriteManifest(&out, entryPath, entries); err != nil {
+			t.Fatal(err)
+		}
+		if entryPath == ManifestCSV && !strings.Contains(out.String(), "2024-03-01T09:00:00Z") {
+			t.Errorf("dates not written in UTC: %s", out.String())
+		}
+		// An export can be imported back, the fields written by the exports being ignored
+		manifest, err := ParseManifest(&out, entryPath)
+		if err != nil {
+			t.Fatalf("%s: %v", entryPath, err)
+		}
+		budget := manifest["reports/budget.csv"]
+		if budget.Name != "Budget, 2024" || !slices.Equal(budget.Tags, []string{"finance", "2024"}) || budget.ContentType != "text/csv" {
+			t.Errorf("%s: budget %+v", entryPath, budget)
+		}
+		if _, ok := manifest["minutes.txt"]; !ok {
+			t.Errorf("%s: minutes.txt not read back", entryPath)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WriteManifest(&out, ManifestJSON, nil); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Fatalf("empty JSON manifest %q, %v", out.String(), err)
+	}
+}
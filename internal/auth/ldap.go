@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// GroupRole maps an LDAP group (matched on its cn or full DN) to an archive role name
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// parseGroupRoles parses mappings like "archive-admins:admin"
+func parseGroupRoles(entries []string) ([]GroupRole, error) {
+	var mappings []GroupRole
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idx := strings.LastIndex(entry, ":")
+		if idx <= 0 || idx == len(entry)-1 {
+			return nil, fmt.Errorf("invalid group role mapping '%s', expected group:role", entry)
+		}
+		mappings = append(mappings, GroupRole{Group: entry[:idx], Role: entry[idx+1:]})
+	}
+	return mappings, nil
+}
+
+// Conn is the subset of *ldap.Conn used by the provider
+type Conn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPProvider authenticates users by binding as them against an LDAP directory
+type LDAPProvider struct {
+	cfg           config.LDAPConfig
+	groupRoles    []GroupRole
+	users         repository.UserRepository // holds the local copies of directory users
+	roles         repository.RoleRepository
+	organizations repository.OrganizationRepository
+	engine        *authz.Engine        // forgets the memberships of the users whose role changes
+	Dial          func() (Conn, error) // replaceable to point the provider at a test server
+}
+
+func NewLDAPProvider(cfg config.LDAPConfig, repos *repository.Repositories, engine *authz.Engine) (*LDAPProvider, error) {
+	groupRoles, err := parseGroupRoles(cfg.GroupRoles)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.GroupBaseDN == "" {
+		cfg.GroupBaseDN = cfg.BaseDN
+	}
+	p := &LDAPProvider{
+		cfg:           cfg,
+		groupRoles:    groupRoles,
+		users:         repos.Users,
+		roles:         repos.Roles,
+		organizations: repos.Organizations,
+		engine:        engine,
+	}
+	p.Dial = p.dial
+	return p, nil
+}
+
+func (p *LDAPProvider) Name() string {
+	return models.AuthSourceLDAP
+}
+
+func (p *LDAPProvider) dial() (Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(p.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// serviceConn opens a connection bound as the service account (or anonymously when no bind DN is set)
+func (p *LDAPProvider) serviceConn() (Conn, error) {
+	conn, err := p.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to bind LDAP service account: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUserDN returns the DN of the directory entry for the username, or "" when it does not exist
+func (p *LDAPProvider) findUserDN(conn Conn, username string) (string, error) {
+	req := ldap.NewSearchRequest(
+		p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn"}, nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to search LDAP user '%s': %w", username, err)
+	}
+	switch len(res.Entries) {
+	case 0:
+		return "", nil
+	case 1:
+		return res.Entries[0].DN, nil
+	default:
+		return "", fmt.Errorf("LDAP user filter matched several entries for '%s'", username)
+	}
+}
+
+// userGroups returns the cn and DN of every group the user belongs to
+func (p *LDAPProvider) userGroups(conn Conn, userDN string) ([]string, error) {
+	req := ldap.NewSearchRequest(
+		p.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(p.cfg.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{"cn"}, nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search LDAP groups: %w", err)
+	}
+
+	var groups []string
+	for _, entry := range res.Entries {
+		groups = append(groups, entry.DN)
+		if cn := entry.GetAttributeValue("cn"); cn != "" {
+			groups = append(groups, cn)
+		}
+	}
+	return groups, nil
+}
+
+// mapRole returns the archive role for the user's groups, or "" when none applies
+func (p *LDAPProvider) mapRole(groups []string) string {
+	for _, mapping := range p.groupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(mapping.Group, group) {
+				return mapping.Role
+			}
+		}
+	}
+	return p.cfg.DefaultRole
+}
+
+// lookup resolves the directory state of a user: its DN and mapped role
+func (p *LDAPProvider) lookup(conn Conn, username string) (userDN, roleName string, err error) {
+	userDN, err = p.findUserDN(conn, username)
+	if err != nil || userDN == "" {
+		return "", "", err
+	}
+	groups, err := p.userGroups(conn, userDN)
+	if err != nil {
+		return "", "", err
+	}
+	return userDN, p.mapRole(groups), nil
+}
+
+// Authenticate binds as the user, maps its groups to a role and provisions or updates the local user
+func (p *LDAPProvider) Authenticate(username, password string) (*models.User, error) {
+	// An empty password would turn the bind into an unauthenticated bind, which most servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.serviceConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	userDN, roleName, err := p.lookup(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if userDN == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind LDAP user: %w", err)
+	}
+
+	if roleName == "" {
+		slog.Info("LDAP user is not a member of any mapped group", "username", username)
+		return nil, ErrInvalidCredentials
+	}
+
+	return p.provisionUser(username, roleName)
+}
+
+// provisionUser creates or updates the local copy of a directory user
+func (p *LDAPProvider) provisionUser(username, roleName string) (*models.User, error) {
+	system := database.Unscoped(context.Background())
+	organization, err := p.organizations.GetBySlug(system, p.cfg.Organization)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP organization '%s' does not exist: %w", p.cfg.Organization, err)
+	}
+	ctx := database.WithOrganization(context.Background(), organization.ID)
+
+	role, err := p.roles.GetByName(ctx, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("mapped role '%s' does not exist: %w", roleName, err)
+	}
+
+	user, err := p.users.GetByUsername(system, username)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		user = &models.User{
+			Username:   username,
+			RoleID:     role.ID,
+			AuthSource: models.AuthSourceLDAP,
+		}
+		if err := p.users.Create(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to provision LDAP user: %w", err)
+		}
+		slog.Info("Provisioned LDAP user", "username", username, "user_id", user.ID, "role", roleName)
+	case err != nil:
+		return nil, err
+	case user.AuthSource != models.AuthSourceLDAP || user.OrganizationID != organization.ID:
+		// Never let the directory take over a local account with the same name
+		return nil, ErrInvalidCredentials
+	default:
+		// Keep the role in line with the directory; disabled accounts stay disabled
+		if user.RoleID != role.ID {
+			if err := p.users.Update(ctx, user, map[string]interface{}{"role_id": role.ID}); err != nil {
+				return nil, fmt.Errorf("failed to update LDAP user: %w", err)
+			}
+			p.engine.InvalidateUser(user.ID)
+		}
+		user.RoleID = role.ID
+	}
+
+	user.Role = *role
+	return user, nil
+}
+
+// Sync disables local LDAP users that were removed from the directory or from every mapped group,
+// and refreshes the role of the others
+func (p *LDAPProvider) Sync() error {
+	users, err := p.users.ListByAuthSource(database.Unscoped(context.Background()), models.AuthSourceLDAP)
+	if err != nil {
+		return fmt.Errorf("failed to list LDAP users: %w", err)
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	conn, err := p.serviceConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for i := range users {
+		user := &users[i]
+		userDN, roleName, err := p.lookup(conn, user.Username)
+		if err != nil {
+			// A lookup error must not disable accounts, skip until the next run
+			slog.Warn("LDAP sync: failed to look up user", "username", user.Username, "error", err)
+			continue
+		}
+
+		ctx := database.WithOrganization(context.Background(), user.OrganizationID)
+		updates := map[string]interface{}{}
+		if userDN == "" || roleName == "" {
+			if !user.Disabled {
+				updates["disabled"] = true
+				slog.Info("LDAP sync: disabling user removed from the directory", "username", user.Username, "user_id", user.ID)
+			}
+		} else {
+			role, err := p.roles.GetByName(ctx, roleName)
+			if err != nil {
+				slog.Warn("LDAP sync: mapped role does not exist", "role", roleName, "organization_id", user.OrganizationID)
+				continue
+			}
+			if role.ID != user.RoleID {
+				updates["role_id"] = role.ID
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := p.users.Update(ctx, user, updates); err != nil {
+				slog.Error("LDAP sync: failed to update user", "username", user.Username, "error", err)
+			}
+			p.engine.InvalidateUser(user.ID)
+		}
+	}
+
+	return nil
+}
+
+// RunSync runs Sync every SyncInterval until the context is cancelled
+func (p *LDAPProvider) RunSync(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Sync(); err != nil {
+				slog.ErrorContext(ctx, "LDAP sync failed", "error", err)
+			}
+		}
+	}
+}
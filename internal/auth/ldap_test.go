@@ -0,0 +1,465 @@
+package auth
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// directory is an in-process LDAP server answering the simple binds and the searches of the provider.
+// Clients reach it through the Dial hook of the provider, over an in-memory connection.
+type directory struct {
+	mu      sync.Mutex
+	entries map[string]map[string][]string // attributes by lower-cased DN
+	binds   []string                       // DNs of the successful binds
+	down    bool                           // refuse connections
+}
+
+func newDirectory() *directory {
+	d := &directory{entries: map[string]map[string][]string{}}
+	d.add("cn=reader,dc=example,dc=org", map[string][]string{"userPassword": {"service-secret"}})
+	d.add("ou=people,dc=example,dc=org", map[string][]string{"objectClass": {"organizationalUnit"}})
+	d.add("ou=groups,dc=example,dc=org", map[string][]string{"objectClass": {"organizationalUnit"}})
+	return d
+}
+
+func (d *directory) add(dn string, attributes map[string][]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[strings.ToLower(dn)] = attributes
+	attributes["dn"] = []string{dn}
+}
+
+func (d *directory) remove(dn string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, strings.ToLower(dn))
+}
+
+// addPerson creates a person under ou=people and returns its DN
+func (d *directory) addPerson(uid, password string) string {
+	dn := "uid=" + uid + ",ou=people,dc=example,dc=org"
+	d.add(dn, map[string][]string{"objectClass": {"person"}, "uid": {uid}, "userPassword": {password}})
+	return dn
+}
+
+// setGroup creates or replaces a group under ou=groups with its members
+func (d *directory) setGroup(cn string, memberDNs ...string) {
+	d.add("cn="+cn+",ou=groups,dc=example,dc=org", map[string][]string{
+		"objectClass": {"groupOfNames"}, "cn": {cn}, "member": memberDNs,
+	})
+}
+
+// boundDNs returns the DNs of the successful binds so far
+func (d *directory) boundDNs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.binds...)
+}
+
+func (d *directory) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = down
+}
+
+// dial is the Dial hook of the provider
+func (d *directory) dial() (Conn, error) {
+	d.mu.Lock()
+	down := d.down
+	d.mu.Unlock()
+	if down {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	go d.serve(server)
+	conn := ldap.NewConn(client, false)
+	conn.Start()
+	return conn, nil
+}
+
+// serve answers the requests of a connection until it is closed or unbound
+func (d *directory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := string(request.Children[1].ByteValue)
+			password := request.Children[2].Data.String()
+			code := d.bind(dn, password)
+			if err := d.respond(conn, messageID, ldap.ApplicationBindResponse, code); err != nil {
+				return
+			}
+		case ldap.ApplicationSearchRequest:
+			if err := d.search(conn, messageID, request); err != nil {
+				return
+			}
+		default:
+			// Unbind, or an operation the provider does not use
+			return
+		}
+	}
+}
+
+func (d *directory) bind(dn, password string) uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[strings.ToLower(dn)]
+	if !ok || password == "" || len(entry["userPassword"]) == 0 || entry["userPassword"][0] != password {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	d.binds = append(d.binds, dn)
+	return ldap.LDAPResultSuccess
+}
+
+func (d *directory) search(conn net.Conn, messageID int64, request *ber.Packet) error {
+	base := strings.ToLower(string(request.Children[0].ByteValue))
+	filter := request.Children[6]
+
+	d.mu.Lock()
+	if _, ok := d.entries[base]; !ok {
+		d.mu.Unlock()
+		return d.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject)
+	}
+	var matches []map[string][]string
+	for dn, entry := range d.entries {
+		if strings.HasSuffix(dn, ","+base) && matchFilter(filter, entry) {
+			matches = append(matches, entry)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, entry := range matches {
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry["dn"][0], "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range entry {
+			if name == "dn" || name == "userPassword" {
+				continue
+			}
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		result.AppendChild(attributes)
+		if err := d.send(conn, messageID, result); err != nil {
+			return err
+		}
+	}
+	return d.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+}
+
+// matchFilter evaluates the and, equality and presence filters the provider sends, ignoring case
+func matchFilter(filter *ber.Packet, entry map[string][]string) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterEqualityMatch:
+		name := string(filter.Children[0].ByteValue)
+		value := string(filter.Children[1].ByteValue)
+		for attribute, values := range entry {
+			if !strings.EqualFold(attribute, name) {
+				continue
+			}
+			for _, v := range values {
+				if strings.EqualFold(v, value) {
+					return true
+				}
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		for attribute := range entry {
+			if strings.EqualFold(attribute, filter.Data.String()) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func (d *directory) respond(conn net.Conn, messageID int64, tag ber.Tag, code uint16) error {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ldap.LDAPResultCodeMap[code], "Diagnostic Message"))
+	return d.send(conn, messageID, result)
+}
+
+func (d *directory) send(conn net.Conn, messageID int64, operation *ber.Packet) error {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	envelope.AppendChild(operation)
+	_, err := conn.Write(envelope.Bytes())
+	return err
+}
+
+// ldapFixture is a provider on the in-memory repositories, pointed at a directory holding alice,
+// an archivist, and bob, a member of the staff group
+type ldapFixture struct {
+	directory *directory
+	provider  *LDAPProvider
+	repos     *repository.Repositories
+	engine    *authz.Engine
+	aliceDN   string
+	bobDN     string
+}
+
+func newLDAPFixture(t *testing.T) *ldapFixture {
+	t.Helper()
+	f := &ldapFixture{directory: newDirectory(), repos: repository.NewMemory()}
+	f.aliceDN = f.directory.addPerson("alice", "alice-secret")
+	f.bobDN = f.directory.addPerson("bob", "bob-secret")
+	f.directory.addPerson("carol", "carol-secret")
+	f.directory.setGroup("archivists", f.aliceDN)
+	f.directory.setGroup("staff", f.bobDN)
+
+	cfg := config.Default().LDAP
+	cfg.URL = "ldap://directory.test"
+	cfg.BindDN = "cn=reader,dc=example,dc=org"
+	cfg.BindPassword = "service-secret"
+	cfg.BaseDN = "ou=people,dc=example,dc=org"
+	cfg.GroupBaseDN = "ou=groups,dc=example,dc=org"
+	// The staff group is matched on its DN, the archivists on their cn
+	cfg.GroupRoles = []string{"archivists:admin", "cn=staff,ou=groups,dc=example,dc=org:user"}
+	cfg.Organization = database.DefaultOrganizationSlug
+
+	f.engine = authz.NewEngine(config.AuthzConfig{CacheTTL: time.Minute}, f.repos)
+	provider, err := NewLDAPProvider(cfg, f.repos, f.engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.Dial = f.directory.dial
+	f.provider = provider
+	return f
+}
+
+func (f *ldapFixture) user(t *testing.T, username string) *models.User {
+	t.Helper()
+	user, err := f.repos.Users.GetByUsername(database.Unscoped(context.Background()), username)
+	if err != nil {
+		t.Fatalf("user %s: %v", username, err)
+	}
+	return user
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	f := newLDAPFixture(t)
+
+	user, err := f.provider.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.Role.Name != "admin" || user.AuthSource != models.AuthSourceLDAP {
+		t.Fatalf("alice authenticated as %+v, want a provisioned LDAP admin", user)
+	}
+	// The searches run as the service account, then the provider binds as the user
+	binds := f.directory.boundDNs()
+	if len(binds) != 2 || binds[0] != "cn=reader,dc=example,dc=org" || binds[1] != f.aliceDN {
+		t.Fatalf("binds %v, want the service account then alice", binds)
+	}
+	stored := f.user(t, "alice")
+	if stored.ID != user.ID || stored.Role.Name != "admin" {
+		t.Fatalf("stored alice %+v", stored)
+	}
+
+	// The group matched on its DN
+	user, err = f.provider.Authenticate("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role.Name != "user" {
+		t.Fatalf("bob has role %q, want user", user.Role.Name)
+	}
+
+	for _, attempt := range []struct{ username, password, why string }{
+		{"alice", "wrong", "wrong password"},
+		{"nobody", "secret", "unknown user"},
+		{"carol", "carol-secret", "member of no mapped group and no default role"},
+		{"al*", "alice-secret", "filter metacharacters in the username"},
+	} {
+		if _, err := f.provider.Authenticate(attempt.username, attempt.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: got %v, want ErrInvalidCredentials", attempt.why, err)
+		}
+	}
+
+	// An empty password would be an unauthenticated bind: it is refused before reaching the directory
+	before := len(f.directory.boundDNs())
+	if _, err := f.provider.Authenticate("alice", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("empty password: got %v, want ErrInvalidCredentials", err)
+	}
+	if len(f.directory.boundDNs()) != before {
+		t.Fatal("empty password reached the directory")
+	}
+}
+
+func TestLDAPDefaultRoleAndServiceAccount(t *testing.T) {
+	f := newLDAPFixture(t)
+	f.provider.cfg.DefaultRole = "user"
+	user, err := f.provider.Authenticate("carol", "carol-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role.Name != "user" {
+		t.Fatalf("carol has role %q, want the default role", user.Role.Name)
+	}
+
+	// A misconfigured service account is an error of the directory, not of the user's credentials
+	f.provider.cfg.BindPassword = "wrong"
+	if _, err := f.provider.Authenticate("alice", "alice-secret"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong service password: got %v, want a bind error", err)
+	}
+	f.directory.setDown(true)
+	if _, err := f.provider.Authenticate("alice", "alice-secret"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("directory down: got %v, want a connection error", err)
+	}
+}
+
+func TestLDAPKeepsLocalAccounts(t *testing.T) {
+	f := newLDAPFixture(t)
+	organization, err := f.repos.Organizations.GetBySlug(database.Unscoped(context.Background()), database.DefaultOrganizationSlug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := database.WithOrganization(context.Background(), organization.ID)
+	role, err := f.repos.Roles.GetByName(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := &models.User{Username: "alice", Password: "x", RoleID: role.ID, AuthSource: models.AuthSourceLocal}
+	if err := f.repos.Users.Create(ctx, local); err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory entry of the same name must not take over the local account
+	if _, err := f.provider.Authenticate("alice", "alice-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if user := f.user(t, "alice"); user.AuthSource != models.AuthSourceLocal || user.RoleID != role.ID {
+		t.Fatalf("local account changed to %+v", user)
+	}
+}
+
+func TestLDAPRoleFollowsGroupsAtLogin(t *testing.T) {
+	f := newLDAPFixture(t)
+	user, err := f.provider.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := database.WithOrganization(context.Background(), user.OrganizationID)
+	if allowed, err := f.engine.HasPermission(ctx, user.ID, "manage_users"); err != nil || !allowed {
+		t.Fatalf("archivist cannot manage users: %v, %v", allowed, err)
+	}
+
+	f.directory.setGroup("archivists")
+	f.directory.setGroup("staff", f.bobDN, f.aliceDN)
+	user, err = f.provider.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role.Name != "user" || f.user(t, "alice").Role.Name != "user" {
+		t.Fatalf("alice kept role %q after leaving the archivists", user.Role.Name)
+	}
+	// The cached permissions of the previous role are dropped
+	if allowed, err := f.engine.HasPermission(ctx, user.ID, "manage_users"); err != nil || allowed {
+		t.Fatalf("former archivist can still manage users: %v, %v", allowed, err)
+	}
+}
+
+func TestLDAPSync(t *testing.T) {
+	f := newLDAPFixture(t)
+	for _, login := range [][2]string{{"alice", "alice-secret"}, {"bob", "bob-secret"}, {"carol", "carol-secret"}} {
+		f.provider.cfg.DefaultRole = "user"
+		if _, err := f.provider.Authenticate(login[0], login[1]); err != nil {
+			t.Fatalf("%s: %v", login[0], err)
+		}
+	}
+	f.provider.cfg.DefaultRole = ""
+
+	// A failed connection leaves every account alone
+	f.directory.setDown(true)
+	if err := f.provider.Sync(); err == nil {
+		t.Fatal("sync succeeded with the directory down")
+	}
+	f.directory.setDown(false)
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if f.user(t, username).Disabled {
+			t.Fatalf("%s disabled by a failed sync", username)
+		}
+	}
+
+	// Bob leaves the directory, alice moves to the staff, carol is in no group without a default role
+	f.directory.remove(f.bobDN)
+	f.directory.setGroup("staff", f.aliceDN)
+	f.directory.setGroup("archivists")
+	if err := f.provider.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := f.user(t, "alice")
+	if alice.Disabled || alice.Role.Name != "user" {
+		t.Fatalf("alice after sync %+v, want an enabled user", alice)
+	}
+	if bob := f.user(t, "bob"); !bob.Disabled {
+		t.Fatal("bob was removed from the directory but is still enabled")
+	}
+	if carol := f.user(t, "carol"); !carol.Disabled {
+		t.Fatal("carol belongs to no mapped group but is still enabled")
+	}
+
+	// Disabled accounts stay disabled when they come back, until an administrator enables them
+	f.directory.addPerson("bob", "bob-secret")
+	f.directory.setGroup("staff", f.aliceDN, f.bobDN)
+	if err := f.provider.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if bob := f.user(t, "bob"); !bob.Disabled {
+		t.Fatal("sync enabled bob again")
+	}
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	mappings, err := parseGroupRoles([]string{" archivists:admin ", "", "cn=staff,ou=groups,dc=example,dc=org:user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 2 || mappings[0] != (GroupRole{"archivists", "admin"}) ||
+		mappings[1] != (GroupRole{"cn=staff,ou=groups,dc=example,dc=org", "user"}) {
+		t.Fatalf("mappings %+v", mappings)
+	}
+	for _, invalid := range []string{"archivists", ":admin", "archivists:"} {
+		if _, err := parseGroupRoles([]string{invalid}); err == nil {
+			t.Errorf("mapping %q accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LocalProvider checks passwords against the bcrypt hashes stored in the users table
+type LocalProvider struct {
+	users repository.UserRepository
+}
+
+func NewLocalProvider(users repository.UserRepository) *LocalProvider {
+	return &LocalProvider{users: users}
+}
+
+func (LocalProvider) Name() string {
+	return models.AuthSourceLocal
+}
+
+func (p *LocalProvider) Authenticate(username, password string) (*models.User, error) {
+	user, err := p.users.GetByUsername(database.Unscoped(context.Background()), username)
+	if err != nil || user.AuthSource != models.AuthSourceLocal {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
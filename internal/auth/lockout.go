@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/models"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LockedError is returned while an account or a client address is locked after too many failed logins
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after %s", e.Until.Format(time.RFC3339))
+}
+
+// lockDuration returns how long to lock after the given number of consecutive failures:
+// nothing below the threshold, then LockoutBase doubled for every failure past it, capped at LockoutMax.
+func lockDuration(cfg config.LoginConfig, failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	delay := cfg.LockoutBase
+	for i := threshold; i < failures && delay < cfg.LockoutMax; i++ {
+		delay *= 2
+	}
+	if delay > cfg.LockoutMax {
+		delay = cfg.LockoutMax
+	}
+	return delay
+}
+
+// addressAttempts tracks the failed logins of one client address
+type addressAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// addressLimiter counts failed logins per client address in memory
+type addressLimiter struct {
+	cfg      config.LoginConfig
+	mu       sync.Mutex
+	attempts map[string]*addressAttempts
+}
+
+func newAddressLimiter(cfg config.LoginConfig) *addressLimiter {
+	return &addressLimiter{cfg: cfg, attempts: map[string]*addressAttempts{}}
+}
+
+// locked returns the end of the lock of an address, if any
+func (l *addressLimiter) locked(address string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if a, ok := l.attempts[address]; ok && now.Before(a.lockedUntil) {
+		return a.lockedUntil, true
+	}
+	return time.Time{}, false
+}
+
+func (l *addressLimiter) fail(address string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget stale entries so the map does not grow without bound
+	for key, a := range l.attempts {
+		if now.Sub(a.lastFailure) > l.cfg.FailureWindow && now.After(a.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+
+	a, ok := l.attempts[address]
+	if !ok {
+		a = &addressAttempts{}
+		l.attempts[address] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	if delay := lockDuration(l.cfg, a.failures, l.cfg.IPMaxAttempts); delay > 0 {
+		a.lockedUntil = now.Add(delay)
+	}
+}
+
+// recordFailure counts a failed login on an account and locks it once the threshold is reached
+func (a *Authenticator) recordFailure(ctx context.Context, user *models.User, now time.Time) error {
+	failures, err := a.users.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if delay := lockDuration(a.lockout, failures, a.lockout.MaxAttempts); delay > 0 {
+		lockedUntil := now.Add(delay)
+		return a.users.Update(ctx, user, map[string]interface{}{"locked_until": &lockedUntil})
+	}
+	return nil
+}
+
+// recordSuccess resets the failure counter of an account
+func (a *Authenticator) recordSuccess(ctx context.Context, user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return a.users.Update(ctx, user, map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	})
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"archiv-system/internal/config"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockDuration(t *testing.T) {
+	cfg := config.LoginConfig{LockoutBase: time.Minute, LockoutMax: 10 * time.Minute}
+	tests := map[int]time.Duration{
+		0:   0,
+		4:   0,
+		5:   time.Minute,
+		6:   2 * time.Minute,
+		7:   4 * time.Minute,
+		8:   8 * time.Minute,
+		9:   10 * time.Minute,
+		10:  10 * time.Minute,
+		500: 10 * time.Minute,
+	}
+	for failures, want := range tests {
+		if got := lockDuration(cfg, failures, 5); got != want {
+			t.Errorf("%d failures: locked %s, want %s", failures, got, want)
+		}
+	}
+
+	// A base above the cap is capped from the first lock
+	cfg.LockoutBase = time.Hour
+	if got := lockDuration(cfg, 5, 5); got != cfg.LockoutMax {
+		t.Errorf("base above the cap: locked %s", got)
+	}
+}
+
+func TestAddressLimiter(t *testing.T) {
+	cfg := config.LoginConfig{IPMaxAttempts: 3, LockoutBase: time.Minute, LockoutMax: time.Hour, FailureWindow: 15 * time.Minute}
+	limiter := newAddressLimiter(cfg)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	limiter.fail("192.0.2.1", now)
+	limiter.fail("192.0.2.1", now.Add(time.Second))
+	if _, locked := limiter.locked("192.0.2.1", now.Add(time.Second)); locked {
+		t.Fatal("address locked below the threshold")
+	}
+	limiter.fail("192.0.2.1", now.Add(2*time.Second))
+	until, locked := limiter.locked("192.0.2.1", now.Add(2*time.Second))
+	if !locked || !until.Equal(now.Add(2*time.Second+time.Minute)) {
+		t.Fatalf("locked %v until %s after 3 failures", locked, until)
+	}
+	if _, locked := limiter.locked("192.0.2.2", now.Add(2*time.Second)); locked {
+		t.Fatal("other address locked")
+	}
+	// Failures during the lock double it
+	limiter.fail("192.0.2.1", now.Add(3*time.Second))
+	if until, _ := limiter.locked("192.0.2.1", now.Add(3*time.Second)); !until.Equal(now.Add(3*time.Second + 2*time.Minute)) {
+		t.Fatalf("locked until %s after 4 failures", until)
+	}
+	if _, locked := limiter.locked("192.0.2.1", now.Add(3*time.Second+2*time.Minute)); locked {
+		t.Fatal("address still locked at the end of its lock")
+	}
+}
+
+func TestAddressLimiterPrunesStaleAddresses(t *testing.T) {
+	cfg := config.LoginConfig{IPMaxAttempts: 2, LockoutBase: time.Hour, LockoutMax: time.Hour, FailureWindow: 15 * time.Minute}
+	limiter := newAddressLimiter(cfg)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	limiter.fail("192.0.2.1", now) // stale once the window has passed
+	limiter.fail("192.0.2.2", now) // locked for an hour
+	limiter.fail("192.0.2.2", now)
+	limiter.fail("192.0.2.3", now.Add(10*time.Minute)) // within the window
+	if len(limiter.attempts) != 3 {
+		t.Fatalf("%d addresses tracked, want 3", len(limiter.attempts))
+	}
+
+	// A failure past the window of the first address forgets it, a locked address is kept until its lock ends
+	limiter.fail("198.51.100.1", now.Add(16*time.Minute))
+	for address, kept := range map[string]bool{"192.0.2.1": false, "192.0.2.2": true, "192.0.2.3": true, "198.51.100.1": true} {
+		if _, ok := limiter.attempts[address]; ok != kept {
+			t.Errorf("%s tracked %v, want %v", address, ok, kept)
+		}
+	}
+	limiter.fail("198.51.100.1", now.Add(2*time.Hour))
+	if len(limiter.attempts) != 1 {
+		t.Errorf("%d addresses tracked after every lock and window ended, want 1", len(limiter.attempts))
+	}
+
+	// The failures of a forgotten address start over
+	limiter.fail("192.0.2.1", now.Add(2*time.Hour))
+	if _, locked := limiter.locked("192.0.2.1", now.Add(2*time.Hour)); locked {
+		t.Error("forgotten address locked on its first new failure")
+	}
+}
+
+func TestLockedError(t *testing.T) {
+	var err error = &LockedError{Until: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	var locked *LockedError
+	if !errors.As(err, &locked) || err.Error() != "too many failed logins, retry after 2024-03-01T10:00:00Z" {
+		t.Fatalf("error %q", err)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"archiv-system/internal/config"
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrWeakPassword is wrapped by every password policy violation
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// bcryptMaxLength is the number of bytes bcrypt actually hashes, longer passwords are silently truncated
+const bcryptMaxLength = 72
+
+//go:embed breached.txt
+var builtinBreached string
+
+// PasswordPolicy holds the rules new passwords must follow
+type PasswordPolicy struct {
+	MinLength int                 // minimum number of characters
+	History   int                 // number of previous passwords that cannot be reused
+	breached  map[string]struct{} // known breached passwords, lower-cased
+}
+
+// NewPasswordPolicy builds the password policy of the configuration, reading its list of breached passwords
+func NewPasswordPolicy(cfg config.PasswordConfig) (PasswordPolicy, error) {
+	policy := PasswordPolicy{MinLength: cfg.MinLength, History: cfg.History, breached: parseBreached(builtinBreached)}
+	if cfg.BreachedFile == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(cfg.BreachedFile)
+	if err != nil {
+		return policy, fmt.Errorf("password.breached_file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			policy.breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return policy, fmt.Errorf("password.breached_file: %w", err)
+	}
+	return policy, nil
+}
+
+// Validate checks a new password against the length rules and the breached password list
+func (p PasswordPolicy) Validate(username, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters are required", ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > bcryptMaxLength {
+		return fmt.Errorf("%w: at most %d bytes are allowed", ErrWeakPassword, bcryptMaxLength)
+	}
+	lowered := strings.ToLower(password)
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return fmt.Errorf("%w: the password cannot contain the username", ErrWeakPassword)
+	}
+	if _, found := p.breached[lowered]; found {
+		return fmt.Errorf("%w: this password appears in a list of breached passwords", ErrWeakPassword)
+	}
+	return nil
+}
+
+func parseBreached(list string) map[string]struct{} {
+	breached := map[string]struct{}{}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return breached
+}
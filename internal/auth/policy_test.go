@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"archiv-system/internal/config"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy, err := NewPasswordPolicy(config.PasswordConfig{MinLength: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, username, password, want string
+	}{
+		{"long enough", "alice", "correct horse battery", ""},
+		{"too short", "alice", "short pass", "at least 12 characters"},
+		{"length in characters, not bytes", "alice", "éééééééééééé", ""},
+		{"eleven characters of two bytes", "alice", "ééééééééééé", "at least 12 characters"},
+		{"72 bytes", "alice", strings.Repeat("a", 72), ""},
+		{"73 bytes", "alice", strings.Repeat("a", 73), "at most 72 bytes"},
+		{"72 bytes in 36 characters", "alice", strings.Repeat("é", 36), ""},
+		{"73 bytes in 37 characters", "alice", strings.Repeat("é", 36) + "a", "at most 72 bytes"},
+		{"username", "alice", "my name is alice!", "cannot contain the username"},
+		{"username in another case", "Alice", "my name is ALICE!", "cannot contain the username"},
+		{"no username", "", "correct horse battery", ""},
+		{"breached", "alice", "administrator", "list of breached passwords"},
+		{"breached in another case", "alice", "AdMiNiStRaToR", "list of breached passwords"},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(tt.username, tt.password)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrWeakPassword) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want ErrWeakPassword with %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyBreachedFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(file, []byte("  Archives-Paris-2024 \n\nkept secret forever\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPasswordPolicy(config.PasswordConfig{MinLength: 8, BreachedFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file adds to the built-in list
+	for _, password := range []string{"archives-paris-2024", "Kept Secret Forever", "password"} {
+		if err := policy.Validate("alice", password); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("%s: got %v, want ErrWeakPassword", password, err)
+		}
+	}
+	if err := policy.Validate("alice", "archives-lyon-2024"); err != nil {
+		t.Errorf("password out of the lists refused: %v", err)
+	}
+
+	if _, err := NewPasswordPolicy(config.PasswordConfig{MinLength: 8, BreachedFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil ||
+		!strings.HasPrefix(err.Error(), "password.breached_file") {
+		t.Fatalf("missing list: got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserDisabled       = errors.New("user account is disabled")
+)
+
+// Provider authenticates a username/password pair and returns the matching local user
+type Provider interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// Authenticator checks logins with the authentication providers, the password policy and the login lockout
+type Authenticator struct {
+	users     repository.UserRepository // stores the accounts checked by Authenticate
+	local     *LocalProvider
+	ldap      *LDAPProvider // nil when LDAP is not enabled
+	policy    PasswordPolicy
+	lockout   config.LoginConfig
+	addresses *addressLimiter
+}
+
+// NewAuthenticator configures the authentication providers (local and LDAP), the password policy and the
+// login lockout
+func NewAuthenticator(repos *repository.Repositories, engine *authz.Engine, cfg *config.Config) (*Authenticator, error) {
+	a := &Authenticator{
+		users:     repos.Users,
+		local:     NewLocalProvider(repos.Users),
+		lockout:   cfg.Login,
+		addresses: newAddressLimiter(cfg.Login),
+	}
+	if cfg.LDAP.Enabled() {
+		provider, err := NewLDAPProvider(cfg.LDAP, repos, engine)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LDAP configuration: %w", err)
+		}
+		a.ldap = provider
+	}
+
+	policy, err := NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password policy: %w", err)
+	}
+	a.policy = policy
+	return a, nil
+}
+
+// LDAP returns the LDAP provider, or nil when LDAP authentication is disabled
+func (a *Authenticator) LDAP() *LDAPProvider {
+	return a.ldap
+}
+
+// Policy returns the password policy in use
+func (a *Authenticator) Policy() PasswordPolicy {
+	return a.policy
+}
+
+// Authenticate picks the provider matching the user's auth source and verifies the credentials.
+// Unknown users are tried against LDAP (when enabled) so that directory users are provisioned on first login.
+// Failed attempts are counted per account and per client address, which are locked with an exponential
+// backoff once too many failures happened. A locked address gets a *LockedError; a locked account answers
+// ErrInvalidCredentials like an unknown one, so that locks do not tell which usernames exist.
+func (a *Authenticator) Authenticate(username, password, address string) (*models.User, error) {
+	now := time.Now()
+	if until, locked := a.addresses.locked(address, now); locked {
+		return nil, &LockedError{Until: until}
+	}
+
+	ctx := database.Unscoped(context.Background())
+	user, err := a.users.GetByUsername(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	found := err == nil
+	accountLocked := found && user.LockedUntil != nil && now.Before(*user.LockedUntil)
+
+	var provider Provider
+	switch {
+	case accountLocked:
+	case found && user.AuthSource == models.AuthSourceLDAP:
+		if a.ldap != nil {
+			provider = a.ldap
+		}
+	case found:
+		provider = a.local
+	case a.ldap != nil:
+		provider = a.ldap
+	}
+
+	var authenticated *models.User
+	if provider == nil {
+		// Take as long as a password check, unknown and locked accounts must not answer faster
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		err = ErrInvalidCredentials
+	} else {
+		authenticated, err = provider.Authenticate(username, password)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.addresses.fail(address, now)
+			if found && !accountLocked {
+				if err := a.recordFailure(ctx, user, now); err != nil {
+					slog.Error("Failed to record login failure", "username", username, "error", err)
+				}
+			}
+		}
+		return nil, err
+	}
+	if authenticated.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if found {
+		if err := a.recordSuccess(ctx, user); err != nil {
+			slog.Error("Failed to reset login failures", "username", username, "error", err)
+		}
+	}
+	return authenticated, nil
+}
+
+// dummyHash is compared with the password of the logins no account can match
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("archiv-system"), bcrypt.DefaultCost)
+	return hash
+})
@@ -0,0 +1,244 @@
+package authz
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrResourceNotFound is returned when the checked document or folder does not exist in the organization
+var ErrResourceNotFound = errors.New("resource not found")
+
+// Resource types that can be checked
+const (
+	ResourceDocument = "document"
+	ResourceFolder   = "folder"
+)
+
+// Resource identifies the object a permission is checked on
+type Resource struct {
+	Type string `json:"type"`
+	ID   uint   `json:"id"`
+}
+
+func Document(id uint) *Resource { return &Resource{Type: ResourceDocument, ID: id} }
+
+func Folder(id uint) *Resource { return &Resource{Type: ResourceFolder, ID: id} }
+
+// Step is one rule evaluated while making a decision
+type Step struct {
+	Rule   string `json:"rule"` // role, owner, grant, folder_grant or policy
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Decision is the outcome of a permission check, with the rules that led to it
+type Decision struct {
+	UserID     uint      `json:"user_id"`
+	Permission string    `json:"permission"`
+	Resource   *Resource `json:"resource,omitempty"`
+	Allowed    bool      `json:"allowed"`
+	Steps      []Step    `json:"steps"`
+}
+
+func (d *Decision) step(rule string, passed bool, format string, args ...interface{}) bool {
+	d.Steps = append(d.Steps, Step{Rule: rule, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	return passed
+}
+
+// Explain evaluates a permission for a user, optionally on a resource, and records every rule evaluated.
+// The user needs the permission through one of their roles; on a resource they must also own it, or have
+// been granted the permission on it or on one of its parent folders, directly or through a group. The
+// policies of the organization applying to the permission come last, see explainPolicies.
+// ctx must be restricted to the organization of the request.
+func (e *Engine) Explain(ctx context.Context, userID uint, permission string, resource *Resource) (*Decision, error) {
+	decision, err := e.decide(ctx, userID, permission, resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.explainPolicies(ctx, decision); err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// explainPolicies adds the outcome of the policies to a decision. They are evaluated as AuthMiddleware does on
+// a route targeting the resource, at the time of the explanation: the conditions on the request see no method,
+// path nor address. A policy can deny what the rules allow; what it allows still needs the rules, checked by
+// the services.
+func (e *Engine) explainPolicies(ctx context.Context, decision *Decision) error {
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return database.ErrMissingTenant
+	}
+	applies, err := e.HasPolicies(ctx, organizationID, decision.Permission)
+	if err != nil || !applies {
+		return err
+	}
+	var documentID *uint
+	if decision.Resource != nil && decision.Resource.Type == ResourceDocument {
+		documentID = &decision.Resource.ID
+	}
+	input, err := e.BuildPolicyInput(ctx, decision.UserID, decision.Permission, documentID, NewPolicyRequest("", "", "", time.Now()))
+	if err != nil {
+		return err
+	}
+	matches, _, err := e.matchPolicies(ctx, organizationID, input)
+	if err != nil {
+		return err
+	}
+
+	roleAllowed := len(decision.Steps) > 0 && decision.Steps[0].Passed
+	allowed, reason, policy := combinePolicies(matches, decision.Permission, roleAllowed, false)
+	switch {
+	case !allowed:
+		decision.step("policy", false, "%s", reason)
+	case policy != nil:
+		decision.step("policy", true, "allowed by policy %s", policy.Name)
+	default:
+		decision.step("policy", true, "no policy denies %s", decision.Permission)
+	}
+	decision.Allowed = decision.Allowed && allowed
+	return nil
+}
+
+// decide evaluates the role, ownership and grant rules of a permission
+func (e *Engine) decide(ctx context.Context, userID uint, permission string, resource *Resource) (*Decision, error) {
+	decision := &Decision{UserID: userID, Permission: permission, Resource: resource}
+
+	granting, roles, err := e.rolesGranting(ctx, userID, permission)
+	if err != nil {
+		return nil, err
+	}
+	if len(granting) > 0 {
+		decision.step("role", true, "granted by role %s", strings.Join(granting, ", "))
+	} else {
+		decision.step("role", false, "none of the roles [%s] grant %s", strings.Join(roles, ", "), permission)
+		return decision, nil
+	}
+	if resource == nil {
+		decision.Allowed = true
+		return decision, nil
+	}
+
+	groupIDs, err := e.GroupIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ownerID uint
+	var folderID *uint
+	switch resource.Type {
+	case ResourceDocument:
+		document, err := e.repos.Documents.Get(ctx, resource.ID)
+		if err != nil {
+			return nil, notFound(err)
+		}
+		ownerID, folderID = document.OwnerID, document.FolderID
+	case ResourceFolder:
+		folder, err := e.repos.Folders.Get(ctx, resource.ID)
+		if err != nil {
+			return nil, notFound(err)
+		}
+		ownerID, folderID = folder.OwnerID, &folder.ID
+	default:
+		return nil, fmt.Errorf("unknown resource type %s", resource.Type)
+	}
+
+	if decision.step("owner", ownerID == userID, "%s %d is owned by user %d", resource.Type, resource.ID, ownerID) {
+		decision.Allowed = true
+		return decision, nil
+	}
+
+	if resource.Type == ResourceDocument {
+		grant, err := e.repos.Grants.Find(ctx, repository.GrantQuery{
+			Permission: permission,
+			DocumentID: &resource.ID,
+			UserID:     userID,
+			GroupIDs:   groupIDs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if grant != nil {
+			decision.step("grant", true, "grant #%d on the document %s", grant.ID, grantee(grant))
+			decision.Allowed = true
+			return decision, nil
+		}
+		decision.step("grant", false, "no grant of %s on the document", permission)
+	}
+
+	folderIDs, err := e.FolderAncestors(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(folderIDs) == 0 {
+		decision.step("folder_grant", false, "the %s is not in a folder", resource.Type)
+		return decision, nil
+	}
+	grant, err := e.repos.Grants.Find(ctx, repository.GrantQuery{
+		Permission: permission,
+		FolderIDs:  folderIDs,
+		UserID:     userID,
+		GroupIDs:   groupIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if grant != nil {
+		decision.step("folder_grant", true, "grant #%d on folder %d %s", grant.ID, *grant.FolderID, grantee(grant))
+		decision.Allowed = true
+		return decision, nil
+	}
+	decision.step("folder_grant", false, "no grant of %s on folders %v", permission, folderIDs)
+	return decision, nil
+}
+
+// Authorize reports whether the user may perform the permission, optionally on a resource. The policies are
+// left to AuthMiddleware and DocumentFilter.
+func (e *Engine) Authorize(ctx context.Context, userID uint, permission string, resource *Resource) (bool, error) {
+	decision, err := e.decide(ctx, userID, permission, resource)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// FolderAncestors returns the folder and all its parents, starting with the folder itself
+func (e *Engine) FolderAncestors(ctx context.Context, folderID *uint) ([]uint, error) {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for folderID != nil && !seen[*folderID] {
+		seen[*folderID] = true
+		ids = append(ids, *folderID)
+
+		folder, err := e.repos.Folders.Get(ctx, *folderID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				break
+			}
+			return nil, err
+		}
+		folderID = folder.ParentID
+	}
+	return ids, nil
+}
+
+func grantee(grant *models.Grant) string {
+	if grant.GroupID != nil {
+		return fmt.Sprintf("to group %d", *grant.GroupID)
+	}
+	return "to the user"
+}
+
+func notFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrResourceNotFound
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package authz
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/repository"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// roleEntry is the cached permission set of a role
+type roleEntry struct {
+	name        string
+	permissions map[string]bool
+	loadedAt    time.Time
+}
+
+// userEntry is the cached membership of a user: its own role, the roles of its groups and its groups
+type userEntry struct {
+	roleIDs  []uint
+	groupIDs []uint
+	loadedAt time.Time
+}
+
+// Engine evaluates permissions. Role permission sets and user memberships are cached and invalidated
+// by the services that change them; entries also expire after ttl, so that changes made by another
+// instance of the application are picked up.
+type Engine struct {
+	ttl   time.Duration
+	repos *repository.Repositories
+	mu    sync.RWMutex
+	roles map[uint]roleEntry
+	users map[uint]userEntry
+
+	policies *policyCache
+}
+
+func NewEngine(cfg config.AuthzConfig, repos *repository.Repositories) *Engine {
+	return &Engine{
+		ttl:      cfg.CacheTTL,
+		repos:    repos,
+		roles:    map[uint]roleEntry{},
+		users:    map[uint]userEntry{},
+		policies: &policyCache{sets: map[uint]policySet{}},
+	}
+}
+
+// InvalidateRole drops the cached permissions of roles
+func (e *Engine) InvalidateRole(roleIDs ...uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range roleIDs {
+		delete(e.roles, id)
+	}
+}
+
+// InvalidateUser drops the cached memberships of users
+func (e *Engine) InvalidateUser(userIDs ...uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range userIDs {
+		delete(e.users, id)
+	}
+}
+
+// InvalidateAll empties the cache
+func (e *Engine) InvalidateAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.roles = map[uint]roleEntry{}
+	e.users = map[uint]userEntry{}
+}
+
+func (e *Engine) fresh(loadedAt time.Time) bool {
+	return time.Since(loadedAt) < e.ttl
+}
+
+func (e *Engine) user(ctx context.Context, userID uint) (userEntry, error) {
+	e.mu.RLock()
+	entry, ok := e.users[userID]
+	e.mu.RUnlock()
+	if ok && e.fresh(entry.loadedAt) {
+		return entry, nil
+	}
+
+	// User IDs are unique across organizations, the membership is read without tenant restriction
+	roleIDs, groupIDs, err := e.repos.Users.Memberships(database.Unscoped(ctx), userID)
+	if err != nil {
+		return entry, err
+	}
+	entry = userEntry{roleIDs: roleIDs, groupIDs: groupIDs, loadedAt: time.Now()}
+	sort.Slice(entry.roleIDs, func(i, j int) bool { return entry.roleIDs[i] < entry.roleIDs[j] })
+
+	e.mu.Lock()
+	e.users[userID] = entry
+	e.mu.Unlock()
+	return entry, nil
+}
+
+func (e *Engine) role(ctx context.Context, roleID uint) (roleEntry, error) {
+	e.mu.RLock()
+	entry, ok := e.roles[roleID]
+	e.mu.RUnlock()
+	if ok && e.fresh(entry.loadedAt) {
+		return entry, nil
+	}
+
+	role, err := e.repos.Roles.Get(database.Unscoped(ctx), roleID)
+	if err != nil {
+		return entry, err
+	}
+	entry = roleEntry{name: role.Name, permissions: map[string]bool{}, loadedAt: time.Now()}
+	for _, permission := range role.Permissions {
+		entry.permissions[permission.Name] = true
+	}
+
+	e.mu.Lock()
+	e.roles[roleID] = entry
+	e.mu.Unlock()
+	return entry, nil
+}
+
+// Permissions returns the union of the permissions of the user's role and of the roles of their groups
+func (e *Engine) Permissions(ctx context.Context, userID uint) ([]string, error) {
+	user, err := e.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	for _, roleID := range user.roleIDs {
+		role, err := e.role(ctx, roleID)
+		if err != nil {
+			return nil, err
+		}
+		for name := range role.permissions {
+			set[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// rolesGranting returns the names of the user's roles holding the permission, and the names of all its roles
+func (e *Engine) rolesGranting(ctx context.Context, userID uint, permission string) (granting, all []string, err error) {
+	user, err := e.user(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, roleID := range user.roleIDs {
+		role, err := e.role(ctx, roleID)
+		if err != nil {
+			return nil, nil, err
+		}
+		all = append(all, role.name)
+		if role.permissions[permission] {
+			granting = append(granting, role.name)
+		}
+	}
+	return granting, all, nil
+}
+
+// HasPermission checks if the user holds the permission through their role or one of their groups
+func (e *Engine) HasPermission(ctx context.Context, userID uint, permission string) (bool, error) {
+	granting, _, err := e.rolesGranting(ctx, userID, permission)
+	return len(granting) > 0, err
+}
+
+// GroupIDs returns the IDs of the groups the user belongs to
+func (e *Engine) GroupIDs(ctx context.Context, userID uint) ([]uint, error) {
+	user, err := e.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.groupIDs, nil
+}
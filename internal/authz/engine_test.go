@@ -0,0 +1,286 @@
+package authz
+
+import (
+	"archiv-system/internal/models"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func (f *policyFixture) hasPermission(t *testing.T, permission string) bool {
+	t.Helper()
+	allowed, err := f.engine.HasPermission(f.ctx, f.user.ID, permission)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allowed
+}
+
+func (f *policyFixture) permissions(t *testing.T, names ...string) []*models.Permission {
+	t.Helper()
+	permissions, err := f.repos.Roles.FindPermissions(f.ctx, names)
+	if err != nil || len(permissions) != len(names) {
+		t.Fatalf("permissions %v: %v", names, err)
+	}
+	return permissions
+}
+
+func TestRoleCacheInvalidation(t *testing.T) {
+	f := newPolicyFixture(t)
+	role, err := f.repos.Roles.GetByName(f.ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.hasPermission(t, "update_document") {
+		t.Fatal("role user grants update_document")
+	}
+
+	// The permissions of the role are cached until the role is invalidated
+	if err := f.repos.Roles.AddPermissions(f.ctx, role, f.permissions(t, "update_document")); err != nil {
+		t.Fatal(err)
+	}
+	if f.hasPermission(t, "update_document") {
+		t.Fatal("role edit seen before the invalidation")
+	}
+	f.engine.InvalidateRole(role.ID)
+	if !f.hasPermission(t, "update_document") {
+		t.Fatal("role edit not seen after the invalidation")
+	}
+	permissions, err := f.engine.Permissions(f.ctx, f.user.ID)
+	if err != nil || fmt.Sprint(permissions) != "[read_document update_document upload_document]" {
+		t.Fatalf("permissions %v: %v", permissions, err)
+	}
+
+	// Without invalidation, an edit made by another instance is seen once the cache expires
+	f.engine.ttl = 50 * time.Millisecond
+	f.engine.InvalidateAll()
+	f.hasPermission(t, "update_document")
+	if err := f.repos.Roles.RemovePermissions(f.ctx, role, f.permissions(t, "update_document")); err != nil {
+		t.Fatal(err)
+	}
+	if !f.hasPermission(t, "update_document") {
+		t.Fatal("role edit seen before the expiry")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if f.hasPermission(t, "update_document") {
+		t.Fatal("role edit not seen after the expiry")
+	}
+}
+
+func TestMembershipCacheInvalidation(t *testing.T) {
+	f := newPolicyFixture(t)
+	editor := &models.Role{Name: "editor"}
+	if err := f.repos.Roles.Create(f.ctx, editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Roles.AddPermissions(f.ctx, editor, f.permissions(t, "update_document")); err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Group{Name: "editors"}
+	if err := f.repos.Groups.Create(f.ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Groups.AddRole(f.ctx, group, editor); err != nil {
+		t.Fatal(err)
+	}
+	if f.hasPermission(t, "update_document") {
+		t.Fatal("update_document granted before joining the group")
+	}
+
+	// The memberships of the user are cached until the user is invalidated
+	if err := f.repos.Groups.AddMember(f.ctx, group, &f.user); err != nil {
+		t.Fatal(err)
+	}
+	if f.hasPermission(t, "update_document") {
+		t.Fatal("membership seen before the invalidation")
+	}
+	f.engine.InvalidateUser(f.user.ID)
+	if !f.hasPermission(t, "update_document") {
+		t.Fatal("role of the group not granted after the invalidation")
+	}
+	if groupIDs, err := f.engine.GroupIDs(f.ctx, f.user.ID); err != nil || len(groupIDs) != 1 || groupIDs[0] != group.ID {
+		t.Fatalf("groups %v: %v", groupIDs, err)
+	}
+
+	// A change of the role of the user too
+	admin, err := f.repos.Roles.GetByName(f.ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Users.Update(f.ctx, &f.user, map[string]interface{}{"role_id": admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if f.hasPermission(t, "manage_users") {
+		t.Fatal("role change seen before the invalidation")
+	}
+	f.engine.InvalidateUser(f.user.ID)
+	if !f.hasPermission(t, "manage_users") {
+		t.Fatal("role change not seen after the invalidation")
+	}
+
+	if err := f.repos.Groups.RemoveMember(f.ctx, group, f.user.ID); err != nil {
+		t.Fatal(err)
+	}
+	f.engine.InvalidateUser(f.user.ID)
+	if groupIDs, err := f.engine.GroupIDs(f.ctx, f.user.ID); err != nil || len(groupIDs) != 0 {
+		t.Fatalf("groups %v after leaving the group: %v", groupIDs, err)
+	}
+}
+
+// steps summarizes the rules of a decision as "rule:passed:detail"
+func steps(decision *Decision) []string {
+	var summary []string
+	for _, step := range decision.Steps {
+		summary = append(summary, fmt.Sprintf("%s:%v:%s", step.Rule, step.Passed, step.Detail))
+	}
+	return summary
+}
+
+func TestExplainReasons(t *testing.T) {
+	f := newPolicyFixture(t)
+	// A document of another user, in a sub-folder of theirs
+	role, err := f.repos.Roles.GetByName(f.ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := &models.User{Username: "owner", Password: "x", RoleID: role.ID}
+	if err := f.repos.Users.Create(f.ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+	parent := &models.Folder{Name: "archives", OwnerID: owner.ID}
+	if err := f.repos.Folders.Create(f.ctx, parent); err != nil {
+		t.Fatal(err)
+	}
+	child := &models.Folder{Name: "2024", OwnerID: owner.ID, ParentID: &parent.ID}
+	if err := f.repos.Folders.Create(f.ctx, child); err != nil {
+		t.Fatal(err)
+	}
+	other := &models.Document{Name: "c.pdf", Type: "application/pdf", URL: "c.pdf", OwnerID: owner.ID, FolderID: &child.ID}
+	if err := f.repos.Documents.Create(f.ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Group{Name: "readers"}
+	if err := f.repos.Groups.Create(f.ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Groups.AddMember(f.ctx, group, &f.user); err != nil {
+		t.Fatal(err)
+	}
+	f.engine.InvalidateUser(f.user.ID)
+
+	explain := func(permission string, resource *Resource) *Decision {
+		t.Helper()
+		decision, err := f.engine.Explain(f.ctx, f.user.ID, permission, resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed, err := f.engine.Authorize(f.ctx, f.user.ID, permission, resource)
+		if err != nil || allowed != decision.Allowed {
+			t.Fatalf("Authorize = %v, %v, Explain allowed %v", allowed, err, decision.Allowed)
+		}
+		return decision
+	}
+	check := func(decision *Decision, allowed bool, want ...string) {
+		t.Helper()
+		got := steps(decision)
+		if decision.Allowed != allowed || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("allowed %v, steps %q, want %v, %q", decision.Allowed, got, allowed, want)
+		}
+	}
+	own := f.documents[0].ID
+	rolePassed := "role:true:granted by role user"
+
+	check(explain("read_document", nil), true, rolePassed)
+	check(explain("update_document", Document(own)), false, "role:false:none of the roles [user] grant update_document")
+	check(explain("read_document", Document(own)), true, rolePassed,
+		fmt.Sprintf("owner:true:document %d is owned by user %d", own, f.user.ID))
+
+	notOwned := fmt.Sprintf("owner:false:document %d is owned by user %d", other.ID, owner.ID)
+	noGrant := "grant:false:no grant of read_document on the document"
+	check(explain("read_document", Document(other.ID)), false, rolePassed, notOwned, noGrant,
+		fmt.Sprintf("folder_grant:false:no grant of read_document on folders [%d %d]", child.ID, parent.ID))
+
+	// A grant on the document, to the user
+	grant := &models.Grant{DocumentID: &other.ID, UserID: &f.user.ID, Permission: "read_document"}
+	if err := f.repos.Grants.Create(f.ctx, grant); err != nil {
+		t.Fatal(err)
+	}
+	check(explain("read_document", Document(other.ID)), true, rolePassed, notOwned,
+		fmt.Sprintf("grant:true:grant #%d on the document to the user", grant.ID))
+	if err := f.repos.Grants.Delete(f.ctx, grant.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A grant on a parent folder, to a group of the user, covers the document and the sub-folder
+	folderGrant := &models.Grant{FolderID: &parent.ID, GroupID: &group.ID, Permission: "read_document"}
+	if err := f.repos.Grants.Create(f.ctx, folderGrant); err != nil {
+		t.Fatal(err)
+	}
+	granted := fmt.Sprintf("folder_grant:true:grant #%d on folder %d to group %d", folderGrant.ID, parent.ID, group.ID)
+	check(explain("read_document", Document(other.ID)), true, rolePassed, notOwned, noGrant, granted)
+	check(explain("read_document", Folder(child.ID)), true, rolePassed,
+		fmt.Sprintf("owner:false:folder %d is owned by user %d", child.ID, owner.ID), granted)
+
+	if _, err := f.engine.Explain(f.ctx, f.user.ID, "read_document", Document(other.ID+100)); !errors.Is(err, ErrResourceNotFound) {
+		t.Fatalf("missing document: got %v, want ErrResourceNotFound", err)
+	}
+}
+
+func TestExplainPolicies(t *testing.T) {
+	f := newPolicyFixture(t)
+	secret, public := f.documents[0].ID, f.documents[1].ID
+	f.addPolicy(t, models.Policy{
+		Name:       "hide-secret",
+		Permission: "read_document",
+		Effect:     models.PolicyDeny,
+		Condition:  `"secret" in document.tags`,
+	})
+	f.addPolicy(t, models.Policy{
+		Name:       "edit-public",
+		Permission: "update_document",
+		Effect:     models.PolicyAllow,
+		Condition:  `"public" in document.tags`,
+	})
+
+	explain := func(permission string, resource *Resource) *Decision {
+		t.Helper()
+		decision, err := f.engine.Explain(f.ctx, f.user.ID, permission, resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decision
+	}
+	last := func(decision *Decision) string {
+		return steps(decision)[len(decision.Steps)-1]
+	}
+
+	// A deny policy refuses what the owner is allowed; the services' check leaves the policies to the middleware
+	decision := explain("read_document", Document(secret))
+	if decision.Allowed || last(decision) != "policy:false:denied by policy hide-secret" {
+		t.Errorf("secret document: allowed %v, steps %q", decision.Allowed, steps(decision))
+	}
+	if allowed, err := f.engine.Authorize(f.ctx, f.user.ID, "read_document", Document(secret)); err != nil || !allowed {
+		t.Errorf("Authorize = %v, %v, want the owner allowed", allowed, err)
+	}
+
+	decision = explain("read_document", Document(public))
+	if !decision.Allowed || last(decision) != "policy:true:no policy denies read_document" {
+		t.Errorf("public document: allowed %v, steps %q", decision.Allowed, steps(decision))
+	}
+
+	// An allow policy passes the route check, the role is still required by the services
+	decision = explain("update_document", Document(public))
+	if decision.Allowed || fmt.Sprint(steps(decision)) != "[role:false:none of the roles [user] grant update_document policy:true:allowed by policy edit-public]" {
+		t.Errorf("update of the public document: allowed %v, steps %q", decision.Allowed, steps(decision))
+	}
+	decision = explain("update_document", Document(secret))
+	if decision.Allowed || last(decision) != "policy:false:no role grants update_document" {
+		t.Errorf("update of the secret document: allowed %v, steps %q", decision.Allowed, steps(decision))
+	}
+
+	// Without policy for the permission, no policy step is recorded
+	if decision := explain("upload_document", nil); len(decision.Steps) != 1 || !decision.Allowed {
+		t.Errorf("upload: allowed %v, steps %q", decision.Allowed, steps(decision))
+	}
+}
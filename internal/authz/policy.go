@@ -0,0 +1,403 @@
+package authz
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// PolicyUser holds the user attributes available to policy conditions
+type PolicyUser struct {
+	ID         uint     `expr:"id"`
+	Username   string   `expr:"username"`
+	Role       string   `expr:"role"`
+	Groups     []string `expr:"groups"`
+	AuthSource string   `expr:"auth_source"`
+}
+
+// PolicyDocument holds the attributes of the document targeted by the request
+type PolicyDocument struct {
+	ID        uint      `expr:"id"`
+	Name      string    `expr:"name"`
+	OwnerID   uint      `expr:"owner_id"`
+	FolderID  uint      `expr:"folder_id"` // 0 when the document is not in a folder
+	Tags      []string  `expr:"tags"`
+	Size      int64     `expr:"size"`
+	CreatedAt time.Time `expr:"created_at"`
+}
+
+// PolicyRequest holds the attributes of the HTTP request
+type PolicyRequest struct {
+	Method  string    `expr:"method"`
+	Path    string    `expr:"path"`
+	IP      string    `expr:"ip"`
+	Time    time.Time `expr:"time"`
+	Hour    int       `expr:"hour"`    // 0-23, server local time
+	Weekday string    `expr:"weekday"` // "Monday" ... "Sunday"
+}
+
+// PolicyInput is the environment policy conditions are evaluated against.
+// Document is nil on routes that do not target a document.
+type PolicyInput struct {
+	Permission string          `expr:"permission"`
+	User       PolicyUser      `expr:"user"`
+	Document   *PolicyDocument `expr:"document"`
+	Request    PolicyRequest   `expr:"request"`
+}
+
+// compiledPolicy is a policy with its condition compiled once
+type compiledPolicy struct {
+	models.Policy
+	program    *vm.Program
+	onDocument bool // the condition reads the document attributes
+}
+
+type policySet struct {
+	policies []compiledPolicy
+	loadedAt time.Time
+}
+
+// policyCache holds the compiled enabled policies of each organization
+type policyCache struct {
+	mu   sync.RWMutex
+	sets map[uint]policySet
+}
+
+// CompileCondition checks that a condition is a valid boolean expression over PolicyInput
+func CompileCondition(condition string) (*vm.Program, error) {
+	return expr.Compile(condition, expr.Env(PolicyInput{}), expr.AsBool())
+}
+
+// documentReader finds the references to the document in a condition
+type documentReader struct{ found bool }
+
+func (r *documentReader) Visit(node *ast.Node) {
+	if identifier, ok := (*node).(*ast.IdentifierNode); ok && identifier.Value == "document" {
+		r.found = true
+	}
+}
+
+// readsDocument reports whether a compiled condition reads the document attributes
+func readsDocument(program *vm.Program) bool {
+	reader := &documentReader{}
+	node := program.Node()
+	ast.Walk(&node, reader)
+	return reader.found
+}
+
+// InvalidatePolicies drops the compiled policies of an organization
+func (e *Engine) InvalidatePolicies(organizationID uint) {
+	e.policies.mu.Lock()
+	defer e.policies.mu.Unlock()
+	delete(e.policies.sets, organizationID)
+}
+
+// loadPolicies returns the compiled enabled policies of an organization
+func (e *Engine) loadPolicies(ctx context.Context, organizationID uint) ([]compiledPolicy, error) {
+	pc := e.policies
+	pc.mu.RLock()
+	set, ok := pc.sets[organizationID]
+	pc.mu.RUnlock()
+	if ok && e.fresh(set.loadedAt) {
+		return set.policies, nil
+	}
+
+	stored, err := e.repos.Policies.ListEnabled(database.Unscoped(ctx), organizationID)
+	if err != nil {
+		return nil, err
+	}
+	set = policySet{loadedAt: time.Now()}
+	for _, policy := range stored {
+		program, err := CompileCondition(policy.Condition)
+		if err != nil {
+			// Conditions are validated when saved; skip a policy that no longer compiles
+			slog.WarnContext(ctx, "Policy cannot be compiled and is ignored", "policy_id", policy.ID, "policy", policy.Name, "error", err)
+			continue
+		}
+		set.policies = append(set.policies, compiledPolicy{Policy: policy, program: program, onDocument: readsDocument(program)})
+	}
+
+	pc.mu.Lock()
+	pc.sets[organizationID] = set
+	pc.mu.Unlock()
+	return set.policies, nil
+}
+
+// HasPolicies reports whether enabled policies of the organization apply to the permission,
+// so that callers only gather attributes when needed
+func (e *Engine) HasPolicies(ctx context.Context, organizationID uint, permission string) (bool, error) {
+	loaded, err := e.loadPolicies(ctx, organizationID)
+	if err != nil {
+		return false, err
+	}
+	for _, policy := range loaded {
+		if policy.Permission == "*" || policy.Permission == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// EvaluatePolicies combines the role decision with the organization policies: the request is allowed when
+// a role grants the permission or an allow policy matches, and no deny policy matches. Dry-run policies do not
+// change the outcome; when taking them into account would have, the difference is logged. A condition failing
+// at runtime counts as matching for deny policies and as not matching for allow policies.
+// Policies reading the document only apply when the input has one: on routes listing or exporting documents,
+// DocumentFilter applies them to each document instead.
+func (e *Engine) EvaluatePolicies(ctx context.Context, organizationID uint, input PolicyInput, roleAllowed bool) (bool, string, error) {
+	return e.evaluatePolicies(ctx, organizationID, input, roleAllowed, false)
+}
+
+// EvaluateListPolicies is EvaluatePolicies for the routes whose documents are checked one by one by DocumentFilter:
+// when an allow policy reading the document may grant the permission on some of them, the request goes through
+// unless a deny policy matches without the document, and the filter decides for each document.
+func (e *Engine) EvaluateListPolicies(ctx context.Context, organizationID uint, input PolicyInput, roleAllowed bool) (bool, string, error) {
+	return e.evaluatePolicies(ctx, organizationID, input, roleAllowed, true)
+}
+
+// policyMatch is a policy applying to the input, with the result of its condition
+type policyMatch struct {
+	policy  *compiledPolicy
+	matched bool
+}
+
+func (e *Engine) evaluatePolicies(ctx context.Context, organizationID uint, input PolicyInput, roleAllowed, perDocument bool) (bool, string, error) {
+	matches, deferred, err := e.matchPolicies(ctx, organizationID, input)
+	if err != nil {
+		return false, "", err
+	}
+
+	allowed, reason, _ := combinePolicies(matches, input.Permission, roleAllowed, false)
+	if dryRunAllowed, _, policy := combinePolicies(matches, input.Permission, roleAllowed, true); dryRunAllowed != allowed {
+		message := "Dry-run policy would have denied"
+		if dryRunAllowed {
+			message = "Dry-run policy would have allowed"
+		}
+		slog.InfoContext(ctx, message, "policy_id", policy.ID, "policy", policy.Name, "permission", input.Permission,
+			"user_id", input.User.ID, "method", input.Request.Method, "path", input.Request.Path)
+	}
+
+	if !allowed && perDocument && deferred {
+		// No deny policy matched when a role would have granted the permission
+		if allowedByRole, _, _ := combinePolicies(matches, input.Permission, true, false); allowedByRole {
+			return true, "", nil
+		}
+	}
+	return allowed, reason, nil
+}
+
+// matchPolicies evaluates the conditions of the policies of the organization applying to the input. deferred
+// reports an enforced allow policy left out for reading the document when the input has none.
+func (e *Engine) matchPolicies(ctx context.Context, organizationID uint, input PolicyInput) (matches []policyMatch, deferred bool, err error) {
+	loaded, err := e.loadPolicies(ctx, organizationID)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range loaded {
+		policy := &loaded[i]
+		if policy.Permission != "*" && policy.Permission != input.Permission {
+			continue
+		}
+		if policy.onDocument && input.Document == nil {
+			deferred = deferred || (policy.Effect == models.PolicyAllow && !policy.DryRun)
+			continue
+		}
+		matched, err := policy.matches(input)
+		if err != nil {
+			slog.WarnContext(ctx, "Policy evaluation failed", "policy_id", policy.ID, "policy", policy.Name, "user_id", input.User.ID, "error", err)
+			matched = policy.Effect == models.PolicyDeny
+		}
+		matches = append(matches, policyMatch{policy: policy, matched: matched})
+	}
+	return matches, deferred, nil
+}
+
+// combinePolicies returns the outcome of the matching policies, with the policy deciding it when it is not the role
+// decision. Dry-run policies are only counted when withDryRun is set.
+func combinePolicies(matches []policyMatch, permission string, roleAllowed, withDryRun bool) (bool, string, *compiledPolicy) {
+	var allowedBy *compiledPolicy
+	for _, match := range matches {
+		if !match.matched || (match.policy.DryRun && !withDryRun) {
+			continue
+		}
+		switch match.policy.Effect {
+		case models.PolicyDeny:
+			return false, fmt.Sprintf("denied by policy %s", match.policy.Name), match.policy
+		case models.PolicyAllow:
+			if allowedBy == nil {
+				allowedBy = match.policy
+			}
+		}
+	}
+	if roleAllowed {
+		return true, "", nil
+	}
+	if allowedBy != nil {
+		return true, "", allowedBy
+	}
+	return false, "no role grants " + permission, nil
+}
+
+func (p *compiledPolicy) matches(input PolicyInput) (bool, error) {
+	result, err := expr.Run(p.program, input)
+	if err != nil {
+		return false, err
+	}
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition returned %T instead of bool", result)
+	}
+	return matched, nil
+}
+
+// BuildPolicyInput gathers the user attributes and, when documentID is set, the document attributes.
+// ctx must be restricted to the organization of the request.
+func (e *Engine) BuildPolicyInput(ctx context.Context, userID uint, permission string, documentID *uint, request PolicyRequest) (PolicyInput, error) {
+	input := PolicyInput{Permission: permission, Request: request}
+
+	user, err := e.repos.Users.Get(ctx, userID)
+	if err != nil {
+		return input, err
+	}
+	input.User = PolicyUser{
+		ID:         user.ID,
+		Username:   user.Username,
+		Role:       user.Role.Name,
+		Groups:     []string{},
+		AuthSource: user.AuthSource,
+	}
+	if input.User.Groups, err = e.repos.Groups.NamesOf(ctx, userID); err != nil {
+		return input, err
+	}
+
+	if documentID != nil {
+		document, err := e.repos.Documents.Get(ctx, *documentID)
+		if err != nil {
+			return input, notFound(err)
+		}
+		input.Document = policyDocument(document)
+	}
+	return input, nil
+}
+
+// policyDocument returns the attributes of a document loaded with its tags
+func policyDocument(document *models.Document) *PolicyDocument {
+	attributes := &PolicyDocument{
+		ID:        document.ID,
+		Name:      document.Name,
+		OwnerID:   document.OwnerID,
+		Tags:      []string{},
+		Size:      document.Size,
+		CreatedAt: document.CreatedAt,
+	}
+	if document.FolderID != nil {
+		attributes.FolderID = *document.FolderID
+	}
+	if document.Tags != nil {
+		for _, tag := range *document.Tags {
+			attributes.Tags = append(attributes.Tags, tag.Name)
+		}
+	}
+	return attributes
+}
+
+type policyRequestKey struct{}
+
+// WithPolicyRequest returns a context carrying the attributes of the HTTP request, for the policies evaluated
+// by the services
+func WithPolicyRequest(ctx context.Context, request PolicyRequest) context.Context {
+	return context.WithValue(ctx, policyRequestKey{}, request)
+}
+
+// PolicyRequestFrom returns the request attributes of the context; outside of a request only the time is known
+func PolicyRequestFrom(ctx context.Context) PolicyRequest {
+	if request, ok := ctx.Value(policyRequestKey{}).(PolicyRequest); ok {
+		return request
+	}
+	return NewPolicyRequest("", "", "", time.Now())
+}
+
+// DocumentFilter applies the policies on document attributes to the documents returned by a list or an export,
+// which the route-level check cannot see: deny policies hide documents, allow policies grant the permission on
+// the documents they match when no role does
+type DocumentFilter struct {
+	engine      *Engine
+	input       PolicyInput
+	roleAllowed bool
+	loaded      bool // the user attributes are loaded on first use, when a policy applies
+}
+
+// DocumentFilter returns the filter of the documents the user reaches with the permission.
+// ctx must be restricted to the organization of the request.
+func (e *Engine) DocumentFilter(ctx context.Context, userID uint, permission string) (*DocumentFilter, error) {
+	roleAllowed, err := e.HasPermission(ctx, userID, permission)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentFilter{
+		engine:      e,
+		input:       PolicyInput{Permission: permission, User: PolicyUser{ID: userID}, Request: PolicyRequestFrom(ctx)},
+		roleAllowed: roleAllowed,
+	}, nil
+}
+
+// Allows evaluates the policies of the document's organization on a document loaded with its tags
+func (f *DocumentFilter) Allows(ctx context.Context, document *models.Document) (bool, error) {
+	applies, err := f.engine.HasPolicies(ctx, document.OrganizationID, f.input.Permission)
+	if err != nil || !applies {
+		return err == nil && f.roleAllowed, err
+	}
+	if !f.loaded {
+		input, err := f.engine.BuildPolicyInput(ctx, f.input.User.ID, f.input.Permission, nil, f.input.Request)
+		if err != nil {
+			return false, err
+		}
+		f.input, f.loaded = input, true
+	}
+
+	input := f.input
+	input.Document = policyDocument(document)
+	allowed, reason, err := f.engine.EvaluatePolicies(ctx, document.OrganizationID, input, f.roleAllowed)
+	if err != nil {
+		return false, err
+	}
+	if !allowed {
+		slog.DebugContext(ctx, "Document filtered out by policy", "document_id", document.ID, "user_id", input.User.ID, "reason", reason)
+	}
+	return allowed, nil
+}
+
+// Filter returns the documents allowed by the policies, in the same order
+func (f *DocumentFilter) Filter(ctx context.Context, documents []models.Document) ([]models.Document, error) {
+	allowed := make([]models.Document, 0, len(documents))
+	for i := range documents {
+		ok, err := f.Allows(ctx, &documents[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			allowed = append(allowed, documents[i])
+		}
+	}
+	return allowed, nil
+}
+
+// NewPolicyRequest fills the request attributes
+func NewPolicyRequest(method, path, ip string, now time.Time) PolicyRequest {
+	return PolicyRequest{
+		Method:  method,
+		Path:    path,
+		IP:      ip,
+		Time:    now,
+		Hour:    now.Hour(),
+		Weekday: now.Weekday().String(),
+	}
+}
@@ -0,0 +1,249 @@
+package authz
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadsDocument(t *testing.T) {
+	cases := map[string]bool{
+		`"secret" in document.tags`:                 true,
+		`document != nil && document.owner_id == 1`: true,
+		`user.role == "admin"`:                      false,
+		`request.hour < 8 || request.hour > 18`:     false,
+	}
+	for condition, want := range cases {
+		program, err := CompileCondition(condition)
+		if err != nil {
+			t.Fatalf("%s: %v", condition, err)
+		}
+		if got := readsDocument(program); got != want {
+			t.Errorf("readsDocument(%s) = %v, want %v", condition, got, want)
+		}
+	}
+}
+
+// policyFixture is an engine on a SQLite database holding a user "reader" of the role user and two documents
+// of theirs, a.pdf tagged secret and b.pdf tagged public
+type policyFixture struct {
+	engine       *Engine
+	repos        *repository.Repositories
+	ctx          context.Context
+	organization models.Organization
+	user         models.User
+	documents    []models.Document
+}
+
+func newPolicyFixture(t *testing.T) *policyFixture {
+	t.Helper()
+	db := database.InitDB(config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:", AutoMigrate: true},
+		config.AdminConfig{Username: "admin", Password: "Initial-Passw0rd!"})
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	f := &policyFixture{repos: repository.NewGorm(db)}
+	f.engine = NewEngine(config.AuthzConfig{CacheTTL: time.Minute}, f.repos)
+
+	if err := database.System(db).Where("slug = ?", database.DefaultOrganizationSlug).First(&f.organization).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.ctx = database.WithOrganization(context.Background(), f.organization.ID)
+	scoped := db.WithContext(f.ctx)
+
+	var role models.Role
+	if err := scoped.Where("name = ?", "user").First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.user = models.User{Username: "reader", Password: "x", RoleID: role.ID}
+	if err := scoped.Create(&f.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	secret, public := []models.Tag{{Name: "secret"}}, []models.Tag{{Name: "public"}}
+	f.documents = []models.Document{
+		{Name: "a.pdf", Type: "application/pdf", URL: "a.pdf", OwnerID: f.user.ID, Tags: &secret},
+		{Name: "b.pdf", Type: "application/pdf", URL: "b.pdf", OwnerID: f.user.ID, Tags: &public},
+	}
+	if err := scoped.Create(&f.documents).Error; err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *policyFixture) addPolicy(t *testing.T, policy models.Policy) {
+	t.Helper()
+	policy.Enabled = true
+	if err := f.repos.Policies.Create(f.ctx, &policy); err != nil {
+		t.Fatal(err)
+	}
+	f.engine.InvalidatePolicies(f.organization.ID)
+}
+
+// listInput is the input of the route-level check of a list, which has no document
+func (f *policyFixture) listInput(t *testing.T) PolicyInput {
+	t.Helper()
+	input, err := f.engine.BuildPolicyInput(f.ctx, f.user.ID, "read_document", nil, NewPolicyRequest("GET", "/documents/viewlist", "127.0.0.1", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+// visible returns the names of the documents of the user the filter lets them read
+func (f *policyFixture) visible(t *testing.T) []string {
+	t.Helper()
+	listed, err := f.repos.Documents.Find(f.ctx, repository.DocumentQuery{OwnerID: f.user.ID}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := f.engine.DocumentFilter(f.ctx, f.user.ID, "read_document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := filter.Filter(f.ctx, listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, document := range allowed {
+		names = append(names, document.Name)
+	}
+	return names
+}
+
+func TestDocumentPoliciesFilterLists(t *testing.T) {
+	f := newPolicyFixture(t)
+	f.addPolicy(t, models.Policy{
+		Name:       "hide-secret",
+		Permission: "read_document",
+		Effect:     models.PolicyDeny,
+		Condition:  `"secret" in document.tags`,
+	})
+
+	// The route-level check has no document: the policy is left to the filter instead of denying the list
+	allowed, reason, err := f.engine.EvaluatePolicies(f.ctx, f.organization.ID, f.listInput(t), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Fatalf("list route denied: %s", reason)
+	}
+	if names := f.visible(t); len(names) != 1 || names[0] != "b.pdf" {
+		t.Fatalf("filtered documents %v, want only b.pdf", names)
+	}
+
+	// The document route still applies the policy itself
+	secretID := f.documents[0].ID
+	input, err := f.engine.BuildPolicyInput(f.ctx, f.user.ID, "read_document", &secretID, NewPolicyRequest("GET", "/documents/1/thumbnail", "127.0.0.1", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _, err := f.engine.EvaluatePolicies(f.ctx, f.organization.ID, input, true); err != nil || allowed {
+		t.Fatalf("document route: allowed=%v err=%v, want denied", allowed, err)
+	}
+}
+
+func TestAllowPoliciesGrantListedDocuments(t *testing.T) {
+	f := newPolicyFixture(t)
+	// The reader loses read_document, a policy grants it on the public documents only
+	guest := &models.Role{Name: "guest"}
+	if err := f.repos.Roles.Create(f.ctx, guest); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Users.Update(f.ctx, &f.user, map[string]interface{}{"role_id": guest.ID}); err != nil {
+		t.Fatal(err)
+	}
+	f.engine.InvalidateUser(f.user.ID)
+	f.addPolicy(t, models.Policy{
+		Name:       "share-public",
+		Permission: "read_document",
+		Effect:     models.PolicyAllow,
+		Condition:  `"public" in document.tags`,
+	})
+
+	input := f.listInput(t)
+	if allowed, _, err := f.engine.EvaluatePolicies(f.ctx, f.organization.ID, input, false); err != nil || allowed {
+		t.Fatalf("route without documents: allowed=%v err=%v, want denied", allowed, err)
+	}
+	if allowed, reason, err := f.engine.EvaluateListPolicies(f.ctx, f.organization.ID, input, false); err != nil || !allowed {
+		t.Fatalf("list route: denied (%s, %v), want the filter to decide", reason, err)
+	}
+	if names := f.visible(t); len(names) != 1 || names[0] != "b.pdf" {
+		t.Fatalf("filtered documents %v, want only b.pdf", names)
+	}
+
+	// A deny policy matching without the document still refuses the list
+	f.addPolicy(t, models.Policy{
+		Name:       "block-reader",
+		Permission: "*",
+		Effect:     models.PolicyDeny,
+		Condition:  `user.username == "reader"`,
+	})
+	allowed, reason, err := f.engine.EvaluateListPolicies(f.ctx, f.organization.ID, input, false)
+	if err != nil || allowed || reason != "denied by policy block-reader" {
+		t.Fatalf("list route: allowed=%v reason=%q err=%v, want denied by block-reader", allowed, reason, err)
+	}
+}
+
+func TestDryRunPoliciesLogDifferences(t *testing.T) {
+	f := newPolicyFixture(t)
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	evaluate := func(roleAllowed bool) bool {
+		t.Helper()
+		logs.Reset()
+		allowed, _, err := f.engine.EvaluatePolicies(f.ctx, f.organization.ID, f.listInput(t), roleAllowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+
+	f.addPolicy(t, models.Policy{
+		Name:       "open-reader",
+		Permission: "read_document",
+		Effect:     models.PolicyAllow,
+		Condition:  `user.role == "user"`,
+		DryRun:     true,
+	})
+	if evaluate(false) {
+		t.Fatal("dry-run policy allowed the request")
+	}
+	if !strings.Contains(logs.String(), "Dry-run policy would have allowed") || !strings.Contains(logs.String(), "policy=open-reader") {
+		t.Fatalf("logs %q, want the grant logged", logs.String())
+	}
+	// The role already grants the permission, the dry-run policy makes no difference
+	if !evaluate(true) || logs.Len() != 0 {
+		t.Fatalf("logs %q, want none", logs.String())
+	}
+
+	f.addPolicy(t, models.Policy{
+		Name:       "freeze-reader",
+		Permission: "read_document",
+		Effect:     models.PolicyDeny,
+		Condition:  `user.username == "reader"`,
+		DryRun:     true,
+	})
+	if !evaluate(true) {
+		t.Fatal("dry-run policy denied the request")
+	}
+	if !strings.Contains(logs.String(), "Dry-run policy would have denied") || !strings.Contains(logs.String(), "policy=freeze-reader") {
+		t.Fatalf("logs %q, want the denial logged", logs.String())
+	}
+	// The dry-run deny wins over the dry-run allow, the outcome stays a denial
+	if evaluate(false) || logs.Len() != 0 {
+		t.Fatalf("logs %q, want none", logs.String())
+	}
+}
@@ -0,0 +1,120 @@
+// Package bagit writes and validates BagIt bags (RFC 8493), the packaging of the preservation exports and ingests.
+// A bag holds its files under data/, next to manifests of their checksums and a bag-info.txt of metadata.
+package bagit
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ErrInvalidBag reports a bag that does not pass validation, see ValidationError for the problems found
+var ErrInvalidBag = errors.New("invalid bag")
+
+// Version is the version of the specification the bags are written in
+const Version = "1.0"
+
+// Names of the tag files
+const (
+	DeclarationFile = "bagit.txt"
+	InfoFile        = "bag-info.txt"
+	FetchFile       = "fetch.txt"
+	PayloadDir      = "data"
+)
+
+// Checksum algorithms, as named in the manifest files. The bags are written with SHA-256 and SHA-512.
+const (
+	MD5    = "md5"
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+var algorithms = map[string]func() hash.Hash{
+	MD5:    md5.New,
+	SHA1:   sha1.New,
+	SHA256: sha256.New,
+	SHA512: sha512.New,
+}
+
+// writtenAlgorithms are the checksums of the bags written
+var writtenAlgorithms = []string{SHA256, SHA512}
+
+// Checksums holds the hex checksums of a file by algorithm
+type Checksums map[string]string
+
+// InfoField is a line of bag-info.txt
+type InfoField struct {
+	Label string
+	Value string
+}
+
+// Info holds the fields of bag-info.txt, in their order; a label may appear more than once
+type Info []InfoField
+
+// Get returns the value of the first field with a label, ignoring case, or "" when missing
+func (i Info) Get(label string) string {
+	for _, field := range i {
+		if strings.EqualFold(field.Label, label) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Set replaces the value of a field, or adds it when missing
+func (i *Info) Set(label, value string) {
+	for j, field := range *i {
+		if strings.EqualFold(field.Label, label) {
+			(*i)[j].Value = value
+			return
+		}
+	}
+	*i = append(*i, InfoField{Label: label, Value: value})
+}
+
+// ParseInfoField reads a field given as "Label: Value"
+func ParseInfoField(line string) (InfoField, error) {
+	label, value, ok := strings.Cut(line, ":")
+	label, value = strings.TrimSpace(label), strings.TrimSpace(value)
+	if !ok || label == "" || strings.ContainsAny(label, "\r\n") {
+		return InfoField{}, fmt.Errorf("bag-info field '%s' must look like 'Label: Value'", line)
+	}
+	return InfoField{Label: label, Value: value}, nil
+}
+
+// manifestName returns the name of the payload (or tag) manifest of an algorithm
+func manifestName(algorithm string, tag bool) string {
+	if tag {
+		return "tagmanifest-" + algorithm + ".txt"
+	}
+	return "manifest-" + algorithm + ".txt"
+}
+
+// encodePath escapes the characters a manifest line cannot hold, as the specification requires
+func encodePath(p string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(p)
+}
+
+func decodePath(p string) string {
+	return strings.NewReplacer("%25", "%", "%0D", "\r", "%0d", "\r", "%0A", "\n", "%0a", "\n").Replace(p)
+}
+
+// formatSize gives a size in the human-readable form of the Bag-Size field
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, exp := float64(n)/unit, 0
+	for size >= unit && exp < 4 {
+		size /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %s", size, []string{"KB", "MB", "GB", "TB", "PB"}[exp])
+}
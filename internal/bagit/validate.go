@@ -0,0 +1,431 @@
+package bagit
+
+import (
+	"archiv-system/internal/archive"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTagFileSize bounds the tag files kept in memory during a validation
+const maxTagFileSize = 32 << 20
+
+// maxProblems bounds the problems recorded for a bag, the others are only counted
+const maxProblems = 1000
+
+// ValidationError lists the problems of an invalid bag
+type ValidationError struct {
+	Problems []string
+	Omitted  int // problems found past maxProblems
+}
+
+func (e *ValidationError) Error() string {
+	const shown = 10
+	problems := e.Problems
+	if len(problems) > shown {
+		problems = problems[:shown]
+	}
+	message := fmt.Sprintf("%s: %s", ErrInvalidBag, strings.Join(problems, "; "))
+	if more := len(e.Problems) + e.Omitted - len(problems); more > 0 {
+		message += fmt.Sprintf(" (and %d more problems)", more)
+	}
+	return message
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidBag }
+
+// Bag is a bag that passed validation
+type Bag struct {
+	Root    string // directory of the bag in what was validated, with a trailing slash, "" when at the top
+	Version string
+	Info    Info
+	Payload []PayloadFile // sorted by path
+	tags    map[string][]byte
+}
+
+// PayloadFile is a file of the payload of a bag
+type PayloadFile struct {
+	Path      string // slash-separated, relative to data/
+	Size      int64
+	Checksums Checksums // of the algorithms of the manifests of the bag
+}
+
+// TagFile returns the content of a tag file, at a path relative to the root of the bag
+func (b *Bag) TagFile(name string) ([]byte, bool) {
+	content, ok := b.tags[name]
+	return content, ok
+}
+
+// Size returns the size of the payload in bytes
+func (b *Bag) Size() int64 {
+	var size int64
+	for _, file := range b.Payload {
+		size += file.Size
+	}
+	return size
+}
+
+type bagFile struct {
+	size    int64
+	sums    Checksums
+	content []byte // tag files only, nil when too large
+}
+
+// Validator checks a bag whose files are given one by one, in any order, so that a bag can be validated from
+// a directory as well as from a zip or tar archive read once
+type Validator struct {
+	files    map[string]*bagFile
+	problems []string
+}
+
+func NewValidator() *Validator {
+	return &Validator{files: make(map[string]*bagFile)}
+}
+
+// Add reads a file of the bag, at a cleaned slash-separated path, possibly under the top-level directory of
+// the bag, and computes its checksums
+func (v *Validator) Add(name string, r io.Reader) error {
+	if _, exists := v.files[name]; exists {
+		v.Reject(name, "found twice")
+		return nil
+	}
+	hashes := make(map[string]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms)+1)
+	for algorithm, newHash := range algorithms {
+		hashes[algorithm] = newHash()
+		writers = append(writers, hashes[algorithm])
+	}
+	var content *bytes.Buffer
+	if !mayBePayload(name) {
+		content = new(bytes.Buffer)
+		writers = append(writers, &limitedBuffer{buf: content, limit: maxTagFileSize})
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	file := &bagFile{size: n, sums: make(Checksums, len(hashes))}
+	for algorithm, h := range hashes {
+		file.sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	if content != nil && n <= maxTagFileSize {
+		file.content = append([]byte{}, content.Bytes()...)
+	}
+	v.files[name] = file
+	return nil
+}
+
+// Reject records a problem with an entry that cannot be added, such as a link
+func (v *Validator) Reject(name, reason string) {
+	v.problem("%s: %s", name, reason)
+}
+
+func (v *Validator) problem(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the bag once all its files were added: its declaration, that every payload file is listed in
+// every payload manifest and every listed file is present with the right checksum, the tag manifests and the
+// Payload-Oxum. It returns a *ValidationError listing the problems of an invalid bag.
+func (v *Validator) Validate() (*Bag, error) {
+	root, ok := v.root()
+	if !ok {
+		v.problem("%s not found at the top of the bag", DeclarationFile)
+		return nil, v.result()
+	}
+	bag := &Bag{Root: root, tags: make(map[string][]byte)}
+
+	files := make(map[string]*bagFile, len(v.files))
+	for name, file := range v.files {
+		rel, inside := strings.CutPrefix(name, root)
+		if !inside {
+			v.problem("%s is outside the bag", name)
+			continue
+		}
+		files[rel] = file
+	}
+
+	declaration := parseFields(files[DeclarationFile].content)
+	bag.Version = declaration.Get("BagIt-Version")
+	if bag.Version != "1.0" && bag.Version != "0.97" {
+		v.problem("%s: unsupported BagIt-Version '%s'", DeclarationFile, bag.Version)
+	}
+	if encoding := declaration.Get("Tag-File-Character-Encoding"); !strings.EqualFold(encoding, "UTF-8") {
+		v.problem("%s: unsupported Tag-File-Character-Encoding '%s'", DeclarationFile, encoding)
+	}
+	if _, ok := files[FetchFile]; ok {
+		v.problem("%s is not supported, the bag must hold all its payload", FetchFile)
+	}
+	if info, ok := files[InfoFile]; ok {
+		if info.content == nil {
+			v.problem("%s is too large", InfoFile)
+		}
+		bag.Info = parseFields(info.content)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	payloadManifests := 0
+	for _, name := range names {
+		algorithm, tag, ok := parseManifestName(name)
+		if !ok {
+			continue
+		}
+		if algorithms[algorithm] == nil {
+			v.problem("%s: unsupported algorithm '%s'", name, algorithm)
+			continue
+		}
+		listed := v.checkManifest(files, name, algorithm, tag)
+		if tag {
+			continue
+		}
+		payloadManifests++
+		for _, filePath := range names {
+			if inPayload(filePath) && !listed[filePath] {
+				v.problem("%s is not listed in %s", filePath, name)
+			}
+		}
+	}
+	if payloadManifests == 0 {
+		v.problem("no payload manifest found")
+	}
+
+	var octets int64
+	for _, name := range names {
+		file := files[name]
+		if !inPayload(name) {
+			bag.tags[name] = file.content
+			continue
+		}
+		octets += file.size
+		bag.Payload = append(bag.Payload, PayloadFile{
+			Path:      strings.TrimPrefix(name, PayloadDir+"/"),
+			Size:      file.size,
+			Checksums: file.sums,
+		})
+	}
+	if oxum := bag.Info.Get("Payload-Oxum"); oxum != "" {
+		want := strconv.FormatInt(octets, 10) + "." + strconv.Itoa(len(bag.Payload))
+		if oxum != want {
+			v.problem("Payload-Oxum is %s, the payload holds %s", oxum, want)
+		}
+	}
+
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	return bag, nil
+}
+
+// checkManifest verifies the files listed in a manifest and returns their paths
+func (v *Validator) checkManifest(files map[string]*bagFile, name, algorithm string, tag bool) map[string]bool {
+	manifest := files[name]
+	if manifest.content == nil {
+		v.problem("%s is too large", name)
+		return nil
+	}
+	listed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(manifest.content))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTagFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		i := strings.IndexAny(text, " \t")
+		if i < 0 {
+			v.problem("%s line %d: expected a checksum and a path", name, line)
+			continue
+		}
+		checksum, filePath := text[:i], decodePath(strings.TrimLeft(text[i:], " \t"))
+		filePath = strings.TrimPrefix(filePath, "./")
+		if filePath == "" || path.IsAbs(filePath) || path.Clean(filePath) != filePath || filePath == ".." || strings.HasPrefix(filePath, "../") {
+			v.problem("%s line %d: invalid path '%s'", name, line, filePath)
+			continue
+		}
+		if inPayload(filePath) == tag {
+			where := "outside " + PayloadDir + "/"
+			if tag {
+				where = "a payload file"
+			}
+			v.problem("%s line %d: %s is %s", name, line, filePath, where)
+			continue
+		}
+		if listed[filePath] {
+			v.problem("%s line %d: %s listed twice", name, line, filePath)
+			continue
+		}
+		listed[filePath] = true
+
+		file, ok := files[filePath]
+		switch {
+		case !ok:
+			v.problem("%s lists %s, which is missing", name, filePath)
+		case !strings.EqualFold(file.sums[algorithm], checksum):
+			v.problem("%s: %s checksum mismatch", filePath, algorithm)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		v.problem("%s: %v", name, err)
+	}
+	return listed
+}
+
+// root returns the directory holding bagit.txt: the top, or the only top-level directory of an archive
+func (v *Validator) root() (string, bool) {
+	if _, ok := v.files[DeclarationFile]; ok {
+		return "", true
+	}
+	var root string
+	for name := range v.files {
+		dir, _, nested := strings.Cut(name, "/")
+		if !nested || (root != "" && dir != root) {
+			return "", false
+		}
+		root = dir
+	}
+	if _, ok := v.files[root+"/"+DeclarationFile]; !ok || root == "" {
+		return "", false
+	}
+	return root + "/", true
+}
+
+func (v *Validator) result() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	err := &ValidationError{Problems: v.problems}
+	if len(err.Problems) > maxProblems {
+		err.Problems, err.Omitted = err.Problems[:maxProblems], len(err.Problems)-maxProblems
+	}
+	return err
+}
+
+// ValidateDir validates the bag in a directory
+func ValidateDir(dir string) (*Bag, error) {
+	v := NewValidator()
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case entry.IsDir():
+			return nil
+		case !entry.Type().IsRegular():
+			v.Reject(rel, "not a regular file")
+			return nil
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return v.Add(rel, file)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.Validate()
+}
+
+// ValidateArchive validates a bag serialized as a zip or tar(.gz) archive
+func ValidateArchive(name string) (*Bag, error) {
+	v := NewValidator()
+	err := archive.Walk(name, func(entry archive.Entry) error {
+		if entry.Dir {
+			return nil
+		}
+		if !entry.Regular {
+			v.Reject(entry.Path, "not a regular file")
+			return nil
+		}
+		content, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		return v.Add(entry.Path, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.Validate()
+}
+
+// inPayload tells whether a path relative to the root of the bag is in the payload directory
+func inPayload(name string) bool {
+	return strings.HasPrefix(name, PayloadDir+"/")
+}
+
+// mayBePayload tells whether a path, relative to the root of the bag or to the top-level directory above it,
+// may be in the payload directory; the content of the other files is kept as they may be tag files
+func mayBePayload(name string) bool {
+	_, rest, nested := strings.Cut(name, "/")
+	return inPayload(name) || (nested && inPayload(rest))
+}
+
+// parseManifestName recognizes manifest-<algorithm>.txt and tagmanifest-<algorithm>.txt at the root of the bag
+func parseManifestName(name string) (algorithm string, tag bool, ok bool) {
+	if strings.Contains(name, "/") || !strings.HasSuffix(name, ".txt") {
+		return "", false, false
+	}
+	name = strings.TrimSuffix(name, ".txt")
+	if algorithm, ok = strings.CutPrefix(name, "tagmanifest-"); ok {
+		return algorithm, true, algorithm != ""
+	}
+	algorithm, ok = strings.CutPrefix(name, "manifest-")
+	return algorithm, false, ok && algorithm != ""
+}
+
+// parseFields reads the "Label: Value" lines of bagit.txt or bag-info.txt, lines starting with a space or a
+// tab continuing the value of the previous one
+func parseFields(content []byte) Info {
+	var info Info
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	for _, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(info) > 0 {
+			info[len(info)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		if field, err := ParseInfoField(line); err == nil {
+			info = append(info, field)
+		}
+	}
+	return info
+}
+
+// limitedBuffer keeps the first bytes written to it, up to limit, and drops the rest
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit + 1 - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,162 @@
+package bagit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// manifest lists the files with their SHA-256, sorted by path
+func manifest(files map[string]string) string {
+	paths := make([]string, 0, len(files))
+	for name := range files {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	var lines strings.Builder
+	for _, name := range paths {
+		fmt.Fprintf(&lines, "%s  %s\n", sha256Hex(files[name]), name)
+	}
+	return lines.String()
+}
+
+// validBag returns the files of a bag holding two payload files, with its manifests and tag manifest
+func validBag() map[string]string {
+	payload := map[string]string{
+		"data/minutes.txt":        "minutes of the board\n",
+		"data/reports/budget.csv": "year,amount\n2024,100\n",
+	}
+	files := map[string]string{
+		DeclarationFile:       "BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n",
+		"manifest-sha256.txt": manifest(payload),
+		InfoFile:              "Source-Organization: Archives\nPayload-Oxum: 42.2\n",
+	}
+	files["tagmanifest-sha256.txt"] = manifest(files)
+	for name, content := range payload {
+		files[name] = content
+	}
+	return files
+}
+
+func writeBag(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestValidateDir(t *testing.T) {
+	bag, err := ValidateDir(writeBag(t, validBag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bag.Version != "1.0" || bag.Root != "" || bag.Info.Get("source-organization") != "Archives" {
+		t.Fatalf("bag %+v", bag)
+	}
+	if len(bag.Payload) != 2 || bag.Payload[0].Path != "minutes.txt" || bag.Payload[1].Path != "reports/budget.csv" {
+		t.Fatalf("payload %+v", bag.Payload)
+	}
+	if bag.Size() != 42 || bag.Payload[0].Checksums[SHA256] != sha256Hex("minutes of the board\n") {
+		t.Fatalf("payload of %d bytes, checksums %v", bag.Size(), bag.Payload[0].Checksums)
+	}
+	if content, ok := bag.TagFile(InfoFile); !ok || !strings.Contains(string(content), "Payload-Oxum") {
+		t.Fatalf("bag-info.txt %q", content)
+	}
+}
+
+func TestValidateDirRejectsInvalidBags(t *testing.T) {
+	tests := []struct {
+		name  string
+		alter func(files map[string]string)
+		want  []string // problems expected among those reported
+	}{
+		{"payload checksum mismatch", func(files map[string]string) {
+			files["data/minutes.txt"] = "minutes of the BOARD\n"
+		}, []string{"data/minutes.txt: sha256 checksum mismatch"}},
+		{"missing payload file", func(files map[string]string) {
+			delete(files, "data/reports/budget.csv")
+		}, []string{"manifest-sha256.txt lists data/reports/budget.csv, which is missing", "Payload-Oxum is 42.2, the payload holds 21.1"}},
+		{"extra payload file", func(files map[string]string) {
+			files["data/notes.txt"] = "not listed"
+		}, []string{"data/notes.txt is not listed in manifest-sha256.txt"}},
+		{"tag file changed after its tag manifest", func(files map[string]string) {
+			files[InfoFile] += "Contact-Name: Someone\n"
+		}, []string{"bag-info.txt: sha256 checksum mismatch"}},
+		{"tag manifest listing a payload file", func(files map[string]string) {
+			files["tagmanifest-sha256.txt"] += sha256Hex(files["data/minutes.txt"]) + "  data/minutes.txt\n"
+		}, []string{"tagmanifest-sha256.txt line 4: data/minutes.txt is a payload file"}},
+		{"tag manifest listing a missing file", func(files map[string]string) {
+			files["tagmanifest-sha256.txt"] += sha256Hex("") + "  metadata/mets.xml\n"
+		}, []string{"tagmanifest-sha256.txt lists metadata/mets.xml, which is missing"}},
+		{"path escaping the bag", func(files map[string]string) {
+			files["manifest-sha256.txt"] += sha256Hex("") + "  data/../../etc/passwd\n"
+		}, []string{"manifest-sha256.txt line 3: invalid path 'data/../../etc/passwd'"}},
+		{"missing bagit.txt", func(files map[string]string) {
+			delete(files, DeclarationFile)
+		}, []string{"bagit.txt not found at the top of the bag"}},
+		{"unsupported version", func(files map[string]string) {
+			files[DeclarationFile] = "BagIt-Version: 2.0\nTag-File-Character-Encoding: UTF-8\n"
+			delete(files, "tagmanifest-sha256.txt")
+		}, []string{"bagit.txt: unsupported BagIt-Version '2.0'"}},
+		{"no payload manifest", func(files map[string]string) {
+			delete(files, "manifest-sha256.txt")
+			delete(files, "tagmanifest-sha256.txt")
+		}, []string{"no payload manifest found"}},
+		{"fetch.txt", func(files map[string]string) {
+			files[FetchFile] = "https://example.org/file 10 data/remote.txt\n"
+		}, []string{"fetch.txt is not supported, the bag must hold all its payload"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := validBag()
+			tt.alter(files)
+			_, err := ValidateDir(writeBag(t, files))
+			if !errors.Is(err, ErrInvalidBag) {
+				t.Fatalf("got %v, want ErrInvalidBag", err)
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("got %T, want a *ValidationError", err)
+			}
+			for _, want := range tt.want {
+				found := false
+				for _, problem := range invalid.Problems {
+					found = found || strings.HasPrefix(problem, want)
+				}
+				if !found {
+					t.Errorf("problem %q not reported in %q", want, invalid.Problems)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := &ValidationError{Problems: make([]string, 12), Omitted: 3}
+	for i := range err.Problems {
+		err.Problems[i] = fmt.Sprintf("problem %d", i+1)
+	}
+	message := err.Error()
+	if !strings.HasPrefix(message, "invalid bag: problem 1; ") || !strings.HasSuffix(message, "problem 10 (and 5 more problems)") {
+		t.Fatalf("message %q", message)
+	}
+}
@@ -0,0 +1,144 @@
+package bagit
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer writes a bag as a zip archive, under a top-level directory named after the bag. The payload is
+// streamed and its checksums computed as it is written, the manifests and bag-info.txt come last.
+type Writer struct {
+	zw       *zip.Writer
+	name     string
+	payload  map[string]Checksums // by path from the root of the bag
+	tags     map[string]Checksums
+	octets   int64
+	modified time.Time
+}
+
+// NewWriter starts a bag named name on w
+func NewWriter(w io.Writer, name string) *Writer {
+	return &Writer{
+		zw:       zip.NewWriter(w),
+		name:     name,
+		payload:  make(map[string]Checksums),
+		tags:     make(map[string]Checksums),
+		modified: time.Now(),
+	}
+}
+
+// AddFile adds a file of the payload, at a slash-separated path relative to data/, and returns its checksums
+func (bw *Writer) AddFile(filePath string, modified time.Time, r io.Reader) (Checksums, error) {
+	entryPath := path.Join(PayloadDir, filePath)
+	if _, exists := bw.payload[entryPath]; exists {
+		return nil, fmt.Errorf("duplicate payload file %s", filePath)
+	}
+	sums, n, err := bw.write(entryPath, modified, r)
+	if err != nil {
+		return nil, err
+	}
+	bw.payload[entryPath] = sums
+	bw.octets += n
+	return sums, nil
+}
+
+// AddTagFile adds a tag file, at a slash-separated path relative to the root of the bag, listed in the tag
+// manifests
+func (bw *Writer) AddTagFile(filePath string, content []byte) error {
+	if filePath == PayloadDir || strings.HasPrefix(filePath, PayloadDir+"/") {
+		return fmt.Errorf("tag file %s cannot be in the payload directory", filePath)
+	}
+	sums, _, err := bw.write(filePath, bw.modified, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	bw.tags[filePath] = sums
+	return nil
+}
+
+// Close writes bagit.txt, the payload manifests, bag-info.txt with the fields of info and those computed
+// (Payload-Oxum, Bag-Size and, unless given, Bagging-Date), the tag manifests, and ends the archive
+func (bw *Writer) Close(info Info) error {
+	if err := bw.AddTagFile(DeclarationFile, []byte("BagIt-Version: "+Version+"\nTag-File-Character-Encoding: UTF-8\n")); err != nil {
+		return err
+	}
+	for _, algorithm := range writtenAlgorithms {
+		if err := bw.AddTagFile(manifestName(algorithm, false), formatManifest(bw.payload, algorithm)); err != nil {
+			return err
+		}
+	}
+
+	info = append(Info{}, info...)
+	if info.Get("Bagging-Date") == "" {
+		info.Set("Bagging-Date", bw.modified.Format("2006-01-02"))
+	}
+	info.Set("Payload-Oxum", strconv.FormatInt(bw.octets, 10)+"."+strconv.Itoa(len(bw.payload)))
+	info.Set("Bag-Size", formatSize(bw.octets))
+	var buf bytes.Buffer
+	for _, field := range info {
+		// Line breaks of a value become continuation lines
+		value := strings.ReplaceAll(strings.ReplaceAll(field.Value, "\r\n", "\n"), "\n", "\n  ")
+		fmt.Fprintf(&buf, "%s: %s\n", field.Label, value)
+	}
+	if err := bw.AddTagFile(InfoFile, buf.Bytes()); err != nil {
+		return err
+	}
+
+	// The tag manifests list every tag file written so far, themselves excepted
+	tags := make(map[string]Checksums, len(bw.tags))
+	for entryPath, sums := range bw.tags {
+		tags[entryPath] = sums
+	}
+	for _, algorithm := range writtenAlgorithms {
+		if _, _, err := bw.write(manifestName(algorithm, true), bw.modified, bytes.NewReader(formatManifest(tags, algorithm))); err != nil {
+			return err
+		}
+	}
+	return bw.zw.Close()
+}
+
+// write adds a file to the archive under the directory of the bag, hashing it with the written algorithms
+func (bw *Writer) write(entryPath string, modified time.Time, r io.Reader) (Checksums, int64, error) {
+	file, err := bw.zw.CreateHeader(&zip.FileHeader{Name: bw.name + "/" + entryPath, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return nil, 0, err
+	}
+	hashes := make(map[string]hash.Hash, len(writtenAlgorithms))
+	writers := []io.Writer{file}
+	for _, algorithm := range writtenAlgorithms {
+		hashes[algorithm] = algorithms[algorithm]()
+		writers = append(writers, hashes[algorithm])
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return nil, n, err
+	}
+	sums := make(Checksums, len(hashes))
+	for algorithm, h := range hashes {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, n, nil
+}
+
+// formatManifest lists files and their checksum, sorted by path
+func formatManifest(files map[string]Checksums, algorithm string) []byte {
+	paths := make([]string, 0, len(files))
+	for entryPath := range files {
+		paths = append(paths, entryPath)
+	}
+	sort.Strings(paths)
+	var buf bytes.Buffer
+	for _, entryPath := range paths {
+		fmt.Fprintf(&buf, "%s  %s\n", files[entryPath][algorithm], encodePath(entryPath))
+	}
+	return buf.Bytes()
+}
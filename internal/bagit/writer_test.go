@@ -0,0 +1,87 @@
+package bagit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterOutputValidates(t *testing.T) {
+	var out bytes.Buffer
+	bw := NewWriter(&out, "export-1")
+	modified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"minutes.txt":           "minutes of the board\n",
+		"reports/budget.csv":    "year,amount\n2024,100\n",
+		"100% done\nreport.txt": "escaped name",
+	}
+	for name, content := range files {
+		sums, err := bw.AddFile(name, modified, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sums[SHA256] != sha256Hex(content) || sums[SHA512] == "" {
+			t.Fatalf("%s: checksums %v", name, sums)
+		}
+	}
+	if _, err := bw.AddFile("minutes.txt", modified, strings.NewReader("again")); err == nil {
+		t.Fatal("payload file added twice")
+	}
+	if err := bw.AddTagFile("data/manifest.json", []byte("[]")); err == nil {
+		t.Fatal("tag file added to the payload")
+	}
+	if err := bw.AddTagFile("metadata/manifest.json", []byte("[]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Close(Info{{Label: "Source-Organization", Value: "Archives"}, {Label: "External-Description", Value: "two\nlines"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "export-1.zip")
+	if err := os.WriteFile(archive, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bag, err := ValidateArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bag.Root != "export-1/" || bag.Version != Version || len(bag.Payload) != len(files) {
+		t.Fatalf("bag under %q, version %s, %d payload files", bag.Root, bag.Version, len(bag.Payload))
+	}
+	for _, file := range bag.Payload {
+		if file.Checksums[SHA256] != sha256Hex(files[file.Path]) {
+			t.Errorf("%s: checksum %s", file.Path, file.Checksums[SHA256])
+		}
+	}
+	for label, want := range map[string]string{
+		"Source-Organization":  "Archives",
+		"External-Description": "two lines",
+		"Payload-Oxum":         "54.3",
+		"Bag-Size":             "54 B",
+		"Bagging-Date":         time.Now().Format("2006-01-02"),
+	} {
+		if got := bag.Info.Get(label); got != want {
+			t.Errorf("%s: %q, want %q", label, got, want)
+		}
+	}
+	if content, ok := bag.TagFile("metadata/manifest.json"); !ok || string(content) != "[]\n" {
+		t.Errorf("metadata/manifest.json %q", content)
+	}
+	for _, name := range []string{"manifest-sha512.txt", "tagmanifest-sha256.txt", "tagmanifest-sha512.txt"} {
+		if _, ok := bag.TagFile(name); !ok {
+			t.Errorf("%s not written", name)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KB", 1536: "1.5 KB", 5 << 30: "5.0 GB"}
+	for n, want := range tests {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,631 @@
+package config
+
+import (
+	"archiv-system/internal/filetype"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the application configuration. Values come from the defaults, then the YAML file given by
+// -config (or CONFIG_FILE), then the environment variables named in the env tags, then the command line flags.
+type Config struct {
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Storage      StorageConfig      `yaml:"storage"`
+	Encryption   EncryptionConfig   `yaml:"encryption"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	Password     PasswordConfig     `yaml:"password"`
+	Login        LoginConfig        `yaml:"login"`
+	LDAP         LDAPConfig         `yaml:"ldap"`
+	Authz        AuthzConfig        `yaml:"authz"`
+	Notifier     NotifierConfig     `yaml:"notifier"`
+	Upload       UploadConfig       `yaml:"upload"`
+	Fixity       FixityConfig       `yaml:"fixity"`
+	Preview      PreviewConfig      `yaml:"preview"`
+	Scan         ScanConfig         `yaml:"scan"`
+	Import       ImportConfig       `yaml:"import"`
+	Export       ExportConfig       `yaml:"export"`
+	Preservation PreservationConfig `yaml:"preservation"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	Log          LogConfig          `yaml:"log"`
+	Admin        AdminConfig        `yaml:"admin"`
+}
+
+type ServerConfig struct {
+	Address string `yaml:"address" env:"LISTEN_ADDR"`
+	// Listener of the Prometheus metrics, apart from the API for the metrics cover every organization; disabled when empty
+	MetricsAddress string `yaml:"metrics_address" env:"METRICS_ADDR"`
+	TLSCertFile    string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"` // TLS is enabled when both files are set
+	TLSKeyFile     string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	// Time given to in-flight requests and background workers to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// Addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header gives the client address;
+	// empty trusts none, the client address being the peer of the connection
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// TLSEnabled reports whether the server must serve HTTPS
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+// Database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // single file, for single-node deployments and tests
+)
+
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver" env:"DB_DRIVER"` // postgres or sqlite
+	Path            string        `yaml:"path" env:"DB_PATH"`     // database file of the sqlite driver, ":memory:" for a throwaway database
+	URL             string        `yaml:"url" env:"DATABASE_URL"` // full DSN, overrides the fields below
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"sslmode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	// Apply pending schema migrations at startup; when disabled, run the migrate command before starting
+	AutoMigrate bool `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+// DSN returns the connection string, including the password
+func (d DatabaseConfig) DSN() string {
+	if d.Driver == DriverSQLite {
+		return d.Path
+	}
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode)
+}
+
+// Redacted returns a description of the connection safe to log, without password
+func (d DatabaseConfig) Redacted() string {
+	if d.Driver == DriverSQLite {
+		return "sqlite " + d.Path
+	}
+	if d.URL != "" {
+		if u, err := url.Parse(d.URL); err == nil && u.Scheme != "" {
+			if u.User != nil {
+				u.User = url.User(u.User.Username())
+			}
+			return u.String()
+		}
+		return "(database url)"
+	}
+	return fmt.Sprintf("host=%s user=%s dbname=%s port=%d sslmode=%s", d.Host, d.User, d.Name, d.Port, d.SSLMode)
+}
+
+type StorageConfig struct {
+	Backend string `yaml:"backend" env:"STORAGE_BACKEND"` // only "local" for now
+	Path    string `yaml:"path" env:"STORAGE_PATH"`       // root directory of the local backend
+}
+
+// Key providers holding the master keys of the encryption at rest
+const (
+	KeyProviderLocal = "local" // keyfile on the server
+)
+
+// EncryptionConfig drives the encryption at rest of the stored files
+type EncryptionConfig struct {
+	Enabled  bool   `yaml:"enabled" env:"ENCRYPTION_ENABLED"`   // encrypt new files; encrypted files stay readable while a keyfile is set
+	Provider string `yaml:"provider" env:"ENCRYPTION_PROVIDER"` // only "local" for now
+	KeyFile  string `yaml:"key_file" env:"ENCRYPTION_KEY_FILE"` // master keys of the local provider, the last one wraps new data keys
+}
+
+type JWTConfig struct {
+	Secret     string        `yaml:"secret" env:"JWT_SECRET"`
+	Expiration time.Duration `yaml:"expiration" env:"JWT_EXPIRATION"`
+}
+
+// PasswordConfig is the policy new passwords must follow, and the self-service reset
+type PasswordConfig struct {
+	MinLength int `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"` // characters, at most 72 bytes being hashed
+	History   int `yaml:"history" env:"PASSWORD_HISTORY"`       // previous passwords that cannot be reused
+	// Additional list of breached passwords, one per line, refused on top of the built-in list
+	BreachedFile string `yaml:"breached_file" env:"PASSWORD_BREACHED_FILE"`
+	// Front-end page the reset link points to, {token} being replaced by the reset token; the raw token is sent when empty
+	ResetURL string `yaml:"reset_url" env:"PASSWORD_RESET_URL"`
+}
+
+// bcryptMaxLength is the number of bytes bcrypt hashes, longer passwords being truncated
+const bcryptMaxLength = 72
+
+// LoginConfig is the brute-force protection of the login: accounts and client addresses are locked after
+// too many failures, for LockoutBase doubled on every further failure up to LockoutMax
+type LoginConfig struct {
+	MaxAttempts   int           `yaml:"max_attempts" env:"LOGIN_MAX_ATTEMPTS"`       // failures of an account before it is locked
+	IPMaxAttempts int           `yaml:"ip_max_attempts" env:"LOGIN_IP_MAX_ATTEMPTS"` // failures from a client address before it is locked
+	LockoutBase   time.Duration `yaml:"lockout_base" env:"LOGIN_LOCKOUT_BASE"`
+	LockoutMax    time.Duration `yaml:"lockout_max" env:"LOGIN_LOCKOUT_MAX"`
+	// Failures from an address older than this are forgotten
+	FailureWindow time.Duration `yaml:"failure_window" env:"LOGIN_FAILURE_WINDOW"`
+}
+
+// LDAPConfig drives the LDAP / Active Directory authentication, enabled when URL is set
+type LDAPConfig struct {
+	URL                string `yaml:"url" env:"LDAP_URL"`                                   // e.g. ldaps://dc.example.org:636
+	StartTLS           bool   `yaml:"start_tls" env:"LDAP_START_TLS"`                       // upgrade a plain ldap:// connection
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"LDAP_INSECURE_SKIP_VERIFY"` // test servers only
+	BindDN             string `yaml:"bind_dn" env:"LDAP_BIND_DN"`                           // service account of the searches, anonymous when empty
+	BindPassword       string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	BaseDN             string `yaml:"base_dn" env:"LDAP_BASE_DN"`             // base of the user searches
+	UserFilter         string `yaml:"user_filter" env:"LDAP_USER_FILTER"`     // %s is replaced by the escaped username
+	GroupBaseDN        string `yaml:"group_base_dn" env:"LDAP_GROUP_BASE_DN"` // base of the group searches, BaseDN when empty
+	GroupFilter        string `yaml:"group_filter" env:"LDAP_GROUP_FILTER"`   // %s is replaced by the escaped user DN
+	// Roles of the members of directory groups, as "group:role", the group being its cn or DN; the first match wins
+	GroupRoles   []string      `yaml:"group_roles" env:"LDAP_GROUP_ROLES"`
+	DefaultRole  string        `yaml:"default_role" env:"LDAP_DEFAULT_ROLE"` // role of the users of no mapped group, denied when empty
+	Organization string        `yaml:"organization" env:"LDAP_ORGANIZATION"` // slug of the organization of the directory users
+	SyncInterval time.Duration `yaml:"sync_interval" env:"LDAP_SYNC_INTERVAL"`
+}
+
+// Enabled reports whether users are authenticated against the directory
+func (l LDAPConfig) Enabled() bool {
+	return l.URL != ""
+}
+
+// AuthzConfig drives the permission checks
+type AuthzConfig struct {
+	// Lifetime of the cached role permissions and memberships, after which changes made by another instance apply
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"AUTHZ_CACHE_TTL"`
+}
+
+// Notifiers delivering the messages to users
+const (
+	NotifierLog  = "log"  // recipient and subject in the server log, the message is not delivered
+	NotifierSMTP = "smtp" // e-mail
+)
+
+// NotifierConfig drives the delivery of password reset links and alerts
+type NotifierConfig struct {
+	Type         string `yaml:"type" env:"NOTIFIER"` // log or smtp
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"` // no authentication when empty
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	SMTPFrom     string `yaml:"smtp_from" env:"SMTP_FROM"`
+}
+
+type UploadConfig struct {
+	MaxSizeMB int64 `yaml:"max_size_mb" env:"UPLOAD_MAX_SIZE_MB"`
+	// Content types accepted, as detected from the bytes, e.g. ["application/pdf", "image/*"]; empty accepts any type.
+	// Roles and folders can restrict them further.
+	AllowedTypes []string `yaml:"allowed_types" env:"UPLOAD_ALLOWED_TYPES"`
+	// Lower size limits by content type pattern, the most specific pattern applying, e.g. {"video/*": 50}
+	MaxSizeMBByType map[string]int64 `yaml:"max_size_mb_by_type"`
+}
+
+// MaxSize returns the upload limit in bytes
+func (u UploadConfig) MaxSize() int64 {
+	return u.MaxSizeMB << 20
+}
+
+// FixityConfig drives the periodic verification of the stored files against their checksums
+type FixityConfig struct {
+	Enabled bool `yaml:"enabled" env:"FIXITY_ENABLED"`
+	// A file is verified again once its last check is older than the interval
+	Interval        time.Duration `yaml:"interval" env:"FIXITY_INTERVAL"`
+	RateMBPerSecond int64         `yaml:"rate_mb_per_second" env:"FIXITY_RATE_MB_PER_SECOND"` // read rate limit, 0 for unlimited
+	SHA512          bool          `yaml:"sha512" env:"FIXITY_SHA512"`                         // also record a SHA-512 checksum at upload
+	AlertTo         string        `yaml:"alert_to" env:"FIXITY_ALERT_TO"`                     // e-mail address alerted on failures, logged only when empty
+}
+
+// RateLimit returns the read rate limit in bytes per second, 0 when unlimited
+func (f FixityConfig) RateLimit() int64 {
+	return f.RateMBPerSecond << 20
+}
+
+// PreviewConfig drives the thumbnails generated in the background after upload
+type PreviewConfig struct {
+	Enabled   bool `yaml:"enabled" env:"PREVIEW_ENABLED"`
+	Workers   int  `yaml:"workers" env:"PREVIEW_WORKERS"`       // concurrent generations
+	QueueSize int  `yaml:"queue_size" env:"PREVIEW_QUEUE_SIZE"` // pending generations, new uploads get no preview when full
+	// Command rendering the first page of PDFs, poppler's pdftoppm or a compatible program; PDFs get no preview when empty
+	PDFRenderer string        `yaml:"pdf_renderer" env:"PREVIEW_PDF_RENDERER"`
+	Timeout     time.Duration `yaml:"timeout" env:"PREVIEW_TIMEOUT"` // limit of one generation
+}
+
+// What to do with an uploaded file found infected
+const (
+	OnInfectedReject = "reject" // delete the file and its document
+	OnInfectedHold   = "hold"   // keep the file in quarantine for an administrator to review
+)
+
+// ScanConfig drives the malware scanning of the uploaded files, which stay in quarantine until scanned
+type ScanConfig struct {
+	Enabled    bool          `yaml:"enabled" env:"SCAN_ENABLED"`
+	Address    string        `yaml:"address" env:"SCAN_ADDRESS"`         // clamd, "tcp://host:port" or "unix:///path/to/clamd.sock"
+	Timeout    time.Duration `yaml:"timeout" env:"SCAN_TIMEOUT"`         // limit of one scan
+	OnInfected string        `yaml:"on_infected" env:"SCAN_ON_INFECTED"` // reject or hold
+	Workers    int           `yaml:"workers" env:"SCAN_WORKERS"`         // concurrent scans
+	QueueSize  int           `yaml:"queue_size" env:"SCAN_QUEUE_SIZE"`   // pending scans, new uploads stay in quarantine when full
+}
+
+// ImportConfig drives the bulk imports of zip and tar archives, run in the background
+type ImportConfig struct {
+	Enabled    bool  `yaml:"enabled" env:"IMPORT_ENABLED"`
+	MaxSizeMB  int64 `yaml:"max_size_mb" env:"IMPORT_MAX_SIZE_MB"` // size of an archive; each file is limited as an upload
+	MaxEntries int   `yaml:"max_entries" env:"IMPORT_MAX_ENTRIES"` // files of an archive
+	Workers    int   `yaml:"workers" env:"IMPORT_WORKERS"`         // concurrent imports
+	QueueSize  int   `yaml:"queue_size" env:"IMPORT_QUEUE_SIZE"`   // pending imports, new ones are refused when full
+	// Directory holding the archives, unencrypted, until their import ends; the system temporary directory when empty
+	TempDir string `yaml:"temp_dir" env:"IMPORT_TEMP_DIR"`
+}
+
+// MaxSize returns the archive size limit in bytes
+func (i ImportConfig) MaxSize() int64 {
+	return i.MaxSizeMB << 20
+}
+
+// ExportConfig drives the bulk exports of documents as zip archives. Small exports are streamed in the response,
+// larger ones are built in the background and kept for a while in the storage.
+type ExportConfig struct {
+	Enabled         bool          `yaml:"enabled" env:"EXPORT_ENABLED"`
+	MaxDocuments    int           `yaml:"max_documents" env:"EXPORT_MAX_DOCUMENTS"`       // documents of an export
+	StreamDocuments int           `yaml:"stream_documents" env:"EXPORT_STREAM_DOCUMENTS"` // more documents are exported in the background
+	StreamSizeMB    int64         `yaml:"stream_size_mb" env:"EXPORT_STREAM_SIZE_MB"`     // as are exports of more data
+	Workers         int           `yaml:"workers" env:"EXPORT_WORKERS"`                   // concurrent background exports
+	QueueSize       int           `yaml:"queue_size" env:"EXPORT_QUEUE_SIZE"`             // pending exports, new ones are refused when full
+	Retention       time.Duration `yaml:"retention" env:"EXPORT_RETENTION"`               // how long a background export can be downloaded
+	// Fields added to the bag-info.txt of the BagIt exports, as "Label: Value", e.g. "Contact-Email: archives@example.org"
+	BagInfo []string `yaml:"bag_info" env:"EXPORT_BAG_INFO"`
+}
+
+// StreamSize returns the size above which an export runs in the background, in bytes
+func (e ExportConfig) StreamSize() int64 {
+	return e.StreamSizeMB << 20
+}
+
+// PreservationConfig drives the archival information packages (AIP): BagIt bags of documents and of all their
+// versions, described by METS and PREMIS metadata, built in the background and kept in the storage
+type PreservationConfig struct {
+	Enabled      bool `yaml:"enabled" env:"PRESERVATION_ENABLED"`
+	OnIngest     bool `yaml:"on_ingest" env:"PRESERVATION_ON_INGEST"`         // package the documents of each completed import
+	MaxDocuments int  `yaml:"max_documents" env:"PRESERVATION_MAX_DOCUMENTS"` // documents asked for in a package
+	Workers      int  `yaml:"workers" env:"PRESERVATION_WORKERS"`             // packages built at once
+	QueueSize    int  `yaml:"queue_size" env:"PRESERVATION_QUEUE_SIZE"`       // pending packages, new ones are refused when full
+	// How long a package waits for the malware scans of its documents, those still in quarantine are left out
+	ScanWait time.Duration `yaml:"scan_wait" env:"PRESERVATION_SCAN_WAIT"`
+}
+
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" env:"TRACING_ENABLED"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_OTLP_ENDPOINT"` // OTLP/HTTP collector, host:port
+	Insecure    bool    `yaml:"insecure" env:"TRACING_OTLP_INSECURE"` // plain HTTP to the collector
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"` // share of new traces recorded, 0 to 1
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`   // debug, info, warn or error
+	Format string `yaml:"format" env:"LOG_FORMAT"` // json or text
+}
+
+// AdminConfig is the administrator created on the first start, when the database has none. The account must
+// change its password at first login.
+type AdminConfig struct {
+	Username string `yaml:"username" env:"ADMIN_USERNAME"`
+	Password string `yaml:"password" env:"ADMIN_PASSWORD"` // required to create the account, unused afterwards
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Address: ":8080", MetricsAddress: ":9090", ShutdownTimeout: 30 * time.Second},
+		Database: DatabaseConfig{
+			Driver:          DriverPostgres,
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Name:            "archiv_db",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			AutoMigrate:     true,
+		},
+		LDAP: LDAPConfig{
+			UserFilter:   "(&(objectClass=person)(uid=%s))",
+			GroupFilter:  "(&(objectClass=groupOfNames)(member=%s))",
+			Organization: "default",
+			SyncInterval: time.Hour,
+		},
+		Storage:      StorageConfig{Backend: "local", Path: "uploads"},
+		Encryption:   EncryptionConfig{Provider: KeyProviderLocal},
+		JWT:          JWTConfig{Expiration: 24 * time.Hour},
+		Password:     PasswordConfig{MinLength: 8, History: 5},
+		Login:        LoginConfig{MaxAttempts: 5, IPMaxAttempts: 20, LockoutBase: time.Minute, LockoutMax: time.Hour, FailureWindow: 15 * time.Minute},
+		Authz:        AuthzConfig{CacheTTL: 5 * time.Minute},
+		Notifier:     NotifierConfig{Type: NotifierLog, SMTPPort: 587},
+		Upload:       UploadConfig{MaxSizeMB: 100},
+		Fixity:       FixityConfig{Enabled: true, Interval: 24 * time.Hour, RateMBPerSecond: 20},
+		Preview:      PreviewConfig{Enabled: true, Workers: 2, QueueSize: 100, Timeout: time.Minute},
+		Scan:         ScanConfig{Address: "tcp://localhost:3310", Timeout: 2 * time.Minute, OnInfected: OnInfectedReject, Workers: 2, QueueSize: 100},
+		Import:       ImportConfig{Enabled: true, MaxSizeMB: 2048, MaxEntries: 10000, Workers: 1, QueueSize: 10},
+		Export:       ExportConfig{Enabled: true, MaxDocuments: 50000, StreamDocuments: 500, StreamSizeMB: 1024, Workers: 1, QueueSize: 10, Retention: 24 * time.Hour},
+		Preservation: PreservationConfig{Enabled: true, OnIngest: true, MaxDocuments: 10000, Workers: 1, QueueSize: 100, ScanWait: time.Hour},
+		Tracing:      TracingConfig{Endpoint: "localhost:4318", ServiceName: "archiv-system", SampleRatio: 1},
+		Log:          LogConfig{Level: "info", Format: "json"},
+		Admin:        AdminConfig{Username: "admin"},
+	}
+}
+
+// Load builds the configuration from the command line arguments (without the program name)
+func Load(args []string) (*Config, error) {
+	cfg, _, err := LoadCommand("archiv-system", args)
+	return cfg, err
+}
+
+// LoadCommand is Load for the tools taking positional arguments after the flags, which it returns
+func LoadCommand(name string, args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path of the YAML configuration file")
+	address := fs.String("listen", "", "listen address, e.g. :8080")
+	storagePath := fs.String("storage-path", "", "root directory of the local storage")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, nil, fmt.Errorf("invalid configuration file %s: %w", *configFile, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, nil, err
+	}
+
+	if *address != "" {
+		cfg.Server.Address = *address
+	}
+	if *storagePath != "" {
+		cfg.Storage.Path = *storagePath
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// Validate checks the configuration and reports every problem at once
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Server.Address == "" {
+		problems = append(problems, "server.address is required")
+	}
+	if c.Server.MetricsAddress != "" && c.Server.MetricsAddress == c.Server.Address {
+		problems = append(problems, "server.metrics_address must differ from server.address")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		problems = append(problems, "server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problems = append(problems, fmt.Sprintf("server.trusted_proxies: '%s' is neither an IP address nor a CIDR range", proxy))
+			}
+		}
+	}
+	switch c.Database.Driver {
+	case DriverPostgres:
+		if c.Database.URL == "" && (c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "") {
+			problems = append(problems, "database.url or database.host, database.name and database.user are required")
+		}
+	case DriverSQLite:
+		if c.Database.Path == "" {
+			problems = append(problems, "database.path is required with the sqlite driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown database.driver '%s'", c.Database.Driver))
+	}
+	if c.Database.MaxOpenConns < 1 || c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.max_idle_conns must be between 0 and database.max_open_conns, which must be positive")
+	}
+	if c.Storage.Backend != "local" {
+		problems = append(problems, fmt.Sprintf("unknown storage.backend '%s'", c.Storage.Backend))
+	}
+	if c.Storage.Path == "" {
+		problems = append(problems, "storage.path is required")
+	}
+	if c.Encryption.Provider != KeyProviderLocal {
+		problems = append(problems, fmt.Sprintf("unknown encryption.provider '%s'", c.Encryption.Provider))
+	}
+	if c.Encryption.Enabled && c.Encryption.KeyFile == "" {
+		problems = append(problems, "encryption.key_file is required when encryption is enabled")
+	}
+	if len(c.JWT.Secret) < 32 {
+		problems = append(problems, "jwt.secret (JWT_SECRET) must be at least 32 characters long")
+	}
+	if c.JWT.Expiration <= 0 {
+		problems = append(problems, "jwt.expiration must be positive")
+	}
+	if c.Password.MinLength < 1 || c.Password.MinLength > bcryptMaxLength {
+		problems = append(problems, fmt.Sprintf("password.min_length must be between 1 and %d", bcryptMaxLength))
+	}
+	if c.Password.History < 0 {
+		problems = append(problems, "password.history must not be negative")
+	}
+	if c.Login.MaxAttempts < 1 || c.Login.IPMaxAttempts < 1 || c.Login.LockoutBase <= 0 ||
+		c.Login.LockoutMax < c.Login.LockoutBase || c.Login.FailureWindow <= 0 {
+		problems = append(problems, "login.max_attempts, login.ip_max_attempts, login.lockout_base and login.failure_window must be positive and login.lockout_max at least login.lockout_base")
+	}
+	if c.LDAP.Enabled() {
+		if c.LDAP.BaseDN == "" || c.LDAP.UserFilter == "" || c.LDAP.GroupFilter == "" || c.LDAP.Organization == "" {
+			problems = append(problems, "ldap.base_dn, ldap.user_filter, ldap.group_filter and ldap.organization are required when ldap.url is set")
+		}
+		if c.LDAP.SyncInterval <= 0 {
+			problems = append(problems, "ldap.sync_interval must be positive when ldap.url is set")
+		}
+	}
+	for _, mapping := range c.LDAP.GroupRoles {
+		if i := strings.LastIndex(mapping, ":"); i <= 0 || i == len(mapping)-1 {
+			problems = append(problems, fmt.Sprintf("ldap.group_roles: invalid mapping '%s', expected group:role", mapping))
+		}
+	}
+	if c.Authz.CacheTTL <= 0 {
+		problems = append(problems, "authz.cache_ttl must be positive")
+	}
+	switch c.Notifier.Type {
+	case NotifierLog:
+	case NotifierSMTP:
+		if c.Notifier.SMTPHost == "" || c.Notifier.SMTPFrom == "" || c.Notifier.SMTPPort < 1 {
+			problems = append(problems, "notifier.smtp_host, notifier.smtp_from and notifier.smtp_port are required with the smtp notifier")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown notifier.type '%s'", c.Notifier.Type))
+	}
+	if c.Upload.MaxSizeMB < 1 {
+		problems = append(problems, "upload.max_size_mb must be positive")
+	}
+	if _, err := filetype.ParsePatterns(c.Upload.AllowedTypes); err != nil {
+		problems = append(problems, "upload.allowed_types: "+err.Error())
+	}
+	for pattern, limit := range c.Upload.MaxSizeMBByType {
+		if _, err := filetype.ParsePatterns([]string{pattern}); err != nil || pattern == "" {
+			problems = append(problems, fmt.Sprintf("upload.max_size_mb_by_type: invalid pattern '%s'", pattern))
+		}
+		if limit < 1 {
+			problems = append(problems, fmt.Sprintf("upload.max_size_mb_by_type: limit of '%s' must be positive", pattern))
+		}
+	}
+	if c.Fixity.Enabled && c.Fixity.Interval <= 0 {
+		problems = append(problems, "fixity.interval must be positive when fixity checks are enabled")
+	}
+	if c.Fixity.RateMBPerSecond < 0 {
+		problems = append(problems, "fixity.rate_mb_per_second must not be negative")
+	}
+	if c.Preview.Enabled && (c.Preview.Workers < 1 || c.Preview.QueueSize < 1 || c.Preview.Timeout <= 0) {
+		problems = append(problems, "preview.workers, preview.queue_size and preview.timeout must be positive when previews are enabled")
+	}
+	if c.Scan.Enabled && (c.Scan.Address == "" || c.Scan.Workers < 1 || c.Scan.QueueSize < 1 || c.Scan.Timeout <= 0) {
+		problems = append(problems, "scan.address is required and scan.workers, scan.queue_size and scan.timeout must be positive when scanning is enabled")
+	}
+	if c.Scan.OnInfected != OnInfectedReject && c.Scan.OnInfected != OnInfectedHold {
+		problems = append(problems, fmt.Sprintf("unknown scan.on_infected '%s'", c.Scan.OnInfected))
+	}
+	if c.Import.Enabled && (c.Import.MaxSizeMB < 1 || c.Import.MaxEntries < 1 || c.Import.Workers < 1 || c.Import.QueueSize < 1) {
+		problems = append(problems, "import.max_size_mb, import.max_entries, import.workers and import.queue_size must be positive when imports are enabled")
+	}
+	if c.Export.Enabled && (c.Export.MaxDocuments < 1 || c.Export.StreamDocuments < 1 || c.Export.StreamSizeMB < 1 ||
+		c.Export.Workers < 1 || c.Export.QueueSize < 1 || c.Export.Retention <= 0) {
+		problems = append(problems, "export.max_documents, export.stream_documents, export.stream_size_mb, export.workers, export.queue_size and export.retention must be positive when exports are enabled")
+	}
+	for _, field := range c.Export.BagInfo {
+		if label, _, ok := strings.Cut(field, ":"); !ok || strings.TrimSpace(label) == "" {
+			problems = append(problems, fmt.Sprintf("export.bag_info field '%s' must look like 'Label: Value'", field))
+		}
+	}
+	if c.Preservation.Enabled && (c.Preservation.MaxDocuments < 1 || c.Preservation.Workers < 1 || c.Preservation.QueueSize < 1 || c.Preservation.ScanWait < 0) {
+		problems = append(problems, "preservation.max_documents, preservation.workers and preservation.queue_size must be positive and preservation.scan_wait cannot be negative when preservation is enabled")
+	}
+	if c.Tracing.Enabled && (c.Tracing.Endpoint == "" || c.Tracing.ServiceName == "") {
+		problems = append(problems, "tracing.endpoint and tracing.service_name are required when tracing is enabled")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown log.level '%s'", c.Log.Level))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		problems = append(problems, fmt.Sprintf("unknown log.format '%s'", c.Log.Format))
+	}
+	if c.Admin.Username == "" {
+		problems = append(problems, "admin.username is required")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// applyEnv overrides the fields having an env tag with the matching environment variables
+func applyEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(value); err != nil {
+				return err
+			}
+			continue
+		}
+		key := field.Tag.Get("env")
+		raw, ok := os.LookupEnv(key)
+		if key == "" || !ok {
+			continue
+		}
+
+		switch {
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value.SetInt(int64(d))
+		case field.Type.Kind() == reflect.String:
+			value.SetString(raw)
+		case field.Type.Kind() == reflect.Int || field.Type.Kind() == reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value.SetInt(n)
+		case field.Type.Kind() == reflect.Float64:
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value.SetFloat(f)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+			// Comma-separated list
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value.Set(reflect.ValueOf(items))
+		case field.Type.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value.SetBool(b)
+		default:
+			return fmt.Errorf("%s: unsupported type %s", key, field.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid returns the defaults completed with the settings having no default
+func valid() *Config {
+	cfg := Default()
+	cfg.JWT.Secret = strings.Repeat("s", 32)
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string // problems reported, none when empty
+	}{
+		{"defaults with a secret", func(c *Config) {}, nil},
+		{"sqlite", func(c *Config) { c.Database = DatabaseConfig{Driver: DriverSQLite, Path: ":memory:", MaxOpenConns: 1} }, nil},
+		{"postgres url", func(c *Config) { c.Database.Host, c.Database.URL = "", "postgres://archiv@db/archiv_db" }, nil},
+		{"tls pair", func(c *Config) { c.Server.TLSCertFile, c.Server.TLSKeyFile = "cert.pem", "key.pem" }, nil},
+		{"trusted proxies", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16"} }, nil},
+		{"no secret", func(c *Config) { c.JWT.Secret = "" }, []string{"jwt.secret (JWT_SECRET) must be at least 32 characters long"}},
+		{"short secret", func(c *Config) { c.JWT.Secret = strings.Repeat("s", 31) }, []string{"jwt.secret"}},
+		{"no address", func(c *Config) { c.Server.Address = "" }, []string{"server.address is required"}},
+		{"metrics on the api address", func(c *Config) { c.Server.MetricsAddress = c.Server.Address }, []string{"server.metrics_address must differ"}},
+		{"certificate without key", func(c *Config) { c.Server.TLSCertFile = "cert.pem" }, []string{"must be set together"}},
+		{"invalid proxy", func(c *Config) { c.Server.TrustedProxies = []string{"proxy.local"} }, []string{"'proxy.local' is neither an IP address nor a CIDR range"}},
+		{"unknown driver", func(c *Config) { c.Database.Driver = "mysql" }, []string{"unknown database.driver 'mysql'"}},
+		{"postgres without host", func(c *Config) { c.Database.Host = "" }, []string{"database.url or database.host"}},
+		{"sqlite without path", func(c *Config) { c.Database.Driver = DriverSQLite }, []string{"database.path is required"}},
+		{"more idle than open connections", func(c *Config) { c.Database.MaxIdleConns = 30 }, []string{"database.max_idle_conns"}},
+		{"no open connection", func(c *Config) { c.Database.MaxOpenConns, c.Database.MaxIdleConns = 0, 0 }, []string{"database.max_idle_conns"}},
+		{"unknown storage", func(c *Config) { c.Storage.Backend = "s3" }, []string{"unknown storage.backend 's3'"}},
+		{"no upload limit", func(c *Config) { c.Upload.MaxSizeMB = 0 }, []string{"upload.max_size_mb must be positive"}},
+		{"invalid type limit", func(c *Config) { c.Upload.MaxSizeMBByType = map[string]int64{"application/pdf": 0} }, []string{"limit of 'application/pdf' must be positive"}},
+		{"bad log level", func(c *Config) { c.Log.Level = "verbose" }, []string{"unknown log.level 'verbose'"}},
+		{"every problem at once", func(c *Config) {
+			c.Server.Address, c.JWT.Secret, c.Storage.Path = "", "", ""
+		}, []string{"server.address is required", "storage.path is required", "jwt.secret"}},
+	}
+	for _, tt := range tests {
+		cfg := valid()
+		tt.change(cfg)
+		err := cfg.Validate()
+		if len(tt.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: accepted", tt.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "invalid configuration: ") || strings.Count(err.Error(), "; ") != len(tt.want)-1 {
+			t.Errorf("%s: got %q, want %d problems", tt.name, err, len(tt.want))
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %q, want %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name, key, value string
+		get              func(c *Config) interface{}
+		want             interface{}
+	}{
+		{"string", "STORAGE_PATH", "/srv/archives", func(c *Config) interface{} { return c.Storage.Path }, "/srv/archives"},
+		{"int", "DB_MAX_OPEN_CONNS", "40", func(c *Config) interface{} { return c.Database.MaxOpenConns }, 40},
+		{"duration", "JWT_EXPIRATION", "90m", func(c *Config) interface{} { return c.JWT.Expiration }, 90 * time.Minute},
+		{"bool", "DB_AUTO_MIGRATE", "false", func(c *Config) interface{} { return c.Database.AutoMigrate }, false},
+		{"float", "TRACING_SAMPLE_RATIO", "0.25", func(c *Config) interface{} { return c.Tracing.SampleRatio }, 0.25},
+		{"list", "TRUSTED_PROXIES", " 10.0.0.1, ,192.168.0.0/16 ", func(c *Config) interface{} { return c.Server.TrustedProxies },
+			[]string{"10.0.0.1", "192.168.0.0/16"}},
+		{"empty string", "DB_HOST", "", func(c *Config) interface{} { return c.Database.Host }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			cfg := Default()
+			if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s=%q: got %#v, want %#v", tt.key, tt.value, got, tt.want)
+			}
+		})
+	}
+
+	for key, value := range map[string]string{"DB_PORT": "5432a", "JWT_EXPIRATION": "a day", "DB_AUTO_MIGRATE": "maybe", "TRACING_SAMPLE_RATIO": "half"} {
+		t.Run("invalid "+key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if err := applyEnv(reflect.ValueOf(Default()).Elem()); err == nil || !strings.HasPrefix(err.Error(), key+": ") {
+				t.Errorf("%s=%q: got %v", key, value, err)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	const password = "s3cr3t-p4ss"
+	tests := []struct {
+		name     string
+		database DatabaseConfig
+		want     string
+	}{
+		{"fields", DatabaseConfig{Driver: DriverPostgres, Host: "db", Port: 5432, User: "archiv", Password: password, Name: "archiv_db", SSLMode: "require"},
+			"host=db user=archiv dbname=archiv_db port=5432 sslmode=require"},
+		{"url", DatabaseConfig{Driver: DriverPostgres, URL: "postgres://archiv:" + password + "@db:5432/archiv_db?sslmode=require"},
+			"postgres://archiv@db:5432/archiv_db?sslmode=require"},
+		{"url overriding the fields", DatabaseConfig{Driver: DriverPostgres, URL: "postgres://archiv:" + password + "@db/archiv_db", Password: password},
+			"postgres://archiv@db/archiv_db"},
+		{"keyword url", DatabaseConfig{Driver: DriverPostgres, URL: "host=db user=archiv password=" + password + " dbname=archiv_db"},
+			"(database url)"},
+		{"sqlite", DatabaseConfig{Driver: DriverSQLite, Path: "/var/lib/archiv/archiv.db", Password: password},
+			"sqlite /var/lib/archiv/archiv.db"},
+	}
+	for _, tt := range tests {
+		got := tt.database.Redacted()
+		if got != tt.want || strings.Contains(got, password) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.database.Driver == DriverPostgres && !strings.Contains(tt.database.DSN(), password) {
+			t.Errorf("%s: DSN %q lost the password", tt.name, tt.database.DSN())
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("server:\n  address: \":8081\"\nstorage:\n  path: /srv/file\njwt:\n  secret: "+strings.Repeat("f", 32)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"CONFIG_FILE", "JWT_SECRET", "LISTEN_ADDR"} {
+		t.Setenv(key, "") // restored at the end of the test
+		os.Unsetenv(key)
+	}
+	t.Setenv("STORAGE_PATH", "/srv/env")
+
+	// The environment overrides the file and the flags override both
+	cfg, args, err := LoadCommand("test", []string{"-config", file, "-listen", ":8082", "documents"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Address != ":8082" || cfg.Storage.Path != "/srv/env" || cfg.JWT.Secret != strings.Repeat("f", 32) || len(args) != 1 || args[0] != "documents" {
+		t.Errorf("address %s, storage %s, args %v", cfg.Server.Address, cfg.Storage.Path, args)
+	}
+
+	// Unknown keys of the file are refused, the configuration is validated
+	if err := os.WriteFile(file, []byte("server:\n  adress: \":8081\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadCommand("test", []string{"-config", file}); err == nil || !strings.Contains(err.Error(), "field adress not found") {
+		t.Errorf("misspelled key: got %v", err)
+	}
+	if _, _, err := LoadCommand("test", nil); err == nil || !strings.Contains(err.Error(), "jwt.secret") {
+		t.Errorf("missing secret: got %v", err)
+	}
+}
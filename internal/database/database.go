@@ -1,92 +1,282 @@
 package database
 
 import (
+	"archiv-system/internal/config"
 	"archiv-system/internal/models"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/opentelemetry/tracing"
 )
 
-var DB *gorm.DB
+// DefaultOrganizationSlug identifies the organization owning the data created before multi-tenancy
+const DefaultOrganizationSlug = "default"
 
-func InitDB() *gorm.DB {
-	dsn := "host=localhost user=postgres password=root dbname=archiv_db port=5432 sslmode=disable"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// tenantModels are the models scoped to an organization
+var tenantModels = []interface{}{
+	&models.User{},
+	&models.Role{},
+	&models.SeededGrant{},
+	&models.Document{},
+	&models.Tag{},
+	&models.Group{},
+	&models.Folder{},
+	&models.Grant{},
+	&models.Policy{},
+	&models.FixityEvent{},
+	&models.Derivative{},
+	&models.AuditEvent{},
+	&models.ImportJob{},
+	&models.ImportEntry{},
+	&models.ExportJob{},
+	&models.ArchivalPackage{},
+}
+
+// newLogger sends the warnings of gorm (errors, slow queries) to the application logger.
+// Queries are logged with placeholders only, so that bound values such as password hashes never appear.
+func newLogger() logger.Interface {
+	return logger.New(slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn), logger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  logger.Warn,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      true,
+	})
+}
+
+// Open connects to the database and installs the tracing plugin, the connection pool settings and the
+// tenant callbacks, without touching the schema.
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	// Never log cfg.DSN(), it contains the password
+	slog.Info("Connecting to database", "database", cfg.Redacted())
+	db, err := gorm.Open(dialector(cfg), &gorm.Config{Logger: newLogger()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+
+	// Trace every query, without the bound values which may hold secrets
+	if err := db.Use(tracing.NewPlugin(tracing.WithoutQueryVariables(), tracing.WithoutMetrics())); err != nil {
+		return nil, fmt.Errorf("failed to enable query tracing: %w", err)
+	}
+
+	// Connection pool
+	sqlDB, err := db.DB()
 	if err != nil {
-		panic("failed to connect to the database: " + err.Error())
+		return nil, fmt.Errorf("failed to access the connection pool: %w", err)
+	}
+	if cfg.Driver == config.DriverSQLite {
+		// SQLite has a single writer, and an in-memory database lives and dies with its connection
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	} else {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+
+	// Restrict every query on tenant tables to the organization found in the context
+	if err := registerTenantCallbacks(db, tenantModels...); err != nil {
+		return nil, fmt.Errorf("failed to register tenant callbacks: %w", err)
+	}
+
+	return db, nil
+}
+
+// dialector returns the gorm driver of the configured database
+func dialector(cfg config.DatabaseConfig) gorm.Dialector {
+	if cfg.Driver != config.DriverSQLite {
+		return postgres.Open(cfg.DSN())
+	}
+	// Enforce foreign keys like Postgres does, and wait for the lock instead of failing with SQLITE_BUSY
+	dsn := cfg.DSN()
+	if strings.Contains(dsn, "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+	return sqlite.Open(dsn + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+}
+
+// InitDB opens the database, brings its schema up to date and seeds it: the default organization, the built-in
+// roles of every organization and, on the first start, the administrator described by admin.
+func InitDB(cfg config.DatabaseConfig, admin config.AdminConfig) *gorm.DB {
+	db, err := Open(cfg)
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx := context.Background()
+
+	// Schema migrations, unless they are run separately with the migrate command
+	if cfg.AutoMigrate {
+		if _, err := Migrate(ctx, db); err != nil {
+			panic("failed to migrate database: " + err.Error())
+		}
+	} else {
+		pending, err := PendingMigrations(ctx, db)
+		if err != nil {
+			panic("failed to check migrations: " + err.Error())
+		}
+		if len(pending) > 0 {
+			panic(fmt.Sprintf("%v: %d pending", ErrMigrationsPending, len(pending)))
+		}
+	}
+	sys := System(db)
+
+	// Default organization, owner of the data created before multi-tenancy
+	defaultOrg, err := ensureDefaultOrganization(sys)
+	if err != nil {
+		panic("failed to create default organization: " + err.Error())
+	}
+
+	// Seed roles and permissions, so that permissions added since the last start reach every organization
+	var organizationIDs []uint
+	if err := sys.Model(&models.Organization{}).Pluck("id", &organizationIDs).Error; err != nil {
+		panic("failed to list organizations: " + err.Error())
+	}
+	for _, organizationID := range organizationIDs {
+		if err := SeedRolesAndPermissions(db, organizationID); err != nil {
+			panic("failed to seed roles and permissions: " + err.Error())
+		}
 	}
 
-	// Assign global database
-	DB = db
+	if err := ensureSuperAdmin(db, defaultOrg.ID, admin); err != nil {
+		panic("failed to create default admin: " + err.Error())
+	}
+
+	return db
+}
 
-	// Table migration
-	if err := db.AutoMigrate(
-		&models.Document{},
-		&models.User{},
-		&models.Role{},
-		&models.Permission{},
-		&models.RolePermission{},
-	); err != nil {
-		panic("failed to migrate database: " + err.Error())
+// ensureDefaultOrganization returns the default organization, creating it if needed
+func ensureDefaultOrganization(db *gorm.DB) (*models.Organization, error) {
+	defaultOrg := models.Organization{Name: "Default", Slug: DefaultOrganizationSlug, AllowRegistration: true}
+	if err := db.Where("slug = ?", DefaultOrganizationSlug).FirstOrCreate(&defaultOrg).Error; err != nil {
+		return nil, err
 	}
+	return &defaultOrg, nil
+}
 
-	// Seed roles and permissions
-	if err := SeedRolesAndPermissions(); err != nil {
-		panic("failed to seed roles and permissions: " + err.Error())
+// ensureSuperAdmin makes sure at least one super-admin exists, promoting the first administrator
+// of the default organization or creating the configured one, who must change its password at first login
+func ensureSuperAdmin(db *gorm.DB, organizationID uint, cfg config.AdminConfig) error {
+	var count int64
+	if err := System(db).Model(&models.User{}).Where("super_admin = ?", true).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	db = db.WithContext(WithOrganization(context.Background(), organizationID))
+	var adminRole models.Role
+	if err := db.Where("name = ?", "admin").First(&adminRole).Error; err != nil {
+		return err
 	}
 
 	var admin models.User
-	if err := DB.Where("role_id = ?", 1).First(&admin).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Create a default admin
-			defaultAdmin := models.User{
-				Username: "Angislad",
-				Password: HashPassword("viceash"), // Use a secure hashing function
-				RoleID:   1,                       // 1 corresponds to the Admin role
-			}
-			DB.Create(&defaultAdmin)
-			log.Println("Default admin created: username=Angislad, password=viceash")
+	if err := db.Where("role_id = ?", adminRole.ID).Order("id").First(&admin).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if cfg.Password == "" {
+			return errors.New("no administrator exists, set admin.password (ADMIN_PASSWORD) to create the first one")
 		}
+		admin = models.User{
+			Username:           cfg.Username,
+			Password:           HashPassword(cfg.Password),
+			RoleID:             adminRole.ID,
+			SuperAdmin:         true,
+			MustChangePassword: true,
+		}
+		if err := db.Create(&admin).Error; err != nil {
+			return err
+		}
+		slog.Warn("Administrator created, its password must be changed at first login", "username", admin.Username, "user_id", admin.ID)
+	} else if err := db.Model(&admin).Update("super_admin", true).Error; err != nil {
+		return err
 	}
+	return nil
+}
 
-	// Log admin information
-	log.Printf("Admin user: %+v\n", admin)
+// renameLegacySeededGrants moves aside a seeded_grants table without organization_id,
+// whose primary key cannot be extended by AutoMigrate. Only used when adopting a legacy schema.
+func renameLegacySeededGrants(db *gorm.DB) (bool, error) {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.SeededGrant{}) || migrator.HasColumn(&models.SeededGrant{}, "organization_id") {
+		return false, nil
+	}
+	if err := migrator.RenameTable("seeded_grants", "seeded_grants_legacy"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	return DB
+// backfillOrganization assigns the rows of the baseline tables created before multi-tenancy to the organization
+func backfillOrganization(db *gorm.DB, organizationID uint, legacySeededGrants bool) error {
+	for _, model := range baselineModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		if !tenantTables[table] {
+			continue
+		}
+		if err := db.Exec("UPDATE "+table+" SET organization_id = ? WHERE organization_id IS NULL", organizationID).Error; err != nil {
+			return fmt.Errorf("failed to backfill %s: %w", table, err)
+		}
+	}
+
+	if legacySeededGrants {
+		if err := db.Exec(`INSERT INTO seeded_grants (organization_id, role_name, permission_name)
+			SELECT ?, role_name, permission_name FROM seeded_grants_legacy`, organizationID).Error; err != nil {
+			return fmt.Errorf("failed to copy legacy seeded grants: %w", err)
+		}
+		return db.Migrator().DropTable("seeded_grants_legacy")
+	}
+	return nil
+}
+
+// DefaultRolePermissions is the initial permission set of the built-in roles.
+// It is only applied once per (role, permission) pair: permissions removed by an admin are not re-added.
+var DefaultRolePermissions = map[string][]string{
+	"admin": {"read_document", "update_document", "delete_document", "upload_document", "manage_roles", "manage_users", "manage_groups", "manage_policies", "manage_fixity", "manage_quarantine", "view_audit", "manage_preservation"},
+	"user":  {"read_document", "upload_document"},
 }
 
-func SeedRolesAndPermissions() error {
-	// Define roles and permissions
-	permissions := []string{"read_document", "update_document", "delete_document", "upload_document"}
+// Permissions lists every permission known to the application
+var Permissions = []string{"read_document", "update_document", "delete_document", "upload_document", "manage_roles", "manage_users", "manage_groups", "manage_policies", "manage_fixity", "manage_quarantine", "view_audit", "manage_preservation"}
+
+// SeedRolesAndPermissions creates the permissions and the built-in roles of an organization
+func SeedRolesAndPermissions(db *gorm.DB, organizationID uint) error {
+	db = db.WithContext(WithOrganization(context.Background(), organizationID))
 
 	// Create permissions
-	var createdPermissions []models.Permission
-	for _, permName := range permissions {
+	permissionsByName := make(map[string]models.Permission)
+	for _, permName := range Permissions {
 		perm := models.Permission{Name: permName}
-		if err := DB.FirstOrCreate(&perm, "name = ?", permName).Error; err != nil {
+		if err := db.FirstOrCreate(&perm, "name = ?", permName).Error; err != nil {
 			return fmt.Errorf("failed to seed permission '%s': %v", permName, err)
 		}
-		createdPermissions = append(createdPermissions, perm)
+		permissionsByName[permName] = perm
 	}
 
 	// Create roles and assign permissions
-	rolePermissions := map[string][]string{
-		"admin": {"read_document", "update_document", "delete_document", "upload_document"},
-		"user":  {"read_document", "upload_document"},
-	}
-
-	for roleName, permNames := range rolePermissions {
+	for roleName, permNames := range DefaultRolePermissions {
 		var role models.Role
-		// Use FirstOrCreate to ensure no duplicates are created
-		if err := DB.Where("name = ?", roleName).First(&role).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
+		if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// If the role does not exist, create it
 				role = models.Role{Name: roleName}
-				if err := DB.Create(&role).Error; err != nil {
+				if err := db.Create(&role).Error; err != nil {
 					return fmt.Errorf("failed to seed role '%s': %v", roleName, err)
 				}
 			} else {
@@ -94,20 +284,29 @@ func SeedRolesAndPermissions() error {
 			}
 		}
 
-		// Assign permissions
+		// Assign permissions that were never seeded before
 		for _, permName := range permNames {
-			for _, perm := range createdPermissions {
-				if perm.Name == permName {
-					if err := DB.Model(&role).Association("Permissions").Append(&perm); err != nil {
-						return fmt.Errorf("failed to assign permission '%s' to role '%s': %v", permName, roleName, err)
-					}
+			grant := models.SeededGrant{RoleName: roleName, PermissionName: permName}
+			result := db.Where(&grant).Limit(1).Find(&models.SeededGrant{})
+			if result.Error != nil {
+				return fmt.Errorf("failed to check seeded permission '%s' for role '%s': %v", permName, roleName, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				continue
+			}
+
+			perm := permissionsByName[permName]
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&role).Association("Permissions").Append(&perm); err != nil {
+					return err
 				}
+				return tx.Create(&grant).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to assign permission '%s' to role '%s': %v", permName, roleName, err)
 			}
+			slog.Debug("Seeded permission", "permission", permName, "role", roleName, "organization_id", organizationID)
 		}
-
-		// Log role and permissions information
-		log.Printf("Role: %+v\n", role)
-		log.Printf("Permissions: %+v\n", role.Permissions)
 	}
 
 	return nil
@@ -116,7 +315,7 @@ func SeedRolesAndPermissions() error {
 func HashPassword(password string) string {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Fatalf("Failed to hash password: %v", err)
+		panic("failed to hash password: " + err.Error())
 	}
 	return string(hashedPassword)
 }
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationCheckTTL is how long the readiness probe reuses the result of the last migration check
+const migrationCheckTTL = 10 * time.Second
+
+// migrationCheck caches the last migration check, probes coming every few seconds
+var migrationCheck struct {
+	sync.Mutex
+	db        *gorm.DB
+	checkedAt time.Time
+	err       error
+}
+
+// Ping checks that the database answers
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CheckMigrations fails when the schema has pending migrations, e.g. after a rollback run with the migrate
+// command, or when they cannot be listed. The result is kept for a few seconds.
+func CheckMigrations(ctx context.Context, db *gorm.DB) error {
+	migrationCheck.Lock()
+	defer migrationCheck.Unlock()
+	if migrationCheck.db == db && time.Since(migrationCheck.checkedAt) < migrationCheckTTL {
+		return migrationCheck.err
+	}
+
+	pending, err := PendingMigrations(ctx, db)
+	if err == nil && len(pending) > 0 {
+		err = fmt.Errorf("%d pending", len(pending))
+	}
+	migrationCheck.db, migrationCheck.checkedAt, migrationCheck.err = db, time.Now(), err
+	return err
+}
@@ -0,0 +1,359 @@
+package database
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds one set of migrations per dialect, in migrations/<dialect>, with the same versions
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrMigrationsPending is returned at startup when automatic migration is disabled and the schema is behind
+var ErrMigrationsPending = errors.New("database schema is not up to date, run the migrate command")
+
+// migrationLockKey identifies the advisory lock serializing migrations across instances
+const migrationLockKey int64 = 0x61726368697631 // "archiv1"
+
+// baselineVersion is the migration matching the schema AutoMigrate used to create
+const baselineVersion int64 = 1
+
+// baselineModels are the models of the baseline schema, created by AutoMigrate when adopting a legacy
+// database. Tables added by later migrations are left to those migrations, but AutoMigrate gives these
+// tables the columns of the current models: the Postgres migrations adding columns to them use IF NOT EXISTS.
+var baselineModels = []interface{}{
+	&models.Organization{},
+	&models.Permission{},
+	&models.RolePermission{},
+	&models.PasswordHistory{},
+	&models.PasswordResetToken{},
+	&models.User{},
+	&models.Role{},
+	&models.SeededGrant{},
+	&models.Document{},
+	&models.Tag{},
+	&models.Group{},
+	&models.Folder{},
+	&models.Grant{},
+	&models.Policy{},
+}
+
+// migrationFilePattern matches <version>_<name>.up.sql and <version>_<name>.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change with its rollback
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus tells whether a migration was applied, and when
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+	Unknown   bool       `json:"unknown"` // applied but absent from this build, e.g. after a downgrade
+}
+
+// createSchemaMigrations creates the table recording the applied migrations, by dialect
+var createSchemaMigrations = map[string]string{
+	"postgres": `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    bigint PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at timestamptz NOT NULL
+)`,
+	"sqlite": `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    integer PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at datetime NOT NULL
+)`,
+}
+
+// sqliteMigrationLock serializes migrations within the process on SQLite, which has no advisory locks
+var sqliteMigrationLock sync.Mutex
+
+// schemaMigration is a row of schema_migrations
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the migrations embedded in the binary for a dialect (postgres or sqlite), ordered by version
+func Migrations(dialect string) ([]Migration, error) {
+	dir := "migrations/" + dialect
+	files, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for the %s dialect: %w", dialect, err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", file.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", file.Name(), err)
+		}
+		content, err := migrationFiles.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations in order, each in its own transaction, and returns them.
+// A database created by AutoMigrate before versioned migrations existed is brought up to date once
+// and recorded at the baseline version.
+func Migrate(ctx context.Context, db *gorm.DB) ([]Migration, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 || migrations[0].Version != baselineVersion {
+		return nil, fmt.Errorf("baseline migration %d is missing", baselineVersion)
+	}
+
+	var applied []Migration
+	err = withMigrationLock(ctx, db, func(db *gorm.DB) error {
+		done, err := appliedMigrations(db)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 && db.Migrator().HasTable(&models.User{}) {
+			if err := adoptLegacySchema(db, migrations[0]); err != nil {
+				return fmt.Errorf("failed to adopt the existing schema: %w", err)
+			}
+			done[baselineVersion] = schemaMigration{Version: baselineVersion}
+		}
+
+		for _, migration := range migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			slog.InfoContext(ctx, "Applying migration", "version", migration.Version, "name", migration.Name)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Rollback reverts the last steps applied migrations, most recent first, and returns them
+func Rollback(ctx context.Context, db *gorm.DB, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, errors.New("the number of migrations to roll back must be positive")
+	}
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	known := map[int64]Migration{}
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	var reverted []Migration
+	err = withMigrationLock(ctx, db, func(db *gorm.DB) error {
+		var done []schemaMigration
+		if err := db.Order("version DESC").Limit(steps).Find(&done).Error; err != nil {
+			return err
+		}
+		for _, row := range done {
+			migration, ok := known[row.Version]
+			if !ok {
+				return fmt.Errorf("migration %d_%s is not part of this build and cannot be rolled back", row.Version, row.Name)
+			}
+			slog.InfoContext(ctx, "Rolling back migration", "version", migration.Version, "name", migration.Name)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rollback of %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists the known migrations and the applied ones missing from this build
+func Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	db = db.WithContext(Unscoped(ctx))
+	done := map[int64]schemaMigration{}
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		if done, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := done[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(done, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range done {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// PendingMigrations returns the migrations not applied yet
+func PendingMigrations(ctx context.Context, db *gorm.DB) ([]MigrationStatus, error) {
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []MigrationStatus
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status)
+		}
+	}
+	return pending, nil
+}
+
+// withMigrationLock runs fn while holding a session-level advisory lock, so that instances starting
+// together do not migrate concurrently; the others wait and then find nothing left to apply. fn runs on the
+// connection holding the lock, which also works with a pool of a single connection.
+// SQLite serves a single node: a process-wide lock is enough there, SQLite locking each transaction.
+func withMigrationLock(ctx context.Context, db *gorm.DB, fn func(db *gorm.DB) error) error {
+	dialect := db.Dialector.Name()
+	createTable, ok := createSchemaMigrations[dialect]
+	if !ok {
+		return fmt.Errorf("migrations are not supported on %s", dialect)
+	}
+	if dialect == "sqlite" {
+		sqliteMigrationLock.Lock()
+		defer sqliteMigrationLock.Unlock()
+		return runLocked(ctx, db, createTable, fn)
+	}
+
+	return db.WithContext(Unscoped(ctx)).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire the migration lock: %w", err)
+		}
+		defer func() {
+			// The lock is released with the session anyway if this fails
+			if err := conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				slog.Warn("Failed to release the migration lock", "error", err)
+			}
+		}()
+
+		return runLocked(ctx, conn, createTable, fn)
+	})
+}
+
+// runLocked creates schema_migrations if needed and runs fn, once the migration lock is held
+func runLocked(ctx context.Context, db *gorm.DB, createTable string, fn func(db *gorm.DB) error) error {
+	db = db.WithContext(Unscoped(ctx))
+	if err := db.Exec(createTable).Error; err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(db)
+}
+
+func appliedMigrations(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// adoptLegacySchema upgrades a database created by AutoMigrate, possibly before multi-tenancy,
+// to the baseline schema and records the baseline as applied
+func adoptLegacySchema(db *gorm.DB, baseline Migration) error {
+	slog.Warn("Adopting a schema created before versioned migrations", "baseline", baselineVersion)
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Seeded grants created before organizations existed are keyed differently
+		legacySeededGrants, err := renameLegacySeededGrants(tx)
+		if err != nil {
+			return err
+		}
+		if err := tx.AutoMigrate(baselineModels...); err != nil {
+			return err
+		}
+
+		defaultOrg, err := ensureDefaultOrganization(tx)
+		if err != nil {
+			return err
+		}
+		if err := backfillOrganization(tx, defaultOrg.ID, legacySeededGrants); err != nil {
+			return err
+		}
+		return tx.Create(&schemaMigration{Version: baseline.Version, Name: baseline.Name, AppliedAt: time.Now()}).Error
+	})
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/models"
+	"context"
+	"testing"
+)
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	postgres, err := Migrations("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("%d postgres migrations, %d sqlite migrations", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d: postgres %d_%s, sqlite %d_%s", i,
+				postgres[i].Version, postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+		if sqlite[i].up == "" || sqlite[i].down == "" {
+			t.Errorf("sqlite migration %d_%s lacks its up or down script", sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+	if _, err := Migrations("mysql"); err == nil {
+		t.Error("migrations found for an unsupported dialect")
+	}
+}
+
+func TestMigrateAndRollback(t *testing.T) {
+	db, err := Open(config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	all, err := Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(all) {
+		t.Fatalf("%d pending migrations on an empty database, want %d", len(pending), len(all))
+	}
+
+	applied, err := Migrate(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(all) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(all))
+	}
+	for _, model := range append(baselineModels, &models.FixityEvent{}, &models.Derivative{}, &models.AuditEvent{},
+		&models.ImportJob{}, &models.ExportJob{}, &models.ArchivalPackage{}) {
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("table of %T missing after migration", model)
+		}
+	}
+
+	// Migrating again is a no-op
+	if applied, err = Migrate(ctx, db); err != nil || len(applied) != 0 {
+		t.Fatalf("second migration applied %d migrations, error %v", len(applied), err)
+	}
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil || status.Unknown {
+			t.Errorf("migration %d_%s: %+v", status.Version, status.Name, status)
+		}
+	}
+
+	// Every down script reverts its up script, so the schema can be rebuilt after a full rollback
+	reverted, err := Rollback(ctx, db, len(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(all) || reverted[0].Version != all[len(all)-1].Version {
+		t.Fatalf("rolled back %d migrations starting at %d", len(reverted), reverted[0].Version)
+	}
+	if db.Migrator().HasTable(&models.User{}) {
+		t.Error("users table left after rolling back the baseline")
+	}
+	if applied, err = Migrate(ctx, db); err != nil || len(applied) != len(all) {
+		t.Fatalf("migration after rollback applied %d migrations, error %v", len(applied), err)
+	}
+
+	if _, err := Rollback(ctx, db, 0); err == nil {
+		t.Error("rollback of 0 migrations accepted")
+	}
+}
+
+func TestInitDBSeedsSQLite(t *testing.T) {
+	cfg := config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:", AutoMigrate: true}
+	db := InitDB(cfg, config.AdminConfig{Username: "admin", Password: "Initial-Password-1"})
+	sys := System(db)
+
+	var organization models.Organization
+	if err := sys.Where("slug = ?", DefaultOrganizationSlug).First(&organization).Error; err != nil {
+		t.Fatalf("default organization: %v", err)
+	}
+	var roles []models.Role
+	if err := sys.Preload("Permissions").Where("organization_id = ?", organization.ID).Find(&roles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != len(DefaultRolePermissions) {
+		t.Fatalf("%d roles seeded, want %d", len(roles), len(DefaultRolePermissions))
+	}
+	for _, role := range roles {
+		if len(role.Permissions) != len(DefaultRolePermissions[role.Name]) {
+			t.Errorf("role %s has %d permissions, want %d", role.Name, len(role.Permissions), len(DefaultRolePermissions[role.Name]))
+		}
+	}
+
+	var admin models.User
+	if err := sys.Where("username = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatalf("admin: %v", err)
+	}
+	if !admin.SuperAdmin || !admin.MustChangePassword || admin.OrganizationID != organization.ID {
+		t.Fatalf("admin %+v, want a super-admin of the default organization who must change its password", admin)
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS fixity_events;
+
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS fixity_checked_at,
+    DROP COLUMN IF EXISTS fixity_status,
+    DROP COLUMN IF EXISTS sha512,
+    DROP COLUMN IF EXISTS sha256;
@@ -0,0 +1,20 @@
+-- Checksums recorded at upload, outcome of the last fixity check, and the failures found by the checks.
+
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS sha256 text,
+    ADD COLUMN IF NOT EXISTS sha512 text,
+    ADD COLUMN IF NOT EXISTS fixity_status text,
+    ADD COLUMN IF NOT EXISTS fixity_checked_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS fixity_events (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    document_id     bigint NOT NULL,
+    outcome         text NOT NULL,
+    expected_sha256 text,
+    actual_sha256   text,
+    detail          text,
+    created_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_fixity_events_organization_id ON fixity_events (organization_id);
+CREATE INDEX IF NOT EXISTS idx_fixity_events_document_id ON fixity_events (document_id);
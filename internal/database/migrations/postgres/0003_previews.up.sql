@@ -0,0 +1,19 @@
+-- Thumbnails of the documents, generated in the background after upload.
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS preview_status text;
+
+CREATE TABLE IF NOT EXISTS derivatives (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    document_id     bigint NOT NULL,
+    kind            text NOT NULL,
+    size            text NOT NULL,
+    content_type    text NOT NULL,
+    url             text NOT NULL,
+    width           bigint,
+    height          bigint,
+    bytes           bigint,
+    created_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_derivatives_organization_id ON derivatives (organization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_derivatives_document_kind_size ON derivatives (document_id, kind, size);
@@ -0,0 +1,3 @@
+ALTER TABLE folders DROP COLUMN IF EXISTS allowed_upload_types;
+ALTER TABLE roles DROP COLUMN IF EXISTS allowed_upload_types;
+ALTER TABLE documents DROP COLUMN IF EXISTS declared_type;
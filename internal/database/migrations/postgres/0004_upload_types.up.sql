@@ -0,0 +1,8 @@
+-- Content types detected at upload next to the declared ones, and the upload allow-lists of roles and folders.
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS declared_type text;
+-- Documents uploaded before detection only have the declared type
+UPDATE documents SET declared_type = type WHERE declared_type IS NULL;
+
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS allowed_upload_types text;
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS allowed_upload_types text;
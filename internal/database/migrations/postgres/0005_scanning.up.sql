@@ -0,0 +1,21 @@
+-- Malware scanning of the uploads, and the audit log recording the infected files.
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_status text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_engine text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_signature text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS scanned_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_documents_scan_status ON documents (scan_status);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    actor_id        bigint,
+    action          text NOT NULL,
+    target_type     text,
+    target_id       bigint,
+    detail          text,
+    created_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_organization_id ON audit_events (organization_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
@@ -0,0 +1,36 @@
+-- Bulk imports of zip and tar archives, run in the background, and the outcome of each of their entries.
+
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    user_id         bigint NOT NULL,
+    folder_id       bigint,
+    filename        text,
+    format          text,
+    status          text NOT NULL,
+    total           bigint,
+    processed       bigint,
+    imported        bigint,
+    failed          bigint,
+    skipped         bigint,
+    error           text,
+    archive_path    text,
+    created_at      timestamptz,
+    started_at      timestamptz,
+    finished_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_organization_id ON import_jobs (organization_id);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs (user_id);
+
+CREATE TABLE IF NOT EXISTS import_entries (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    job_id          bigint NOT NULL,
+    path            text NOT NULL,
+    status          text NOT NULL,
+    document_id     bigint,
+    error           text,
+    created_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_import_entries_organization_id ON import_entries (organization_id);
+CREATE INDEX IF NOT EXISTS idx_import_entries_job_id ON import_entries (job_id);
@@ -0,0 +1,23 @@
+-- Bulk exports of documents built in the background, kept in the storage until they expire.
+
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    user_id         bigint NOT NULL,
+    status          text NOT NULL,
+    manifest        text,
+    document_ids    text,
+    total           bigint,
+    processed       bigint,
+    failed          bigint,
+    size            bigint,
+    error           text,
+    url             text,
+    created_at      timestamptz,
+    started_at      timestamptz,
+    finished_at     timestamptz,
+    expires_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_organization_id ON export_jobs (organization_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_expires_at ON export_jobs (expires_at);
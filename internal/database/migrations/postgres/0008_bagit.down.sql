@@ -0,0 +1,2 @@
+ALTER TABLE import_jobs DROP COLUMN IF EXISTS bag;
+ALTER TABLE export_jobs DROP COLUMN IF EXISTS format;
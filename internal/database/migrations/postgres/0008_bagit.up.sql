@@ -0,0 +1,7 @@
+-- BagIt packaging: the format of the exports and the imports of bags, validated before their payload is imported.
+
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS format text;
+-- Exports made before were zip archives
+UPDATE export_jobs SET format = 'zip' WHERE format IS NULL;
+
+ALTER TABLE import_jobs ADD COLUMN IF NOT EXISTS bag boolean NOT NULL DEFAULT false;
@@ -0,0 +1,23 @@
+-- Archival information packages (AIP): BagIt bags of documents and all their versions, described by METS and
+-- PREMIS metadata, kept in the storage.
+
+CREATE TABLE IF NOT EXISTS archival_packages (
+    id              bigserial PRIMARY KEY,
+    organization_id bigint,
+    user_id         bigint,
+    import_id       bigint,
+    status          text NOT NULL,
+    document_ids    text,
+    files           bigint,
+    skipped         bigint,
+    size            bigint,
+    sha256          text,
+    error           text,
+    url             text,
+    created_at      timestamptz,
+    started_at      timestamptz,
+    finished_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_archival_packages_organization_id ON archival_packages (organization_id);
+CREATE INDEX IF NOT EXISTS idx_archival_packages_user_id ON archival_packages (user_id);
+CREATE INDEX IF NOT EXISTS idx_archival_packages_import_id ON archival_packages (import_id);
@@ -0,0 +1,8 @@
+ALTER TABLE archival_packages DROP COLUMN IF EXISTS key_id;
+ALTER TABLE archival_packages DROP COLUMN IF EXISTS encrypted;
+ALTER TABLE export_jobs DROP COLUMN IF EXISTS key_id;
+ALTER TABLE export_jobs DROP COLUMN IF EXISTS encrypted;
+ALTER TABLE derivatives DROP COLUMN IF EXISTS key_id;
+ALTER TABLE derivatives DROP COLUMN IF EXISTS encrypted;
+ALTER TABLE documents DROP COLUMN IF EXISTS key_id;
+ALTER TABLE documents DROP COLUMN IF EXISTS encrypted;
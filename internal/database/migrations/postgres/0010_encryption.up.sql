@@ -0,0 +1,11 @@
+-- Encryption of the stored files recorded with the records referencing them, instead of being read from the
+-- start of the files. Files encrypted before this migration are recorded by "keys backfill".
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS key_id text;
+ALTER TABLE derivatives ADD COLUMN IF NOT EXISTS encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE derivatives ADD COLUMN IF NOT EXISTS key_id text;
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS key_id text;
+ALTER TABLE archival_packages ADD COLUMN IF NOT EXISTS encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE archival_packages ADD COLUMN IF NOT EXISTS key_id text;
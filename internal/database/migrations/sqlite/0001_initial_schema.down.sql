@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS policies;
+DROP TABLE IF EXISTS grants;
+DROP TABLE IF EXISTS document_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS folders;
+DROP TABLE IF EXISTS group_roles;
+DROP TABLE IF EXISTS user_groups;
+DROP TABLE IF EXISTS "groups";
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS password_histories;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS seeded_grants;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS organizations;
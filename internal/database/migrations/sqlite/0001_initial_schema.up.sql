@@ -0,0 +1,164 @@
+-- SQLite version of the initial schema, see the postgres migration of the same version.
+-- Types follow the affinities SQLite and its driver understand: integer keys, datetime columns.
+
+CREATE TABLE organizations (
+    id                 integer PRIMARY KEY AUTOINCREMENT,
+    name               text NOT NULL CONSTRAINT uni_organizations_name UNIQUE,
+    slug               text NOT NULL CONSTRAINT uni_organizations_slug UNIQUE,
+    allow_registration boolean NOT NULL DEFAULT false,
+    created_at         datetime
+);
+
+CREATE TABLE permissions (
+    id   integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL CONSTRAINT uni_permissions_name UNIQUE
+);
+
+CREATE TABLE roles (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    name            text NOT NULL
+);
+CREATE UNIQUE INDEX idx_roles_organization_name ON roles (organization_id, name);
+
+CREATE TABLE role_permissions (
+    role_id       bigint CONSTRAINT fk_role_permissions_role REFERENCES roles (id),
+    permission_id bigint CONSTRAINT fk_role_permissions_permission REFERENCES permissions (id),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE seeded_grants (
+    organization_id bigint,
+    role_name       text,
+    permission_name text,
+    PRIMARY KEY (organization_id, role_name, permission_name)
+);
+
+CREATE TABLE users (
+    id                   integer PRIMARY KEY AUTOINCREMENT,
+    organization_id      bigint,
+    username             text NOT NULL CONSTRAINT uni_users_username UNIQUE,
+    email                text,
+    password             text NOT NULL,
+    role_id              bigint NOT NULL CONSTRAINT fk_users_role REFERENCES roles (id),
+    auth_source          text NOT NULL DEFAULT 'local',
+    super_admin          boolean NOT NULL DEFAULT false,
+    disabled             boolean NOT NULL DEFAULT false,
+    must_change_password boolean NOT NULL DEFAULT false,
+    last_login_at        datetime,
+    failed_logins        bigint NOT NULL DEFAULT 0,
+    locked_until         datetime,
+    created_at           datetime
+);
+CREATE INDEX idx_users_organization_id ON users (organization_id);
+
+CREATE TABLE password_histories (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    user_id    bigint NOT NULL,
+    hash       text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_password_histories_user_id ON password_histories (user_id);
+
+CREATE TABLE password_reset_tokens (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    user_id    bigint NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at    datetime,
+    created_at datetime
+);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+
+CREATE TABLE "groups" (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    name            text NOT NULL,
+    created_at      datetime
+);
+CREATE UNIQUE INDEX idx_groups_organization_name ON "groups" (organization_id, name);
+
+CREATE TABLE user_groups (
+    group_id bigint CONSTRAINT fk_user_groups_group REFERENCES "groups" (id),
+    user_id  bigint CONSTRAINT fk_user_groups_user REFERENCES users (id),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE TABLE group_roles (
+    group_id bigint CONSTRAINT fk_group_roles_group REFERENCES "groups" (id),
+    role_id  bigint CONSTRAINT fk_group_roles_role REFERENCES roles (id),
+    PRIMARY KEY (group_id, role_id)
+);
+
+CREATE TABLE folders (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    name            text NOT NULL,
+    parent_id       bigint,
+    owner_id        bigint NOT NULL,
+    created_at      datetime
+);
+CREATE INDEX idx_folders_organization_id ON folders (organization_id);
+CREATE INDEX idx_folders_parent_id ON folders (parent_id);
+
+CREATE TABLE documents (
+    id                  integer PRIMARY KEY AUTOINCREMENT,
+    organization_id     bigint,
+    name                text NOT NULL,
+    type                text NOT NULL,
+    url                 text NOT NULL,
+    size                bigint NOT NULL DEFAULT 0,
+    owner_id            bigint NOT NULL CONSTRAINT fk_documents_owner REFERENCES users (id),
+    folder_id           bigint,
+    version             bigint DEFAULT 1,
+    previous_version_id bigint DEFAULT 0,
+    created_at          datetime,
+    updated_at          datetime
+);
+CREATE INDEX idx_documents_organization_id ON documents (organization_id);
+CREATE INDEX idx_documents_folder_id ON documents (folder_id);
+
+CREATE TABLE tags (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    name            text NOT NULL
+);
+CREATE UNIQUE INDEX idx_tags_organization_name ON tags (organization_id, name);
+
+CREATE TABLE document_tags (
+    document_id bigint CONSTRAINT fk_document_tags_document REFERENCES documents (id),
+    tag_id      bigint CONSTRAINT fk_document_tags_tag REFERENCES tags (id),
+    PRIMARY KEY (document_id, tag_id)
+);
+
+CREATE TABLE grants (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    document_id     bigint,
+    folder_id       bigint,
+    user_id         bigint,
+    group_id        bigint,
+    permission      text NOT NULL,
+    created_at      datetime
+);
+CREATE INDEX idx_grants_organization_id ON grants (organization_id);
+CREATE INDEX idx_grants_document_id ON grants (document_id);
+CREATE INDEX idx_grants_folder_id ON grants (folder_id);
+CREATE INDEX idx_grants_user_id ON grants (user_id);
+CREATE INDEX idx_grants_group_id ON grants (group_id);
+
+CREATE TABLE policies (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    name            text NOT NULL,
+    description     text,
+    permission      text NOT NULL,
+    effect          text NOT NULL,
+    condition       text NOT NULL,
+    enabled         boolean NOT NULL DEFAULT true,
+    dry_run         boolean NOT NULL DEFAULT false,
+    created_at      datetime,
+    updated_at      datetime
+);
+CREATE UNIQUE INDEX idx_policies_organization_name ON policies (organization_id, name);
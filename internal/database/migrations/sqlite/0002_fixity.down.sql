@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS fixity_events;
+
+ALTER TABLE documents DROP COLUMN fixity_checked_at;
+ALTER TABLE documents DROP COLUMN fixity_status;
+ALTER TABLE documents DROP COLUMN sha512;
+ALTER TABLE documents DROP COLUMN sha256;
@@ -0,0 +1,19 @@
+-- SQLite version of the fixity migration, see the postgres migration of the same version.
+
+ALTER TABLE documents ADD COLUMN sha256 text;
+ALTER TABLE documents ADD COLUMN sha512 text;
+ALTER TABLE documents ADD COLUMN fixity_status text;
+ALTER TABLE documents ADD COLUMN fixity_checked_at datetime;
+
+CREATE TABLE fixity_events (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    document_id     bigint NOT NULL,
+    outcome         text NOT NULL,
+    expected_sha256 text,
+    actual_sha256   text,
+    detail          text,
+    created_at      datetime
+);
+CREATE INDEX idx_fixity_events_organization_id ON fixity_events (organization_id);
+CREATE INDEX idx_fixity_events_document_id ON fixity_events (document_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS derivatives;
+
+ALTER TABLE documents DROP COLUMN preview_status;
@@ -0,0 +1,19 @@
+-- SQLite version of the previews migration, see the postgres migration of the same version.
+
+ALTER TABLE documents ADD COLUMN preview_status text;
+
+CREATE TABLE derivatives (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    document_id     bigint NOT NULL,
+    kind            text NOT NULL,
+    size            text NOT NULL,
+    content_type    text NOT NULL,
+    url             text NOT NULL,
+    width           bigint,
+    height          bigint,
+    bytes           bigint,
+    created_at      datetime
+);
+CREATE INDEX idx_derivatives_organization_id ON derivatives (organization_id);
+CREATE UNIQUE INDEX idx_derivatives_document_kind_size ON derivatives (document_id, kind, size);
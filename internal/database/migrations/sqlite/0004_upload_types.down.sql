@@ -0,0 +1,3 @@
+ALTER TABLE folders DROP COLUMN allowed_upload_types;
+ALTER TABLE roles DROP COLUMN allowed_upload_types;
+ALTER TABLE documents DROP COLUMN declared_type;
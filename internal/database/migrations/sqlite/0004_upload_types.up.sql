@@ -0,0 +1,7 @@
+-- SQLite version of the upload types migration, see the postgres migration of the same version.
+
+ALTER TABLE documents ADD COLUMN declared_type text;
+UPDATE documents SET declared_type = type WHERE declared_type IS NULL;
+
+ALTER TABLE roles ADD COLUMN allowed_upload_types text;
+ALTER TABLE folders ADD COLUMN allowed_upload_types text;
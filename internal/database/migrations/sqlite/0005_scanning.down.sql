@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS audit_events;
+
+DROP INDEX IF EXISTS idx_documents_scan_status;
+ALTER TABLE documents DROP COLUMN scanned_at;
+ALTER TABLE documents DROP COLUMN scan_signature;
+ALTER TABLE documents DROP COLUMN scan_engine;
+ALTER TABLE documents DROP COLUMN scan_status;
@@ -0,0 +1,21 @@
+-- SQLite version of the scanning migration, see the postgres migration of the same version.
+
+ALTER TABLE documents ADD COLUMN scan_status text;
+ALTER TABLE documents ADD COLUMN scan_engine text;
+ALTER TABLE documents ADD COLUMN scan_signature text;
+ALTER TABLE documents ADD COLUMN scanned_at datetime;
+CREATE INDEX idx_documents_scan_status ON documents (scan_status);
+
+CREATE TABLE audit_events (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    actor_id        bigint,
+    action          text NOT NULL,
+    target_type     text,
+    target_id       bigint,
+    detail          text,
+    created_at      datetime
+);
+CREATE INDEX idx_audit_events_organization_id ON audit_events (organization_id);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX idx_audit_events_action ON audit_events (action);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS import_entries;
+DROP TABLE IF EXISTS import_jobs;
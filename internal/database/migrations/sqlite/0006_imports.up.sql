@@ -0,0 +1,36 @@
+-- SQLite version of the imports migration, see the postgres migration of the same version.
+
+CREATE TABLE import_jobs (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    user_id         bigint NOT NULL,
+    folder_id       bigint,
+    filename        text,
+    format          text,
+    status          text NOT NULL,
+    total           bigint,
+    processed       bigint,
+    imported        bigint,
+    failed          bigint,
+    skipped         bigint,
+    error           text,
+    archive_path    text,
+    created_at      datetime,
+    started_at      datetime,
+    finished_at     datetime
+);
+CREATE INDEX idx_import_jobs_organization_id ON import_jobs (organization_id);
+CREATE INDEX idx_import_jobs_user_id ON import_jobs (user_id);
+
+CREATE TABLE import_entries (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    job_id          bigint NOT NULL,
+    path            text NOT NULL,
+    status          text NOT NULL,
+    document_id     bigint,
+    error           text,
+    created_at      datetime
+);
+CREATE INDEX idx_import_entries_organization_id ON import_entries (organization_id);
+CREATE INDEX idx_import_entries_job_id ON import_entries (job_id);
@@ -0,0 +1,23 @@
+-- SQLite version of the exports migration, see the postgres migration of the same version.
+
+CREATE TABLE export_jobs (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    user_id         bigint NOT NULL,
+    status          text NOT NULL,
+    manifest        text,
+    document_ids    text,
+    total           bigint,
+    processed       bigint,
+    failed          bigint,
+    size            bigint,
+    error           text,
+    url             text,
+    created_at      datetime,
+    started_at      datetime,
+    finished_at     datetime,
+    expires_at      datetime
+);
+CREATE INDEX idx_export_jobs_organization_id ON export_jobs (organization_id);
+CREATE INDEX idx_export_jobs_user_id ON export_jobs (user_id);
+CREATE INDEX idx_export_jobs_expires_at ON export_jobs (expires_at);
@@ -0,0 +1,6 @@
+-- SQLite version of the BagIt migration, see the postgres migration of the same version.
+
+ALTER TABLE export_jobs ADD COLUMN format text;
+UPDATE export_jobs SET format = 'zip' WHERE format IS NULL;
+
+ALTER TABLE import_jobs ADD COLUMN bag boolean NOT NULL DEFAULT false;
@@ -0,0 +1,22 @@
+-- SQLite version of the preservation migration, see the postgres migration of the same version.
+
+CREATE TABLE archival_packages (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    organization_id bigint,
+    user_id         bigint,
+    import_id       bigint,
+    status          text NOT NULL,
+    document_ids    text,
+    files           bigint,
+    skipped         bigint,
+    size            bigint,
+    sha256          text,
+    error           text,
+    url             text,
+    created_at      datetime,
+    started_at      datetime,
+    finished_at     datetime
+);
+CREATE INDEX idx_archival_packages_organization_id ON archival_packages (organization_id);
+CREATE INDEX idx_archival_packages_user_id ON archival_packages (user_id);
+CREATE INDEX idx_archival_packages_import_id ON archival_packages (import_id);
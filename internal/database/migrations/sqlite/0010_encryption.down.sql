@@ -0,0 +1,8 @@
+ALTER TABLE archival_packages DROP COLUMN key_id;
+ALTER TABLE archival_packages DROP COLUMN encrypted;
+ALTER TABLE export_jobs DROP COLUMN key_id;
+ALTER TABLE export_jobs DROP COLUMN encrypted;
+ALTER TABLE derivatives DROP COLUMN key_id;
+ALTER TABLE derivatives DROP COLUMN encrypted;
+ALTER TABLE documents DROP COLUMN key_id;
+ALTER TABLE documents DROP COLUMN encrypted;
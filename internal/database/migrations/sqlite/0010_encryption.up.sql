@@ -0,0 +1,10 @@
+-- SQLite version of the encryption migration, see the postgres migration of the same version.
+
+ALTER TABLE documents ADD COLUMN encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE documents ADD COLUMN key_id text;
+ALTER TABLE derivatives ADD COLUMN encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE derivatives ADD COLUMN key_id text;
+ALTER TABLE export_jobs ADD COLUMN encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE export_jobs ADD COLUMN key_id text;
+ALTER TABLE archival_packages ADD COLUMN encrypted boolean NOT NULL DEFAULT false;
+ALTER TABLE archival_packages ADD COLUMN key_id text;
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrMissingTenant = errors.New("query on a tenant table without organization in context")
+	ErrCrossTenant   = errors.New("record belongs to another organization")
+	ErrRawTenantSQL  = errors.New("raw SQL on a tenant table requires an unscoped context")
+	ErrTenantJoin    = errors.New("join on a tenant table cannot be scoped to the organization")
+)
+
+type tenantKey struct{}
+
+// tenantScope is stored in the context; the last of WithOrganization and Unscoped wins
+type tenantScope struct {
+	organizationID uint
+	unscoped       bool
+}
+
+// tenantTables lists the tables holding an organization_id column, filled by registerTenantCallbacks
+var tenantTables = map[string]bool{}
+
+// tenantTablePattern matches a tenant table name in raw SQL, built by registerTenantCallbacks
+var tenantTablePattern *regexp.Regexp
+
+// rawJoinPattern matches a raw join clause such as "LEFT JOIN documents d ON ...": the table, its alias and ON
+var rawJoinPattern = regexp.MustCompile(`(?i)\bJOIN\s+"?(\w+)"?(?:\s+(?:AS\s+)?"?(\w+)"?)?\s+ON\s+`)
+
+// WithOrganization returns a context whose queries are restricted to the organization
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantScope{organizationID: organizationID})
+}
+
+// Unscoped returns a context whose queries may cross organizations.
+// It is reserved to system tasks (seeding, login, background jobs) and super-admin endpoints.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantScope{unscoped: true})
+}
+
+// OrganizationFromContext returns the organization the context is restricted to
+func OrganizationFromContext(ctx context.Context) (uint, bool) {
+	scope, ok := ctx.Value(tenantKey{}).(tenantScope)
+	if !ok || scope.unscoped {
+		return 0, false
+	}
+	return scope.organizationID, true
+}
+
+// TenantScope returns the organization the context restricts queries to, with restricted=false for an
+// Unscoped context. It fails with ErrMissingTenant when the context has neither, like queries on tenant tables.
+func TenantScope(ctx context.Context) (organizationID uint, restricted bool, err error) {
+	scope, ok := ctx.Value(tenantKey{}).(tenantScope)
+	if !ok {
+		return 0, false, ErrMissingTenant
+	}
+	return scope.organizationID, !scope.unscoped, nil
+}
+
+// System returns the database handle for code running outside of any tenant
+func System(db *gorm.DB) *gorm.DB {
+	return db.WithContext(Unscoped(context.Background()))
+}
+
+// registerTenantCallbacks makes every query on a tenant table filter on the organization found in the
+// statement context, and every insert stamp it. Queries without organization nor explicit Unscoped context
+// are rejected, so a forgotten context fails instead of leaking data across tenants. Raw SQL cannot be
+// rewritten: it is rejected on tenant tables unless the context is Unscoped.
+func registerTenantCallbacks(db *gorm.DB, tenantModels ...interface{}) error {
+	var names []string
+	for _, model := range tenantModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		tenantTables[stmt.Schema.Table] = true
+		names = append(names, regexp.QuoteMeta(stmt.Schema.Table))
+	}
+	tenantTablePattern = regexp.MustCompile(`(?i)\b(` + strings.Join(names, "|") + `)\b`)
+
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:row", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:delete", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("tenant:raw", scopeTenant); err != nil {
+		return err
+	}
+	return callbacks.Create().Before("gorm:create").Register("tenant:create", stampTenant)
+}
+
+// tenantOf resolves the tenant restriction of a statement. It returns ok=false when the statement
+// does not need one (not a tenant table or unscoped context) and records an error when it is missing.
+func tenantOf(db *gorm.DB) (organizationID uint, ok bool) {
+	stmt := db.Statement
+	if stmt.SQL.Len() > 0 {
+		checkRawSQL(db)
+		return 0, false
+	}
+	if !tenantTables[stmt.Table] {
+		return 0, false
+	}
+	scope, found := stmt.Context.Value(tenantKey{}).(tenantScope)
+	if !found {
+		db.AddError(ErrMissingTenant)
+		return 0, false
+	}
+	if scope.unscoped {
+		return 0, false
+	}
+	return scope.organizationID, true
+}
+
+// checkRawSQL rejects raw SQL (Raw, Exec) naming a tenant table outside of an Unscoped context
+func checkRawSQL(db *gorm.DB) {
+	stmt := db.Statement
+	if scope, found := stmt.Context.Value(tenantKey{}).(tenantScope); found && scope.unscoped {
+		return
+	}
+	if table := tenantTablePattern.FindString(stmt.SQL.String()); table != "" {
+		db.AddError(fmt.Errorf("%w: %s", ErrRawTenantSQL, table))
+	}
+}
+
+func scopeTenant(db *gorm.DB) {
+	organizationID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID},
+	}})
+	scopeJoins(db, organizationID)
+}
+
+// scopeJoins restricts the tenant tables joined by the statement to the organization. The predicate goes
+// into the ON clause, so that a LEFT JOIN keeps the rows without a match in the organization.
+func scopeJoins(db *gorm.DB, organizationID uint) {
+	stmt := db.Statement
+	for i := range stmt.Joins {
+		join := &stmt.Joins[i]
+
+		// Association joins such as Joins("Role"): gorm evaluates On against each joined table
+		if relations, ok := joinRelations(stmt, join.Name); ok {
+			for _, relation := range relations {
+				if tenantTables[relation.FieldSchema.Table] {
+					where := clause.Where{}
+					if join.On != nil {
+						where.Exprs = append(where.Exprs, join.On.Exprs...)
+					}
+					where.Exprs = append(where.Exprs, clause.Eq{
+						Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID,
+					})
+					join.On = &where
+					break
+				}
+			}
+			continue
+		}
+
+		// Raw joins such as Joins("JOIN tags ON tags.id = document_tags.tag_id")
+		matches := rawJoinPattern.FindAllStringSubmatchIndex(join.Name, -1)
+		tenant := false
+		for _, match := range matches {
+			tenant = tenant || tenantTables[join.Name[match[2]:match[3]]]
+		}
+		if !tenant {
+			continue
+		}
+		if len(matches) > 1 || hasNamedVars(join.Conds) {
+			db.AddError(fmt.Errorf("%w: %s", ErrTenantJoin, join.Name))
+			return
+		}
+		match := matches[0]
+		alias := join.Name[match[2]:match[3]]
+		if match[4] >= 0 {
+			alias = join.Name[match[4]:match[5]]
+		}
+		join.Name = join.Name[:match[1]] + alias + ".organization_id = ? AND (" + join.Name[match[1]:] + ")"
+		join.Conds = append([]interface{}{organizationID}, join.Conds...)
+	}
+}
+
+// joinRelations resolves an association join name ("Role", "Owner.Role") to its relationships
+func joinRelations(stmt *gorm.Statement, name string) ([]*schema.Relationship, bool) {
+	if stmt.Schema == nil {
+		return nil, false
+	}
+	var relations []*schema.Relationship
+	current := stmt.Schema.Relationships.Relations
+	for _, part := range strings.Split(name, ".") {
+		relation, ok := current[part]
+		if !ok {
+			return nil, false
+		}
+		relations = append(relations, relation)
+		current = relation.FieldSchema.Relationships.Relations
+	}
+	return relations, true
+}
+
+// hasNamedVars reports whether join conditions use named arguments, which a positional predicate would break
+func hasNamedVars(conds []interface{}) bool {
+	for _, cond := range conds {
+		switch cond.(type) {
+		case sql.NamedArg, map[string]interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+func stampTenant(db *gorm.DB) {
+	organizationID, ok := tenantOf(db)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("OrganizationID")
+	if field == nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	stamp := func(record reflect.Value) {
+		value, zero := field.ValueOf(ctx, record)
+		if zero {
+			if err := field.Set(ctx, record, organizationID); err != nil {
+				db.AddError(err)
+			}
+		} else if value != organizationID {
+			db.AddError(ErrCrossTenant)
+		}
+	}
+
+	switch records := reflect.Indirect(db.Statement.ReflectValue); records.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < records.Len(); i++ {
+			stamp(reflect.Indirect(records.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(records)
+	}
+}
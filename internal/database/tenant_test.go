@@ -0,0 +1,191 @@
+package database
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/models"
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB returns a migrated in-memory SQLite database
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open(config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// tenantFixture holds two organizations with a role and a user each
+type tenantFixture struct {
+	orgA, orgB   models.Organization
+	roleA, roleB models.Role
+	userA, userB models.User
+}
+
+func newTenantFixture(t *testing.T, db *gorm.DB) *tenantFixture {
+	t.Helper()
+	system := System(db)
+	f := &tenantFixture{
+		orgA: models.Organization{Name: "Org A", Slug: "org-a"},
+		orgB: models.Organization{Name: "Org B", Slug: "org-b"},
+	}
+	for _, org := range []*models.Organization{&f.orgA, &f.orgB} {
+		if err := system.Create(org).Error; err != nil {
+			t.Fatalf("create organization: %v", err)
+		}
+	}
+	f.roleA = models.Role{OrganizationID: f.orgA.ID, Name: "reader"}
+	f.roleB = models.Role{OrganizationID: f.orgB.ID, Name: "reader"}
+	for _, role := range []*models.Role{&f.roleA, &f.roleB} {
+		if err := system.Create(role).Error; err != nil {
+			t.Fatalf("create role: %v", err)
+		}
+	}
+	f.userA = models.User{OrganizationID: f.orgA.ID, Username: "alice", Password: "x", RoleID: f.roleA.ID}
+	f.userB = models.User{OrganizationID: f.orgB.ID, Username: "bob", Password: "x", RoleID: f.roleB.ID}
+	for _, user := range []*models.User{&f.userA, &f.userB} {
+		if err := system.Create(user).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return f
+}
+
+func TestTenantScopesQueries(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db)
+
+	var users []models.User
+	if err := db.WithContext(WithOrganization(context.Background(), f.orgA.ID)).Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != f.userA.ID {
+		t.Fatalf("organization A sees %+v, want only alice", users)
+	}
+
+	if err := db.WithContext(context.Background()).Find(&users).Error; !errors.Is(err, ErrMissingTenant) {
+		t.Fatalf("query without organization: got %v, want ErrMissingTenant", err)
+	}
+
+	created := models.User{Username: "carol", Password: "x", RoleID: f.roleA.ID}
+	if err := db.WithContext(WithOrganization(context.Background(), f.orgA.ID)).Create(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if created.OrganizationID != f.orgA.ID {
+		t.Fatalf("created user has organization %d, want %d", created.OrganizationID, f.orgA.ID)
+	}
+	foreign := models.User{OrganizationID: f.orgB.ID, Username: "dave", Password: "x", RoleID: f.roleB.ID}
+	if err := db.WithContext(WithOrganization(context.Background(), f.orgA.ID)).Create(&foreign).Error; !errors.Is(err, ErrCrossTenant) {
+		t.Fatalf("insert into another organization: got %v, want ErrCrossTenant", err)
+	}
+}
+
+func TestTenantRejectsRawSQL(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db)
+	scoped := db.WithContext(WithOrganization(context.Background(), f.orgA.ID))
+
+	var names []string
+	if err := scoped.Raw("SELECT username FROM users").Scan(&names).Error; !errors.Is(err, ErrRawTenantSQL) {
+		t.Fatalf("Raw on a tenant table: got %v, want ErrRawTenantSQL", err)
+	}
+	if err := scoped.Exec("UPDATE users SET disabled = ?", true).Error; !errors.Is(err, ErrRawTenantSQL) {
+		t.Fatalf("Exec on a tenant table: got %v, want ErrRawTenantSQL", err)
+	}
+	if err := db.WithContext(context.Background()).Raw("SELECT username FROM users").Scan(&names).Error; !errors.Is(err, ErrRawTenantSQL) {
+		t.Fatalf("Raw without organization: got %v, want ErrRawTenantSQL", err)
+	}
+
+	var disabled int64
+	if err := System(db).Model(&models.User{}).Where("disabled = ?", true).Count(&disabled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if disabled != 0 {
+		t.Fatalf("rejected Exec disabled %d users", disabled)
+	}
+
+	// Raw SQL on other tables, and any raw SQL in an unscoped context, is allowed
+	var version []int
+	if err := scoped.Raw("SELECT version FROM schema_migrations").Scan(&version).Error; err != nil {
+		t.Fatalf("Raw on a global table: %v", err)
+	}
+	if err := System(db).Raw("SELECT username FROM users ORDER BY id").Scan(&names).Error; err != nil {
+		t.Fatalf("unscoped Raw: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("unscoped Raw returned %v, want both users", names)
+	}
+}
+
+func TestTenantScopesJoins(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db)
+	scoped := db.WithContext(WithOrganization(context.Background(), f.orgA.ID))
+
+	// Inconsistent rows pointing across organizations, which joins must not follow
+	foreignDocument := models.Document{OrganizationID: f.orgB.ID, Name: "b.pdf", Type: "application/pdf", URL: "b.pdf", OwnerID: f.userA.ID}
+	if err := System(db).Create(&foreignDocument).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := System(db).Model(&f.userA).Update("role_id", f.roleB.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Raw LEFT JOIN: the user is kept, the document of the other organization is not counted
+	var owners []struct {
+		Username string
+		DocCount int64
+	}
+	if err := scoped.Table("users").
+		Select("users.username, COUNT(documents.id) AS doc_count").
+		Joins("LEFT JOIN documents ON users.id = documents.owner_id").
+		Group("users.username").
+		Scan(&owners).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 1 || owners[0].Username != "alice" || owners[0].DocCount != 0 {
+		t.Fatalf("LEFT JOIN returned %+v, want alice with 0 documents", owners)
+	}
+
+	// Raw INNER JOIN
+	var count int64
+	if err := scoped.Model(&models.User{}).
+		Joins("JOIN roles r ON r.id = users.role_id").
+		Where("r.name = ?", "reader").
+		Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("JOIN matched %d users through a role of another organization", count)
+	}
+
+	// Association join
+	var user models.User
+	if err := scoped.Joins("Role").First(&user, f.userA.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role.ID != 0 {
+		t.Fatalf("association join loaded role %d of another organization", user.Role.ID)
+	}
+
+	// Joins of the system context are left alone
+	if err := System(db).Joins("Role").First(&user, f.userA.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role.ID != f.roleB.ID {
+		t.Fatalf("unscoped association join loaded role %d, want %d", user.Role.ID, f.roleB.ID)
+	}
+}
@@ -0,0 +1,161 @@
+// Package encryption protects the stored files with envelope encryption: every file is encrypted with its own
+// random data key (AES-256-GCM), and the data key is stored next to the content, wrapped by a master key held
+// by a KeyProvider. Rotating the master key only rewraps the data keys, the content is never re-encrypted.
+package encryption
+
+import (
+	"archiv-system/internal/config"
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrUnknownKey    = errors.New("unknown master key")
+	ErrNoKeyProvider = errors.New("no master key configured")
+	ErrInvalidKeyID  = errors.New("key id must be 1 to 64 letters, digits, dots, dashes or underscores")
+)
+
+// keySize is the size of the master keys and data keys (AES-256)
+const keySize = 32
+
+// keyIDPattern keeps key ids short enough for the file header and safe to print
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// KeyProvider wraps and unwraps the data keys with master keys. The local keyfile is the only provider for now;
+// a KMS or Vault provider implements the same methods, calling the service instead of holding the keys.
+type KeyProvider interface {
+	// KeyID identifies the master key wrapping new data keys
+	KeyID() string
+	// Wrap encrypts a data key with the current master key and returns the id of that key
+	Wrap(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped by the master key keyID, which may be an older key
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// NewKeyProvider returns the key provider of the configuration
+func NewKeyProvider(cfg config.EncryptionConfig) (KeyProvider, error) {
+	switch cfg.Provider {
+	case config.KeyProviderLocal:
+		return NewLocalKeyProvider(cfg.KeyFile)
+	default:
+		return nil, fmt.Errorf("unsupported key provider '%s'", cfg.Provider)
+	}
+}
+
+// LocalKeyProvider holds the master keys read from a keyfile. Each line holds a key id and a base64-encoded
+// 32-byte key separated by a space; the last key wraps the new data keys, the others stay available to unwrap
+// the data keys wrapped before a rotation. Empty lines and lines starting with # are ignored.
+type LocalKeyProvider struct {
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// NewLocalKeyProvider reads the master keys of a keyfile
+func NewLocalKeyProvider(path string) (*LocalKeyProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyfile: %w", err)
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Mode().Perm()&0o077 != 0 {
+		slog.Warn("The keyfile is readable by other users, restrict it with chmod 600", "path", path)
+	}
+
+	lp := &LocalKeyProvider{keys: make(map[string]cipher.AEAD)}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("keyfile line %d: expected \"<id> <base64 key>\"", lineNumber)
+		}
+		id := fields[0]
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("keyfile line %d: %w", lineNumber, ErrInvalidKeyID)
+		}
+		if _, exists := lp.keys[id]; exists {
+			return nil, fmt.Errorf("keyfile line %d: duplicate key id '%s'", lineNumber, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("keyfile line %d: key must be %d bytes encoded in base64", lineNumber, keySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		lp.keys[id] = aead
+		lp.current = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if lp.current == "" {
+		return nil, fmt.Errorf("keyfile %s holds no key", path)
+	}
+	return lp, nil
+}
+
+func (lp *LocalKeyProvider) KeyID() string {
+	return lp.current
+}
+
+// Wrap seals the data key with the current master key; the key id is authenticated along with it
+func (lp *LocalKeyProvider) Wrap(_ context.Context, dataKey []byte) (string, []byte, error) {
+	aead := lp.keys[lp.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(dataKey)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return lp.current, aead.Seal(nonce, nonce, dataKey, []byte(lp.current)), nil
+}
+
+func (lp *LocalKeyProvider) Unwrap(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := lp.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrCorrupted
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key does not match master key '%s'", ErrCorrupted, keyID)
+	}
+	return dataKey, nil
+}
+
+// GenerateKey returns a keyfile line holding a new random master key
+func GenerateKey(id string) (string, error) {
+	if !keyIDPattern.MatchString(id) {
+		return "", ErrInvalidKeyID
+	}
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return id + " " + base64.StdEncoding.EncodeToString(key), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,72 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalKeyProvider(t *testing.T) {
+	first, second := generateKey(t, "2024-01"), generateKey(t, "2025-01")
+	keys := newKeys(t, "# rotated yearly", "", first, second)
+	if keys.KeyID() != "2025-01" {
+		t.Fatalf("current key %s, want the last one", keys.KeyID())
+	}
+
+	ctx := context.Background()
+	dataKey := []byte(strings.Repeat("d", keySize))
+	keyID, wrapped, err := keys.Wrap(ctx, dataKey)
+	if err != nil || keyID != "2025-01" {
+		t.Fatalf("wrapped with %s (%v), want the current key", keyID, err)
+	}
+	if unwrapped, err := keys.Unwrap(ctx, keyID, wrapped); err != nil || string(unwrapped) != string(dataKey) {
+		t.Fatalf("unwrap: %v", err)
+	}
+	// The key id is authenticated with the wrapped key
+	if _, err := keys.Unwrap(ctx, "2024-01", wrapped); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("unwrap under another key id: got %v, want ErrCorrupted", err)
+	}
+	if _, err := keys.Unwrap(ctx, "2023-01", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("unwrap with a removed key: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestLocalKeyProviderRejectsInvalidKeyfiles(t *testing.T) {
+	valid := generateKey(t, "k1")
+	tests := map[string]string{
+		"no key":         "# nothing yet\n",
+		"invalid id":     "k/1 " + strings.Fields(valid)[1] + "\n",
+		"duplicate id":   valid + "\n" + valid + "\n",
+		"short key":      "k1 c2hvcnQ=\n",
+		"not base64":     "k1 not-base64!\n",
+		"missing key":    "k1\n",
+		"too many parts": valid + " extra\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewLocalKeyProvider(path); err == nil {
+				t.Fatal("keyfile accepted")
+			}
+		})
+	}
+	if _, err := NewLocalKeyProvider(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing keyfile accepted")
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	if _, err := GenerateKey(strings.Repeat("k", maxKeyIDSize+1)); !errors.Is(err, ErrInvalidKeyID) {
+		t.Fatalf("got %v, want ErrInvalidKeyID", err)
+	}
+	a, b := generateKey(t, "k1"), generateKey(t, "k1")
+	if a == b {
+		t.Fatal("two generated keys are equal")
+	}
+}
@@ -0,0 +1,290 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorrupted reports an encrypted file whose header or content was altered or truncated
+var ErrCorrupted = errors.New("encrypted file is corrupted")
+
+// An encrypted file starts with a fixed-size header, followed by the content cut into segments of segmentSize
+// bytes, each sealed with the data key. Header layout:
+//
+//	magic (8) | nonce prefix (7) | key id length (1) | key id (64) | wrapped key length (2) | wrapped key
+//
+// The header keeps its size whatever the key provider, so that a rotation rewrites it in place.
+const (
+	HeaderSize    = 512
+	segmentSize   = 64 << 10
+	prefixSize    = 7
+	maxKeyIDSize  = 64
+	wrappedOffset = len(Magic) + prefixSize + 1 + maxKeyIDSize + 2
+	maxWrapped    = HeaderSize - wrappedOffset
+)
+
+// Magic starts every encrypted file
+const Magic = "ARCENC01"
+
+// header is the decoded header of an encrypted file
+type header struct {
+	prefix  [prefixSize]byte
+	keyID   string
+	wrapped []byte
+}
+
+func (h *header) marshal() ([]byte, error) {
+	if len(h.keyID) > maxKeyIDSize {
+		return nil, ErrInvalidKeyID
+	}
+	if len(h.wrapped) > maxWrapped {
+		return nil, fmt.Errorf("wrapped data key too long: %d bytes, at most %d", len(h.wrapped), maxWrapped)
+	}
+	buf := make([]byte, HeaderSize)
+	offset := copy(buf, Magic)
+	offset += copy(buf[offset:], h.prefix[:])
+	buf[offset] = byte(len(h.keyID))
+	copy(buf[offset+1:], h.keyID)
+	binary.BigEndian.PutUint16(buf[wrappedOffset-2:], uint16(len(h.wrapped)))
+	copy(buf[wrappedOffset:], h.wrapped)
+	return buf, nil
+}
+
+func parseHeader(buf []byte) (*header, error) {
+	if len(buf) < HeaderSize || !bytes.HasPrefix(buf, []byte(Magic)) {
+		return nil, fmt.Errorf("%w: invalid header", ErrCorrupted)
+	}
+	h := &header{}
+	offset := len(Magic)
+	offset += copy(h.prefix[:], buf[offset:])
+	keyIDSize := int(buf[offset])
+	wrappedSize := int(binary.BigEndian.Uint16(buf[wrappedOffset-2:]))
+	if keyIDSize == 0 || keyIDSize > maxKeyIDSize || wrappedSize > maxWrapped {
+		return nil, fmt.Errorf("%w: invalid header", ErrCorrupted)
+	}
+	h.keyID = string(buf[offset+1 : offset+1+keyIDSize])
+	h.wrapped = append([]byte(nil), buf[wrappedOffset:wrappedOffset+wrappedSize]...)
+	return h, nil
+}
+
+// nonce derives the nonce of a segment from the random prefix of the file, the segment number and whether it is
+// the last one, so that segments cannot be reordered, dropped or the file truncated without detection
+func nonce(prefix [prefixSize]byte, counter uint32, last bool) []byte {
+	n := make([]byte, prefixSize+5)
+	copy(n, prefix[:])
+	binary.BigEndian.PutUint32(n[prefixSize:], counter)
+	if last {
+		n[prefixSize+4] = 1
+	}
+	return n
+}
+
+// NewWriter writes the header of a new encrypted file to w, with a fresh data key wrapped by keys, and returns
+// the writer encrypting the content. Close must be called to seal the last segment; it does not close w.
+func NewWriter(ctx context.Context, w io.Writer, keys KeyProvider) (io.WriteCloser, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &header{}
+	if _, err := io.ReadFull(rand.Reader, h.prefix[:]); err != nil {
+		return nil, err
+	}
+	if h.keyID, h.wrapped, err = keys.Wrap(ctx, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	buf, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, prefix: h.prefix, buf: make([]byte, 0, segmentSize+aead.Overhead())}, nil
+}
+
+type writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  [prefixSize]byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+func (ew *writer) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed encryption writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data comes, the last segment being sealed differently
+		if len(ew.buf) == segmentSize {
+			if err := ew.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(ew.buf[len(ew.buf):segmentSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last segment, which may be empty
+func (ew *writer) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.seal(true)
+}
+
+func (ew *writer) seal(last bool) error {
+	if ew.counter == ^uint32(0) {
+		return errors.New("file too large to encrypt")
+	}
+	sealed := ew.aead.Seal(ew.buf[:0], nonce(ew.prefix, ew.counter, last), ew.buf, nil)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// NewReader reads the header of an encrypted file from r, unwraps its data key with keys and returns the
+// reader decrypting the content. Reads fail with ErrCorrupted when the content was altered or truncated.
+func NewReader(ctx context.Context, r io.Reader, keys KeyProvider) (io.Reader, error) {
+	buf := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: truncated header", ErrCorrupted)
+		}
+		return nil, err
+	}
+	h, err := parseHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, ErrNoKeyProvider
+	}
+	dataKey, err := keys.Unwrap(ctx, h.keyID, h.wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(dataKey) != keySize {
+		return nil, fmt.Errorf("%w: invalid data key", ErrCorrupted)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: bufio.NewReaderSize(r, segmentSize+aead.Overhead()), aead: aead, prefix: h.prefix,
+		buf: make([]byte, segmentSize+aead.Overhead())}, nil
+}
+
+type reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  [prefixSize]byte
+	counter uint32
+	buf     []byte
+	plain   []byte
+	done    bool
+}
+
+func (dr *reader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+// open decrypts the next segment, the last one being the segment followed by the end of the file
+func (dr *reader) open() error {
+	n, err := io.ReadFull(dr.r, dr.buf)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := dr.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < dr.aead.Overhead() {
+		return fmt.Errorf("%w: truncated content", ErrCorrupted)
+	}
+
+	plain, err := dr.aead.Open(dr.buf[:0], nonce(dr.prefix, dr.counter, last), dr.buf[:n], nil)
+	if err != nil {
+		return fmt.Errorf("%w: segment %d does not authenticate", ErrCorrupted, dr.counter)
+	}
+	dr.counter++
+	dr.plain, dr.done = plain, last
+	return nil
+}
+
+// Rewrap returns header, the header of an encrypted file, with the data key wrapped again by the current master
+// key of keys; the content of the file is untouched. It reports whether the header changed, which it does not
+// when the data key is already wrapped by the current master key. The new header has the size of the old one,
+// the caller writes it in its place.
+func Rewrap(ctx context.Context, header []byte, keys KeyProvider) ([]byte, bool, error) {
+	h, err := parseHeader(header)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.keyID == keys.KeyID() {
+		return header, false, nil
+	}
+
+	dataKey, err := keys.Unwrap(ctx, h.keyID, h.wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.keyID, h.wrapped, err = keys.Wrap(ctx, dataKey); err != nil {
+		return nil, false, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	buf, err := h.marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, true, nil
+}
+
+// KeyID returns the id of the master key wrapping the data key of header, the header of an encrypted file, once
+// keys unwrapped it: content merely starting like an encrypted file fails with ErrCorrupted or ErrUnknownKey.
+func KeyID(ctx context.Context, header []byte, keys KeyProvider) (string, error) {
+	h, err := parseHeader(header)
+	if err != nil {
+		return "", err
+	}
+	if _, err := keys.Unwrap(ctx, h.keyID, h.wrapped); err != nil {
+		return "", err
+	}
+	return h.keyID, nil
+}
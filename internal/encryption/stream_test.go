@@ -0,0 +1,201 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newKeys returns a key provider reading the keyfile lines, the last line holding the current key
+func newKeys(t *testing.T, lines ...string) *LocalKeyProvider {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewLocalKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func generateKey(t *testing.T, id string) string {
+	t.Helper()
+	line, err := GenerateKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func encrypt(t *testing.T, keys KeyProvider, plain []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	w, err := NewWriter(context.Background(), &sealed, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sealed.Bytes()
+}
+
+func decrypt(keys KeyProvider, sealed []byte) ([]byte, error) {
+	r, err := NewReader(context.Background(), bytes.NewReader(sealed), keys)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	keys := newKeys(t, generateKey(t, "k1"))
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3 * segmentSize} {
+		plain := randomBytes(t, size)
+		sealed := encrypt(t, keys, plain)
+		if segments := (size + segmentSize - 1) / segmentSize; size > 0 && len(sealed) != HeaderSize+size+segments*16 {
+			t.Errorf("%d bytes: %d bytes encrypted, want the header and %d sealed segments", size, len(sealed), segments)
+		}
+		if bytes.Contains(sealed, plain) && size > 0 {
+			t.Errorf("%d bytes: plaintext found in the encrypted file", size)
+		}
+		got, err := decrypt(keys, sealed)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: decrypted %d bytes that differ from the plaintext", size, len(got))
+		}
+	}
+}
+
+func TestCorruptionDetected(t *testing.T) {
+	keys := newKeys(t, generateKey(t, "k1"))
+	// Two full segments and a short last one
+	sealed := encrypt(t, keys, randomBytes(t, 2*segmentSize+10))
+	full := segmentSize + 16
+	segment := func(i int) []byte {
+		start := HeaderSize + i*full
+		return sealed[start:min(start+full, len(sealed))]
+	}
+
+	tests := []struct {
+		name  string
+		alter func() []byte
+	}{
+		{"tampered segment", func() []byte {
+			altered := bytes.Clone(sealed)
+			altered[HeaderSize+full+100] ^= 1
+			return altered
+		}},
+		{"reordered segments", func() []byte {
+			return bytes.Join([][]byte{sealed[:HeaderSize], segment(1), segment(0), segment(2)}, nil)
+		}},
+		{"last segment dropped", func() []byte {
+			return sealed[:HeaderSize+2*full]
+		}},
+		{"truncated segment", func() []byte {
+			return sealed[:len(sealed)-5]
+		}},
+		{"last segment duplicated", func() []byte {
+			return bytes.Join([][]byte{sealed, segment(2)}, nil)
+		}},
+		{"truncated header", func() []byte {
+			return sealed[:HeaderSize-1]
+		}},
+		{"tampered wrapped key", func() []byte {
+			altered := bytes.Clone(sealed)
+			altered[wrappedOffset] ^= 1
+			return altered
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(keys, tt.alter()); !errors.Is(err, ErrCorrupted) {
+				t.Fatalf("got %v, want ErrCorrupted", err)
+			}
+		})
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	sealed := encrypt(t, newKeys(t, generateKey(t, "k1")), []byte("archived"))
+	if _, err := decrypt(newKeys(t, generateKey(t, "k2")), sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("got %v, want ErrUnknownKey", err)
+	}
+	// A key with the same id but other bytes does not unwrap the data key
+	if _, err := decrypt(newKeys(t, generateKey(t, "k1")), sealed); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("got %v, want ErrCorrupted", err)
+	}
+	if _, err := decrypt(nil, sealed); !errors.Is(err, ErrNoKeyProvider) {
+		t.Fatalf("got %v, want ErrNoKeyProvider", err)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	ctx := context.Background()
+	first, second := generateKey(t, "k1"), generateKey(t, "k2")
+	plain := randomBytes(t, segmentSize+1)
+	sealed := encrypt(t, newKeys(t, first), plain)
+
+	rotated := newKeys(t, first, second)
+	header, rewrapped, err := Rewrap(ctx, sealed[:HeaderSize], rotated)
+	if err != nil || !rewrapped {
+		t.Fatalf("rewrap: %v, rewrapped %v", err, rewrapped)
+	}
+	if len(header) != HeaderSize {
+		t.Fatalf("new header of %d bytes, want %d", len(header), HeaderSize)
+	}
+	if keyID, err := KeyID(ctx, header, rotated); err != nil || keyID != "k2" {
+		t.Fatalf("key id %q (%v), want k2", keyID, err)
+	}
+	rewritten := append(header, sealed[HeaderSize:]...)
+
+	// Only the new key is needed once rewrapped, the content was not re-encrypted
+	if !bytes.Equal(rewritten[HeaderSize:], sealed[HeaderSize:]) {
+		t.Error("content changed by the rewrap")
+	}
+	got, err := decrypt(newKeys(t, second), rewritten)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("decrypting with the new key: %v", err)
+	}
+
+	// A header already wrapped by the current key is left alone
+	if _, rewrapped, err := Rewrap(ctx, header, rotated); err != nil || rewrapped {
+		t.Fatalf("second rewrap: %v, rewrapped %v", err, rewrapped)
+	}
+	if _, _, err := Rewrap(ctx, sealed[:HeaderSize], newKeys(t, second)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("rewrap without the old key: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyIDRejectsLookalikes(t *testing.T) {
+	keys := newKeys(t, generateKey(t, "k1"))
+	// Plaintext starting with the magic, padded to a header
+	lookalike := append([]byte(Magic), make([]byte, HeaderSize)...)
+	lookalike[len(Magic)+prefixSize] = 2
+	copy(lookalike[len(Magic)+prefixSize+1:], "k1")
+	if _, err := KeyID(context.Background(), lookalike, keys); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("got %v, want ErrCorrupted", err)
+	}
+}
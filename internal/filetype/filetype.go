@@ -0,0 +1,151 @@
+// Package filetype detects the content type of files from their bytes and matches content types against
+// allow-list patterns such as "application/pdf", "image/*" or "*/*".
+package filetype
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ErrInvalidPattern is returned for a pattern that is not "type/subtype", "type/*" or "*/*"
+var ErrInvalidPattern = errors.New("content type patterns must look like type/subtype, type/* or */*")
+
+// sniffSize is the number of bytes read to detect a content type
+const sniffSize = 3072
+
+var patternSyntax = regexp.MustCompile(`^(\*/\*|[a-z0-9][a-z0-9!#$&^_.+-]*/(\*|[a-z0-9][a-z0-9!#$&^_.+-]*))$`)
+
+// Detect reads the start of r and returns the detected type, and the bytes read, which the caller
+// must put back in front of the rest of r (e.g. with io.MultiReader)
+func Detect(r io.Reader) (*mimetype.MIME, []byte, error) {
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil, err
+	}
+	head = head[:n]
+	return mimetype.Detect(head), head, nil
+}
+
+// Normalize lowercases a content type and drops its parameters ("Text/HTML; charset=utf-8" gives "text/html")
+func Normalize(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// MediaType returns the detected type without parameters
+func MediaType(detected *mimetype.MIME) string {
+	return Normalize(detected.String())
+}
+
+// DeclaredMatches reports whether a content type declared by a client agrees with the detected one.
+// Generic declarations (none, application/octet-stream) claim nothing. A declared ancestor of the detected
+// type agrees (application/zip for a .docx). Plain text agrees with any textual declaration, and
+// undetected binary content with any type the detector does not know.
+func DeclaredMatches(declared string, detected *mimetype.MIME) bool {
+	declared = Normalize(declared)
+	if declared == "" || declared == "application/octet-stream" {
+		return true
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(declared) {
+			return true
+		}
+	}
+	switch {
+	case detected.Is("text/plain"):
+		return textual(declared)
+	case detected.Is("application/octet-stream"):
+		return mimetype.Lookup(declared) == nil
+	}
+	return false
+}
+
+// textual reports whether a content type designates text the detector may only recognize as plain text
+func textual(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-javascript",
+		"application/yaml", "application/x-yaml", "application/x-sh", "application/sql":
+		return true
+	}
+	return false
+}
+
+// ParsePatterns validates and normalizes a list of patterns, dropping empty entries and duplicates
+func ParsePatterns(patterns []string) ([]string, error) {
+	seen := make(map[string]bool, len(patterns))
+	parsed := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" || seen[pattern] {
+			continue
+		}
+		if !patternSyntax.MatchString(pattern) {
+			return nil, fmt.Errorf("%w: '%s'", ErrInvalidPattern, pattern)
+		}
+		seen[pattern] = true
+		parsed = append(parsed, pattern)
+	}
+	return parsed, nil
+}
+
+// Split parses a comma-separated list of patterns as stored in the database, skipping invalid entries
+func Split(list string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		if parsed, err := ParsePatterns([]string{pattern}); err == nil {
+			patterns = append(patterns, parsed...)
+		}
+	}
+	return patterns
+}
+
+// Allowed reports whether a media type matches one of the patterns; an empty list allows every type
+func Allowed(patterns []string, mediaType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if specificity(pattern, mediaType) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit returns the value of the most specific pattern matching a media type (exact type, then type/*,
+// then */*), and false when none matches
+func Limit(limits map[string]int64, mediaType string) (int64, bool) {
+	best, value := 0, int64(0)
+	for pattern, limit := range limits {
+		if s := specificity(strings.ToLower(pattern), mediaType); s > best {
+			best, value = s, limit
+		}
+	}
+	return value, best > 0
+}
+
+// specificity ranks how a pattern matches a media type: 3 exactly, 2 by type/*, 1 by */*, 0 not at all
+func specificity(pattern, mediaType string) int {
+	switch {
+	case pattern == mediaType:
+		return 3
+	case pattern == "*/*":
+		return 1
+	case strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")):
+		return 2
+	}
+	return 0
+}
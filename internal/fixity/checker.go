@@ -0,0 +1,229 @@
+package fixity
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/encryption"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/models"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// batchSize is the number of documents loaded at once during a pass
+const batchSize = 100
+
+// maxAlertLines bounds the failures listed in one alert message
+const maxAlertLines = 50
+
+// Checker verifies the stored files against the checksums recorded at upload. A file is verified again
+// once its last check is older than the configured interval; failures are recorded as fixity events.
+type Checker struct {
+	documents repository.DocumentRepository
+	events    repository.FixityEventRepository
+	store     *storage.Store
+	notifier  notify.Notifier // sends the alerts
+	cfg       config.FixityConfig
+}
+
+func NewChecker(documents repository.DocumentRepository, events repository.FixityEventRepository, store *storage.Store,
+	notifier notify.Notifier, cfg config.FixityConfig) *Checker {
+	return &Checker{documents: documents, events: events, store: store, notifier: notifier, cfg: cfg}
+}
+
+// Summary is the outcome of a pass
+type Summary struct {
+	Checked   int
+	BytesRead int64
+	Failures  []models.FixityEvent
+}
+
+// Run verifies the files due for a check, then looks for due files again regularly, until ctx is cancelled
+func (c *Checker) Run(ctx context.Context) {
+	poll := c.cfg.Interval
+	if poll > time.Hour {
+		poll = time.Hour
+	}
+	for {
+		summary, err := c.Pass(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Fixity pass failed", "error", err)
+		} else if summary.Checked > 0 {
+			slog.InfoContext(ctx, "Fixity pass completed", "checked", summary.Checked,
+				"bytes_read", summary.BytesRead, "failures", len(summary.Failures))
+		}
+
+		timer := time.NewTimer(poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Pass verifies every document never checked or last checked before the interval, in every organization,
+// and sends one alert listing the failures
+func (c *Checker) Pass(ctx context.Context) (summary Summary, err error) {
+	ctx, span := tracing.Start(ctx, "fixity.Pass")
+	defer func() {
+		span.SetAttributes(attribute.Int("fixity.checked", summary.Checked), attribute.Int("fixity.failures", len(summary.Failures)))
+		tracing.End(span, err)
+	}()
+
+	unscoped := database.Unscoped(ctx)
+	cutoff := time.Now().Add(-c.cfg.Interval)
+	limit := newLimiter(c.cfg.RateLimit())
+	defer func() {
+		if len(summary.Failures) > 0 {
+			c.alert(ctx, summary.Failures)
+		}
+	}()
+
+	var lastID uint
+	for {
+		documents, err := c.documents.Find(unscoped, repository.DocumentQuery{AfterID: lastID, CheckedBefore: &cutoff}, 0, batchSize)
+		if err != nil {
+			return summary, err
+		}
+		if len(documents) == 0 {
+			return summary, nil
+		}
+
+		for i := range documents {
+			document := &documents[i]
+			lastID = document.ID
+			event, size, err := c.check(ctx, document, limit)
+			if err != nil {
+				return summary, err
+			}
+			summary.Checked++
+			summary.BytesRead += size
+			if event != nil {
+				summary.Failures = append(summary.Failures, *event)
+			}
+		}
+	}
+}
+
+// check verifies one document and records the outcome. It returns the event recorded on failure,
+// and an error only when the pass must stop (context done, database failure).
+func (c *Checker) check(ctx context.Context, document *models.Document, limit *limiter) (*models.FixityEvent, int64, error) {
+	backfill := document.SHA256 == ""
+	digests, size, readErr := compute(ctx, c.store, document.URL, document.Encryption, document.SHA512 != "" || (backfill && c.cfg.SHA512), limit)
+	if ctx.Err() != nil {
+		return nil, size, ctx.Err()
+	}
+
+	outcome, detail := models.FixityOK, ""
+	updates := map[string]interface{}{}
+	switch {
+	case errors.Is(readErr, os.ErrNotExist):
+		outcome, detail = models.FixityMissing, "file not found in storage"
+	case errors.Is(readErr, encryption.ErrCorrupted):
+		// The authentication of an encrypted file fails before any checksum can be compared
+		outcome, detail = models.FixityMismatch, readErr.Error()
+	case readErr != nil:
+		outcome, detail = models.FixityError, readErr.Error()
+	case backfill:
+		// Uploaded before checksums were recorded: the current content becomes the reference, with the
+		// algorithms recorded at upload today
+		updates["sha256"] = digests.SHA256
+		if digests.SHA512 != "" {
+			updates["sha512"] = digests.SHA512
+		}
+		slog.InfoContext(ctx, "Recorded the checksum of a document uploaded before fixity checks", "document_id", document.ID)
+	case digests.SHA256 != document.SHA256:
+		outcome, detail = models.FixityMismatch, "SHA-256 differs from the checksum recorded at upload"
+	case document.SHA512 != "" && digests.SHA512 != document.SHA512:
+		outcome, detail = models.FixityMismatch, "SHA-512 differs from the checksum recorded at upload"
+	}
+	metrics.ObserveFixity(outcome, size)
+
+	scoped := database.WithOrganization(ctx, document.OrganizationID)
+	updates["fixity_status"] = outcome
+	updates["fixity_checked_at"] = time.Now()
+	// UpdateColumns leaves updated_at alone: a check does not change the document
+	if err := c.documents.UpdateColumns(scoped, document.ID, updates); err != nil {
+		return nil, size, fmt.Errorf("failed to record the fixity of document %d: %w", document.ID, err)
+	}
+	if outcome == models.FixityOK {
+		if backfill {
+			return nil, size, c.recordBackfill(scoped, document, digests)
+		}
+		return nil, size, nil
+	}
+
+	event := models.FixityEvent{
+		DocumentID:     document.ID,
+		Outcome:        outcome,
+		ExpectedSHA256: document.SHA256,
+		ActualSHA256:   digests.SHA256,
+		Detail:         detail,
+	}
+	if err := c.events.Create(scoped, &event); err != nil {
+		return nil, size, fmt.Errorf("failed to record the fixity event of document %d: %w", document.ID, err)
+	}
+	slog.ErrorContext(ctx, "Fixity check failed", "document_id", document.ID, "organization_id", document.OrganizationID,
+		"outcome", outcome, "path", document.URL, "detail", detail)
+	return &event, size, nil
+}
+
+// recordBackfill records that the checksums of a document were computed from its stored copy, which may
+// already differ from the uploaded file, rather than at upload
+func (c *Checker) recordBackfill(ctx context.Context, document *models.Document, digests Digests) error {
+	algorithms := "SHA-256"
+	if digests.SHA512 != "" {
+		algorithms += " and SHA-512"
+	}
+	event := models.FixityEvent{
+		DocumentID:   document.ID,
+		Outcome:      models.FixityBackfilled,
+		ActualSHA256: digests.SHA256,
+		Detail:       fmt.Sprintf("no checksum was recorded at upload, %s computed from the stored copy", algorithms),
+	}
+	if err := c.events.Create(ctx, &event); err != nil {
+		return fmt.Errorf("failed to record the checksum backfill of document %d: %w", document.ID, err)
+	}
+	return nil
+}
+
+// alert notifies the configured recipient of the failures of a pass; they are logged in any case
+func (c *Checker) alert(ctx context.Context, failures []models.FixityEvent) {
+	if c.cfg.AlertTo == "" {
+		return
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "%d stored files failed their fixity check:\n\n", len(failures))
+	for i, event := range failures {
+		if i == maxAlertLines {
+			fmt.Fprintf(&body, "... and %d more, see the fixity events\n", len(failures)-maxAlertLines)
+			break
+		}
+		fmt.Fprintf(&body, "- document %d (organization %d): %s, %s\n", event.DocumentID, event.OrganizationID, event.Outcome, event.Detail)
+	}
+
+	msg := notify.Message{
+		To:      c.cfg.AlertTo,
+		Subject: fmt.Sprintf("Archive fixity alert: %d failed checks", len(failures)),
+		Body:    body.String(),
+	}
+	if err := c.notifier.Notify(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to send the fixity alert", "to", c.cfg.AlertTo, "error", err)
+	}
+}
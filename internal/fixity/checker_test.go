@@ -0,0 +1,90 @@
+package fixity
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPassBackfillsMissingChecksums(t *testing.T) {
+	db, err := database.Open(config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := database.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	system := database.System(db)
+
+	organization := models.Organization{Name: "Archive", Slug: "archive"}
+	if err := system.Create(&organization).Error; err != nil {
+		t.Fatal(err)
+	}
+	role := models.Role{OrganizationID: organization.ID, Name: "user"}
+	if err := system.Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	owner := models.User{OrganizationID: organization.ID, Username: "owner", Password: "x", RoleID: role.ID}
+	if err := system.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("uploaded before fixity checks")
+	path := filepath.Join(t.TempDir(), "legacy.txt")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	document := models.Document{OrganizationID: organization.ID, Name: "legacy.txt", Type: "text/plain", URL: path, OwnerID: owner.ID}
+	if err := system.Create(&document).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := storage.New(config.StorageConfig{Backend: "local", Path: t.TempDir()}, config.EncryptionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := repository.NewGorm(db)
+	checker := NewChecker(repos.Documents, repos.FixityEvents, store, notify.LogNotifier{},
+		config.FixityConfig{Interval: time.Hour, SHA512: true})
+	summary, err := checker.Pass(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Checked != 1 || len(summary.Failures) != 0 {
+		t.Fatalf("pass checked %d documents with %d failures, want 1 and 0", summary.Checked, len(summary.Failures))
+	}
+
+	sum256, sum512 := sha256.Sum256(content), sha512.Sum512(content)
+	if err := system.First(&document, document.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if document.SHA256 != hex.EncodeToString(sum256[:]) || document.SHA512 != hex.EncodeToString(sum512[:]) {
+		t.Fatalf("backfilled checksums %q / %q do not match the stored copy", document.SHA256, document.SHA512)
+	}
+	if document.FixityStatus != models.FixityOK {
+		t.Fatalf("fixity status %q, want %q", document.FixityStatus, models.FixityOK)
+	}
+
+	var events []models.FixityEvent
+	if err := system.Where("document_id = ?", document.ID).Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Outcome != models.FixityBackfilled || events[0].ActualSHA256 != document.SHA256 {
+		t.Fatalf("events %+v, want one backfill event", events)
+	}
+	if want := "no checksum was recorded at upload, SHA-256 and SHA-512 computed from the stored copy"; events[0].Detail != want {
+		t.Fatalf("backfill detail %q, want %q", events[0].Detail, want)
+	}
+}
@@ -0,0 +1,112 @@
+// Package fixity records the checksums of the stored files and verifies them periodically, so that the
+// archive can prove that no file was silently lost or altered.
+package fixity
+
+import (
+	"archiv-system/internal/models"
+	"archiv-system/internal/storage"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"time"
+)
+
+// Digests are the hex-encoded checksums of a file. SHA512 is empty when it is not computed.
+type Digests struct {
+	SHA256 string
+	SHA512 string
+}
+
+// Compute reads a stored file and returns the checksums of its content, decrypted when encrypted,
+// including SHA-512 when withSHA512 is set
+func Compute(ctx context.Context, store *storage.Store, path string, enc models.Encryption, withSHA512 bool) (Digests, error) {
+	digests, _, err := compute(ctx, store, path, enc, withSHA512, nil)
+	return digests, err
+}
+
+// compute reads the file at path through the limiter (nil for no limit) and returns its checksums
+// and the number of bytes read
+func compute(ctx context.Context, store *storage.Store, path string, enc models.Encryption, withSHA512 bool, limit *limiter) (Digests, int64, error) {
+	file, err := store.Open(ctx, path, enc)
+	if err != nil {
+		return Digests{}, 0, err
+	}
+	defer file.Close()
+
+	sum256 := sha256.New()
+	var sum512 hash.Hash
+	writer := io.Writer(sum256)
+	if withSHA512 {
+		sum512 = sha512.New()
+		writer = io.MultiWriter(sum256, sum512)
+	}
+
+	size, err := io.CopyBuffer(writer, &limitedReader{ctx: ctx, r: file, limit: limit}, make([]byte, 64<<10))
+	if err != nil {
+		return Digests{}, size, err
+	}
+	digests := Digests{SHA256: hex.EncodeToString(sum256.Sum(nil))}
+	if sum512 != nil {
+		digests.SHA512 = hex.EncodeToString(sum512.Sum(nil))
+	}
+	return digests, size, nil
+}
+
+// limiter spreads reads over time so that they stay under rate bytes per second on average.
+// Idle time is not saved up: a limiter left unused does not allow a burst afterwards.
+type limiter struct {
+	rate int64
+	next time.Time
+}
+
+func newLimiter(rate int64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate}
+}
+
+// wait blocks until n more bytes can be read, or ctx is done
+func (l *limiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+
+	delay := time.Until(l.next)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitedReader reads through a limiter and stops when its context is done
+type limitedReader struct {
+	ctx   context.Context
+	r     io.Reader
+	limit *limiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if waitErr := lr.limit.wait(lr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"archiv-system/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAuditEvents returns a page of the audit log, most recent first, optionally filtered by ?action=
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	events, total, err := h.audit.ListEvents(c.Request.Context(), c.Query("action"), page, pageSize)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch audit events", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Audit events fetched successfully", gin.H{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
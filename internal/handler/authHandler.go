@@ -1,17 +1,65 @@
 package handler
 
 import (
+	"archiv-system/internal/auth"
 	"archiv-system/internal/database"
-	"archiv-system/internal/models"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/services"
 	"archiv-system/internal/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // Register permet de créer un nouvel utilisateur
-func Register(c *gin.Context) {
+func (h *Handler) Register(c *gin.Context) {
+	var req struct {
+		Username     string `json:"username" binding:"required"`
+		Password     string `json:"password" binding:"required"`
+		Email        string `json:"email" binding:"omitempty,email"` // Optionnel, sert à réinitialiser le mot de passe
+		Organization string `json:"organization"`                    // Slug de l'organisation, "default" si absent
+	}
+
+	// Récupération des données d'entrée
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+	// Créer l'utilisateur dans l'organisation, avec le rôle "user"
+	user, err := h.users.Register(c.Request.Context(), services.RegisterInput{
+		Username:     req.Username,
+		Password:     req.Password,
+		Email:        req.Email,
+		Organization: req.Organization,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRegistrationClosed):
+			utils.RespondError(c, http.StatusBadRequest, "Registration is not open for this organization", nil)
+		case errors.Is(err, auth.ErrWeakPassword):
+			utils.RespondError(c, http.StatusBadRequest, "Password rejected", err.Error())
+		case errors.Is(err, services.ErrUsernameTaken):
+			utils.RespondError(c, http.StatusConflict, "Username already taken", nil)
+		default:
+			slog.ErrorContext(c.Request.Context(), "Failed to create user", "username", req.Username, "error", err)
+			utils.RespondError(c, http.StatusInternalServerError, "Failed to create user", err.Error())
+		}
+		return
+	}
+
+	// Répondre avec succès
+	utils.RespondJSON(c, http.StatusCreated, "User created successfully", gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+	})
+}
+
+// Login permet à un utilisateur de se connecter
+func (h *Handler) Login(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -23,46 +71,76 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Vérifier si le rôle "user" existe
-	var role models.Role
-	if err := database.DB.Where("name = ?", "user").First(&role).Error; err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch default role", err.Error())
-		log.Printf("Error fetching role 'user': %v", err)
+	// Vérification des identifiants (base locale ou annuaire LDAP)
+	user, err := h.authenticator.Authenticate(req.Username, req.Password, c.ClientIP())
+	if err != nil {
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			metrics.AuthFailure(metrics.AuthLocked)
+			retryAfter := int(math.Ceil(time.Until(locked.Until).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"message": "Too many failed logins, try again later"})
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			metrics.AuthFailure(metrics.AuthInvalidCredentials)
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid username or password"})
+		case errors.Is(err, auth.ErrUserDisabled):
+			metrics.AuthFailure(metrics.AuthDisabled)
+			c.JSON(http.StatusForbidden, gin.H{"message": "User account is disabled"})
+		default:
+			metrics.AuthFailure(metrics.AuthError)
+			slog.ErrorContext(c.Request.Context(), "Authentication error", "username", req.Username, "error", err)
+			utils.RespondError(c, http.StatusServiceUnavailable, "Authentication service unavailable", nil)
+		}
 		return
 	}
 
-	// Hacher le mot de passe
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// Génération d'un token JWT
+	token, err := h.tokens.GenerateToken(user.ID, user.OrganizationID, user.Role.Name)
 	if err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, "Failed to hash password", err.Error())
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to generate token", err.Error())
 		return
 	}
 
-	// Créer l'utilisateur
-	user := models.User{
-		Username: req.Username,
-		Password: string(hashedPassword),
-		RoleID:   role.ID, // Associer l'utilisateur au rôle "user"
+	// Enregistrer la date de connexion
+	ctx := database.WithOrganization(c.Request.Context(), user.OrganizationID)
+	if err := h.users.RecordLogin(ctx, user.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to record login", "user_id", user.ID, "error", err)
 	}
 
-	// Enregistrer l'utilisateur dans la base de données
-	if err := database.DB.Create(&user).Error; err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, "Failed to create user", err.Error())
+	// Répondre avec succès
+	utils.RespondJSON(c, http.StatusOK, "Login successful", gin.H{
+		"token":                token,
+		"must_change_password": user.MustChangePassword,
+	})
+}
+
+// ChangePassword permet à un utilisateur de changer son propre mot de passe
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+
+	// Récupération des données d'entrée
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
 		return
 	}
 
-	// Répondre avec succès
-	utils.RespondJSON(c, http.StatusCreated, "User created successfully", gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-	})
+	if err := h.users.ChangePassword(c.Request.Context(), c.GetUint("userID"), req.CurrentPassword, req.NewPassword); err != nil {
+		respondUserError(c, "Failed to change password", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, "Password changed successfully", nil)
 }
 
-// Login permet à un utilisateur de se connecter
-func Login(c *gin.Context) {
+// ForgotPassword envoie un jeton de réinitialisation à l'adresse e-mail de l'utilisateur.
+// La réponse est identique que le compte existe ou non.
+func (h *Handler) ForgotPassword(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
 	}
 
 	// Récupération des données d'entrée
@@ -71,26 +149,30 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Recherche de l'utilisateur dans la base de données
-	var user models.User
-	if err := database.DB.Preload("Role").Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid username or password"})
-		return
+	if err := h.passwords.RequestReset(c.Request.Context(), req.Username); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Password reset request failed", "username", req.Username, "error", err)
+	}
+
+	utils.RespondJSON(c, http.StatusOK, "If the account exists, a password reset link has been sent", nil)
+}
+
+// ResetPassword choisit un nouveau mot de passe à l'aide d'un jeton de réinitialisation
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
 	}
 
-	// Vérification du mot de passe
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid username or password"})
+	// Récupération des données d'entrée
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
 		return
 	}
 
-	// Génération d'un token JWT
-	token, err := utils.GenerateToken(user.ID, user.Role.Name)
-	if err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, "Failed to generate token", err.Error())
+	if err := h.passwords.ResetWithToken(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		respondUserError(c, "Failed to reset password", err)
 		return
 	}
 
-	// Répondre avec succès
-	utils.RespondJSON(c, http.StatusOK, "Login successful", gin.H{"token": token})
+	utils.RespondJSON(c, http.StatusOK, "Password reset successfully", nil)
 }
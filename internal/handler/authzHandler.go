@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExplainPermission shows why a user is allowed or denied a permission, optionally on a document
+// or folder: GET /admin/authz/explain?user_id=3&permission=update_document&document_id=42
+func (h *Handler) ExplainPermission(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query("user_id"), 10, 64)
+	if err != nil || userID == 0 {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid user_id parameter", nil)
+		return
+	}
+	permission := c.Query("permission")
+	if permission == "" {
+		utils.RespondError(c, http.StatusBadRequest, "The permission parameter is required", nil)
+		return
+	}
+	documentID, ok := parseOptionalIDQuery(c, "document_id")
+	if !ok {
+		return
+	}
+	folderID, ok := parseOptionalIDQuery(c, "folder_id")
+	if !ok {
+		return
+	}
+
+	var resource *authz.Resource
+	switch {
+	case documentID != nil && folderID != nil:
+		utils.RespondError(c, http.StatusBadRequest, "Give at most one of document_id or folder_id", nil)
+		return
+	case documentID != nil:
+		resource = authz.Document(*documentID)
+	case folderID != nil:
+		resource = authz.Folder(*folderID)
+	}
+
+	// Only users of the administrator's organization can be inspected
+	ctx := c.Request.Context()
+	if _, err := h.users.GetUser(ctx, uint(userID)); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.RespondError(c, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch user", err.Error())
+		return
+	}
+
+	decision, err := h.authz.Explain(ctx, uint(userID), permission, resource)
+	if err != nil {
+		if errors.Is(err, authz.ErrResourceNotFound) {
+			utils.RespondError(c, http.StatusNotFound, "Document or folder not found", nil)
+			return
+		}
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to evaluate permission", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Permission evaluated successfully", gin.H{"decision": decision})
+}
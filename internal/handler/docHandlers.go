@@ -1,11 +1,14 @@
 package handler
 
 import (
-	"archiv-system/internal/database"
+	"archiv-system/internal/metrics"
 	"archiv-system/internal/models"
 	"archiv-system/internal/services"
 	"archiv-system/internal/utils"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,7 +16,7 @@ import (
 )
 
 // UploadFile handles the uploading of documents
-func UploadFile(c *gin.Context) {
+func (h *Handler) UploadFile(c *gin.Context) {
 	// Récupérer l'ID de l'utilisateur
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -30,6 +33,11 @@ func UploadFile(c *gin.Context) {
 	// Récupérer le fichier de la requête
 	file, err := c.FormFile("file")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.RespondError(c, http.StatusRequestEntityTooLarge, "File too large", err.Error())
+			return
+		}
 		utils.RespondError(c, http.StatusBadRequest, "Failed to get file", err.Error())
 		return
 	}
@@ -38,24 +46,34 @@ func UploadFile(c *gin.Context) {
 	uploadedFile := &models.UploadedFile{
 		Filename:    file.Filename,
 		ContentType: file.Header.Get("Content-Type"),
-		Save: func(destination string) error {
-			return c.SaveUploadedFile(file, destination)
+		Size:        file.Size,
+		Open: func() (io.ReadCloser, error) {
+			return file.Open()
 		},
 	}
 
 	// Récupérer les tags de la requête
 	tags := c.PostForm("tags")
 
+	// Dossier de destination, facultatif
+	folderID, ok := parseFolderIDForm(c)
+	if !ok {
+		return
+	}
+
 	// Appeler la logique métier
 	input := services.UploadFileInput{
-		UserID: userIDUint,
-		File:   uploadedFile,
-		Tags:   &models.Tag{Name: tags},
+		UserID:   userIDUint,
+		File:     uploadedFile,
+		Tags:     &models.Tag{Name: tags},
+		FolderID: folderID,
 	}
 
-	document, err := services.ProcessFileUpload(input)
+	start := time.Now()
+	document, err := h.documents.ProcessFileUpload(c.Request.Context(), input)
+	metrics.ObserveUpload(file.Size, time.Since(start), err)
 	if err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, err.Error(), nil)
+		respondUploadError(c, err)
 		return
 	}
 
@@ -72,9 +90,9 @@ func UploadFile(c *gin.Context) {
 }
 
 // ViewListDoc handles the retrieval of all documents
-func ViewListDoc(c *gin.Context) {
-	var documents []models.Document
-	if database.DB.Find(&documents).Error != nil {
+func (h *Handler) ViewListDoc(c *gin.Context) {
+	documents, err := h.documents.ListDocuments(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
 		utils.RespondError(c, http.StatusBadRequest, "Failed to fetch documents", gin.H{"error": "Failed to fetch documents"})
 		return
 	}
@@ -82,8 +100,11 @@ func ViewListDoc(c *gin.Context) {
 }
 
 // UpdateDocument handles the updating of a document
-func UpdateDocument(c *gin.Context) {
-	docID := c.Param("id")
+func (h *Handler) UpdateDocument(c *gin.Context) {
+	docID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 	//valider les entrées
 	var updateRequest models.UpdateRequest
 	if err := c.BindJSON(&updateRequest); err != nil {
@@ -92,9 +113,12 @@ func UpdateDocument(c *gin.Context) {
 	}
 
 	// Appeler la logique métier
-	documentService := &services.DocumentService{}
-	updateDocument, err := documentService.ProcessFileUpdate(docID, updateRequest)
+	updateDocument, err := h.documents.ProcessFileUpdate(c.Request.Context(), docID, updateRequest)
 	if err != nil {
+		if errors.Is(err, services.ErrDocumentNotFound) {
+			utils.RespondError(c, http.StatusNotFound, "Document not found", nil)
+			return
+		}
 		utils.RespondError(c, http.StatusInternalServerError, "Failed to update document", err.Error())
 		return
 	}
@@ -103,10 +127,10 @@ func UpdateDocument(c *gin.Context) {
 }
 
 // GetUserDocuments handles the retrieval of documents for a specific user
-func GetUserDocuments(c *gin.Context) {
-	userID := c.GetUint("UserID") // Retrieve the user ID from the context
+func (h *Handler) GetUserDocuments(c *gin.Context) {
+	userID := c.GetUint("userID") // Retrieve the user ID from the context
 
-	documents, err := utils.GetDocumentsByOwnerID(database.DB, userID)
+	documents, err := h.documents.ListUserDocuments(c.Request.Context(), userID)
 	if err != nil {
 		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch documents", err.Error())
 		return
@@ -115,7 +139,7 @@ func GetUserDocuments(c *gin.Context) {
 }
 
 // GetDocumentsByTags handles the retrieval of documents by tags
-func GetDocumentsByTags(c *gin.Context) {
+func (h *Handler) GetDocumentsByTags(c *gin.Context) {
 	tags := c.DefaultQuery("tags", "") // Retrieve tags from the query (comma-separated)
 
 	if tags == "" {
@@ -124,13 +148,10 @@ func GetDocumentsByTags(c *gin.Context) {
 	}
 
 	tagNames := strings.Split(tags, ",")
-	var documents []models.Document
 
 	// Search for documents associated with the given tags
-	if err := database.DB.Preload("Tags").Joins("JOIN document_tags ON document_tags.document_id = documents.id").
-		Joins("JOIN tags ON tags.id = document_tags.tag_id").
-		Where("tags.name IN (?)", tagNames).
-		Find(&documents).Error; err != nil {
+	documents, err := h.documents.ListDocumentsByTags(c.Request.Context(), c.GetUint("userID"), tagNames)
+	if err != nil {
 		utils.RespondError(c, http.StatusInternalServerError, "Failed to find documents by tags", err.Error())
 		return
 	}
@@ -142,16 +163,18 @@ func GetDocumentsByTags(c *gin.Context) {
 }
 
 // DeleteDocument handles the deletion of a document
-func DeleteDocument(c *gin.Context) {
-	docID := c.Param("id")
-
-	var document models.Document
-	if err := database.DB.First(&document, docID).Error; err != nil {
-		utils.RespondError(c, http.StatusNotFound, "Document not found", gin.H{"error": "Document not found"})
+func (h *Handler) DeleteDocument(c *gin.Context) {
+	docID, ok := parseIDParam(c, "id")
+	if !ok {
 		return
 	}
 
-	if err := database.DB.Delete(&document).Error; err != nil {
+	document, err := h.documents.DeleteDocument(c.Request.Context(), docID)
+	if err != nil {
+		if errors.Is(err, services.ErrDocumentNotFound) {
+			utils.RespondError(c, http.StatusNotFound, "Document not found", gin.H{"error": "Document not found"})
+			return
+		}
 		utils.RespondError(c, http.StatusInternalServerError, "Failed to delete document", err.Error())
 		return
 	}
@@ -159,8 +182,11 @@ func DeleteDocument(c *gin.Context) {
 }
 
 // CheckDocumentUpdate checks if a document has been updated since it was last viewed
-func CheckDocumentUpdate(c *gin.Context) {
-	docID := c.Param("id")
+func (h *Handler) CheckDocumentUpdate(c *gin.Context) {
+	docID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 	lastViewedTimeStr := c.GetHeader("LastViewed")
 	lastViewedTime, err := time.Parse(time.RFC3339, lastViewedTimeStr)
 	if err != nil {
@@ -168,8 +194,12 @@ func CheckDocumentUpdate(c *gin.Context) {
 		return
 	}
 
-	updatedAt, err := utils.GetDocumentUpdatedAt(docID)
+	updatedAt, err := h.documents.DocumentUpdatedAt(c.Request.Context(), docID)
 	if err != nil {
+		if errors.Is(err, services.ErrDocumentNotFound) {
+			utils.RespondError(c, http.StatusNotFound, "Document not found", nil)
+			return
+		}
 		utils.RespondError(c, http.StatusInternalServerError, "Failed to check update status", err.Error())
 		return
 	}
@@ -180,3 +210,35 @@ func CheckDocumentUpdate(c *gin.Context) {
 		utils.RespondJSON(c, http.StatusOK, "Document not updated", gin.H{"update_available": false})
 	}
 }
+
+// parseFolderIDForm reads the optional folder_id form field and responds with 400 when it is invalid
+func parseFolderIDForm(c *gin.Context) (*uint, bool) {
+	value := c.PostForm("folder_id")
+	if value == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid folder_id", nil)
+		return nil, false
+	}
+	folderID := uint(id)
+	return &folderID, true
+}
+
+// respondUploadError maps upload errors to HTTP statuses
+func respondUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTypeMismatch),
+		errors.Is(err, services.ErrTypeNotAllowed):
+		utils.RespondError(c, http.StatusUnsupportedMediaType, err.Error(), nil)
+	case errors.Is(err, services.ErrFileTooLarge):
+		utils.RespondError(c, http.StatusRequestEntityTooLarge, err.Error(), nil)
+	case errors.Is(err, services.ErrFolderNotFound):
+		utils.RespondError(c, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, services.ErrFolderForbidden):
+		utils.RespondError(c, http.StatusForbidden, err.Error(), nil)
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, err.Error(), nil)
+	}
+}
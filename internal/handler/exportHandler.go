@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportDocuments exports documents, given by document_ids or found by a query on tags, folder, name and type,
+// as a zip archive with a manifest.json or manifest.csv of their metadata, or as a BagIt bag ("format": "bagit")
+// holding that manifest under metadata/. A dissemination package ("format": "dip") is such a bag with a METS.xml
+// of the documents and their PREMIS metadata. Small exports are streamed in the response; large ones, or those
+// asked with "background", are built in the background (202) and downloaded from /documents/export/:id/download
+// once completed.
+func (h *Handler) ExportDocuments(c *gin.Context) {
+	var req services.ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+	ctx := c.Request.Context()
+	userID := c.GetUint("userID")
+
+	selection, err := h.exports.Select(ctx, userID, req)
+	if err != nil {
+		respondExportError(c, "Failed to export documents", err)
+		return
+	}
+	if selection.Background {
+		job, err := h.exports.StartExport(ctx, userID, selection)
+		if err != nil {
+			respondExportError(c, "Failed to start export", err)
+			return
+		}
+		utils.RespondJSON(c, http.StatusAccepted, "Export started", gin.H{"export": job})
+		return
+	}
+
+	// Le statut est envoyé avant l'archive : une erreur ne peut plus qu'interrompre le flux
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, selection.Name))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := h.exports.WriteArchive(ctx, c.Writer, selection); err != nil {
+		slog.ErrorContext(ctx, "Export interrupted", "documents", len(selection.Documents), "error", err)
+	}
+}
+
+// GetExport returns the progress of a background export of the user
+func (h *Handler) GetExport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.exports.GetExport(c.Request.Context(), jobID, c.GetUint("userID"))
+	if err != nil {
+		respondExportError(c, "Failed to fetch export", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Export fetched successfully", gin.H{"export": job})
+}
+
+// DownloadExport serves the archive of a completed background export of the user
+func (h *Handler) DownloadExport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, content, err := h.exports.OpenExport(c.Request.Context(), jobID, c.GetUint("userID"))
+	if err != nil {
+		respondExportError(c, "Failed to download export", err)
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, job.Size, "application/zip", content, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="export-%d.zip"`, job.ID),
+	})
+}
+
+// respondExportError maps export service errors to HTTP statuses
+func respondExportError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrExportNotFound),
+		errors.Is(err, services.ErrDocumentNotFound),
+		errors.Is(err, services.ErrFolderNotFound),
+		errors.Is(err, services.ErrNothingToExport):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrExportForbidden):
+		utils.RespondError(c, http.StatusForbidden, message, err.Error())
+	case errors.Is(err, services.ErrInvalidExport),
+		errors.Is(err, filetype.ErrInvalidPattern):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrExportTooLarge):
+		utils.RespondError(c, http.StatusRequestEntityTooLarge, message, err.Error())
+	case errors.Is(err, services.ErrDocumentQuarantined):
+		utils.RespondError(c, http.StatusLocked, message, err.Error())
+	case errors.Is(err, services.ErrExportNotReady):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	case errors.Is(err, services.ErrExportExpired):
+		utils.RespondError(c, http.StatusGone, message, err.Error())
+	case errors.Is(err, services.ErrExportUnavailable),
+		errors.Is(err, jobs.ErrQueueFull),
+		errors.Is(err, jobs.ErrQueueClosed):
+		utils.RespondError(c, http.StatusServiceUnavailable, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDocumentFixity returns the checksums of a document, its last verification and its recent failures
+func (h *Handler) GetDocumentFixity(c *gin.Context) {
+	docID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	report, err := h.fixity.DocumentFixity(c.Request.Context(), docID)
+	if err != nil {
+		respondFixityError(c, "Failed to fetch fixity", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Fixity fetched successfully", gin.H{"fixity": report})
+}
+
+// ListFixity returns a page of the last verification of each document, optionally filtered by ?status=
+func (h *Handler) ListFixity(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	reports, total, err := h.fixity.ListFixity(c.Request.Context(), c.Query("status"), page, pageSize)
+	if err != nil {
+		respondFixityError(c, "Failed to fetch fixity", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Fixity fetched successfully", gin.H{
+		"documents": reports,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// ListFixityEvents returns a page of the failed fixity checks, most recent first
+func (h *Handler) ListFixityEvents(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	events, total, err := h.fixity.ListEvents(c.Request.Context(), page, pageSize)
+	if err != nil {
+		respondFixityError(c, "Failed to fetch fixity events", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Fixity events fetched successfully", gin.H{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// respondFixityError maps fixity service errors to HTTP statuses
+func respondFixityError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrInvalidFixityStatus):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
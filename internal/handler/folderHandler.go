@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListFolders returns the folders the user owns or that were shared with them
+func (h *Handler) ListFolders(c *gin.Context) {
+	folders, err := h.folders.ListFolders(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch folders", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Folders fetched successfully", gin.H{"folders": folders})
+}
+
+// CreateFolder creates a folder owned by the user
+func (h *Handler) CreateFolder(c *gin.Context) {
+	var req struct {
+		Name         string   `json:"name" binding:"required"`
+		ParentID     *uint    `json:"parent_id"`
+		AllowedTypes []string `json:"allowed_types"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	folder, err := h.folders.CreateFolder(c.Request.Context(), req.Name, req.ParentID, req.AllowedTypes, c.GetUint("userID"))
+	if err != nil {
+		respondFolderError(c, "Failed to create folder", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, "Folder created successfully", gin.H{"folder": folder})
+}
+
+// SetFolderUploadTypes restricts the content types accepted in a folder (an empty list accepts all types)
+func (h *Handler) SetFolderUploadTypes(c *gin.Context) {
+	folderID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		AllowedTypes []string `json:"allowed_types"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	folder, err := h.folders.SetFolderUploadTypes(c.Request.Context(), folderID, req.AllowedTypes, c.GetUint("userID"))
+	if err != nil {
+		respondFolderError(c, "Failed to update folder", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Folder updated successfully", gin.H{"folder": folder})
+}
+
+// MoveDocument puts a document in a folder (or back at the root with a null folder_id)
+func (h *Handler) MoveDocument(c *gin.Context) {
+	var req struct {
+		FolderID *uint `json:"folder_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	document, err := h.folders.MoveDocument(c.Request.Context(), c.Param("id"), req.FolderID, c.GetUint("userID"))
+	if err != nil {
+		respondFolderError(c, "Failed to move document", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Document moved successfully", gin.H{"document": document})
+}
+
+// respondFolderError maps folder service errors to HTTP statuses
+func respondFolderError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrFolderNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrFolderForbidden),
+		errors.Is(err, services.ErrFolderNotOwner):
+		utils.RespondError(c, http.StatusForbidden, message, err.Error())
+	case errors.Is(err, filetype.ErrInvalidPattern):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrTypeNotAllowed):
+		utils.RespondError(c, http.StatusUnsupportedMediaType, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
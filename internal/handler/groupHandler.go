@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListGroups returns every group with its members and roles
+func (h *Handler) ListGroups(c *gin.Context) {
+	groups, err := h.groups.ListGroups(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch groups", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Groups fetched successfully", gin.H{"groups": groups})
+}
+
+// CreateGroup creates a new group
+func (h *Handler) CreateGroup(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	group, err := h.groups.CreateGroup(c.Request.Context(), req.Name)
+	if err != nil {
+		respondGroupError(c, "Failed to create group", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, "Group created successfully", gin.H{"group": group})
+}
+
+// DeleteGroup deletes a group and the grants given to it
+func (h *Handler) DeleteGroup(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.DeleteGroup(c.Request.Context(), groupID); err != nil {
+		respondGroupError(c, "Failed to delete group", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Group deleted successfully", nil)
+}
+
+// AddGroupMember adds a user to a group
+func (h *Handler) AddGroupMember(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	group, err := h.groups.AddMember(c.Request.Context(), groupID, req.UserID)
+	if err != nil {
+		respondGroupError(c, "Failed to add member", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Member added successfully", gin.H{"group": group})
+}
+
+// RemoveGroupMember removes a user from a group
+func (h *Handler) RemoveGroupMember(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseIDParam(c, "userID")
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.RemoveMember(c.Request.Context(), groupID, userID)
+	if err != nil {
+		respondGroupError(c, "Failed to remove member", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Member removed successfully", gin.H{"group": group})
+}
+
+// AssignGroupRole gives a role to every member of a group
+func (h *Handler) AssignGroupRole(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	group, err := h.groups.AssignRole(c.Request.Context(), groupID, req.Role)
+	if err != nil {
+		respondGroupError(c, "Failed to assign role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Role assigned successfully", gin.H{"group": group})
+}
+
+// UnassignGroupRole removes a role from a group
+func (h *Handler) UnassignGroupRole(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	roleID, ok := parseIDParam(c, "roleID")
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.UnassignRole(c.Request.Context(), groupID, roleID)
+	if err != nil {
+		respondGroupError(c, "Failed to unassign role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Role unassigned successfully", gin.H{"group": group})
+}
+
+// ListGrants returns the grants, optionally filtered with ?document_id= or ?folder_id=
+func (h *Handler) ListGrants(c *gin.Context) {
+	documentID, ok := parseOptionalIDQuery(c, "document_id")
+	if !ok {
+		return
+	}
+	folderID, ok := parseOptionalIDQuery(c, "folder_id")
+	if !ok {
+		return
+	}
+
+	grants, err := h.groups.ListGrants(c.Request.Context(), documentID, folderID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch grants", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Grants fetched successfully", gin.H{"grants": grants})
+}
+
+// CreateGrant gives a permission on a document or folder to a user or group
+func (h *Handler) CreateGrant(c *gin.Context) {
+	var req services.GrantInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	grant, err := h.groups.CreateGrant(c.Request.Context(), req)
+	if err != nil {
+		respondGroupError(c, "Failed to create grant", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, "Grant created successfully", gin.H{"grant": grant})
+}
+
+// DeleteGrant revokes a grant
+func (h *Handler) DeleteGrant(c *gin.Context) {
+	grantID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.DeleteGrant(c.Request.Context(), grantID); err != nil {
+		respondGroupError(c, "Failed to delete grant", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Grant deleted successfully", nil)
+}
+
+// parseOptionalIDQuery reads an optional numeric query parameter
+func parseOptionalIDQuery(c *gin.Context, name string) (*uint, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid "+name+" parameter", nil)
+		return nil, false
+	}
+	result := uint(id)
+	return &result, true
+}
+
+// respondGroupError maps group and grant service errors to HTTP statuses
+func respondGroupError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrGrantNotFound),
+		errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrRoleNotFound),
+		errors.Is(err, services.ErrTargetNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrInvalidGrant),
+		errors.Is(err, services.ErrPermissionNotFound):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrGroupExists):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
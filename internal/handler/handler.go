@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/services"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Handler serves the HTTP API on top of the services it is built with
+type Handler struct {
+	documents     *services.DocumentService
+	users         *services.UserService
+	roles         *services.RoleService
+	passwords     *services.PasswordService
+	groups        *services.GroupService
+	folders       *services.FolderService
+	policies      *services.PolicyService
+	organizations *services.OrganizationService
+	fixity        *services.FixityService
+	previews      *services.PreviewService
+	audit         *services.AuditService
+	scans         *services.ScanService
+	imports       *services.ImportService
+	exports       *services.ExportService
+	preservation  *services.PreservationService
+	authenticator *auth.Authenticator
+	tokens        *utils.JWT
+	authz         *authz.Engine
+	store         *storage.Store // checked by the readiness probe
+	db            *gorm.DB       // checked by the readiness probe, nil when running without a database
+}
+
+func New(svc *services.Services, authenticator *auth.Authenticator, tokens *utils.JWT, engine *authz.Engine,
+	store *storage.Store, db *gorm.DB) *Handler {
+	return &Handler{
+		documents:     svc.Documents,
+		users:         svc.Users,
+		roles:         svc.Roles,
+		passwords:     svc.Passwords,
+		groups:        svc.Groups,
+		folders:       svc.Folders,
+		policies:      svc.Policies,
+		organizations: svc.Organizations,
+		fixity:        svc.Fixity,
+		previews:      svc.Previews,
+		audit:         svc.Audit,
+		scans:         svc.Scans,
+		imports:       svc.Imports,
+		exports:       svc.Exports,
+		preservation:  svc.Preservation,
+		authenticator: authenticator,
+		tokens:        tokens,
+		authz:         engine,
+		store:         store,
+		db:            db,
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"archiv-system/internal/database"
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shuttingDown makes the readiness probe fail while the server drains
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown tells the load balancer to stop sending traffic
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Healthz is the liveness probe: the process is up and serving requests
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz is the readiness probe: the database answers, the storage is writable and the schema is migrated
+func (h *Handler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+		} else {
+			checks[name] = "ok"
+		}
+	}
+
+	if shuttingDown.Load() {
+		check("server", errors.New("shutting down"))
+	}
+	check("storage", h.store.CheckWritable())
+	if h.db != nil {
+		check("database", database.Ping(ctx, h.db))
+		check("migrations", database.CheckMigrations(ctx, h.db))
+	}
+
+	status, label := http.StatusOK, "ready"
+	if !ready {
+		status, label = http.StatusServiceUnavailable, "not ready"
+	}
+	c.JSON(status, gin.H{"status": label, "checks": checks})
+}
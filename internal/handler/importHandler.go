@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"archiv-system/internal/archive"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportDocuments starts the import of a zip or tar(.gz) archive in the background. The directories of the
+// archive become folders, inside the optional folder_id, and an optional manifest.csv or manifest.json at its
+// root gives the names, tags and types of the files. With bag=true, the archive is a BagIt bag whose checksums
+// are validated before its data/ directory is imported, the manifest being under metadata/.
+func (h *Handler) ImportDocuments(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.RespondError(c, http.StatusRequestEntityTooLarge, "Archive too large", err.Error())
+			return
+		}
+		utils.RespondError(c, http.StatusBadRequest, "Failed to get file", err.Error())
+		return
+	}
+	folderID, ok := parseFolderIDForm(c)
+	if !ok {
+		return
+	}
+	bag := false
+	if value := c.PostForm("bag"); value != "" {
+		if bag, err = strconv.ParseBool(value); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "Invalid bag", nil)
+			return
+		}
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Failed to read file", err.Error())
+		return
+	}
+	defer content.Close()
+
+	job, err := h.imports.StartImport(c.Request.Context(), c.GetUint("userID"), folderID, file.Filename, bag, content)
+	if err != nil {
+		respondImportError(c, "Failed to start import", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusAccepted, "Import started", gin.H{"import": job})
+}
+
+// GetImport returns the progress of an import of the user
+func (h *Handler) GetImport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.imports.GetImport(c.Request.Context(), jobID, c.GetUint("userID"))
+	if err != nil {
+		respondImportError(c, "Failed to fetch import", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Import fetched successfully", gin.H{"import": job})
+}
+
+// ListImportEntries returns a page of the outcome of the entries of an import, optionally filtered by ?status=
+func (h *Handler) ListImportEntries(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	entries, total, err := h.imports.ListEntries(c.Request.Context(), jobID, c.GetUint("userID"), c.Query("status"), page, pageSize)
+	if err != nil {
+		respondImportError(c, "Failed to fetch import entries", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Import entries fetched successfully", gin.H{
+		"entries":   entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// respondImportError maps import service errors to HTTP statuses
+func respondImportError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrImportNotFound),
+		errors.Is(err, services.ErrFolderNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrFolderForbidden):
+		utils.RespondError(c, http.StatusForbidden, message, err.Error())
+	case errors.Is(err, archive.ErrUnsupportedFormat):
+		utils.RespondError(c, http.StatusUnsupportedMediaType, message, err.Error())
+	case errors.Is(err, services.ErrInvalidImportStatus):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrImportUnavailable),
+		errors.Is(err, jobs.ErrQueueFull),
+		errors.Is(err, jobs.ErrQueueClosed):
+		utils.RespondError(c, http.StatusServiceUnavailable, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/database"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListOrganizations returns every organization with usage counters (super-admin)
+func (h *Handler) ListOrganizations(c *gin.Context) {
+	organizations, err := h.organizations.ListOrganizations(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch organizations", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Organizations fetched successfully", gin.H{"organizations": organizations})
+}
+
+// CreateOrganization creates an organization with its first administrator (super-admin)
+func (h *Handler) CreateOrganization(c *gin.Context) {
+	var req services.OrganizationInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	organization, err := h.organizations.CreateOrganization(c.Request.Context(), req)
+	if err != nil {
+		respondOrganizationError(c, "Failed to create organization", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, "Organization created successfully", gin.H{"organization": organization})
+}
+
+// UpdateOrganization renames an organization and toggles public registration (super-admin)
+func (h *Handler) UpdateOrganization(c *gin.Context) {
+	organizationID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name              string `json:"name" binding:"required"`
+		AllowRegistration bool   `json:"allow_registration"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	organization, err := h.organizations.UpdateOrganization(c.Request.Context(), organizationID, req.Name, req.AllowRegistration)
+	if err != nil {
+		respondOrganizationError(c, "Failed to update organization", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Organization updated successfully", gin.H{"organization": organization})
+}
+
+// DeleteOrganization deletes an empty organization (super-admin)
+func (h *Handler) DeleteOrganization(c *gin.Context) {
+	organizationID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.organizations.DeleteOrganization(c.Request.Context(), organizationID); err != nil {
+		respondOrganizationError(c, "Failed to delete organization", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Organization deleted successfully", nil)
+}
+
+// ListOrganizationUsers lists the users of any organization (super-admin)
+func (h *Handler) ListOrganizationUsers(c *gin.Context) {
+	organizationID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	ctx := database.WithOrganization(c.Request.Context(), organizationID)
+	users, total, err := h.users.ListUsers(ctx, c.Query("q"), page, pageSize)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch users", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Users fetched successfully", gin.H{
+		"users":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// respondOrganizationError maps organization service errors to HTTP statuses
+func respondOrganizationError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrganizationNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrInvalidSlug),
+		errors.Is(err, auth.ErrWeakPassword):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrOrganizationExists),
+		errors.Is(err, services.ErrOrganizationNotEmpty),
+		errors.Is(err, services.ErrUsernameTaken),
+		errors.Is(err, services.ErrDefaultOrganization):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
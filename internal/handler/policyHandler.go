@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPolicies returns the attribute-based policies of the organization
+func (h *Handler) ListPolicies(c *gin.Context) {
+	policies, err := h.policies.ListPolicies(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch policies", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Policies fetched successfully", gin.H{"policies": policies})
+}
+
+// CreatePolicy creates a policy after compiling its condition
+func (h *Handler) CreatePolicy(c *gin.Context) {
+	var req services.PolicyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	policy, err := h.policies.CreatePolicy(c.Request.Context(), req)
+	if err != nil {
+		respondPolicyError(c, "Failed to create policy", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, "Policy created successfully", gin.H{"policy": policy})
+}
+
+// UpdatePolicy replaces a policy
+func (h *Handler) UpdatePolicy(c *gin.Context) {
+	policyID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req services.PolicyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	policy, err := h.policies.UpdatePolicy(c.Request.Context(), policyID, req)
+	if err != nil {
+		respondPolicyError(c, "Failed to update policy", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Policy updated successfully", gin.H{"policy": policy})
+}
+
+// DeletePolicy deletes a policy
+func (h *Handler) DeletePolicy(c *gin.Context) {
+	policyID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.policies.DeletePolicy(c.Request.Context(), policyID); err != nil {
+		respondPolicyError(c, "Failed to delete policy", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Policy deleted successfully", nil)
+}
+
+// respondPolicyError maps policy service errors to HTTP statuses
+func respondPolicyError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrPolicyNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrInvalidPolicy),
+		errors.Is(err, services.ErrPermissionNotFound):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrPolicyExists):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
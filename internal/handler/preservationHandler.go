@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePackage starts the archival information package (AIP) of documents, given by document_ids or as those
+// ingested by an import (import_id): a BagIt bag of the documents and of all their previous versions, with a METS
+// document holding their PREMIS metadata, built in the background and kept in the storage
+func (h *Handler) CreatePackage(c *gin.Context) {
+	var req services.PackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+	userID := c.GetUint("userID")
+
+	pkg, err := h.preservation.StartPackage(c.Request.Context(), &userID, req)
+	if err != nil {
+		respondPackageError(c, "Failed to start archival package", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusAccepted, "Archival package started", gin.H{"package": pkg})
+}
+
+// ListPackages returns a page of the archival packages of the organization, most recent first
+func (h *Handler) ListPackages(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	packages, total, err := h.preservation.ListPackages(c.Request.Context(), page, pageSize)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch archival packages", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Archival packages fetched successfully", gin.H{
+		"packages":  packages,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetPackage returns an archival package with its status
+func (h *Handler) GetPackage(c *gin.Context) {
+	pkgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	pkg, err := h.preservation.GetPackage(c.Request.Context(), pkgID)
+	if err != nil {
+		respondPackageError(c, "Failed to fetch archival package", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Archival package fetched successfully", gin.H{"package": pkg})
+}
+
+// DownloadPackage serves the bag of a completed archival package
+func (h *Handler) DownloadPackage(c *gin.Context) {
+	pkgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	pkg, content, err := h.preservation.OpenPackage(c.Request.Context(), pkgID)
+	if err != nil {
+		respondPackageError(c, "Failed to download archival package", err)
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, pkg.Size, "application/zip", content, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="aip-%d.zip"`, pkg.ID),
+	})
+}
+
+// respondPackageError maps preservation service errors to HTTP statuses
+func respondPackageError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound),
+		errors.Is(err, services.ErrDocumentNotFound),
+		errors.Is(err, services.ErrImportNotFound),
+		errors.Is(err, services.ErrNothingToPackage):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrInvalidPackage):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrPackageTooLarge):
+		utils.RespondError(c, http.StatusRequestEntityTooLarge, message, err.Error())
+	case errors.Is(err, services.ErrDocumentQuarantined):
+		utils.RespondError(c, http.StatusLocked, message, err.Error())
+	case errors.Is(err, services.ErrPackageNotReady):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	case errors.Is(err, services.ErrPreservationUnavailable),
+		errors.Is(err, jobs.ErrQueueFull),
+		errors.Is(err, jobs.ErrQueueClosed):
+		utils.RespondError(c, http.StatusServiceUnavailable, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"archiv-system/internal/models"
+	"archiv-system/internal/preview"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetThumbnail serves the thumbnail of a document in the requested size (?size=small, medium or large)
+func (h *Handler) GetThumbnail(c *gin.Context) {
+	docID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	size := c.DefaultQuery("size", preview.DefaultSize)
+
+	derivative, content, err := h.previews.Thumbnail(c.Request.Context(), docID, size)
+	if err != nil {
+		respondPreviewError(c, err)
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, derivative.Bytes, derivative.ContentType, content, map[string]string{
+		"Cache-Control": "private, max-age=3600",
+	})
+}
+
+// respondPreviewError maps preview service errors to HTTP statuses
+func respondPreviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPreviewPending):
+		// Génération en cours : le client réessaie plus tard
+		c.Header("Retry-After", "5")
+		utils.RespondJSON(c, http.StatusAccepted, "Preview is being generated", gin.H{"status": models.PreviewPending})
+	case errors.Is(err, services.ErrDocumentNotFound),
+		errors.Is(err, services.ErrPreviewUnavailable):
+		utils.RespondError(c, http.StatusNotFound, "Preview not found", err.Error())
+	case errors.Is(err, services.ErrDocumentQuarantined):
+		utils.RespondError(c, http.StatusLocked, "Document is in quarantine", err.Error())
+	case errors.Is(err, services.ErrInvalidPreviewSize):
+		utils.RespondError(c, http.StatusBadRequest, "Invalid size parameter", err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch preview", err.Error())
+	}
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPermissions returns every permission that can be assigned to a role
+func (h *Handler) ListPermissions(c *gin.Context) {
+	permissions, err := h.roles.ListPermissions(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch permissions", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Permissions fetched successfully", gin.H{"permissions": permissions})
+}
+
+// ListRoles returns every role with its permissions
+func (h *Handler) ListRoles(c *gin.Context) {
+	roles, err := h.roles.ListRoles(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch roles", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Roles fetched successfully", gin.H{"roles": roles})
+}
+
+// CreateRole creates a new role
+func (h *Handler) CreateRole(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	role, err := h.roles.CreateRole(c.Request.Context(), req.Name, req.Permissions)
+	if err != nil {
+		respondRoleError(c, "Failed to create role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, "Role created successfully", gin.H{"role": role})
+}
+
+// UpdateRole renames a role
+func (h *Handler) UpdateRole(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	role, err := h.roles.RenameRole(c.Request.Context(), roleID, req.Name)
+	if err != nil {
+		respondRoleError(c, "Failed to update role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Role updated successfully", gin.H{"role": role})
+}
+
+// DeleteRole deletes a role that is not assigned to any user
+func (h *Handler) DeleteRole(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.roles.DeleteRole(c.Request.Context(), roleID); err != nil {
+		respondRoleError(c, "Failed to delete role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Role deleted successfully", nil)
+}
+
+// AssignPermission adds a permission to a role
+func (h *Handler) AssignPermission(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Permission string `json:"permission" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	role, err := h.roles.AssignPermission(c.Request.Context(), roleID, req.Permission)
+	if err != nil {
+		respondRoleError(c, "Failed to assign permission", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Permission assigned successfully", gin.H{"role": role})
+}
+
+// UnassignPermission removes a permission from a role
+func (h *Handler) UnassignPermission(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	role, err := h.roles.UnassignPermission(c.Request.Context(), roleID, c.Param("permission"))
+	if err != nil {
+		respondRoleError(c, "Failed to unassign permission", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Permission unassigned successfully", gin.H{"role": role})
+}
+
+// SetRoleUploadTypes restricts the content types the users of a role can upload (an empty list accepts all types)
+func (h *Handler) SetRoleUploadTypes(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		AllowedTypes []string `json:"allowed_types"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	role, err := h.roles.SetRoleUploadTypes(c.Request.Context(), roleID, req.AllowedTypes)
+	if err != nil {
+		respondRoleError(c, "Failed to update role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Role updated successfully", gin.H{"role": role})
+}
+
+// ChangeUserRole assigns another role to a user
+func (h *Handler) ChangeUserRole(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid input data", err.Error())
+		return
+	}
+
+	user, err := h.roles.ChangeUserRole(c.Request.Context(), userID, req.Role)
+	if err != nil {
+		respondRoleError(c, "Failed to change user role", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "User role changed successfully", gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"role":     user.Role.Name,
+	})
+}
+
+// parseIDParam reads a numeric route parameter and responds with 400 when it is invalid
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid "+name+" parameter", nil)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondRoleError maps role service errors to HTTP statuses
+func respondRoleError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrPermissionNotFound),
+		errors.Is(err, filetype.ErrInvalidPattern):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrRoleExists),
+		errors.Is(err, services.ErrRoleInUse),
+		errors.Is(err, services.ErrProtectedRole),
+		errors.Is(err, services.ErrBuiltinRole),
+		errors.Is(err, services.ErrLastAdmin):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
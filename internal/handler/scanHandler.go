@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListQuarantine returns a page of the documents waiting for their malware scan, infected or whose scan failed
+func (h *Handler) ListQuarantine(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	documents, total, err := h.scans.ListQuarantine(c.Request.Context(), page, pageSize)
+	if err != nil {
+		respondScanError(c, "Failed to fetch quarantine", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Quarantine fetched successfully", gin.H{
+		"documents": documents,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// RescanDocument puts a document back in quarantine and queues a new malware scan
+func (h *Handler) RescanDocument(c *gin.Context) {
+	docID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	document, err := h.scans.Rescan(c.Request.Context(), docID, c.GetUint("userID"))
+	if err != nil {
+		respondScanError(c, "Failed to scan document", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusAccepted, "Scan scheduled", gin.H{"document": document})
+}
+
+// respondScanError maps scan service errors to HTTP statuses
+func respondScanError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrScanUnavailable):
+		utils.RespondError(c, http.StatusServiceUnavailable, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/services"
+	"archiv-system/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListUsers returns a page of users, optionally filtered by a username search
+func (h *Handler) ListUsers(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	users, total, err := h.users.ListUsers(c.Request.Context(), c.Query("q"), page, pageSize)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "Failed to fetch users", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Users fetched successfully", gin.H{
+		"users":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetUser returns a user with its role, document count, storage usage and last login
+func (h *Handler) GetUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.GetUserDetail(c.Request.Context(), userID)
+	if err != nil {
+		respondUserError(c, "Failed to fetch user", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "User fetched successfully", gin.H{"user": user})
+}
+
+// DisableUser disables an account, rejecting its tokens immediately
+func (h *Handler) DisableUser(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+// EnableUser re-enables a disabled account
+func (h *Handler) EnableUser(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *Handler) setUserDisabled(c *gin.Context, disabled bool) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.SetDisabled(c.Request.Context(), userID, c.GetUint("userID"), disabled)
+	if err != nil {
+		respondUserError(c, "Failed to update user", err)
+		return
+	}
+
+	message := "User enabled successfully"
+	if disabled {
+		message = "User disabled successfully"
+	}
+	utils.RespondJSON(c, http.StatusOK, message, gin.H{"id": user.ID, "disabled": disabled})
+}
+
+// ResetUserPassword sets a temporary password that the user must change at the next login
+func (h *Handler) ResetUserPassword(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	temporary, err := h.users.ResetPassword(c.Request.Context(), userID)
+	if err != nil {
+		respondUserError(c, "Failed to reset password", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "Password reset successfully", gin.H{"temporary_password": temporary})
+}
+
+// UnlockUser lifts the lockout of an account locked after too many failed logins
+func (h *Handler) UnlockUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Unlock(c.Request.Context(), userID)
+	if err != nil {
+		respondUserError(c, "Failed to unlock user", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "User unlocked successfully", gin.H{"id": user.ID})
+}
+
+// DeleteUser deletes a user. With ?transfer_to=<id> the documents are given to another user,
+// otherwise they are deleted.
+func (h *Handler) DeleteUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var transferTo *uint
+	if value := c.Query("transfer_to"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			utils.RespondError(c, http.StatusBadRequest, "Invalid transfer_to parameter", nil)
+			return
+		}
+		target := uint(id)
+		transferTo = &target
+	}
+
+	if err := h.users.DeleteUser(c.Request.Context(), userID, c.GetUint("userID"), transferTo); err != nil {
+		respondUserError(c, "Failed to delete user", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "User deleted successfully", nil)
+}
+
+// parsePagination reads the page and page_size query parameters
+func parsePagination(c *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid page parameter", nil)
+		return 0, 0, false
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 {
+		utils.RespondError(c, http.StatusBadRequest, "Invalid page_size parameter", nil)
+		return 0, 0, false
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize, true
+}
+
+// respondUserError maps user service errors to HTTP statuses
+func respondUserError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, services.ErrTransferNotFound),
+		errors.Is(err, services.ErrInvalidPassword),
+		errors.Is(err, services.ErrInvalidResetToken),
+		errors.Is(err, services.ErrPasswordReused),
+		errors.Is(err, auth.ErrWeakPassword):
+		utils.RespondError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, services.ErrSelfAction),
+		errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrExternalAccount):
+		utils.RespondError(c, http.StatusConflict, message, err.Error())
+	default:
+		utils.RespondError(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrQueueFull is returned when a queue cannot accept more tasks
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrQueueClosed is returned once the shutdown has started
+	ErrQueueClosed = errors.New("job queue is closed")
+)
+
+// Task is a unit of background work
+type Task func(ctx context.Context) error
+
+// Queue runs tasks on a fixed number of workers
+type Queue struct {
+	name   string
+	mu     sync.RWMutex
+	closed bool
+	tasks  chan Task
+}
+
+var (
+	queuesMu sync.Mutex
+	queues   = map[string]*Queue{}
+)
+
+// NewQueue creates a queue holding up to capacity pending tasks, processed by workers goroutines
+// that stop with the runner. Pending tasks are still run on shutdown, until its deadline.
+func (r *Runner) NewQueue(name string, workers, capacity int) *Queue {
+	q := &Queue{name: name, tasks: make(chan Task, capacity)}
+	for i := 0; i < workers; i++ {
+		r.start(name, func() { q.work(r.work) })
+	}
+
+	r.mu.Lock()
+	r.queues = append(r.queues, q)
+	r.mu.Unlock()
+
+	queuesMu.Lock()
+	queues[name] = q
+	queuesMu.Unlock()
+	return q
+}
+
+// work runs the tasks until the queue is closed and drained, or ctx is done
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-q.tasks:
+			if !ok {
+				return
+			}
+			if err := task(ctx); err != nil {
+				slog.ErrorContext(ctx, "Job failed", "queue", q.name, "error", err)
+			}
+		}
+	}
+}
+
+// Enqueue adds a task without blocking
+func (q *Queue) Enqueue(task Task) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.tasks <- task:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// close stops the intake of tasks, the workers returning once the pending ones are done
+func (q *Queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.tasks)
+	}
+}
+
+// Name returns the name of the queue
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Depth returns the number of pending tasks
+func (q *Queue) Depth() int {
+	return len(q.tasks)
+}
+
+// Queues returns the queues created so far, sorted by name
+func Queues() []*Queue {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	list := make([]*Queue, 0, len(queues))
+	for _, q := range queues {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
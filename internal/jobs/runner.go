@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Runner starts background workers and stops them on shutdown. Periodic workers are stopped as soon as the
+// shutdown starts; queues stop taking tasks and their workers run the pending ones until the shutdown deadline,
+// when the tasks still running are cancelled.
+type Runner struct {
+	stop       context.Context // done when the shutdown starts
+	stopCancel context.CancelFunc
+	work       context.Context // done at the shutdown deadline
+	workCancel context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	queues     []*Queue
+}
+
+func NewRunner() *Runner {
+	r := &Runner{}
+	r.stop, r.stopCancel = context.WithCancel(context.Background())
+	r.work, r.workCancel = context.WithCancel(context.Background())
+	return r
+}
+
+// Go runs a worker until the runner is shut down. The worker must return once its context is done.
+func (r *Runner) Go(name string, worker func(ctx context.Context)) {
+	r.start(name, func() { worker(r.stop) })
+}
+
+func (r *Runner) start(name string, worker func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		worker()
+		slog.Info("Background worker stopped", "worker", name)
+	}()
+}
+
+// Shutdown stops the periodic workers and the intake of the queues, then waits for the queues to be drained.
+// Once ctx expires, the tasks still running are cancelled and ctx's error is returned.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.stopCancel()
+	r.mu.Lock()
+	for _, q := range r.queues {
+		q.close()
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	defer r.workCancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsQueues(t *testing.T) {
+	r := NewRunner()
+	q := r.NewQueue("test-drain", 1, 10)
+
+	var ran atomic.Int32
+	for i := 0; i < 5; i++ {
+		err := q.Enqueue(func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			ran.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if got := ran.Load(); got != 5 {
+		t.Errorf("%d tasks ran, want the 5 queued before the shutdown", got)
+	}
+	if err := q.Enqueue(func(context.Context) error { return nil }); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Enqueue after shutdown: got %v, want ErrQueueClosed", err)
+	}
+}
+
+func TestShutdownCancelsTasksAtDeadline(t *testing.T) {
+	r := NewRunner()
+	q := r.NewQueue("test-deadline", 1, 1)
+
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	err := q.Enqueue(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	<-started
+
+	var stopped atomic.Bool
+	r.Go("periodic", func(ctx context.Context) {
+		<-ctx.Done()
+		stopped.Store(true)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown: got %v, want the deadline error", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the running task was not cancelled at the deadline")
+	}
+	if !stopped.Load() {
+		t.Error("the periodic worker was not stopped")
+	}
+}
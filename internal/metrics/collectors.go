@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/models"
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// storageCollector reports the size of the stored documents per backend and per organization, read from the
+// database at scrape time
+type storageCollector struct {
+	db                *gorm.DB
+	backend           string
+	backendBytes      *prometheus.Desc
+	organizationBytes *prometheus.Desc
+}
+
+func newStorageCollector(db *gorm.DB, backend string) *storageCollector {
+	return &storageCollector{
+		db:      db,
+		backend: backend,
+		backendBytes: prometheus.NewDesc(namespace+"_storage_bytes", "Size of the stored documents by storage backend.",
+			[]string{"backend"}, nil),
+		organizationBytes: prometheus.NewDesc(namespace+"_storage_organization_bytes", "Size of the stored documents by organization.",
+			[]string{"organization_id"}, nil),
+	}
+}
+
+func (sc *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.backendBytes
+	ch <- sc.organizationBytes
+}
+
+func (sc *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rows []struct {
+		OrganizationID uint
+		Size           int64
+	}
+	// Usage of every organization, the metrics being served to the operators only
+	if err := sc.db.WithContext(database.Unscoped(ctx)).Model(&models.Document{}).
+		Select("organization_id, COALESCE(SUM(size), 0) AS size").Group("organization_id").
+		Scan(&rows).Error; err != nil {
+		slog.Error("Metrics: failed to compute storage usage", "error", err)
+		return
+	}
+
+	var total int64
+	for _, row := range rows {
+		total += row.Size
+		ch <- prometheus.MustNewConstMetric(sc.organizationBytes, prometheus.GaugeValue, float64(row.Size),
+			strconv.FormatUint(uint64(row.OrganizationID), 10))
+	}
+	ch <- prometheus.MustNewConstMetric(sc.backendBytes, prometheus.GaugeValue, float64(total), sc.backend)
+}
+
+// queueCollector reports the number of pending tasks of every background job queue
+type queueCollector struct {
+	depth *prometheus.Desc
+}
+
+func newQueueCollector() *queueCollector {
+	return &queueCollector{
+		depth: prometheus.NewDesc(namespace+"_job_queue_depth", "Pending tasks in background job queues.",
+			[]string{"queue"}, nil),
+	}
+}
+
+func (qc *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- qc.depth
+}
+
+func (qc *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, q := range jobs.Queues() {
+		ch <- prometheus.MustNewConstMetric(qc.depth, prometheus.GaugeValue, float64(q.Depth()), q.Name())
+	}
+}
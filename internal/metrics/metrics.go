@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "archiv"
+
+// Registry holds the application metrics, exposed by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	uploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes received in uploaded documents.",
+	})
+
+	uploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_duration_seconds",
+		Help:      "Duration of document uploads (storage and database), by outcome.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"outcome"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Failed logins by reason.",
+	}, []string{"reason"})
+
+	permissionDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "permission_denials_total",
+		Help:      "Requests denied by the authorization middleware, by permission.",
+	}, []string{"permission"})
+
+	fixityChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fixity_checks_total",
+		Help:      "Stored files verified against their checksum, by outcome.",
+	}, []string{"outcome"})
+
+	fixityBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fixity_bytes_read_total",
+		Help:      "Bytes read by the fixity checks.",
+	})
+
+	previewGenerations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "preview_generations_total",
+		Help:      "Thumbnail generations of documents, by outcome.",
+	}, []string{"outcome"})
+
+	scanResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scan_results_total",
+		Help:      "Malware scans of uploaded files, by outcome.",
+	}, []string{"outcome"})
+)
+
+// Reasons of authentication failures
+const (
+	AuthInvalidCredentials = "invalid_credentials"
+	AuthDisabled           = "disabled"
+	AuthLocked             = "locked"
+	AuthError              = "error"
+	AuthInvalidToken       = "invalid_token"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestDuration,
+		uploadBytes,
+		uploadDuration,
+		authFailures,
+		permissionDenials,
+		fixityChecks,
+		fixityBytes,
+		previewGenerations,
+		scanResults,
+		newQueueCollector(),
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of the database and the storage usage it records,
+// labelled with the storage backend
+func RegisterDB(db *gorm.DB, backend string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := Registry.Register(collectors.NewDBStatsCollector(sqlDB, "archiv")); err != nil {
+		return err
+	}
+	return Registry.Register(newStorageCollector(db, backend))
+}
+
+// Handler serves the metrics in the Prometheus format. It is meant for the separate metrics listener, not
+// reachable by the users of the API.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	return mux
+}
+
+// Middleware records the duration of every request, labelled by route template to bound cardinality
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveUpload records an upload of size bytes
+func ObserveUpload(size int64, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	} else {
+		uploadBytes.Add(float64(size))
+	}
+	uploadDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+// AuthFailure counts a failed authentication
+func AuthFailure(reason string) {
+	authFailures.WithLabelValues(reason).Inc()
+}
+
+// PermissionDenied counts a request denied by the authorization middleware
+func PermissionDenied(permission string) {
+	permissionDenials.WithLabelValues(permission).Inc()
+}
+
+// ObserveFixity counts a fixity check of a file, having read size bytes
+func ObserveFixity(outcome string, size int64) {
+	fixityChecks.WithLabelValues(outcome).Inc()
+	fixityBytes.Add(float64(size))
+}
+
+// ObservePreview counts a thumbnail generation, by its outcome (a models.Preview* status)
+func ObservePreview(outcome string) {
+	previewGenerations.WithLabelValues(outcome).Inc()
+}
+
+// ObserveScan counts a malware scan, by its outcome (a models.Scan* status)
+func ObserveScan(outcome string) {
+	scanResults.WithLabelValues(outcome).Inc()
+}
@@ -1,16 +1,37 @@
 package middleware
 
 import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/database"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/repository"
 	"archiv-system/internal/utils"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// PasswordChangePath is the only route reachable by a user who must change their password
+const PasswordChangePath = "/user/password"
+
+// Auth authenticates the requests and checks the permissions of their user
+type Auth struct {
+	tokens *utils.JWT
+	engine *authz.Engine
+	users  repository.UserRepository // resolves the user of each authenticated request
+}
+
+func NewAuth(tokens *utils.JWT, engine *authz.Engine, users repository.UserRepository) *Auth {
+	return &Auth{tokens: tokens, engine: engine, users: users}
+}
+
 // JWTAuthMiddleware verifies the validity of the JWT and adds user information to the context
-func JWTAuthMiddleware() gin.HandlerFunc {
+func (a *Auth) JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the token from the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -30,26 +51,67 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 
 		// Verify and parse the token
 		tokenString := parts[1]
-		claims, err := utils.ParseToken(tokenString)
+		claims, err := a.tokens.ParseToken(tokenString)
 		if err != nil {
+			metrics.AuthFailure(metrics.AuthInvalidToken)
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token", "error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		// Check if the role is missing in the token
-		if claims.RoleName == "" {
-			c.JSON(http.StatusForbidden, gin.H{"message": "Role is missing in token"})
+		// Resolve the current role and account state from the database rather than trusting the token,
+		// so that role changes and deactivation take effect without a new login
+		user, err := a.users.Get(database.Unscoped(c.Request.Context()), claims.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			metrics.AuthFailure(metrics.AuthInvalidToken)
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "User no longer exists"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load user", "user_id", claims.UserID, "error", err)
+			utils.RespondError(c, http.StatusInternalServerError, "Failed to load user", nil)
+			c.Abort()
+			return
+		}
+		// The tenant comes from the token and must still be the user's organization
+		if user.OrganizationID != claims.OrganizationID {
+			metrics.AuthFailure(metrics.AuthInvalidToken)
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		if user.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"message": "User account is disabled"})
+			c.Abort()
+			return
+		}
+
+		// A user with a temporary password may only change it
+		if user.MustChangePassword && c.FullPath() != PasswordChangePath {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Password change required"})
+			c.Abort()
+			return
+		}
+
+		roleName := user.Role.Name
+		if roleName == "" {
+			c.JSON(http.StatusForbidden, gin.H{"message": "User has no role"})
 			c.Abort()
 			return
 		}
 
 		// Add token information to the context
 		c.Set("userID", claims.UserID)
-		c.Set("roleName", claims.RoleName)
+		c.Set("roleName", roleName)
+		c.Set("organizationID", claims.OrganizationID)
+		c.Set("superAdmin", user.SuperAdmin)
 
-		// Log user information
-		log.Printf("User ID: %d, Role: %s", claims.UserID, claims.RoleName)
+		// Restrict every database query of the request to the user's organization, and keep the request
+		// attributes for the policies evaluated by the services
+		ctx := database.WithOrganization(c.Request.Context(), claims.OrganizationID)
+		ctx = authz.WithPolicyRequest(ctx, authz.NewPolicyRequest(c.Request.Method, c.Request.URL.Path, c.ClientIP(), time.Now()))
+		c.Request = c.Request.WithContext(ctx)
 
 		// Continue the request
 		c.Next()
@@ -57,7 +119,17 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 }
 
 // AuthMiddleware verifies if the user has the required permission
-func AuthMiddleware(requiredPermission string) gin.HandlerFunc {
+func (a *Auth) AuthMiddleware(requiredPermission string) gin.HandlerFunc {
+	return a.authorize(requiredPermission, false)
+}
+
+// ListAuthMiddleware verifies the permission on routes listing or exporting documents, whose documents are checked
+// one by one by the services: a policy granting the permission on some documents lets the request through
+func (a *Auth) ListAuthMiddleware(requiredPermission string) gin.HandlerFunc {
+	return a.authorize(requiredPermission, true)
+}
+
+func (a *Auth) authorize(requiredPermission string, perDocument bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Retrieve token information from the context (set by JWTAuthMiddleware)
 		userID, exists := c.Get("userID")
@@ -68,18 +140,83 @@ func AuthMiddleware(requiredPermission string) gin.HandlerFunc {
 			return
 		}
 
-		// Check if the user has the required permission
-		if !utils.HasPermission(roleName.(string), requiredPermission) {
-			utils.RespondError(c, http.StatusForbidden, "You don't have permission to access this resource", nil)
-			log.Printf("Permission denied: %s for user ID: %v, Role: %s", requiredPermission, userID, roleName)
+		// Check if the user has the required permission, through their role or their groups
+		allowed, err := a.engine.HasPermission(c.Request.Context(), userID.(uint), requiredPermission)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load permissions", "user_id", userID, "error", err)
+			utils.RespondError(c, http.StatusInternalServerError, "Failed to check permissions", nil)
+			c.Abort()
+			return
+		}
+
+		// Attribute-based policies of the organization may grant or deny on top of the roles
+		reason := ""
+		organizationID := c.GetUint("organizationID")
+		applies, err := a.engine.HasPolicies(c.Request.Context(), organizationID, requiredPermission)
+		if err == nil && applies {
+			evaluate := a.engine.EvaluatePolicies
+			if perDocument {
+				evaluate = a.engine.EvaluateListPolicies
+			}
+			var input authz.PolicyInput
+			input, err = a.buildPolicyInput(c, userID.(uint), requiredPermission)
+			if err == nil {
+				allowed, reason, err = evaluate(c.Request.Context(), organizationID, input, allowed)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, authz.ErrResourceNotFound) {
+				utils.RespondError(c, http.StatusNotFound, "Document not found", nil)
+			} else {
+				slog.ErrorContext(c.Request.Context(), "Failed to evaluate policies", "user_id", userID, "error", err)
+				utils.RespondError(c, http.StatusInternalServerError, "Failed to check permissions", nil)
+			}
 			c.Abort()
 			return
 		}
 
-		// Log permission check
-		log.Printf("Permission granted: %s for user ID: %v, Role: %s", requiredPermission, userID, roleName)
+		if !allowed {
+			metrics.PermissionDenied(requiredPermission)
+			utils.RespondError(c, http.StatusForbidden, "You don't have permission to access this resource", nil)
+			slog.WarnContext(c.Request.Context(), "Permission denied", "permission", requiredPermission, "user_id", userID, "role", roleName, "reason", reason)
+			c.Abort()
+			return
+		}
 
 		// Continue the request
 		c.Next()
 	}
 }
+
+// buildPolicyInput collects the attributes policies are evaluated against.
+// On /documents/:id routes the targeted document is included; the documents of lists and exports are
+// checked by the services.
+func (a *Auth) buildPolicyInput(c *gin.Context, userID uint, permission string) (authz.PolicyInput, error) {
+	var documentID *uint
+	if strings.HasPrefix(c.FullPath(), "/documents/:id") {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			return authz.PolicyInput{}, authz.ErrResourceNotFound
+		}
+		docID := uint(id)
+		documentID = &docID
+	}
+
+	request := authz.PolicyRequestFrom(c.Request.Context())
+	return a.engine.BuildPolicyInput(c.Request.Context(), userID, permission, documentID, request)
+}
+
+// SuperAdminMiddleware restricts a route to super-admins and lifts the organization restriction,
+// so that the handler can manage every tenant
+func SuperAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("superAdmin") {
+			utils.RespondError(c, http.StatusForbidden, "You don't have permission to access this resource", nil)
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(database.Unscoped(c.Request.Context()))
+		c.Next()
+	}
+}
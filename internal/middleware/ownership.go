@@ -1,16 +1,16 @@
 package middleware
 
 import (
-	"archiv-system/internal/models"
-	"archiv-system/internal/utils"
+	"archiv-system/internal/authz"
 	"errors"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 	"net/http"
 	"strconv"
 )
 
-func OwnershipMiddleware(db *gorm.DB) gin.HandlerFunc {
+// OwnershipMiddleware lets the request through when the user owns the document,
+// or was granted the permission on it (directly, through a group or through a folder)
+func (a *Auth) OwnershipMiddleware(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		// Get document ID from query parameters
@@ -22,38 +22,27 @@ func OwnershipMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var ownerID uint
-
 		// Get logged-in user ID from context
-		userID, exists := c.Get("UserID")
+		userID, exists := c.Get("userID")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
-		err = db.Table("documents").Select("owner_id").Where("id = ? AND owner_id = ?", docID, userID).Scan(&ownerID).Error
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You do not own this document or it does not exist"})
-			c.Abort()
-			return
-		}
-		// Check if user is the owner
-		var doc models.Document
-		if err := db.First(&doc, docID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
-			c.Abort()
-			return
-		}
-
-		isOwner, err := utils.IsDocumentOwner(docID, userID.(uint))
+		// Check if user is the owner or has a grant
+		allowed, err := a.engine.Authorize(c.Request.Context(), userID.(uint), permission, authz.Document(uint(docID)))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document ownership"})
+			if errors.Is(err, authz.ErrResourceNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document ownership"})
+			}
 			c.Abort()
 			return
 		}
-		if !isOwner {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You do not own this document"})
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this document"})
 			c.Abort()
 			return
 		}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Actions enregistrées dans le journal d'audit
+const (
+	AuditMalwareRejected = "malware.rejected" // Fichier infecté supprimé à l'analyse
+	AuditMalwareHeld     = "malware.held"     // Fichier infecté conservé en quarantaine
+	AuditScanRequested   = "scan.requested"   // Nouvelle analyse demandée par un administrateur
+	AuditPackageCreated  = "package.created"  // Paquet d'archivage (AIP) construit et conservé
+)
+
+// AuditEvent enregistre une action sensible sur l'archive, avec son auteur
+type AuditEvent struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"organization_id"`
+	ActorID        *uint     `gorm:"index" json:"actor_id"` // Utilisateur à l'origine de l'action, nil pour le système
+	Action         string    `gorm:"not null;index" json:"action"`
+	TargetType     string    `json:"target_type"` // Type de l'objet concerné, par exemple "document"
+	TargetID       uint      `json:"target_id"`
+	Detail         string    `json:"detail"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// États de la génération des aperçus d'un document
+const (
+	PreviewPending     = "pending"     // génération en attente ou en cours
+	PreviewReady       = "ready"       // miniatures disponibles
+	PreviewFailed      = "failed"      // la génération a échoué
+	PreviewUnsupported = "unsupported" // type de fichier sans aperçu
+)
+
+// Types de dérivés
+const (
+	DerivativeThumbnail = "thumbnail" // miniature d'une image, ou rendu de la première page d'un PDF
+)
+
+// Derivative est un fichier produit à partir d'un document, stocké à côté de lui
+type Derivative struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"-"`
+	DocumentID     uint      `gorm:"not null;uniqueIndex:idx_derivatives_document_kind_size" json:"document_id"`
+	Kind           string    `gorm:"not null;uniqueIndex:idx_derivatives_document_kind_size" json:"kind"`
+	Size           string    `gorm:"not null;uniqueIndex:idx_derivatives_document_kind_size" json:"size"` // small, medium ou large
+	ContentType    string    `gorm:"not null" json:"content_type"`
+	URL            string    `gorm:"not null" json:"-"` // Chemin du fichier dans le stockage
+	Encryption               // Chiffrement du fichier stocké
+	Width          int       `json:"width"`
+	Height         int       `json:"height"`
+	Bytes          int64     `json:"bytes"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -4,18 +4,40 @@ import (
 	"time"
 )
 
+// États de l'analyse antivirus d'un document. Un document en attente, infecté ou en erreur reste en quarantaine.
+const (
+	ScanPending  = "pending"  // Le fichier attend son analyse
+	ScanClean    = "clean"    // Aucun logiciel malveillant trouvé
+	ScanInfected = "infected" // Fichier infecté, conservé pour examen
+	ScanError    = "error"    // L'analyse a échoué, à relancer
+)
+
 type Document struct {
-	ID                uint      `gorm:"primary_key"`
-	Name              string    `gorm:"not null"`
-	Type              string    `gorm:"not null"`
-	URL               string    `gorm:"not null"`
-	Tags              *[]Tag    `gorm:"many2many:document_tags;"`
-	OwnerID           uint      `gorm:"not null"`           // Référence à l'utilisateur propriétaire
-	Owner             User      `gorm:"foreignKey:OwnerID"` // Relation avec User
-	Version           int       `gorm:"default:1"`
-	PreviousVersionID uint      `gorm:"default:0"`
-	CreatedAt         time.Time `gorm:"autoCreateTime"`
-	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
+	ID                uint       `gorm:"primary_key"`
+	OrganizationID    uint       `gorm:"index"`
+	Name              string     `gorm:"not null"`
+	Type              string     `gorm:"not null"` // Type détecté à partir du contenu
+	DeclaredType      string     // Type annoncé par le client lors du dépôt
+	URL               string     `gorm:"not null"`
+	Encryption                   // Chiffrement du fichier stocké
+	Size              int64      `gorm:"not null;default:0"` // Taille du fichier en octets
+	Tags              *[]Tag     `gorm:"many2many:document_tags;"`
+	OwnerID           uint       `gorm:"not null"`           // Référence à l'utilisateur propriétaire
+	Owner             User       `gorm:"foreignKey:OwnerID"` // Relation avec User
+	FolderID          *uint      `gorm:"index"`              // Dossier contenant le document
+	Version           int        `gorm:"default:1"`
+	PreviousVersionID uint       `gorm:"default:0"`
+	SHA256            string     // Empreinte du fichier calculée au dépôt
+	SHA512            string     // Empreinte optionnelle, si activée dans la configuration
+	FixityStatus      string     // Résultat de la dernière vérification d'intégrité, vide si jamais vérifié
+	FixityCheckedAt   *time.Time // Date de la dernière vérification d'intégrité
+	PreviewStatus     string     // État de la génération des miniatures, vide si jamais demandée
+	ScanStatus        string     `gorm:"index"` // État de l'analyse antivirus, vide si l'analyse n'était pas activée
+	ScanEngine        string     // Version du moteur et des signatures de la dernière analyse
+	ScanSignature     string     // Nom du logiciel malveillant trouvé
+	ScannedAt         *time.Time // Date de la dernière analyse
+	CreatedAt         time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime"`
 }
 
 type DocumentTag struct {
@@ -24,6 +46,7 @@ type DocumentTag struct {
 }
 
 type Tag struct {
-	ID   uint   `gorm:"primaryKey"`
-	Name string `gorm:"unique;not null"`
+	ID             uint   `gorm:"primaryKey"`
+	OrganizationID uint   `gorm:"uniqueIndex:idx_tags_organization_name"`
+	Name           string `gorm:"not null;uniqueIndex:idx_tags_organization_name"`
 }
@@ -0,0 +1,8 @@
+package models
+
+// Encryption décrit le chiffrement au repos d'un fichier stocké. Il est enregistré avec le document, la miniature,
+// l'export ou le paquet qui référence le fichier : le contenu n'est jamais examiné pour savoir s'il est chiffré.
+type Encryption struct {
+	Encrypted bool   `gorm:"not null;default:false" json:"-"` // Fichier chiffré avec sa propre clé de données
+	KeyID     string `json:"-"`                               // Clé maîtresse enveloppant la clé de données
+}
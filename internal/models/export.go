@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// États d'un export en arrière-plan
+const (
+	ExportPending   = "pending"   // L'export attend son tour
+	ExportRunning   = "running"   // L'archive est en cours de construction
+	ExportCompleted = "completed" // L'archive peut être téléchargée jusqu'à son expiration
+	ExportFailed    = "failed"    // L'export s'est arrêté avant la fin
+	ExportExpired   = "expired"   // L'archive a été supprimée à son expiration
+)
+
+// Formats des archives d'export
+const (
+	ExportFormatZip   = "zip"   // Archive zip des documents et de leur manifeste
+	ExportFormatBagIt = "bagit" // Sac BagIt 1.0 destiné à la conservation à long terme
+	ExportFormatDIP   = "dip"   // Paquet de diffusion (DIP, modèle OAIS) : sac BagIt décrit par un METS avec les métadonnées PREMIS
+)
+
+// ExportJob suit la construction en arrière-plan d'une archive zip de documents, trop grande pour être
+// envoyée directement
+type ExportJob struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"index" json:"organization_id"`
+	UserID         uint       `gorm:"index;not null" json:"user_id"` // Utilisateur ayant demandé l'export, seul à pouvoir le télécharger
+	Status         string     `gorm:"not null" json:"status"`
+	Format         string     `json:"format"`          // zip, bagit ou dip
+	Manifest       string     `json:"manifest"`        // Format du manifeste, json ou csv
+	DocumentIDs    string     `json:"-"`               // Documents retenus à la demande, séparés par des virgules
+	Total          int        `json:"total"`           // Nombre de documents de l'export
+	Processed      int        `json:"processed"`       // Documents ajoutés à l'archive jusqu'ici
+	Failed         int        `json:"failed"`          // Documents dont le fichier n'a pas pu être lu, listés dans le manifeste
+	Size           int64      `json:"size"`            // Taille de l'archive en octets
+	Error          string     `json:"error,omitempty"` // Cause de l'arrêt d'un export échoué
+	URL            string     `json:"-"`               // Emplacement de l'archive dans le stockage
+	Encryption                // Chiffrement de l'archive stockée
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	ExpiresAt      *time.Time `gorm:"index" json:"expires_at"` // Date de suppression de l'archive
+}
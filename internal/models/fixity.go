@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Résultats possibles d'une vérification d'intégrité
+const (
+	FixityOK       = "ok"       // Le fichier correspond à son empreinte
+	FixityMismatch = "mismatch" // Le contenu du fichier a changé
+	FixityMissing  = "missing"  // Le fichier n'existe plus dans le stockage
+	FixityError    = "error"    // Le fichier n'a pas pu être lu
+
+	// Événement enregistré quand l'empreinte d'un document déposé avant les vérifications est calculée
+	// sur la copie stockée : elle ne prouve pas que le fichier est celui qui a été déposé
+	FixityBackfilled = "backfilled"
+)
+
+// FixityEvent enregistre un échec de vérification d'intégrité d'un document, ou le calcul tardif de son empreinte
+type FixityEvent struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"organization_id"`
+	DocumentID     uint      `gorm:"index;not null" json:"document_id"`
+	Outcome        string    `gorm:"not null" json:"outcome"` // "mismatch", "missing", "error" ou "backfilled"
+	ExpectedSHA256 string    `json:"expected_sha256"`
+	ActualSHA256   string    `json:"actual_sha256"` // Vide si le fichier n'a pas pu être lu
+	Detail         string    `json:"detail"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Group regroupe des utilisateurs (ex. un service) qui héritent des rôles du groupe
+type Group struct {
+	ID             uint      `gorm:"primaryKey"`
+	OrganizationID uint      `gorm:"uniqueIndex:idx_groups_organization_name"`
+	Name           string    `gorm:"not null;uniqueIndex:idx_groups_organization_name"`
+	Users          []*User   `gorm:"many2many:user_groups;"`
+	Roles          []*Role   `gorm:"many2many:group_roles;"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// Folder permet de ranger les documents et de donner accès à tout un dossier en une fois
+type Folder struct {
+	ID             uint      `gorm:"primaryKey"`
+	OrganizationID uint      `gorm:"index"`
+	Name           string    `gorm:"not null"`
+	ParentID       *uint     `gorm:"index"` // Dossier parent, nil pour un dossier racine
+	OwnerID        uint      `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	// Types de fichiers acceptés dans le dossier, séparés par des virgules, vide pour tous
+	AllowedUploadTypes string
+}
+
+// Grant donne une permission sur un document ou un dossier à un utilisateur ou à un groupe.
+// Exactement une cible (DocumentID ou FolderID) et un bénéficiaire (UserID ou GroupID) sont renseignés.
+type Grant struct {
+	ID             uint      `gorm:"primaryKey"`
+	OrganizationID uint      `gorm:"index"`
+	DocumentID     *uint     `gorm:"index"`
+	FolderID       *uint     `gorm:"index"`
+	UserID         *uint     `gorm:"index"`
+	GroupID        *uint     `gorm:"index"`
+	Permission     string    `gorm:"not null"` // ex. "read_document"
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
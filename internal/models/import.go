@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// États d'un import d'archive
+const (
+	ImportPending   = "pending"   // L'import attend son tour
+	ImportRunning   = "running"   // Les fichiers de l'archive sont en cours d'import
+	ImportCompleted = "completed" // Toutes les entrées ont été traitées, certaines ont pu échouer
+	ImportFailed    = "failed"    // L'import s'est arrêté avant la fin
+)
+
+// Résultats de l'import d'une entrée d'archive
+const (
+	ImportEntryImported = "imported" // Le fichier est devenu un document
+	ImportEntryFailed   = "failed"   // Le fichier a été refusé, voir l'erreur
+	ImportEntrySkipped  = "skipped"  // L'entrée n'est pas un fichier ordinaire
+)
+
+// ImportJob suit l'import en arrière-plan d'une archive zip ou tar
+type ImportJob struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"index" json:"organization_id"`
+	UserID         uint       `gorm:"index;not null" json:"user_id"` // Utilisateur propriétaire des documents importés
+	FolderID       *uint      `json:"folder_id"`                     // Dossier de destination, nil pour la racine
+	Filename       string     `json:"filename"`
+	Format         string     `json:"format"`                            // zip, tar ou tar.gz
+	Bag            bool       `gorm:"not null;default:false" json:"bag"` // Sac BagIt, validé avant l'import de sa charge utile
+	Status         string     `gorm:"not null" json:"status"`
+	Total          int        `json:"total"`     // Nombre d'entrées de l'archive, hors dossiers et manifeste
+	Processed      int        `json:"processed"` // Entrées traitées jusqu'ici
+	Imported       int        `json:"imported"`
+	Failed         int        `json:"failed"`
+	Skipped        int        `json:"skipped"`
+	Error          string     `json:"error,omitempty"` // Cause de l'arrêt d'un import échoué
+	ArchivePath    string     `json:"-"`               // Copie temporaire de l'archive, supprimée à la fin de l'import
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
+
+// ImportEntry enregistre le résultat de l'import d'une entrée d'archive
+type ImportEntry struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"organization_id"`
+	JobID          uint      `gorm:"index;not null" json:"job_id"`
+	Path           string    `gorm:"not null" json:"path"` // Chemin de l'entrée dans l'archive
+	Status         string    `gorm:"not null" json:"status"`
+	DocumentID     *uint     `json:"document_id"` // Document créé, nil si l'entrée n'a pas été importée
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Organization est un locataire (filiale) : ses utilisateurs, documents, tags et rôles
+// ne sont jamais visibles des autres organisations
+type Organization struct {
+	ID                uint      `gorm:"primaryKey"`
+	Name              string    `gorm:"unique;not null"`
+	Slug              string    `gorm:"unique;not null"`        // Identifiant court, utilisé comme préfixe de stockage
+	AllowRegistration bool      `gorm:"not null;default:false"` // Autorise l'inscription publique dans l'organisation
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Effets possibles d'une politique
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// Policy est une règle d'autorisation à base d'attributs écrite par un administrateur.
+// Condition est une expression (langage expr) évaluée sur les attributs de l'utilisateur,
+// du document et de la requête, ex. `user.role == "contractor" && "public" in document.tags`.
+type Policy struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"uniqueIndex:idx_policies_organization_name" json:"organization_id"`
+	Name           string    `gorm:"not null;uniqueIndex:idx_policies_organization_name" json:"name"`
+	Description    string    `json:"description"`
+	Permission     string    `gorm:"not null" json:"permission"` // Permission concernée, "*" pour toutes
+	Effect         string    `gorm:"not null" json:"effect"`     // "allow" ou "deny"
+	Condition      string    `gorm:"not null" json:"condition"`
+	Enabled        bool      `gorm:"not null;default:true" json:"enabled"`
+	DryRun         bool      `gorm:"not null;default:false" json:"dry_run"` // Journalise la décision sans l'appliquer
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
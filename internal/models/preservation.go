@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// États de la construction d'un paquet d'archivage
+const (
+	PackagePending   = "pending"   // Le paquet attend son tour
+	PackageRunning   = "running"   // Le sac est en cours de construction
+	PackageCompleted = "completed" // Le paquet est conservé dans le stockage
+	PackageFailed    = "failed"    // La construction s'est arrêtée avant la fin
+)
+
+// ArchivalPackage est un paquet d'information archivé (AIP, modèle OAIS) : un sac BagIt de documents et de toutes
+// leurs versions, décrit par un METS portant leurs métadonnées PREMIS, conservé sans limite de durée dans le stockage
+type ArchivalPackage struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"index" json:"organization_id"`
+	UserID         *uint      `gorm:"index" json:"user_id"`   // Administrateur ayant demandé le paquet, nil pour un paquet créé à l'ingestion
+	ImportID       *uint      `gorm:"index" json:"import_id"` // Import (paquet de versement, SIP) dont les documents sont conservés
+	Status         string     `gorm:"not null" json:"status"`
+	DocumentIDs    string     `json:"-"`               // Documents demandés, séparés par des virgules
+	Files          int        `json:"files"`           // Nombre de fichiers du paquet, versions précédentes comprises
+	Skipped        int        `json:"skipped"`         // Documents laissés de côté, encore en quarantaine
+	Size           int64      `json:"size"`            // Taille de l'archive du sac en octets
+	SHA256         string     `json:"sha256"`          // Empreinte de l'archive du sac, calculée à sa construction
+	Error          string     `json:"error,omitempty"` // Cause de l'arrêt d'une construction échouée
+	URL            string     `json:"-"`               // Emplacement de l'archive dans le stockage
+	Encryption                // Chiffrement de l'archive stockée
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
@@ -1,13 +1,16 @@
 package models
 
+import "io"
+
 type UploadedFile struct {
-	Filename    string             // Le nom du fichier
-	ContentType string             // Le type MIME du fichier (ex. "application/pdf")
-	Save        func(string) error // Fonction pour sauvegarder le fichier à l'emplacement donné
+	Filename    string                        // Le nom du fichier
+	ContentType string                        // Le type MIME du fichier (ex. "application/pdf")
+	Size        int64                         // La taille du fichier en octets
+	Open        func() (io.ReadCloser, error) // Fonction pour lire le contenu du fichier
 }
 
+// UpdateRequest ne porte pas de type MIME : le type d'un document est celui détecté au dépôt
 type UpdateRequest struct {
 	Name string   // Le nouveau nom du document
-	Type string   // Le nouveau type MIME du document
 	Tags []string // Les nouveaux tags du document
 }
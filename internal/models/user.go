@@ -3,18 +3,55 @@ package models
 import "time"
 
 type User struct {
+	ID                 uint       `gorm:"primaryKey"`
+	OrganizationID     uint       `gorm:"index"`
+	Username           string     `gorm:"unique;not null"`
+	Email              string     // Adresse utilisée pour la réinitialisation du mot de passe
+	Password           string     `gorm:"not null" json:"-"`
+	RoleID             uint       `gorm:"not null"`
+	Role               Role       `gorm:"foreignKey:RoleID"`        // Associe Role avec User
+	AuthSource         string     `gorm:"not null;default:'local'"` // "local" (bcrypt) ou "ldap"
+	SuperAdmin         bool       `gorm:"not null;default:false"`   // Administre toutes les organisations
+	Disabled           bool       `gorm:"not null;default:false"`
+	MustChangePassword bool       `gorm:"not null;default:false"` // Mot de passe temporaire à changer à la prochaine connexion
+	LastLoginAt        *time.Time // Date de la dernière connexion réussie
+	FailedLogins       int        `gorm:"not null;default:0"` // Échecs de connexion consécutifs
+	LockedUntil        *time.Time // Compte verrouillé jusqu'à cette date après trop d'échecs
+	Groups             []*Group   `gorm:"many2many:user_groups;"` // Groupes dont l'utilisateur est membre
+	CreatedAt          time.Time  `gorm:"autoCreateTime"`
+}
+
+// PasswordHistory conserve les anciens mots de passe hachés pour empêcher leur réutilisation
+type PasswordHistory struct {
 	ID        uint      `gorm:"primaryKey"`
-	Username  string    `gorm:"unique;not null"`
-	Password  string    `gorm:"not null"`
-	RoleID    uint      `gorm:"not null"`
-	Role      Role      `gorm:"foreignKey:RoleID"` // Associe Role avec User
+	UserID    uint      `gorm:"index;not null"`
+	Hash      string    `gorm:"not null"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+// PasswordResetToken est un jeton de réinitialisation à usage unique, seul son hash SHA-256 est stocké
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Renseigné quand le jeton a servi
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+// Sources d'authentification possibles pour un utilisateur
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+)
+
 type Role struct {
-	ID          uint          `gorm:"primaryKey"`
-	Name        string        `gorm:"unique;not null"`
-	Permissions []*Permission `gorm:"many2many:role_permissions;"`
+	ID             uint          `gorm:"primaryKey"`
+	OrganizationID uint          `gorm:"uniqueIndex:idx_roles_organization_name"`
+	Name           string        `gorm:"not null;uniqueIndex:idx_roles_organization_name"`
+	Permissions    []*Permission `gorm:"many2many:role_permissions;"`
+	// Types de fichiers que le rôle peut déposer, séparés par des virgules (ex. "application/pdf,image/*"), vide pour tous
+	AllowedUploadTypes string
 }
 
 type Permission struct {
@@ -26,3 +63,11 @@ type RolePermission struct {
 	RoleID       uint `gorm:"primaryKey"`
 	PermissionID uint `gorm:"primaryKey"`
 }
+
+// SeededGrant garde la trace des permissions déjà attribuées par le seed,
+// pour ne pas réattribuer une permission qu'un administrateur a retirée
+type SeededGrant struct {
+	OrganizationID uint   `gorm:"primaryKey;autoIncrement:false"`
+	RoleName       string `gorm:"primaryKey"`
+	PermissionName string `gorm:"primaryKey"`
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"archiv-system/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// Message is a notification sent to a user
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to users (password reset links, ...)
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// New returns the notifier of the configuration: the log or SMTP
+func New(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case config.NotifierLog:
+		return LogNotifier{}, nil
+	case config.NotifierSMTP:
+		return SMTPNotifier{
+			Host:     cfg.SMTPHost,
+			Port:     strconv.Itoa(cfg.SMTPPort),
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier '%s'", cfg.Type)
+	}
+}
+
+// LogNotifier records in the server log that a message was sent, for development setups without a mail server.
+// The body is never logged, it may hold a password reset token.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "Notification", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// SMTPNotifier sends messages by e-mail
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (n SMTPNotifier) Notify(_ context.Context, msg Message) error {
+	// Refuse header injection through the recipient or the subject
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("invalid message headers")
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	body := "From: " + n.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + msg.Body
+	return smtp.SendMail(net.JoinHostPort(n.Host, n.Port), auth, n.From, []string{msg.To}, []byte(body))
+}
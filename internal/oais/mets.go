@@ -0,0 +1,261 @@
+package oais
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Namespaces and schemas of the METS document
+const (
+	metsNamespace   = "http://www.loc.gov/METS/"
+	premisNamespace = "http://www.loc.gov/premis/v3"
+	dcNamespace     = "http://purl.org/dc/elements/1.1/"
+	xlinkNamespace  = "http://www.w3.org/1999/xlink"
+	xsiNamespace    = "http://www.w3.org/2001/XMLSchema-instance"
+	schemaLocations = metsNamespace + " https://www.loc.gov/standards/mets/mets.xsd " +
+		premisNamespace + " https://www.loc.gov/standards/premis/v3/premis.xsd"
+)
+
+type mets struct {
+	XMLName        xml.Name  `xml:"mets:mets"`
+	METS           string    `xml:"xmlns:mets,attr"`
+	PREMIS         string    `xml:"xmlns:premis,attr"`
+	DC             string    `xml:"xmlns:dc,attr"`
+	XLink          string    `xml:"xmlns:xlink,attr"`
+	XSI            string    `xml:"xmlns:xsi,attr"`
+	SchemaLocation string    `xml:"xsi:schemaLocation,attr"`
+	ObjID          string    `xml:"OBJID,attr"`
+	Type           string    `xml:"TYPE,attr"`
+	Label          string    `xml:"LABEL,attr,omitempty"`
+	Header         metsHdr   `xml:"mets:metsHdr"`
+	DmdSecs        []mdSec   `xml:"mets:dmdSec"`
+	AmdSecs        []amdSec  `xml:"mets:amdSec"`
+	FileSec        fileSec   `xml:"mets:fileSec"`
+	StructMap      structMap `xml:"mets:structMap"`
+}
+
+type metsHdr struct {
+	CreateDate string      `xml:"CREATEDATE,attr"`
+	Agents     []metsAgent `xml:"mets:agent"`
+}
+
+type metsAgent struct {
+	Role      string `xml:"ROLE,attr"`
+	Type      string `xml:"TYPE,attr"`
+	OtherType string `xml:"OTHERTYPE,attr,omitempty"`
+	Name      string `xml:"mets:name"`
+}
+
+type mdSec struct {
+	ID     string `xml:"ID,attr"`
+	MdWrap mdWrap `xml:"mets:mdWrap"`
+}
+
+type mdWrap struct {
+	MDType  string  `xml:"MDTYPE,attr"`
+	XMLData xmlData `xml:"mets:xmlData"`
+}
+
+// xmlData holds one of the kinds of metadata
+type xmlData struct {
+	*dublinCore
+	Object *premisObject `xml:"premis:object"`
+	Event  *premisEvent  `xml:"premis:event"`
+	Agent  *premisAgent  `xml:"premis:agent"`
+}
+
+// dublinCore is the descriptive metadata of a document
+type dublinCore struct {
+	Title      string   `xml:"dc:title"`
+	Identifier string   `xml:"dc:identifier"`
+	Subjects   []string `xml:"dc:subject"`
+	Format     string   `xml:"dc:format,omitempty"`
+	Date       string   `xml:"dc:date"`
+}
+
+type amdSec struct {
+	ID         string  `xml:"ID,attr"`
+	TechMD     []mdSec `xml:"mets:techMD"`
+	DigiprovMD []mdSec `xml:"mets:digiprovMD"`
+}
+
+type fileSec struct {
+	Groups []fileGrp `xml:"mets:fileGrp"`
+}
+
+type fileGrp struct {
+	Use   string     `xml:"USE,attr"`
+	Files []metsFile `xml:"mets:file"`
+}
+
+type metsFile struct {
+	ID           string `xml:"ID,attr"`
+	GroupID      string `xml:"GROUPID,attr"`
+	MimeType     string `xml:"MIMETYPE,attr,omitempty"`
+	Size         int64  `xml:"SIZE,attr"`
+	Created      string `xml:"CREATED,attr"`
+	Checksum     string `xml:"CHECKSUM,attr,omitempty"`
+	ChecksumType string `xml:"CHECKSUMTYPE,attr,omitempty"`
+	DMDID        string `xml:"DMDID,attr"`
+	ADMID        string `xml:"ADMID,attr"`
+	FLocat       flocat `xml:"mets:FLocat"`
+}
+
+type flocat struct {
+	LocType      string `xml:"LOCTYPE,attr"`
+	OtherLocType string `xml:"OTHERLOCTYPE,attr"`
+	Href         string `xml:"xlink:href,attr"`
+}
+
+type structMap struct {
+	Type string `xml:"TYPE,attr"`
+	Div  *div   `xml:"mets:div"`
+}
+
+type div struct {
+	Type  string `xml:"TYPE,attr"`
+	Label string `xml:"LABEL,attr"`
+	DMDID string `xml:"DMDID,attr,omitempty"`
+	Fptrs []fptr `xml:"mets:fptr"`
+	Divs  []*div `xml:"mets:div"`
+}
+
+type fptr struct {
+	FileID string `xml:"FILEID,attr"`
+}
+
+// METS writes the METS document of the package. Each file has its descriptive metadata in Dublin Core, and its
+// PREMIS object, events and agents in its administrative metadata. The physical structural map places the files
+// in the folders of their documents, the versions of a document in a single item.
+func (p *Package) METS() ([]byte, error) {
+	agents := make(map[string]*Agent, len(p.Agents))
+	for i := range p.Agents {
+		agents[p.Agents[i].ID] = &p.Agents[i]
+	}
+
+	doc := mets{
+		METS:           metsNamespace,
+		PREMIS:         premisNamespace,
+		DC:             dcNamespace,
+		XLink:          xlinkNamespace,
+		XSI:            xsiNamespace,
+		SchemaLocation: schemaLocations,
+		ObjID:          p.ID,
+		Type:           p.Type,
+		Label:          p.Label,
+		Header: metsHdr{
+			CreateDate: formatTime(p.Created),
+			Agents: []metsAgent{
+				{Role: "CREATOR", Type: "ORGANIZATION", Name: p.Creator},
+				{Role: "CREATOR", Type: "OTHER", OtherType: "SOFTWARE", Name: "archiv-system"},
+			},
+		},
+		StructMap: structMap{Type: "physical", Div: &div{Type: "Directory", Label: p.ID}},
+	}
+	files := fileGrp{Use: "original"}
+	dirs := map[string]*div{"": doc.StructMap.Div}
+	items := make(map[string]*div)
+
+	for i := range p.Files {
+		file := &p.Files[i]
+		dmdID, amdID := "dmdSec-"+file.ID, "amdSec-"+file.ID
+
+		doc.DmdSecs = append(doc.DmdSecs, mdSec{ID: dmdID, MdWrap: mdWrap{MDType: "DC", XMLData: xmlData{dublinCore: &dublinCore{
+			Title:      file.Name,
+			Identifier: file.ID,
+			Subjects:   file.Subjects,
+			Format:     file.MimeType,
+			Date:       formatTime(file.Created),
+		}}}})
+
+		amd := amdSec{ID: amdID, TechMD: []mdSec{{
+			ID:     "techMD-" + file.ID,
+			MdWrap: mdWrap{MDType: "PREMIS:OBJECT", XMLData: xmlData{Object: premisObjectOf(file)}},
+		}}}
+		linked := make(map[string]bool)
+		var linkedAgents []*Agent
+		for j := range file.Events {
+			amd.DigiprovMD = append(amd.DigiprovMD, mdSec{
+				ID:     "digiprovMD-" + eventID(file, j),
+				MdWrap: mdWrap{MDType: "PREMIS:EVENT", XMLData: xmlData{Event: premisEventOf(file, j)}},
+			})
+			for _, link := range file.Events[j].Agents {
+				agent, ok := agents[link.AgentID]
+				if !ok {
+					return nil, fmt.Errorf("event %s of file %s refers to unknown agent %s", file.Events[j].Type, file.ID, link.AgentID)
+				}
+				if !linked[agent.ID] {
+					linked[agent.ID] = true
+					linkedAgents = append(linkedAgents, agent)
+				}
+			}
+		}
+		// Each file carries the agents of its events, its metadata is complete on its own
+		for _, agent := range linkedAgents {
+			amd.DigiprovMD = append(amd.DigiprovMD, mdSec{
+				ID:     "digiprovMD-" + file.ID + "-agent-" + agent.ID,
+				MdWrap: mdWrap{MDType: "PREMIS:AGENT", XMLData: xmlData{Agent: premisAgentOf(agent)}},
+			})
+		}
+		doc.AmdSecs = append(doc.AmdSecs, amd)
+
+		entry := metsFile{
+			ID:       "file-" + file.ID,
+			GroupID:  "item-" + file.Item,
+			MimeType: file.MimeType,
+			Size:     file.Size,
+			Created:  formatTime(file.Created),
+			DMDID:    dmdID,
+			ADMID:    amdID,
+			FLocat:   flocat{LocType: "OTHER", OtherLocType: "SYSTEM", Href: file.Path},
+		}
+		for _, checksum := range file.Checksums {
+			if checksum.Algorithm == SHA256 {
+				entry.Checksum, entry.ChecksumType = checksum.Digest, checksum.Algorithm
+			}
+		}
+		files.Files = append(files.Files, entry)
+
+		item, ok := items[file.Item]
+		if !ok {
+			item = &div{Type: "Item"}
+			items[file.Item] = item
+			parent := directory(dirs, file.Dir)
+			parent.Divs = append(parent.Divs, item)
+		}
+		// The item takes the name and description of its latest version
+		item.Label, item.DMDID = file.Name, dmdID
+		item.Fptrs = append(item.Fptrs, fptr{FileID: entry.ID})
+	}
+	doc.FileSec.Groups = []fileGrp{files}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// directory returns the division of a folder of the structural map, creating it and its parents when missing
+func directory(dirs map[string]*div, dir string) *div {
+	dir = strings.Trim(dir, "/")
+	if dir == "." {
+		dir = ""
+	}
+	if d, ok := dirs[dir]; ok {
+		return d
+	}
+	parent := directory(dirs, path.Dir(dir))
+	d := &div{Type: "Directory", Label: path.Base(dir)}
+	parent.Divs = append(parent.Divs, d)
+	dirs[dir] = d
+	return d
+}
+
+// FileID returns the identifier of the file of a document version
+func FileID(documentID uint) string {
+	return "document-" + strconv.FormatUint(uint64(documentID), 10)
+}
@@ -0,0 +1,256 @@
+package oais
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+// node is an element of a parsed XML document
+type node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []*node    `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+// attr returns the value of an attribute by local name
+func (n *node) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// all returns the descendants reached through the children of the successive names
+func (n *node) all(namespace string, names ...string) []*node {
+	found := []*node{n}
+	for _, name := range names {
+		var next []*node
+		for _, parent := range found {
+			for _, child := range parent.Nodes {
+				if child.XMLName.Space == namespace && child.XMLName.Local == name {
+					next = append(next, child)
+				}
+			}
+		}
+		found = next
+	}
+	return found
+}
+
+// text returns the trimmed text of the only descendant reached through the names, "" when there is none
+func (n *node) text(namespace string, names ...string) string {
+	found := n.all(namespace, names...)
+	if len(found) != 1 {
+		return ""
+	}
+	return strings.TrimSpace(found[0].Text)
+}
+
+func parseXML(t *testing.T, data []byte) *node {
+	t.Helper()
+	var root node
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&root); err != nil {
+		t.Fatalf("parse: %v\n%s", err, data)
+	}
+	return &root
+}
+
+// testPackage holds two versions of a report in a sub-folder and a first version of a note at the root
+func testPackage() *Package {
+	created := time.Date(2024, 5, 2, 8, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	ingestion := func(agent string) Event {
+		return Event{Type: EventIngestion, Date: created, Detail: "uploaded", Outcome: OutcomeSuccess,
+			Agents: []AgentLink{{AgentID: agent, Role: RoleImplementer}, {AgentID: "archiv-system", Role: RoleExecutingProgram}}}
+	}
+	return &Package{
+		ID:      "aip-7",
+		Type:    AIP,
+		Label:   "AIP of 3 documents of Archives",
+		Creator: "Archives",
+		Created: created,
+		Agents: []Agent{
+			{ID: "archiv-system", Name: "archiv-system", Type: AgentSoftware},
+			{ID: "user-2", Name: "alice", Type: AgentPerson},
+			{ID: "scanner-3", Name: "ClamAV 1.3", Type: AgentSoftware},
+		},
+		Files: []File{
+			{
+				ID: "document-1", Item: "document-1", Dir: "reports/2024", Path: "data/reports/2024/budget.csv",
+				Name: "budget.csv", MimeType: "text/csv", Size: 21, Created: created, Subjects: []string{"finance", "2024"},
+				Checksums: []Checksum{{Algorithm: SHA256, Digest: "aa11"}, {Algorithm: SHA512, Digest: "bb22"}},
+				Events:    []Event{ingestion("user-2")},
+			},
+			{
+				ID: "document-4", Item: "document-1", Dir: "reports/2024", Path: "data/reports/2024/budget-4.csv",
+				Name: "budget-v2.csv", MimeType: "text/csv", Size: 30, Created: created.Add(time.Hour), Source: "document-1",
+				Checksums: []Checksum{{Algorithm: SHA256, Digest: "cc33"}},
+				Events: []Event{
+					ingestion("user-2"),
+					{Type: EventVirusCheck, Date: created.Add(2 * time.Hour), Detail: "malware scan", Outcome: OutcomeSuccess,
+						OutcomeDetail: "no malware found", Agents: []AgentLink{{AgentID: "scanner-3", Role: RoleExecutingProgram}}},
+				},
+			},
+			{
+				ID: "document-5", Item: "document-5", Path: "data/note.txt", Name: "note.txt", MimeType: "text/plain",
+				Size: 4, Created: created, Checksums: []Checksum{{Algorithm: SHA256, Digest: "dd44"}},
+			},
+		},
+	}
+}
+
+func TestMETSStructure(t *testing.T) {
+	data, err := testPackage().METS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(xml.Header)) {
+		t.Fatal("no XML declaration")
+	}
+	root := parseXML(t, data)
+	if root.XMLName.Space != metsNamespace || root.XMLName.Local != "mets" {
+		t.Fatalf("root element %v", root.XMLName)
+	}
+	if root.attr("OBJID") != "aip-7" || root.attr("TYPE") != AIP || !strings.Contains(root.attr("schemaLocation"), "premis.xsd") {
+		t.Fatalf("root attributes %v", root.Attrs)
+	}
+	header := root.all(metsNamespace, "metsHdr")
+	if len(header) != 1 || header[0].attr("CREATEDATE") != "2024-05-02T06:30:00Z" {
+		t.Fatalf("header %+v", header)
+	}
+	if creators := root.all(metsNamespace, "metsHdr", "agent", "name"); len(creators) != 2 || strings.TrimSpace(creators[0].Text) != "Archives" {
+		t.Fatalf("creators %+v", creators)
+	}
+
+	// The files, with their SHA-256 and location in the bag
+	files := root.all(metsNamespace, "fileSec", "fileGrp", "file")
+	if len(files) != 3 {
+		t.Fatalf("%d files, want 3", len(files))
+	}
+	want := []struct{ id, group, checksum, href string }{
+		{"file-document-1", "item-document-1", "aa11", "data/reports/2024/budget.csv"},
+		{"file-document-4", "item-document-1", "cc33", "data/reports/2024/budget-4.csv"},
+		{"file-document-5", "item-document-5", "dd44", "data/note.txt"},
+	}
+	for i, file := range files {
+		href := file.all(metsNamespace, "FLocat")[0].attr("href")
+		if file.attr("ID") != want[i].id || file.attr("GROUPID") != want[i].group || file.attr("CHECKSUM") != want[i].checksum ||
+			file.attr("CHECKSUMTYPE") != SHA256 || href != want[i].href {
+			t.Errorf("file %d: %v, href %s", i, file.Attrs, href)
+		}
+		if file.attr("DMDID") != "dmdSec-"+strings.TrimPrefix(want[i].id, "file-") {
+			t.Errorf("file %d: DMDID %s", i, file.attr("DMDID"))
+		}
+	}
+
+	// Dublin Core of the first file
+	dc := root.all(metsNamespace, "dmdSec")[0].all(metsNamespace, "mdWrap", "xmlData")[0]
+	if dc.text(dcNamespace, "title") != "budget.csv" || dc.text(dcNamespace, "identifier") != "document-1" || len(dc.all(dcNamespace, "subject")) != 2 {
+		t.Errorf("descriptive metadata %s", data)
+	}
+
+	// The structural map places the versions of a document in one item, under its folders
+	div := root.all(metsNamespace, "structMap", "div")
+	if len(div) != 1 || div[0].attr("LABEL") != "aip-7" {
+		t.Fatalf("structural map root %+v", div)
+	}
+	reports := div[0].all(metsNamespace, "div")
+	if len(reports) != 2 || reports[0].attr("LABEL") != "reports" || reports[1].attr("TYPE") != "Item" || reports[1].attr("LABEL") != "note.txt" {
+		t.Fatalf("top-level divisions %+v", reports)
+	}
+	items := reports[0].all(metsNamespace, "div", "div")
+	if len(items) != 1 || items[0].attr("TYPE") != "Item" || items[0].attr("LABEL") != "budget-v2.csv" || items[0].attr("DMDID") != "dmdSec-document-4" {
+		t.Fatalf("items of reports/2024 %+v", items)
+	}
+	if fptrs := items[0].all(metsNamespace, "fptr"); len(fptrs) != 2 || fptrs[0].attr("FILEID") != "file-document-1" || fptrs[1].attr("FILEID") != "file-document-4" {
+		t.Fatalf("versions of the item %+v", fptrs)
+	}
+}
+
+func TestPREMISMetadata(t *testing.T) {
+	data, err := testPackage().METS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	amdSecs := parseXML(t, data).all(metsNamespace, "amdSec")
+	if len(amdSecs) != 3 {
+		t.Fatalf("%d administrative sections, want 3", len(amdSecs))
+	}
+	objectOf := func(amd *node) *node {
+		return amd.all(metsNamespace, "techMD", "mdWrap", "xmlData")[0].all(premisNamespace, "object")[0]
+	}
+
+	// The checksums recorded at upload are the fixity of the object
+	object := objectOf(amdSecs[0])
+	if object.attr("type") != "premis:file" || object.attr("version") != premisVersion {
+		t.Errorf("object attributes %v", object.Attrs)
+	}
+	if object.text(premisNamespace, "objectIdentifier", "objectIdentifierValue") != "document-1" ||
+		object.text(premisNamespace, "originalName") != "budget.csv" ||
+		object.text(premisNamespace, "objectCharacteristics", "size") != "21" ||
+		object.text(premisNamespace, "objectCharacteristics", "format", "formatDesignation", "formatName") != "text/csv" {
+		t.Errorf("object %s", data)
+	}
+	fixities := object.all(premisNamespace, "objectCharacteristics", "fixity")
+	if len(fixities) != 2 {
+		t.Fatalf("%d fixity elements, want 2", len(fixities))
+	}
+	for i, want := range []Checksum{{SHA256, "aa11"}, {SHA512, "bb22"}} {
+		if fixities[i].text(premisNamespace, "messageDigestAlgorithm") != want.Algorithm || fixities[i].text(premisNamespace, "messageDigest") != want.Digest ||
+			fixities[i].text(premisNamespace, "messageDigestOriginator") != "archiv-system" {
+			t.Errorf("fixity %d of document-1", i)
+		}
+	}
+
+	// The second version derives from the first one
+	object = objectOf(amdSecs[1])
+	if object.text(premisNamespace, "relationship", "relationshipType") != "derivation" ||
+		object.text(premisNamespace, "relationship", "relatedObjectIdentifier", "relatedObjectIdentifierValue") != "document-1" {
+		t.Errorf("relationship of document-4 %s", data)
+	}
+	if links := object.all(premisNamespace, "linkingEventIdentifier"); len(links) != 2 || links[1].text(premisNamespace, "linkingEventIdentifierValue") != "document-4-event-2" {
+		t.Errorf("events linked to document-4 %+v", links)
+	}
+
+	// Its events, then the agents of its events
+	digiprov := amdSecs[1].all(metsNamespace, "digiprovMD")
+	if len(digiprov) != 5 {
+		t.Fatalf("%d provenance sections of document-4, want 2 events and 3 agents", len(digiprov))
+	}
+	scan := digiprov[1].all(metsNamespace, "mdWrap", "xmlData")[0].all(premisNamespace, "event")[0]
+	if digiprov[1].all(metsNamespace, "mdWrap")[0].attr("MDTYPE") != "PREMIS:EVENT" ||
+		scan.text(premisNamespace, "eventType") != EventVirusCheck ||
+		scan.text(premisNamespace, "eventDateTime") != "2024-05-02T08:30:00Z" ||
+		scan.text(premisNamespace, "eventOutcomeInformation", "eventOutcome") != OutcomeSuccess ||
+		scan.text(premisNamespace, "eventOutcomeInformation", "eventOutcomeDetail", "eventOutcomeDetailNote") != "no malware found" ||
+		scan.text(premisNamespace, "linkingAgentIdentifier", "linkingAgentIdentifierValue") != "scanner-3" ||
+		scan.text(premisNamespace, "linkingObjectIdentifier", "linkingObjectIdentifierValue") != "document-4" {
+		t.Errorf("scan event %s", data)
+	}
+	var agents []string
+	for _, section := range digiprov[2:] {
+		agent := section.all(metsNamespace, "mdWrap", "xmlData")[0].all(premisNamespace, "agent")[0]
+		agents = append(agents, agent.text(premisNamespace, "agentIdentifier", "agentIdentifierValue"))
+	}
+	if strings.Join(agents, ",") != "user-2,archiv-system,scanner-3" {
+		t.Errorf("agents of document-4 %v", agents)
+	}
+
+	// A file without events has no provenance section
+	if digiprov := amdSecs[2].all(metsNamespace, "digiprovMD"); len(digiprov) != 0 {
+		t.Errorf("%d provenance sections for document-5", len(digiprov))
+	}
+}
+
+func TestMETSRejectsUnknownAgents(t *testing.T) {
+	pkg := testPackage()
+	pkg.Files[0].Events[0].Agents = append(pkg.Files[0].Events[0].Agents, AgentLink{AgentID: "user-9", Role: RoleAuthorizer})
+	if _, err := pkg.METS(); err == nil || !strings.Contains(err.Error(), "unknown agent user-9") {
+		t.Fatalf("got %v, want an unknown agent error", err)
+	}
+}
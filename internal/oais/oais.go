@@ -0,0 +1,113 @@
+// Package oais describes the information packages of the OAIS reference model (ISO 14721) kept and handed out by
+// the archive: the archival packages (AIP) preserving documents with all their versions, and the dissemination
+// packages (DIP) produced on request. A package is a BagIt bag whose METS document gives its structure and embeds
+// the PREMIS metadata of each file: fixity, format, and the history of the events it went through.
+package oais
+
+import "time"
+
+// Types of information packages
+const (
+	SIP = "SIP" // Submission: the archives and bags received for ingest
+	AIP = "AIP" // Archival: kept in the storage for preservation
+	DIP = "DIP" // Dissemination: produced for a user asking for documents
+)
+
+// METSFile is the name of the METS document in the metadata directory of a package
+const METSFile = "METS.xml"
+
+// Types of PREMIS events, from the preservation vocabulary of the Library of Congress
+const (
+	EventIngestion            = "ingestion"
+	EventMessageDigest        = "message digest calculation"
+	EventFormatIdentification = "format identification"
+	EventVirusCheck           = "virus check"
+	EventQuarantine           = "quarantine"
+	EventFixityCheck          = "fixity check"
+	EventMigration            = "migration"    // New version of a document in another format
+	EventModification         = "modification" // New version of a document in the same format
+	EventPackageCreation      = "information package creation"
+	EventDissemination        = "dissemination"
+)
+
+// Outcomes of the events
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Types of agents
+const (
+	AgentPerson       = "person"
+	AgentSoftware     = "software"
+	AgentOrganization = "organization"
+)
+
+// Roles of the agents of an event
+const (
+	RoleImplementer      = "implementer"       // The person who performed the event
+	RoleAuthorizer       = "authorizer"        // The person who asked for it
+	RoleExecutingProgram = "executing program" // The software that performed it
+)
+
+// Checksum algorithms, as named by PREMIS and METS
+const (
+	SHA256 = "SHA-256"
+	SHA512 = "SHA-512"
+)
+
+// Package describes an information package
+type Package struct {
+	ID      string // Identifier of the package, e.g. "aip-12"
+	Type    string // AIP or DIP
+	Label   string
+	Creator string // Name of the organization holding the documents
+	Created time.Time
+	Agents  []Agent
+	Files   []File // In the order of the structural map
+}
+
+// Agent is a person or a software involved in the events of the files
+type Agent struct {
+	ID   string // Unique in the package
+	Name string
+	Type string // AgentPerson, AgentSoftware or AgentOrganization
+}
+
+// File is a file of the package, a version of a document
+type File struct {
+	ID        string // Unique and permanent, e.g. "document-12", also the PREMIS identifier of the file
+	Item      string // Shared by the versions of a document, grouped in the structural map: the ID of the first one
+	Dir       string // Slash-separated folder of the document, "" for the root
+	Path      string // Location in the package, e.g. "data/reports/summary.pdf"
+	Name      string // Original name
+	MimeType  string
+	Size      int64
+	Checksums []Checksum
+	Created   time.Time
+	Source    string   // ID of the file this one is a new version of, "" for a first version
+	Subjects  []string // Tags of the document
+	Events    []Event  // In chronological order
+}
+
+// Checksum is a digest of a file, in hexadecimal
+type Checksum struct {
+	Algorithm string // SHA256 or SHA512
+	Digest    string
+}
+
+// Event is an event of the history of a file
+type Event struct {
+	Type          string
+	Date          time.Time
+	Detail        string
+	Outcome       string // OutcomeSuccess, OutcomeFailure, or "" when unknown
+	OutcomeDetail string
+	Agents        []AgentLink
+}
+
+// AgentLink ties an agent to an event
+type AgentLink struct {
+	AgentID string
+	Role    string
+}
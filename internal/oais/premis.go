@@ -0,0 +1,175 @@
+package oais
+
+import (
+	"fmt"
+	"time"
+)
+
+// premisVersion is the version of PREMIS the metadata is written in
+const premisVersion = "3.0"
+
+// identifierType is the type of the identifiers of the objects, events and agents, all local to the archive
+const identifierType = "local"
+
+// premisObject describes a file: its fixity, size, format, the version it replaces and its events
+type premisObject struct {
+	XsiType         string                `xml:"xsi:type,attr"`
+	Version         string                `xml:"version,attr"`
+	Identifier      objectIdentifier      `xml:"premis:objectIdentifier"`
+	Characteristics objectCharacteristics `xml:"premis:objectCharacteristics"`
+	OriginalName    string                `xml:"premis:originalName,omitempty"`
+	Relationships   []relationship        `xml:"premis:relationship"`
+	Events          []linkingEvent        `xml:"premis:linkingEventIdentifier"`
+}
+
+type objectIdentifier struct {
+	Type  string `xml:"premis:objectIdentifierType"`
+	Value string `xml:"premis:objectIdentifierValue"`
+}
+
+type objectCharacteristics struct {
+	CompositionLevel int      `xml:"premis:compositionLevel"`
+	Fixity           []fixity `xml:"premis:fixity"`
+	Size             int64    `xml:"premis:size"`
+	Format           format   `xml:"premis:format"`
+}
+
+type fixity struct {
+	Algorithm  string `xml:"premis:messageDigestAlgorithm"`
+	Digest     string `xml:"premis:messageDigest"`
+	Originator string `xml:"premis:messageDigestOriginator,omitempty"`
+}
+
+type format struct {
+	Name string `xml:"premis:formatDesignation>premis:formatName"`
+}
+
+type relationship struct {
+	Type    string                  `xml:"premis:relationshipType"`
+	SubType string                  `xml:"premis:relationshipSubType"`
+	Related relatedObjectIdentifier `xml:"premis:relatedObjectIdentifier"`
+}
+
+type relatedObjectIdentifier struct {
+	Type  string `xml:"premis:relatedObjectIdentifierType"`
+	Value string `xml:"premis:relatedObjectIdentifierValue"`
+}
+
+type linkingEvent struct {
+	Type  string `xml:"premis:linkingEventIdentifierType"`
+	Value string `xml:"premis:linkingEventIdentifierValue"`
+}
+
+// premisEvent describes an event of the history of a file
+type premisEvent struct {
+	Version    string          `xml:"version,attr"`
+	Identifier eventIdentifier `xml:"premis:eventIdentifier"`
+	Type       string          `xml:"premis:eventType"`
+	DateTime   string          `xml:"premis:eventDateTime"`
+	Detail     string          `xml:"premis:eventDetailInformation>premis:eventDetail,omitempty"`
+	Outcome    *eventOutcome   `xml:"premis:eventOutcomeInformation"`
+	Agents     []linkingAgent  `xml:"premis:linkingAgentIdentifier"`
+	Objects    []linkingObject `xml:"premis:linkingObjectIdentifier"`
+}
+
+type eventIdentifier struct {
+	Type  string `xml:"premis:eventIdentifierType"`
+	Value string `xml:"premis:eventIdentifierValue"`
+}
+
+type eventOutcome struct {
+	Outcome string `xml:"premis:eventOutcome,omitempty"`
+	Note    string `xml:"premis:eventOutcomeDetail>premis:eventOutcomeDetailNote,omitempty"`
+}
+
+type linkingAgent struct {
+	Type  string `xml:"premis:linkingAgentIdentifierType"`
+	Value string `xml:"premis:linkingAgentIdentifierValue"`
+	Role  string `xml:"premis:linkingAgentRole,omitempty"`
+}
+
+type linkingObject struct {
+	Type  string `xml:"premis:linkingObjectIdentifierType"`
+	Value string `xml:"premis:linkingObjectIdentifierValue"`
+}
+
+// premisAgent describes a person or a software involved in events
+type premisAgent struct {
+	Version    string          `xml:"version,attr"`
+	Identifier agentIdentifier `xml:"premis:agentIdentifier"`
+	Name       string          `xml:"premis:agentName"`
+	Type       string          `xml:"premis:agentType"`
+}
+
+type agentIdentifier struct {
+	Type  string `xml:"premis:agentIdentifierType"`
+	Value string `xml:"premis:agentIdentifierValue"`
+}
+
+// eventID returns the identifier of the i-th event of a file
+func eventID(file *File, i int) string {
+	return fmt.Sprintf("%s-event-%d", file.ID, i+1)
+}
+
+// premisObjectOf describes a file, the archive being the originator of its checksums
+func premisObjectOf(file *File) *premisObject {
+	object := &premisObject{
+		XsiType:    "premis:file",
+		Version:    premisVersion,
+		Identifier: objectIdentifier{Type: identifierType, Value: file.ID},
+		Characteristics: objectCharacteristics{
+			Size:   file.Size,
+			Format: format{Name: file.MimeType},
+		},
+		OriginalName: file.Name,
+	}
+	for _, checksum := range file.Checksums {
+		object.Characteristics.Fixity = append(object.Characteristics.Fixity,
+			fixity{Algorithm: checksum.Algorithm, Digest: checksum.Digest, Originator: "archiv-system"})
+	}
+	if file.Source != "" {
+		object.Relationships = append(object.Relationships, relationship{
+			Type:    "derivation",
+			SubType: "has source",
+			Related: relatedObjectIdentifier{Type: identifierType, Value: file.Source},
+		})
+	}
+	for i := range file.Events {
+		object.Events = append(object.Events, linkingEvent{Type: identifierType, Value: eventID(file, i)})
+	}
+	return object
+}
+
+// premisEventOf describes the i-th event of a file
+func premisEventOf(file *File, i int) *premisEvent {
+	event := &file.Events[i]
+	described := &premisEvent{
+		Version:    premisVersion,
+		Identifier: eventIdentifier{Type: identifierType, Value: eventID(file, i)},
+		Type:       event.Type,
+		DateTime:   formatTime(event.Date),
+		Detail:     event.Detail,
+		Objects:    []linkingObject{{Type: identifierType, Value: file.ID}},
+	}
+	if event.Outcome != "" || event.OutcomeDetail != "" {
+		described.Outcome = &eventOutcome{Outcome: event.Outcome, Note: event.OutcomeDetail}
+	}
+	for _, link := range event.Agents {
+		described.Agents = append(described.Agents, linkingAgent{Type: identifierType, Value: link.AgentID, Role: link.Role})
+	}
+	return described
+}
+
+func premisAgentOf(agent *Agent) *premisAgent {
+	return &premisAgent{
+		Version:    premisVersion,
+		Identifier: agentIdentifier{Type: identifierType, Value: agent.ID},
+		Name:       agent.Name,
+		Type:       agent.Type,
+	}
+}
+
+// formatTime writes a date as an xs:dateTime, in UTC
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,52 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+
+	// Decoders of the supported image formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels bounds the size of the decoded images, so that a small file cannot claim gigabytes of memory
+const maxPixels = 100_000_000
+
+// ImageRenderer decodes JPEG, PNG, GIF (first frame), WebP and TIFF images
+type ImageRenderer struct{}
+
+func (ImageRenderer) Supports(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/tiff":
+		return true
+	}
+	return false
+}
+
+func (ImageRenderer) Render(_ context.Context, r io.Reader, _ string) (image.Image, error) {
+	// Read at once: TIFF files may hold their dimensions at the end, and the decoder needs random access anyway
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("image too large for a preview: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,56 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// PDFRenderer renders the first page of PDFs with poppler's pdftoppm, or a program taking the same arguments.
+// The document is given on the standard input and the PNG is read from the standard output, so that the
+// content never lands decrypted in a temporary file.
+type PDFRenderer struct {
+	Command string // path of the program
+}
+
+func (pr *PDFRenderer) Supports(contentType string) bool {
+	return contentType == "application/pdf"
+}
+
+func (pr *PDFRenderer) Render(ctx context.Context, r io.Reader, _ string) (image.Image, error) {
+	cmd := exec.CommandContext(ctx, pr.Command,
+		"-f", "1", "-l", "1", "-singlefile", "-png", "-scale-to", strconv.Itoa(maxSide), "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("PDF renderer failed: %w: %s", err, firstLine(stderr.String()))
+		}
+		return nil, fmt.Errorf("failed to run PDF renderer: %w", err)
+	}
+
+	img, err := png.Decode(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rendered page: %w", err)
+	}
+	return img, nil
+}
+
+// firstLine keeps the first line of the error output of the renderer, enough to explain the failure
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,152 @@
+// Package preview renders the thumbnails of the stored documents: scaled-down copies of images, and of the first
+// page of PDFs rendered by an external program. Other formats are added by registering a Renderer.
+package preview
+
+import (
+	"archiv-system/internal/config"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// ErrUnsupported is returned for content types no renderer handles
+var ErrUnsupported = errors.New("no preview renderer for this content type")
+
+// ContentType is the format of the thumbnails
+const ContentType = "image/jpeg"
+
+// DefaultSize is the thumbnail size served when none is asked
+const DefaultSize = "medium"
+
+// Sizes are the thumbnail sizes by name, as the length of the longest side in pixels
+var Sizes = map[string]int{
+	"small":  128,
+	"medium": 256,
+	"large":  512,
+}
+
+// maxSide is the longest side of the largest thumbnail, renderers need not produce bigger images
+const maxSide = 512
+
+// Renderer turns the content of a document into an image to scale down
+type Renderer interface {
+	// Supports reports whether the renderer handles a content type, given without parameters
+	Supports(contentType string) bool
+	// Render decodes or renders the content read from r
+	Render(ctx context.Context, r io.Reader, contentType string) (image.Image, error)
+}
+
+// Generator renders thumbnails with its renderers, tried in order: the first one supporting a content type
+// renders it
+type Generator struct {
+	renderers []Renderer
+}
+
+// NewGenerator sets up the renderers of the configuration: images always, PDFs when a renderer command is
+// configured
+func NewGenerator(cfg config.PreviewConfig) *Generator {
+	g := &Generator{renderers: []Renderer{ImageRenderer{}}}
+	if cfg.PDFRenderer != "" {
+		g.renderers = append(g.renderers, &PDFRenderer{Command: cfg.PDFRenderer})
+	}
+	return g
+}
+
+// Register adds a renderer, tried after the configured ones
+func (g *Generator) Register(renderer Renderer) {
+	g.renderers = append(g.renderers, renderer)
+}
+
+// Supported reports whether thumbnails can be generated for a content type
+func (g *Generator) Supported(contentType string) bool {
+	return g.rendererFor(contentType) != nil
+}
+
+func (g *Generator) rendererFor(contentType string) Renderer {
+	mediaType := normalize(contentType)
+	for _, renderer := range g.renderers {
+		if renderer.Supports(mediaType) {
+			return renderer
+		}
+	}
+	return nil
+}
+
+// normalize drops the parameters of a content type, e.g. "image/png; charset=binary" gives "image/png"
+func normalize(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// Thumbnail is an encoded thumbnail of one of the Sizes
+type Thumbnail struct {
+	Size   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Generate renders the content read from r and returns its thumbnails in every size, largest first.
+// Images smaller than a size are not enlarged.
+func (g *Generator) Generate(ctx context.Context, r io.Reader, contentType string) ([]Thumbnail, error) {
+	renderer := g.rendererFor(contentType)
+	if renderer == nil {
+		return nil, ErrUnsupported
+	}
+	src, err := renderer.Render(ctx, r, normalize(contentType))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(Sizes))
+	for name := range Sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return Sizes[names[i]] > Sizes[names[j]] })
+
+	thumbnails := make([]Thumbnail, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Each size is scaled from the previous one, cheaper than scaling the original again
+		src = scale(src, Sizes[name])
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		bounds := src.Bounds()
+		thumbnails = append(thumbnails, Thumbnail{Size: name, Width: bounds.Dx(), Height: bounds.Dy(), Data: buf.Bytes()})
+	}
+	return thumbnails, nil
+}
+
+// scale fits src in a square of side pixels, on a white background since JPEG has no transparency
+func scale(src image.Image, side int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > side || height > side {
+		if width >= height {
+			width, height = side, max(1, height*side/width)
+		} else {
+			width, height = max(1, width*side/height), side
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
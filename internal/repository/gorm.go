@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// NewGorm returns the repositories backed by the database. Queries on tenant tables are restricted
+// to the organization of the context by the tenant callbacks of the database package.
+func NewGorm(db *gorm.DB) *Repositories {
+	return &Repositories{
+		Documents:     &gormDocuments{db: db},
+		Tags:          &gormTags{db: db},
+		Users:         &gormUsers{db: db},
+		Roles:         &gormRoles{db: db},
+		Organizations: &gormOrganizations{db: db},
+		Groups:        &gormGroups{db: db},
+		Folders:       &gormFolders{db: db},
+		Grants:        &gormGrants{db: db},
+		Policies:      &gormPolicies{db: db},
+		ResetTokens:   &gormResetTokens{db: db},
+		Audit:         &gormAudit{db: db},
+		FixityEvents:  &gormFixityEvents{db: db},
+		Derivatives:   &gormDerivatives{db: db},
+		Imports:       &gormImports{db: db},
+		Exports:       &gormExports{db: db},
+		Packages:      &gormPackages{db: db},
+		Files:         &gormFiles{db: db},
+	}
+}
+
+// notFound maps gorm's missing record error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type gormTags struct {
+	db *gorm.DB
+}
+
+func (r *gormTags) FindOrCreate(ctx context.Context, names []string) ([]models.Tag, error) {
+	db := r.db.WithContext(ctx)
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		tag := models.Tag{}
+		if err := db.Where("name = ?", name).First(&tag).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			tag = models.Tag{Name: name}
+			if err := db.Create(&tag).Error; err != nil {
+				return nil, fmt.Errorf("failed to create tag '%s': %w", name, err)
+			}
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
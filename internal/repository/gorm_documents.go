@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormDocuments struct {
+	db *gorm.DB
+}
+
+func (r *gormDocuments) Create(ctx context.Context, document *models.Document) error {
+	return r.db.WithContext(ctx).Create(document).Error
+}
+
+func (r *gormDocuments) Get(ctx context.Context, id uint) (*models.Document, error) {
+	var document models.Document
+	if err := r.db.WithContext(ctx).Preload("Tags").First(&document, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &document, nil
+}
+
+func (r *gormDocuments) Update(ctx context.Context, document *models.Document) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(document).Error; err != nil {
+			return err
+		}
+		var tags []models.Tag
+		if document.Tags != nil {
+			tags = *document.Tags
+		}
+		return tx.Model(document).Association("Tags").Replace(tags)
+	})
+}
+
+func (r *gormDocuments) Delete(ctx context.Context, document *models.Document) error {
+	return r.db.WithContext(ctx).Select("Tags").Delete(document).Error
+}
+
+func (r *gormDocuments) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Document{}).Count(&count).Error
+	return count, err
+}
+
+func (r *gormDocuments) OwnerUsage(ctx context.Context, ownerID uint) (int64, int64, error) {
+	var usage struct {
+		Count int64
+		Size  int64
+	}
+	err := r.db.WithContext(ctx).Model(&models.Document{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").
+		Where("owner_id = ?", ownerID).
+		Scan(&usage).Error
+	return usage.Count, usage.Size, err
+}
+
+func (r *gormDocuments) CountOwnersSince(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Document{}).
+		Where("created_at >= ?", since).
+		Distinct("owner_id").
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormDocuments) TopOwners(ctx context.Context, limit int) ([]OwnerCount, error) {
+	var owners []OwnerCount
+	err := r.db.WithContext(ctx).Table("users").
+		Select("users.id AS user_id, users.username, COUNT(documents.id) AS doc_count").
+		Joins("LEFT JOIN documents ON users.id = documents.owner_id").
+		Group("users.id, users.username").
+		Order("doc_count DESC, users.id").
+		Limit(limit).
+		Scan(&owners).Error
+	return owners, err
+}
+
+// matching returns the query selecting the documents of q
+func (r *gormDocuments) matching(ctx context.Context, q DocumentQuery) *gorm.DB {
+	db := r.db.WithContext(ctx)
+	query := db.Model(&models.Document{})
+	if q.IDs != nil {
+		query = query.Where("id IN ?", q.IDs)
+	}
+	if q.AfterID != 0 {
+		query = query.Where("id > ?", q.AfterID)
+	}
+	if q.OwnerID != 0 {
+		query = query.Where("owner_id = ?", q.OwnerID)
+	}
+	if len(q.Tags) > 0 {
+		tagged := db.Table("document_tags").Select("document_tags.document_id").
+			Joins("JOIN tags ON tags.id = document_tags.tag_id").Where("tags.name IN ?", q.Tags)
+		query = query.Where("id IN (?)", tagged)
+	}
+	if q.FolderIDs != nil {
+		query = query.Where("folder_id IN ?", q.FolderIDs)
+	}
+	if q.NameContains != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(q.NameContains))
+		query = query.Where(`LOWER(name) LIKE ? ESCAPE '\'`, "%"+escaped+"%")
+	}
+	if q.FixityStatus != "" {
+		query = query.Where("fixity_status = ?", q.FixityStatus)
+	}
+	if q.ScanStatuses != nil {
+		// Documents uploaded before scanning existed have no status at all
+		if slices.Contains(q.ScanStatuses, "") {
+			query = query.Where("(scan_status IN ? OR scan_status IS NULL)", q.ScanStatuses)
+		} else {
+			query = query.Where("scan_status IN ?", q.ScanStatuses)
+		}
+	}
+	if q.CheckedBefore != nil {
+		query = query.Where("(fixity_checked_at IS NULL OR fixity_checked_at < ?)", *q.CheckedBefore)
+	}
+	return query
+}
+
+func (r *gormDocuments) Find(ctx context.Context, q DocumentQuery, offset, limit int) ([]models.Document, error) {
+	query := r.matching(ctx, q).Preload("Tags").Order("id").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var documents []models.Document
+	err := query.Find(&documents).Error
+	return documents, err
+}
+
+func (r *gormDocuments) CountMatching(ctx context.Context, q DocumentQuery) (int64, error) {
+	var count int64
+	err := r.matching(ctx, q).Count(&count).Error
+	return count, err
+}
+
+func (r *gormDocuments) SetFolder(ctx context.Context, document *models.Document, folderID *uint) error {
+	if err := r.db.WithContext(ctx).Model(document).Update("folder_id", folderID).Error; err != nil {
+		return err
+	}
+	document.FolderID = folderID
+	return nil
+}
+
+func (r *gormDocuments) UpdateColumns(ctx context.Context, id uint, changes map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&models.Document{}).Where("id = ?", id).UpdateColumns(changes).Error
+}
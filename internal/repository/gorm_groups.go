@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type gormGroups struct {
+	db *gorm.DB
+}
+
+func (r *gormGroups) Create(ctx context.Context, group *models.Group) error {
+	return r.db.WithContext(ctx).Create(group).Error
+}
+
+func (r *gormGroups) Get(ctx context.Context, id uint) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.WithContext(ctx).Preload("Users").Preload("Roles").First(&group, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) List(ctx context.Context) ([]models.Group, error) {
+	var groups []models.Group
+	err := r.db.WithContext(ctx).Preload("Users").Preload("Roles").Order("name").Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroups) NameTaken(ctx context.Context, name string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Group{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormGroups) Delete(ctx context.Context, group *models.Group) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Users").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(group).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.Grant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
+
+func (r *gormGroups) AddMember(ctx context.Context, group *models.Group, user *models.User) error {
+	return r.db.WithContext(ctx).Model(group).Association("Users").Append(user)
+}
+
+func (r *gormGroups) RemoveMember(ctx context.Context, group *models.Group, userID uint) error {
+	return r.db.WithContext(ctx).Model(group).Association("Users").Delete(&models.User{ID: userID})
+}
+
+func (r *gormGroups) AddRole(ctx context.Context, group *models.Group, role *models.Role) error {
+	return r.db.WithContext(ctx).Model(group).Association("Roles").Append(role)
+}
+
+func (r *gormGroups) RemoveRole(ctx context.Context, group *models.Group, roleID uint) error {
+	return r.db.WithContext(ctx).Model(group).Association("Roles").Delete(&models.Role{ID: roleID})
+}
+
+func (r *gormGroups) NamesOf(ctx context.Context, userID uint) ([]string, error) {
+	names := []string{}
+	err := r.db.WithContext(ctx).Table("groups").
+		Joins("JOIN user_groups ON user_groups.group_id = groups.id").
+		Where("user_groups.user_id = ?", userID).
+		Order("groups.name").
+		Pluck("groups.name", &names).Error
+	return names, err
+}
+
+type gormFolders struct {
+	db *gorm.DB
+}
+
+func (r *gormFolders) Create(ctx context.Context, folder *models.Folder) error {
+	return r.db.WithContext(ctx).Create(folder).Error
+}
+
+func (r *gormFolders) Get(ctx context.Context, id uint) (*models.Folder, error) {
+	var folder models.Folder
+	if err := r.db.WithContext(ctx).First(&folder, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &folder, nil
+}
+
+func (r *gormFolders) List(ctx context.Context) ([]models.Folder, error) {
+	var folders []models.Folder
+	err := r.db.WithContext(ctx).Order("id").Find(&folders).Error
+	return folders, err
+}
+
+func (r *gormFolders) ListAccessible(ctx context.Context, userID uint, groupIDs []uint) ([]models.Folder, error) {
+	db := r.db.WithContext(ctx)
+	shared := db.Model(&models.Grant{}).Select("folder_id").Where("folder_id IS NOT NULL")
+	if len(groupIDs) > 0 {
+		shared = shared.Where("user_id = ? OR group_id IN ?", userID, groupIDs)
+	} else {
+		shared = shared.Where("user_id = ?", userID)
+	}
+
+	var folders []models.Folder
+	err := db.Where("owner_id = ? OR id IN (?)", userID, shared).Order("name").Find(&folders).Error
+	return folders, err
+}
+
+func (r *gormFolders) Find(ctx context.Context, ownerID uint, parentID *uint, name string) (*models.Folder, error) {
+	query := r.db.WithContext(ctx).Where("name = ? AND owner_id = ?", name, ownerID)
+	if parentID != nil {
+		query = query.Where("parent_id = ?", *parentID)
+	} else {
+		query = query.Where("parent_id IS NULL")
+	}
+	var folders []models.Folder
+	if err := query.Order("id").Limit(1).Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, ErrNotFound
+	}
+	return &folders[0], nil
+}
+
+func (r *gormFolders) SetAllowedUploadTypes(ctx context.Context, folder *models.Folder, types string) error {
+	if err := r.db.WithContext(ctx).Model(folder).Update("allowed_upload_types", types).Error; err != nil {
+		return err
+	}
+	folder.AllowedUploadTypes = types
+	return nil
+}
+
+type gormGrants struct {
+	db *gorm.DB
+}
+
+func (r *gormGrants) Create(ctx context.Context, grant *models.Grant) error {
+	return r.db.WithContext(ctx).Create(grant).Error
+}
+
+func (r *gormGrants) List(ctx context.Context, documentID, folderID *uint) ([]models.Grant, error) {
+	query := r.db.WithContext(ctx).Order("id")
+	if documentID != nil {
+		query = query.Where("document_id = ?", *documentID)
+	}
+	if folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	}
+	var grants []models.Grant
+	err := query.Find(&grants).Error
+	return grants, err
+}
+
+func (r *gormGrants) Find(ctx context.Context, q GrantQuery) (*models.Grant, error) {
+	query := r.db.WithContext(ctx).Where("permission = ?", q.Permission)
+	if q.DocumentID != nil {
+		query = query.Where("document_id = ?", *q.DocumentID)
+	} else {
+		query = query.Where("folder_id IN ?", q.FolderIDs)
+	}
+	if len(q.GroupIDs) > 0 {
+		query = query.Where("user_id = ? OR group_id IN ?", q.UserID, q.GroupIDs)
+	} else {
+		query = query.Where("user_id = ?", q.UserID)
+	}
+
+	var grants []models.Grant
+	if err := query.Order("id").Limit(1).Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return nil, nil
+	}
+	return &grants[0], nil
+}
+
+func (r *gormGrants) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.Grant{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormPolicies struct {
+	db *gorm.DB
+}
+
+func (r *gormPolicies) Create(ctx context.Context, policy *models.Policy) error {
+	return r.db.WithContext(ctx).Create(policy).Error
+}
+
+func (r *gormPolicies) Get(ctx context.Context, id uint) (*models.Policy, error) {
+	var policy models.Policy
+	if err := r.db.WithContext(ctx).First(&policy, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &policy, nil
+}
+
+func (r *gormPolicies) List(ctx context.Context) ([]models.Policy, error) {
+	var policies []models.Policy
+	err := r.db.WithContext(ctx).Order("name").Find(&policies).Error
+	return policies, err
+}
+
+func (r *gormPolicies) ListEnabled(ctx context.Context, organizationID uint) ([]models.Policy, error) {
+	var policies []models.Policy
+	err := r.db.WithContext(ctx).Where("organization_id = ? AND enabled = ?", organizationID, true).
+		Order("id").Find(&policies).Error
+	return policies, err
+}
+
+func (r *gormPolicies) NameTaken(ctx context.Context, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Policy{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormPolicies) Update(ctx context.Context, policy *models.Policy) error {
+	return r.db.WithContext(ctx).Save(policy).Error
+}
+
+func (r *gormPolicies) Delete(ctx context.Context, policy *models.Policy) error {
+	return r.db.WithContext(ctx).Delete(policy).Error
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormImports struct {
+	db *gorm.DB
+}
+
+func (r *gormImports) Create(ctx context.Context, job *models.ImportJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+func (r *gormImports) Get(ctx context.Context, id uint) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := r.db.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &job, nil
+}
+
+func (r *gormImports) GetMany(ctx context.Context, ids []uint) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *gormImports) UpdateProgress(ctx context.Context, job *models.ImportJob) error {
+	return r.db.WithContext(ctx).Model(&models.ImportJob{}).Where("id = ?", job.ID).UpdateColumns(map[string]interface{}{
+		"status":      job.Status,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"imported":    job.Imported,
+		"failed":      job.Failed,
+		"skipped":     job.Skipped,
+		"error":       job.Error,
+		"started_at":  job.StartedAt,
+		"finished_at": job.FinishedAt,
+	}).Error
+}
+
+func (r *gormImports) ListByStatus(ctx context.Context, statuses ...string) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	err := r.db.WithContext(ctx).Where("status IN ?", statuses).Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *gormImports) CreateEntry(ctx context.Context, entry *models.ImportEntry) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *gormImports) ListEntries(ctx context.Context, jobID uint, status string, offset, limit int) ([]models.ImportEntry, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.ImportEntry{}).Where("job_id = ?", jobID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []models.ImportEntry
+	err := query.Order("id").Offset(offset).Limit(limit).Find(&entries).Error
+	return entries, total, err
+}
+
+func (r *gormImports) ImportedDocuments(ctx context.Context, jobID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&models.ImportEntry{}).
+		Where("job_id = ? AND status = ? AND document_id IS NOT NULL", jobID, models.ImportEntryImported).
+		Order("document_id").Pluck("document_id", &ids).Error
+	return ids, err
+}
+
+func (r *gormImports) ImportedEntries(ctx context.Context, documentIDs []uint) ([]models.ImportEntry, error) {
+	var entries []models.ImportEntry
+	err := r.db.WithContext(ctx).Where("document_id IN ? AND status = ?", documentIDs, models.ImportEntryImported).
+		Order("id").Find(&entries).Error
+	return entries, err
+}
+
+type gormExports struct {
+	db *gorm.DB
+}
+
+func (r *gormExports) Create(ctx context.Context, job *models.ExportJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+func (r *gormExports) Get(ctx context.Context, id uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := r.db.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &job, nil
+}
+
+func (r *gormExports) UpdateProgress(ctx context.Context, job *models.ExportJob) error {
+	return r.db.WithContext(ctx).Model(&models.ExportJob{}).Where("id = ?", job.ID).UpdateColumns(map[string]interface{}{
+		"status":      job.Status,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"failed":      job.Failed,
+		"size":        job.Size,
+		"error":       job.Error,
+		"url":         job.URL,
+		"encrypted":   job.Encrypted,
+		"key_id":      job.KeyID,
+		"started_at":  job.StartedAt,
+		"finished_at": job.FinishedAt,
+		"expires_at":  job.ExpiresAt,
+	}).Error
+}
+
+func (r *gormExports) ListByStatus(ctx context.Context, statuses ...string) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.WithContext(ctx).Where("status IN ?", statuses).Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *gormExports) ListExpired(ctx context.Context, before time.Time) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.WithContext(ctx).Where("status = ? AND expires_at < ?", models.ExportCompleted, before).
+		Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+type gormPackages struct {
+	db *gorm.DB
+}
+
+func (r *gormPackages) Create(ctx context.Context, pkg *models.ArchivalPackage) error {
+	return r.db.WithContext(ctx).Create(pkg).Error
+}
+
+func (r *gormPackages) Get(ctx context.Context, id uint) (*models.ArchivalPackage, error) {
+	var pkg models.ArchivalPackage
+	if err := r.db.WithContext(ctx).First(&pkg, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &pkg, nil
+}
+
+func (r *gormPackages) List(ctx context.Context, offset, limit int) ([]models.ArchivalPackage, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.ArchivalPackage{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var packages []models.ArchivalPackage
+	err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&packages).Error
+	return packages, total, err
+}
+
+func (r *gormPackages) UpdateProgress(ctx context.Context, pkg *models.ArchivalPackage) error {
+	return r.db.WithContext(ctx).Model(&models.ArchivalPackage{}).Where("id = ?", pkg.ID).UpdateColumns(map[string]interface{}{
+		"status":      pkg.Status,
+		"files":       pkg.Files,
+		"skipped":     pkg.Skipped,
+		"size":        pkg.Size,
+		"sha256":      pkg.SHA256,
+		"error":       pkg.Error,
+		"url":         pkg.URL,
+		"encrypted":   pkg.Encrypted,
+		"key_id":      pkg.KeyID,
+		"started_at":  pkg.StartedAt,
+		"finished_at": pkg.FinishedAt,
+	}).Error
+}
+
+func (r *gormPackages) ListByStatus(ctx context.Context, statuses ...string) ([]models.ArchivalPackage, error) {
+	var packages []models.ArchivalPackage
+	err := r.db.WithContext(ctx).Where("status IN ?", statuses).Order("id").Find(&packages).Error
+	return packages, err
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type gormOrganizations struct {
+	db *gorm.DB
+}
+
+func (r *gormOrganizations) Get(ctx context.Context, id uint) (*models.Organization, error) {
+	var organization models.Organization
+	if err := r.db.WithContext(ctx).First(&organization, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &organization, nil
+}
+
+func (r *gormOrganizations) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	var organization models.Organization
+	if err := r.db.WithContext(ctx).Where("slug = ?", slug).First(&organization).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &organization, nil
+}
+
+func (r *gormOrganizations) List(ctx context.Context) ([]models.Organization, error) {
+	var organizations []models.Organization
+	err := r.db.WithContext(ctx).Order("name").Find(&organizations).Error
+	return organizations, err
+}
+
+func (r *gormOrganizations) Taken(ctx context.Context, name, slug string, exceptID uint) (bool, error) {
+	query := r.db.WithContext(ctx).Model(&models.Organization{}).Where("id <> ?", exceptID)
+	if slug != "" {
+		query = query.Where("name = ? OR slug = ?", name, slug)
+	} else {
+		query = query.Where("name = ?", name)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormOrganizations) Create(ctx context.Context, organization *models.Organization, admin *models.User, adminRole string) error {
+	if err := r.db.WithContext(ctx).Create(organization).Error; err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	if err := database.SeedRolesAndPermissions(r.db, organization.ID); err != nil {
+		return err
+	}
+
+	tenantDB := r.db.WithContext(database.WithOrganization(ctx, organization.ID))
+	var role models.Role
+	if err := tenantDB.Where("name = ?", adminRole).First(&role).Error; err != nil {
+		return notFound(err)
+	}
+	admin.RoleID = role.ID
+	if err := tenantDB.Create(admin).Error; err != nil {
+		return fmt.Errorf("failed to create organization admin: %w", err)
+	}
+	return nil
+}
+
+func (r *gormOrganizations) Update(ctx context.Context, organization *models.Organization, changes map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(organization).Updates(changes).Error
+}
+
+func (r *gormOrganizations) Delete(ctx context.Context, organization *models.Organization) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+		if err := tx.Where("organization_id = ?", organization.ID).Find(&roles).Error; err != nil {
+			return err
+		}
+		for i := range roles {
+			if err := tx.Model(&roles[i]).Association("Permissions").Clear(); err != nil {
+				return err
+			}
+		}
+		var groups []models.Group
+		if err := tx.Where("organization_id = ?", organization.ID).Find(&groups).Error; err != nil {
+			return err
+		}
+		for i := range groups {
+			if err := tx.Model(&groups[i]).Association("Roles").Clear(); err != nil {
+				return err
+			}
+		}
+		for _, model := range []interface{}{&models.Policy{}, &models.Grant{}, &models.Folder{}, &models.Group{}, &models.Tag{}, &models.SeededGrant{}, &models.Role{}} {
+			if err := tx.Where("organization_id = ?", organization.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(organization).Error
+	})
+}
+
+func (r *gormOrganizations) Usage(ctx context.Context, id uint) (int64, int64, error) {
+	db := r.db.WithContext(ctx)
+	var users, documents int64
+	if err := db.Model(&models.User{}).Where("organization_id = ?", id).Count(&users).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := db.Model(&models.Document{}).Where("organization_id = ?", id).Count(&documents).Error; err != nil {
+		return 0, 0, err
+	}
+	return users, documents, nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormResetTokens struct {
+	db *gorm.DB
+}
+
+func (r *gormResetTokens) Replace(ctx context.Context, token *models.PasswordResetToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", token.UserID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (r *gormResetTokens) GetByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+func (r *gormResetTokens) Consume(ctx context.Context, id uint, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormAudit struct {
+	db *gorm.DB
+}
+
+func (r *gormAudit) Create(ctx context.Context, event *models.AuditEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *gormAudit) List(ctx context.Context, action string, offset, limit int) ([]models.AuditEvent, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.AuditEvent{})
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, err
+}
+
+func (r *gormAudit) ListForTargets(ctx context.Context, targetType string, ids []uint) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := r.db.WithContext(ctx).Where("target_type = ? AND target_id IN ?", targetType, ids).Order("id").Find(&events).Error
+	return events, err
+}
+
+type gormFixityEvents struct {
+	db *gorm.DB
+}
+
+func (r *gormFixityEvents) Create(ctx context.Context, event *models.FixityEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *gormFixityEvents) ListByDocument(ctx context.Context, documentID uint, limit int) ([]models.FixityEvent, error) {
+	var events []models.FixityEvent
+	err := r.db.WithContext(ctx).Where("document_id = ?", documentID).Order("id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (r *gormFixityEvents) List(ctx context.Context, offset, limit int) ([]models.FixityEvent, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.FixityEvent{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []models.FixityEvent
+	err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, err
+}
+
+func (r *gormFixityEvents) ListForDocuments(ctx context.Context, documentIDs []uint) ([]models.FixityEvent, error) {
+	var events []models.FixityEvent
+	err := r.db.WithContext(ctx).Where("document_id IN ?", documentIDs).Order("id").Find(&events).Error
+	return events, err
+}
+
+type gormDerivatives struct {
+	db *gorm.DB
+}
+
+func (r *gormDerivatives) Save(ctx context.Context, derivative *models.Derivative) error {
+	key := models.Derivative{DocumentID: derivative.DocumentID, Kind: derivative.Kind, Size: derivative.Size}
+	// A map, so that a thumbnail replaced by a plaintext one is recorded as such
+	return r.db.WithContext(ctx).Where(&key).Assign(map[string]interface{}{
+		"content_type": derivative.ContentType,
+		"url":          derivative.URL,
+		"encrypted":    derivative.Encrypted,
+		"key_id":       derivative.KeyID,
+		"width":        derivative.Width,
+		"height":       derivative.Height,
+		"bytes":        derivative.Bytes,
+	}).FirstOrCreate(derivative).Error
+}
+
+func (r *gormDerivatives) Get(ctx context.Context, documentID uint, kind, size string) (*models.Derivative, error) {
+	var derivative models.Derivative
+	if err := r.db.WithContext(ctx).Where("document_id = ? AND kind = ? AND size = ?", documentID, kind, size).
+		First(&derivative).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &derivative, nil
+}
+
+func (r *gormDerivatives) ListByDocument(ctx context.Context, documentID uint) ([]models.Derivative, error) {
+	var derivatives []models.Derivative
+	err := r.db.WithContext(ctx).Where("document_id = ?", documentID).Order("id").Find(&derivatives).Error
+	return derivatives, err
+}
+
+func (r *gormDerivatives) DeleteByDocument(ctx context.Context, documentID uint) error {
+	return r.db.WithContext(ctx).Where("document_id = ?", documentID).Delete(&models.Derivative{}).Error
+}
+
+type gormFiles struct {
+	db *gorm.DB
+}
+
+func (r *gormFiles) List(ctx context.Context, table string, afterID uint, limit int) ([]StoredFile, error) {
+	if !slices.Contains(StoredFileTables, table) {
+		return nil, fmt.Errorf("no stored files in table %s", table)
+	}
+	var files []StoredFile
+	err := r.db.WithContext(ctx).Table(table).Select("id, url, encrypted, key_id").
+		Where("id > ? AND url <> ''", afterID).Order("id").Limit(limit).Scan(&files).Error
+	for i := range files {
+		files[i].Table = table
+	}
+	return files, err
+}
+
+func (r *gormFiles) SetEncryption(ctx context.Context, file StoredFile) error {
+	if !slices.Contains(StoredFileTables, file.Table) {
+		return fmt.Errorf("no stored files in table %s", file.Table)
+	}
+	return r.db.WithContext(ctx).Table(file.Table).Where("id = ?", file.ID).UpdateColumns(map[string]interface{}{
+		"encrypted": file.Encrypted,
+		"key_id":    file.KeyID,
+	}).Error
+}
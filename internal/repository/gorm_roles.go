@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type gormRoles struct {
+	db *gorm.DB
+}
+
+func (r *gormRoles) Create(ctx context.Context, role *models.Role) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *gormRoles) Get(ctx context.Context, id uint) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").First(&role, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &role, nil
+}
+
+func (r *gormRoles) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &role, nil
+}
+
+func (r *gormRoles) List(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoles) NameTaken(ctx context.Context, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Role{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormRoles) Rename(ctx context.Context, role *models.Role, name string) error {
+	return r.db.WithContext(ctx).Model(role).Update("name", name).Error
+}
+
+func (r *gormRoles) SetAllowedUploadTypes(ctx context.Context, role *models.Role, types string) error {
+	return r.db.WithContext(ctx).Model(role).Update("allowed_upload_types", types).Error
+}
+
+func (r *gormRoles) Delete(ctx context.Context, role *models.Role) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
+func (r *gormRoles) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.WithContext(ctx).Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *gormRoles) FindPermissions(ctx context.Context, names []string) ([]*models.Permission, error) {
+	var permissions []*models.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := r.db.WithContext(ctx).Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *gormRoles) AddPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	return r.db.WithContext(ctx).Model(role).Association("Permissions").Append(permissions)
+}
+
+func (r *gormRoles) RemovePermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	return r.db.WithContext(ctx).Model(role).Association("Permissions").Delete(permissions)
+}
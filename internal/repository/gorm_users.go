@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Role").First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Role").Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormUsers) ListByAuthSource(ctx context.Context, source string) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).Preload("Role").Where("auth_source = ?", source).Order("id").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUsers) List(ctx context.Context, query string, offset, limit int) ([]models.User, int64, error) {
+	db := r.db.WithContext(ctx).Model(&models.User{})
+	if query != "" {
+		// Case-insensitive on every dialect, ILIKE being specific to Postgres
+		db = db.Where("LOWER(username) LIKE ?", "%"+strings.ToLower(query)+"%")
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	if err := db.Preload("Role").
+		Order("username").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *gormUsers) Update(ctx context.Context, user *models.User, changes map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(user).Updates(changes).Error
+}
+
+func (r *gormUsers) Delete(ctx context.Context, user *models.User, transferTo *uint) ([]string, error) {
+	var removedFiles []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if transferTo != nil {
+			if err := tx.Model(&models.Document{}).Where("owner_id = ?", user.ID).
+				Update("owner_id", *transferTo).Error; err != nil {
+				return fmt.Errorf("failed to transfer documents: %w", err)
+			}
+		} else {
+			var documents []models.Document
+			if err := tx.Where("owner_id = ?", user.ID).Find(&documents).Error; err != nil {
+				return err
+			}
+			for _, document := range documents {
+				var derivatives []string
+				if err := tx.Model(&models.Derivative{}).Where("document_id = ?", document.ID).
+					Pluck("url", &derivatives).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("document_id = ?", document.ID).Delete(&models.Derivative{}).Error; err != nil {
+					return fmt.Errorf("failed to delete previews of document %d: %w", document.ID, err)
+				}
+				if err := tx.Select("Tags").Delete(&document).Error; err != nil {
+					return fmt.Errorf("failed to delete document %d: %w", document.ID, err)
+				}
+				removedFiles = append(removedFiles, document.URL)
+				removedFiles = append(removedFiles, derivatives...)
+			}
+		}
+		if err := tx.Model(user).Association("Groups").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Grant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removedFiles, nil
+}
+
+func (r *gormUsers) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUsers) CountWithRoleName(ctx context.Context, roleName string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).
+		Joins("JOIN roles ON roles.id = users.role_id").
+		Where("roles.name = ?", roleName).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormUsers) CountWithRole(ctx context.Context, roleID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).Where("role_id = ?", roleID).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUsers) CountEnabledWithRole(ctx context.Context, roleID, exceptID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("role_id = ? AND disabled = ? AND id <> ?", roleID, false, exceptID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormUsers) IncrementFailedLogins(ctx context.Context, userID uint) (int, error) {
+	db := r.db.WithContext(ctx)
+	if err := db.Model(&models.User{}).Where("id = ?", userID).
+		Update("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+		return 0, err
+	}
+
+	var failures int
+	err := db.Model(&models.User{}).Where("id = ?", userID).Select("failed_logins").Scan(&failures).Error
+	return failures, err
+}
+
+func (r *gormUsers) PasswordHistory(ctx context.Context, userID uint, limit int) ([]string, error) {
+	var hashes []string
+	err := r.db.WithContext(ctx).Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").Limit(limit).Pluck("hash", &hashes).Error
+	return hashes, err
+}
+
+func (r *gormUsers) SetPassword(ctx context.Context, user *models.User, hashed string, mustChange bool, keep int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if user.Password != "" {
+			if err := tx.Create(&models.PasswordHistory{UserID: user.ID, Hash: user.Password}).Error; err != nil {
+				return err
+			}
+		}
+
+		var stale []uint
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).
+			Order("created_at DESC, id DESC").Offset(keep).
+			Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			if err := tx.Delete(&models.PasswordHistory{}, stale).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":             hashed,
+			"must_change_password": mustChange,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		user.Password = hashed
+		user.MustChangePassword = mustChange
+		return nil
+	})
+}
+
+func (r *gormUsers) Memberships(ctx context.Context, userID uint) ([]uint, []uint, error) {
+	db := r.db.WithContext(ctx)
+	var roleIDs, groupRoleIDs, groupIDs []uint
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Pluck("role_id", &roleIDs).Error; err != nil {
+		return nil, nil, err
+	}
+	// Joining groups scopes the join tables to the organization
+	if err := db.Model(&models.Group{}).
+		Joins("JOIN user_groups ON user_groups.group_id = groups.id").
+		Where("user_groups.user_id = ?", userID).
+		Pluck("groups.id", &groupIDs).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(groupIDs) > 0 {
+		if err := db.Table("group_roles").Where("group_id IN ?", groupIDs).
+			Distinct().Pluck("role_id", &groupRoleIDs).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	seen := make(map[uint]bool, len(roleIDs))
+	for _, id := range roleIDs {
+		seen[id] = true
+	}
+	for _, id := range groupRoleIDs {
+		if !seen[id] {
+			seen[id] = true
+			roleIDs = append(roleIDs, id)
+		}
+	}
+	sort.Slice(roleIDs, func(i, j int) bool { return roleIDs[i] < roleIDs[j] })
+	sort.Slice(groupIDs, func(i, j int) bool { return groupIDs[i] < groupIDs[j] })
+	return roleIDs, groupIDs, nil
+}
+
+func (r *gormUsers) Usernames(ctx context.Context, ids []uint) (map[uint]string, error) {
+	usernames := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return usernames, nil
+	}
+	var users []models.User
+	if err := r.db.WithContext(ctx).Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	return usernames, nil
+}
@@ -0,0 +1,946 @@
+package repository
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate is returned by the in-memory repositories where the database would violate a unique constraint
+var ErrDuplicate = errors.New("duplicate record")
+
+// memoryStore holds the records of the in-memory repositories, which share it like tables share a database
+type memoryStore struct {
+	mu            sync.RWMutex
+	nextID        uint
+	organizations map[uint]models.Organization
+	documents     map[uint]models.Document
+	tags          map[uint]models.Tag
+	users         map[uint]models.User
+	roles         map[uint]models.Role
+	permissions   map[uint]models.Permission
+	history       map[uint][]string      // previous password hashes per user, most recent first
+	members       map[uint]map[uint]bool // users of each group
+	groupRoles    map[uint]map[uint]bool // roles of each group
+
+	groups        *memoryTable[models.Group]
+	folders       *memoryTable[models.Folder]
+	grants        *memoryTable[models.Grant]
+	policies      *memoryTable[models.Policy]
+	resetTokens   *memoryTable[models.PasswordResetToken]
+	audit         *memoryTable[models.AuditEvent]
+	fixityEvents  *memoryTable[models.FixityEvent]
+	derivatives   *memoryTable[models.Derivative]
+	imports       *memoryTable[models.ImportJob]
+	importEntries *memoryTable[models.ImportEntry]
+	exports       *memoryTable[models.ExportJob]
+	packages      *memoryTable[models.ArchivalPackage]
+}
+
+// NewMemory returns repositories keeping their records in memory, seeded like a new database:
+// the default organization with its built-in roles, and every permission.
+func NewMemory() *Repositories {
+	s := &memoryStore{
+		organizations: map[uint]models.Organization{},
+		documents:     map[uint]models.Document{},
+		tags:          map[uint]models.Tag{},
+		users:         map[uint]models.User{},
+		roles:         map[uint]models.Role{},
+		permissions:   map[uint]models.Permission{},
+		history:       map[uint][]string{},
+		members:       map[uint]map[uint]bool{},
+		groupRoles:    map[uint]map[uint]bool{},
+	}
+	s.groups = newMemoryTable(s, func(g *models.Group) (*uint, *uint, *time.Time) { return &g.ID, &g.OrganizationID, &g.CreatedAt })
+	s.folders = newMemoryTable(s, func(f *models.Folder) (*uint, *uint, *time.Time) { return &f.ID, &f.OrganizationID, &f.CreatedAt })
+	s.grants = newMemoryTable(s, func(g *models.Grant) (*uint, *uint, *time.Time) { return &g.ID, &g.OrganizationID, &g.CreatedAt })
+	s.policies = newMemoryTable(s, func(p *models.Policy) (*uint, *uint, *time.Time) { return &p.ID, &p.OrganizationID, &p.CreatedAt })
+	s.resetTokens = newMemoryTable(s, func(t *models.PasswordResetToken) (*uint, *uint, *time.Time) { return &t.ID, nil, &t.CreatedAt })
+	s.audit = newMemoryTable(s, func(e *models.AuditEvent) (*uint, *uint, *time.Time) { return &e.ID, &e.OrganizationID, &e.CreatedAt })
+	s.fixityEvents = newMemoryTable(s, func(e *models.FixityEvent) (*uint, *uint, *time.Time) { return &e.ID, &e.OrganizationID, &e.CreatedAt })
+	s.derivatives = newMemoryTable(s, func(d *models.Derivative) (*uint, *uint, *time.Time) { return &d.ID, &d.OrganizationID, &d.CreatedAt })
+	s.imports = newMemoryTable(s, func(j *models.ImportJob) (*uint, *uint, *time.Time) { return &j.ID, &j.OrganizationID, &j.CreatedAt })
+	s.importEntries = newMemoryTable(s, func(e *models.ImportEntry) (*uint, *uint, *time.Time) { return &e.ID, &e.OrganizationID, &e.CreatedAt })
+	s.exports = newMemoryTable(s, func(j *models.ExportJob) (*uint, *uint, *time.Time) { return &j.ID, &j.OrganizationID, &j.CreatedAt })
+	s.packages = newMemoryTable(s, func(p *models.ArchivalPackage) (*uint, *uint, *time.Time) {
+		return &p.ID, &p.OrganizationID, &p.CreatedAt
+	})
+
+	for _, name := range database.Permissions {
+		permission := models.Permission{ID: s.id(), Name: name}
+		s.permissions[permission.ID] = permission
+	}
+	organization := models.Organization{ID: s.id(), Name: "Default", Slug: database.DefaultOrganizationSlug,
+		AllowRegistration: true, CreatedAt: time.Now()}
+	s.organizations[organization.ID] = organization
+	s.seedRoles(organization.ID)
+
+	return &Repositories{
+		Documents:     &memoryDocuments{s},
+		Tags:          &memoryTags{s},
+		Users:         &memoryUsers{s},
+		Roles:         &memoryRoles{s},
+		Organizations: &memoryOrganizations{s},
+		Groups:        &memoryGroups{s},
+		Folders:       &memoryFolders{s},
+		Grants:        &memoryGrants{s},
+		Policies:      &memoryPolicies{s},
+		ResetTokens:   &memoryResetTokens{s},
+		Audit:         &memoryAudit{s},
+		FixityEvents:  &memoryFixityEvents{s},
+		Derivatives:   &memoryDerivatives{s},
+		Imports:       &memoryImports{s},
+		Exports:       &memoryExports{s},
+		Packages:      &memoryPackages{s},
+		Files:         &memoryFiles{s},
+	}
+}
+
+// seedRoles creates the built-in roles of an organization; the store is locked by the caller
+func (s *memoryStore) seedRoles(organizationID uint) {
+	permissionsByName := map[string]*models.Permission{}
+	for _, permission := range s.permissions {
+		permission := permission
+		permissionsByName[permission.Name] = &permission
+	}
+	for roleName, permissionNames := range database.DefaultRolePermissions {
+		role := models.Role{ID: s.id(), OrganizationID: organizationID, Name: roleName}
+		for _, name := range permissionNames {
+			role.Permissions = append(role.Permissions, permissionsByName[name])
+		}
+		s.roles[role.ID] = role
+	}
+}
+
+// id returns the next identifier; the store is locked by the caller
+func (s *memoryStore) id() uint {
+	s.nextID++
+	return s.nextID
+}
+
+// tenant applies the tenant rules of the database package to the in-memory records
+type tenant struct {
+	organizationID uint
+	restricted     bool
+}
+
+func tenantOf(ctx context.Context) (tenant, error) {
+	organizationID, restricted, err := database.TenantScope(ctx)
+	return tenant{organizationID: organizationID, restricted: restricted}, err
+}
+
+// sees reports whether a record of the organization is visible
+func (t tenant) sees(organizationID uint) bool {
+	return !t.restricted || organizationID == t.organizationID
+}
+
+// stamp sets the organization of a new record, which must not belong to another one
+func (t tenant) stamp(organizationID *uint) error {
+	if !t.restricted {
+		return nil
+	}
+	if *organizationID == 0 {
+		*organizationID = t.organizationID
+	} else if *organizationID != t.organizationID {
+		return database.ErrCrossTenant
+	}
+	return nil
+}
+
+type memoryTags struct {
+	s *memoryStore
+}
+
+func (r *memoryTags) FindOrCreate(ctx context.Context, names []string) ([]models.Tag, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		tag, found := models.Tag{}, false
+		for _, existing := range r.s.tags {
+			if existing.Name == name && t.sees(existing.OrganizationID) {
+				tag, found = existing, true
+				break
+			}
+		}
+		if !found {
+			tag = models.Tag{Name: name}
+			if err := t.stamp(&tag.OrganizationID); err != nil {
+				return nil, err
+			}
+			tag.ID = r.s.id()
+			r.s.tags[tag.ID] = tag
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+type memoryDocuments struct {
+	s *memoryStore
+}
+
+// copyDocument returns a document that does not share its tags with the store
+func copyDocument(document models.Document) models.Document {
+	if document.Tags != nil {
+		tags := append([]models.Tag(nil), *document.Tags...)
+		document.Tags = &tags
+	}
+	return document
+}
+
+// list returns the visible documents matching keep, ordered by ID
+func (r *memoryDocuments) list(ctx context.Context, keep func(models.Document) bool) ([]models.Document, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	documents := []models.Document{}
+	for _, document := range r.s.documents {
+		if t.sees(document.OrganizationID) && keep(document) {
+			documents = append(documents, copyDocument(document))
+		}
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].ID < documents[j].ID })
+	return documents, nil
+}
+
+func (r *memoryDocuments) Create(ctx context.Context, document *models.Document) error {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	if err := t.stamp(&document.OrganizationID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	document.ID = r.s.id()
+	if document.Version == 0 {
+		document.Version = 1
+	}
+	document.CreatedAt = time.Now()
+	document.UpdatedAt = document.CreatedAt
+	r.s.documents[document.ID] = copyDocument(*document)
+	return nil
+}
+
+func (r *memoryDocuments) Get(ctx context.Context, id uint) (*models.Document, error) {
+	documents, err := r.list(ctx, func(document models.Document) bool { return document.ID == id })
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, ErrNotFound
+	}
+	return &documents[0], nil
+}
+
+func (r *memoryDocuments) Update(ctx context.Context, document *models.Document) error {
+	if _, err := r.Get(ctx, document.ID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	document.UpdatedAt = time.Now()
+	r.s.documents[document.ID] = copyDocument(*document)
+	return nil
+}
+
+func (r *memoryDocuments) Delete(ctx context.Context, document *models.Document) error {
+	if _, err := r.Get(ctx, document.ID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delete(r.s.documents, document.ID)
+	return nil
+}
+
+func (r *memoryDocuments) Count(ctx context.Context) (int64, error) {
+	documents, err := r.list(ctx, func(models.Document) bool { return true })
+	return int64(len(documents)), err
+}
+
+func (r *memoryDocuments) OwnerUsage(ctx context.Context, ownerID uint) (int64, int64, error) {
+	documents, err := r.Find(ctx, DocumentQuery{OwnerID: ownerID}, 0, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, document := range documents {
+		size += document.Size
+	}
+	return int64(len(documents)), size, nil
+}
+
+func (r *memoryDocuments) CountOwnersSince(ctx context.Context, since time.Time) (int64, error) {
+	documents, err := r.list(ctx, func(document models.Document) bool { return !document.CreatedAt.Before(since) })
+	if err != nil {
+		return 0, err
+	}
+	owners := map[uint]bool{}
+	for _, document := range documents {
+		owners[document.OwnerID] = true
+	}
+	return int64(len(owners)), nil
+}
+
+func (r *memoryDocuments) TopOwners(ctx context.Context, limit int) ([]OwnerCount, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	owners := []OwnerCount{}
+	for _, user := range r.s.users {
+		if !t.sees(user.OrganizationID) {
+			continue
+		}
+		owner := OwnerCount{UserID: user.ID, Username: user.Username}
+		for _, document := range r.s.documents {
+			if document.OwnerID == user.ID {
+				owner.DocCount++
+			}
+		}
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].DocCount != owners[j].DocCount {
+			return owners[i].DocCount > owners[j].DocCount
+		}
+		return owners[i].UserID < owners[j].UserID
+	})
+	if len(owners) > limit {
+		owners = owners[:limit]
+	}
+	return owners, nil
+}
+
+// matches reports whether a document is selected by a query
+func (q DocumentQuery) matches(document models.Document) bool {
+	if q.IDs != nil && !slices.Contains(q.IDs, document.ID) {
+		return false
+	}
+	if document.ID <= q.AfterID {
+		return false
+	}
+	if q.OwnerID != 0 && document.OwnerID != q.OwnerID {
+		return false
+	}
+	if len(q.Tags) > 0 {
+		tagged := false
+		if document.Tags != nil {
+			for _, tag := range *document.Tags {
+				tagged = tagged || slices.Contains(q.Tags, tag.Name)
+			}
+		}
+		if !tagged {
+			return false
+		}
+	}
+	if q.FolderIDs != nil && (document.FolderID == nil || !slices.Contains(q.FolderIDs, *document.FolderID)) {
+		return false
+	}
+	if q.NameContains != "" && !strings.Contains(strings.ToLower(document.Name), strings.ToLower(q.NameContains)) {
+		return false
+	}
+	if q.FixityStatus != "" && document.FixityStatus != q.FixityStatus {
+		return false
+	}
+	if q.ScanStatuses != nil && !slices.Contains(q.ScanStatuses, document.ScanStatus) {
+		return false
+	}
+	return q.CheckedBefore == nil || document.FixityCheckedAt == nil || document.FixityCheckedAt.Before(*q.CheckedBefore)
+}
+
+func (r *memoryDocuments) Find(ctx context.Context, q DocumentQuery, offset, limit int) ([]models.Document, error) {
+	documents, err := r.list(ctx, q.matches)
+	if err != nil {
+		return nil, err
+	}
+	return page(documents, offset, limit), nil
+}
+
+func (r *memoryDocuments) CountMatching(ctx context.Context, q DocumentQuery) (int64, error) {
+	documents, err := r.list(ctx, q.matches)
+	return int64(len(documents)), err
+}
+
+func (r *memoryDocuments) SetFolder(ctx context.Context, document *models.Document, folderID *uint) error {
+	stored, err := r.Get(ctx, document.ID)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	stored.FolderID = folderID
+	stored.UpdatedAt = time.Now()
+	r.s.documents[document.ID] = copyDocument(*stored)
+	document.FolderID, document.UpdatedAt = folderID, stored.UpdatedAt
+	return nil
+}
+
+func (r *memoryDocuments) UpdateColumns(ctx context.Context, id uint, changes map[string]interface{}) error {
+	stored, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	for column, value := range changes {
+		switch column {
+		case "url":
+			stored.URL = value.(string)
+		case "preview_status":
+			stored.PreviewStatus = value.(string)
+		case "scan_status":
+			stored.ScanStatus = value.(string)
+		case "scan_engine":
+			stored.ScanEngine = value.(string)
+		case "scan_signature":
+			stored.ScanSignature = value.(string)
+		case "scanned_at":
+			at := value.(time.Time)
+			stored.ScannedAt = &at
+		case "sha256":
+			stored.SHA256 = value.(string)
+		case "sha512":
+			stored.SHA512 = value.(string)
+		case "fixity_status":
+			stored.FixityStatus = value.(string)
+		case "fixity_checked_at":
+			at := value.(time.Time)
+			stored.FixityCheckedAt = &at
+		default:
+			return fmt.Errorf("unsupported document column %s", column)
+		}
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.documents[id] = copyDocument(*stored)
+	return nil
+}
+
+type memoryUsers struct {
+	s *memoryStore
+}
+
+// withRole returns the user with its role, without permissions like the gorm implementation
+func (r *memoryUsers) withRole(user models.User) models.User {
+	role := r.s.roles[user.RoleID]
+	role.Permissions = nil
+	user.Role = role
+	return user
+}
+
+// list returns the visible users matching keep, ordered by username
+func (r *memoryUsers) list(ctx context.Context, keep func(models.User) bool) ([]models.User, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range r.s.users {
+		if t.sees(user.OrganizationID) && keep(user) {
+			users = append(users, r.withRole(user))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	if err := t.stamp(&user.OrganizationID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	user.ID = r.s.id()
+	if user.AuthSource == "" {
+		user.AuthSource = models.AuthSourceLocal
+	}
+	user.CreatedAt = time.Now()
+	stored := *user
+	stored.Role = models.Role{}
+	r.s.users[user.ID] = stored
+	return nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	users, err := r.list(ctx, func(user models.User) bool { return user.ID == id })
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *memoryUsers) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	users, err := r.list(ctx, func(user models.User) bool { return user.Username == username })
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *memoryUsers) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	users, err := r.list(ctx, func(user models.User) bool { return user.Username == username })
+	return len(users) > 0, err
+}
+
+func (r *memoryUsers) ListByAuthSource(ctx context.Context, source string) ([]models.User, error) {
+	users, err := r.list(ctx, func(user models.User) bool { return user.AuthSource == source })
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, err
+}
+
+func (r *memoryUsers) List(ctx context.Context, query string, offset, limit int) ([]models.User, int64, error) {
+	query = strings.ToLower(query)
+	users, err := r.list(ctx, func(user models.User) bool {
+		return strings.Contains(strings.ToLower(user.Username), query)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	total := int64(len(users))
+	if offset > len(users) {
+		offset = len(users)
+	}
+	users = users[offset:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, total, nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, user *models.User, changes map[string]interface{}) error {
+	current, err := r.Get(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for column, value := range changes {
+		switch column {
+		case "disabled":
+			current.Disabled = value.(bool)
+		case "must_change_password":
+			current.MustChangePassword = value.(bool)
+		case "password":
+			current.Password = value.(string)
+		case "email":
+			current.Email = value.(string)
+		case "role_id":
+			current.RoleID = value.(uint)
+		case "failed_logins":
+			current.FailedLogins = value.(int)
+		case "locked_until":
+			current.LockedUntil, _ = value.(*time.Time)
+		case "last_login_at":
+			switch at := value.(type) {
+			case time.Time:
+				current.LastLoginAt = &at
+			case *time.Time:
+				current.LastLoginAt = at
+			}
+		default:
+			return errors.New("unsupported user column " + column)
+		}
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	stored := *current
+	stored.Role = models.Role{}
+	r.s.users[user.ID] = stored
+	*user = r.withRole(stored)
+	return nil
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, user *models.User, transferTo *uint) ([]string, error) {
+	if _, err := r.Get(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var removedFiles []string
+	for id, document := range r.s.documents {
+		if document.OwnerID != user.ID {
+			continue
+		}
+		if transferTo != nil {
+			document.OwnerID = *transferTo
+			r.s.documents[id] = document
+		} else {
+			delete(r.s.documents, id)
+			removedFiles = append(removedFiles, document.URL)
+			r.s.derivatives.purge(func(derivative *models.Derivative) bool {
+				if derivative.DocumentID != id {
+					return false
+				}
+				removedFiles = append(removedFiles, derivative.URL)
+				return true
+			})
+		}
+	}
+	for _, members := range r.s.members {
+		delete(members, user.ID)
+	}
+	r.s.grants.purge(func(grant *models.Grant) bool { return grant.UserID != nil && *grant.UserID == user.ID })
+	r.s.resetTokens.purge(func(token *models.PasswordResetToken) bool { return token.UserID == user.ID })
+	delete(r.s.users, user.ID)
+	delete(r.s.history, user.ID)
+	return removedFiles, nil
+}
+
+func (r *memoryUsers) Count(ctx context.Context) (int64, error) {
+	users, err := r.list(ctx, func(models.User) bool { return true })
+	return int64(len(users)), err
+}
+
+func (r *memoryUsers) CountWithRoleName(ctx context.Context, roleName string) (int64, error) {
+	users, err := r.list(ctx, func(models.User) bool { return true })
+	var count int64
+	for _, user := range users {
+		if user.Role.Name == roleName {
+			count++
+		}
+	}
+	return count, err
+}
+
+func (r *memoryUsers) CountWithRole(ctx context.Context, roleID uint) (int64, error) {
+	users, err := r.list(ctx, func(user models.User) bool { return user.RoleID == roleID })
+	return int64(len(users)), err
+}
+
+func (r *memoryUsers) CountEnabledWithRole(ctx context.Context, roleID, exceptID uint) (int64, error) {
+	users, err := r.list(ctx, func(user models.User) bool {
+		return user.RoleID == roleID && !user.Disabled && user.ID != exceptID
+	})
+	return int64(len(users)), err
+}
+
+func (r *memoryUsers) IncrementFailedLogins(ctx context.Context, userID uint) (int, error) {
+	if _, err := r.Get(ctx, userID); err != nil {
+		return 0, err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	user := r.s.users[userID]
+	user.FailedLogins++
+	r.s.users[userID] = user
+	return user.FailedLogins, nil
+}
+
+func (r *memoryUsers) PasswordHistory(ctx context.Context, userID uint, limit int) ([]string, error) {
+	if _, err := r.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	hashes := r.s.history[userID]
+	if len(hashes) > limit {
+		hashes = hashes[:limit]
+	}
+	return append([]string(nil), hashes...), nil
+}
+
+func (r *memoryUsers) SetPassword(ctx context.Context, user *models.User, hashed string, mustChange bool, keep int) error {
+	stored, err := r.Get(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	history := r.s.history[user.ID]
+	if stored.Password != "" {
+		history = append([]string{stored.Password}, history...)
+	}
+	if len(history) > keep {
+		history = history[:keep]
+	}
+	r.s.history[user.ID] = history
+
+	stored.Password = hashed
+	stored.MustChangePassword = mustChange
+	stored.Role = models.Role{}
+	r.s.users[user.ID] = *stored
+	user.Password = hashed
+	user.MustChangePassword = mustChange
+	return nil
+}
+
+func (r *memoryUsers) Memberships(ctx context.Context, userID uint) ([]uint, []uint, error) {
+	user, err := r.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	roles := map[uint]bool{user.RoleID: true}
+	groupIDs := []uint{}
+	for groupID, members := range r.s.members {
+		group, ok := r.s.groups.rows[groupID]
+		if !ok || !members[userID] || !t.sees(group.OrganizationID) {
+			continue
+		}
+		groupIDs = append(groupIDs, groupID)
+		for roleID := range r.s.groupRoles[groupID] {
+			roles[roleID] = true
+		}
+	}
+	roleIDs := make([]uint, 0, len(roles))
+	for roleID := range roles {
+		roleIDs = append(roleIDs, roleID)
+	}
+	sort.Slice(roleIDs, func(i, j int) bool { return roleIDs[i] < roleIDs[j] })
+	sort.Slice(groupIDs, func(i, j int) bool { return groupIDs[i] < groupIDs[j] })
+	return roleIDs, groupIDs, nil
+}
+
+func (r *memoryUsers) Usernames(ctx context.Context, ids []uint) (map[uint]string, error) {
+	users, err := r.list(ctx, func(user models.User) bool { return slices.Contains(ids, user.ID) })
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	return usernames, nil
+}
+
+type memoryRoles struct {
+	s *memoryStore
+}
+
+// copyRole returns a role that does not share its permissions with the store
+func copyRole(role models.Role) models.Role {
+	role.Permissions = append([]*models.Permission(nil), role.Permissions...)
+	return role
+}
+
+// list returns the visible roles matching keep, ordered by name
+func (r *memoryRoles) list(ctx context.Context, keep func(models.Role) bool) ([]models.Role, error) {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	roles := []models.Role{}
+	for _, role := range r.s.roles {
+		if t.sees(role.OrganizationID) && keep(role) {
+			roles = append(roles, copyRole(role))
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// save replaces the stored role after checking it is visible
+func (r *memoryRoles) save(ctx context.Context, role models.Role) error {
+	if _, err := r.Get(ctx, role.ID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.roles[role.ID] = copyRole(role)
+	return nil
+}
+
+func (r *memoryRoles) Create(ctx context.Context, role *models.Role) error {
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return err
+	}
+	if err := t.stamp(&role.OrganizationID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.roles {
+		if existing.OrganizationID == role.OrganizationID && existing.Name == role.Name {
+			return ErrDuplicate
+		}
+	}
+	role.ID = r.s.id()
+	r.s.roles[role.ID] = copyRole(*role)
+	return nil
+}
+
+func (r *memoryRoles) Get(ctx context.Context, id uint) (*models.Role, error) {
+	roles, err := r.list(ctx, func(role models.Role) bool { return role.ID == id })
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrNotFound
+	}
+	return &roles[0], nil
+}
+
+func (r *memoryRoles) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	roles, err := r.list(ctx, func(role models.Role) bool { return role.Name == name })
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrNotFound
+	}
+	return &roles[0], nil
+}
+
+func (r *memoryRoles) List(ctx context.Context) ([]models.Role, error) {
+	return r.list(ctx, func(models.Role) bool { return true })
+}
+
+func (r *memoryRoles) NameTaken(ctx context.Context, name string, exceptID uint) (bool, error) {
+	roles, err := r.list(ctx, func(role models.Role) bool { return role.Name == name && role.ID != exceptID })
+	return len(roles) > 0, err
+}
+
+func (r *memoryRoles) Rename(ctx context.Context, role *models.Role, name string) error {
+	stored, err := r.Get(ctx, role.ID)
+	if err != nil {
+		return err
+	}
+	stored.Name = name
+	role.Name = name
+	return r.save(ctx, *stored)
+}
+
+func (r *memoryRoles) SetAllowedUploadTypes(ctx context.Context, role *models.Role, types string) error {
+	stored, err := r.Get(ctx, role.ID)
+	if err != nil {
+		return err
+	}
+	stored.AllowedUploadTypes = types
+	role.AllowedUploadTypes = types
+	return r.save(ctx, *stored)
+}
+
+func (r *memoryRoles) Delete(ctx context.Context, role *models.Role) error {
+	if _, err := r.Get(ctx, role.ID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delete(r.s.roles, role.ID)
+	return nil
+}
+
+func (r *memoryRoles) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	permissions := make([]models.Permission, 0, len(r.s.permissions))
+	for _, permission := range r.s.permissions {
+		permissions = append(permissions, permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+	return permissions, nil
+}
+
+func (r *memoryRoles) FindPermissions(ctx context.Context, names []string) ([]*models.Permission, error) {
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var permissions []*models.Permission
+	for _, permission := range r.s.permissions {
+		if wanted[permission.Name] {
+			permission := permission
+			permissions = append(permissions, &permission)
+		}
+	}
+	return permissions, nil
+}
+
+func (r *memoryRoles) AddPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	stored, err := r.Get(ctx, role.ID)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !hasPermission(stored, permission.ID) {
+			stored.Permissions = append(stored.Permissions, permission)
+		}
+	}
+	return r.save(ctx, *stored)
+}
+
+func (r *memoryRoles) RemovePermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	stored, err := r.Get(ctx, role.ID)
+	if err != nil {
+		return err
+	}
+	removed := map[uint]bool{}
+	for _, permission := range permissions {
+		removed[permission.ID] = true
+	}
+	kept := stored.Permissions[:0]
+	for _, permission := range stored.Permissions {
+		if !removed[permission.ID] {
+			kept = append(kept, permission)
+		}
+	}
+	stored.Permissions = kept
+	return r.save(ctx, *stored)
+}
+
+func hasPermission(role *models.Role, permissionID uint) bool {
+	for _, permission := range role.Permissions {
+		if permission.ID == permissionID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+type memoryGroups struct {
+	s *memoryStore
+}
+
+// withMembers fills the members and roles of groups, without their role nor permissions like the gorm
+// implementation
+func (r *memoryGroups) withMembers(groups []models.Group) []models.Group {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for i := range groups {
+		group := &groups[i]
+		group.Users, group.Roles = []*models.User{}, []*models.Role{}
+		for userID := range r.s.members[group.ID] {
+			if user, ok := r.s.users[userID]; ok {
+				group.Users = append(group.Users, &user)
+			}
+		}
+		for roleID := range r.s.groupRoles[group.ID] {
+			if role, ok := r.s.roles[roleID]; ok {
+				role.Permissions = nil
+				group.Roles = append(group.Roles, &role)
+			}
+		}
+		sort.Slice(group.Users, func(a, b int) bool { return group.Users[a].ID < group.Users[b].ID })
+		sort.Slice(group.Roles, func(a, b int) bool { return group.Roles[a].ID < group.Roles[b].ID })
+	}
+	return groups
+}
+
+func (r *memoryGroups) Create(ctx context.Context, group *models.Group) error {
+	taken, err := r.NameTaken(ctx, group.Name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicate
+	}
+	stored := *group
+	stored.Users, stored.Roles = nil, nil
+	if err := r.s.groups.insert(ctx, &stored); err != nil {
+		return err
+	}
+	group.ID, group.OrganizationID, group.CreatedAt = stored.ID, stored.OrganizationID, stored.CreatedAt
+	return nil
+}
+
+func (r *memoryGroups) Get(ctx context.Context, id uint) (*models.Group, error) {
+	group, err := r.s.groups.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &r.withMembers([]models.Group{*group})[0], nil
+}
+
+func (r *memoryGroups) List(ctx context.Context) ([]models.Group, error) {
+	groups, err := r.s.groups.list(ctx, func(*models.Group) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return r.withMembers(groups), nil
+}
+
+func (r *memoryGroups) NameTaken(ctx context.Context, name string) (bool, error) {
+	groups, err := r.s.groups.list(ctx, func(group *models.Group) bool { return group.Name == name })
+	return len(groups) > 0, err
+}
+
+func (r *memoryGroups) Delete(ctx context.Context, group *models.Group) error {
+	removed, err := r.s.groups.remove(ctx, func(stored *models.Group) bool { return stored.ID == group.ID })
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delete(r.s.members, group.ID)
+	delete(r.s.groupRoles, group.ID)
+	r.s.grants.purge(func(grant *models.Grant) bool { return grant.GroupID != nil && *grant.GroupID == group.ID })
+	return nil
+}
+
+// link adds or removes an entry of a join table of a visible group
+func (r *memoryGroups) link(ctx context.Context, table map[uint]map[uint]bool, groupID, id uint, add bool) error {
+	if _, err := r.s.groups.get(ctx, groupID); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if !add {
+		delete(table[groupID], id)
+		return nil
+	}
+	if table[groupID] == nil {
+		table[groupID] = map[uint]bool{}
+	}
+	table[groupID][id] = true
+	return nil
+}
+
+func (r *memoryGroups) AddMember(ctx context.Context, group *models.Group, user *models.User) error {
+	return r.link(ctx, r.s.members, group.ID, user.ID, true)
+}
+
+func (r *memoryGroups) RemoveMember(ctx context.Context, group *models.Group, userID uint) error {
+	return r.link(ctx, r.s.members, group.ID, userID, false)
+}
+
+func (r *memoryGroups) AddRole(ctx context.Context, group *models.Group, role *models.Role) error {
+	return r.link(ctx, r.s.groupRoles, group.ID, role.ID, true)
+}
+
+func (r *memoryGroups) RemoveRole(ctx context.Context, group *models.Group, roleID uint) error {
+	return r.link(ctx, r.s.groupRoles, group.ID, roleID, false)
+}
+
+func (r *memoryGroups) NamesOf(ctx context.Context, userID uint) ([]string, error) {
+	groups, err := r.s.groups.list(ctx, func(*models.Group) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	names := []string{}
+	for _, group := range groups {
+		if r.s.members[group.ID][userID] {
+			names = append(names, group.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+type memoryFolders struct {
+	s *memoryStore
+}
+
+func (r *memoryFolders) Create(ctx context.Context, folder *models.Folder) error {
+	return r.s.folders.insert(ctx, folder)
+}
+
+func (r *memoryFolders) Get(ctx context.Context, id uint) (*models.Folder, error) {
+	return r.s.folders.get(ctx, id)
+}
+
+func (r *memoryFolders) List(ctx context.Context) ([]models.Folder, error) {
+	return r.s.folders.list(ctx, func(*models.Folder) bool { return true })
+}
+
+func (r *memoryFolders) ListAccessible(ctx context.Context, userID uint, groupIDs []uint) ([]models.Folder, error) {
+	grants, err := r.s.grants.list(ctx, func(grant *models.Grant) bool {
+		return grant.FolderID != nil && (grant.UserID != nil && *grant.UserID == userID ||
+			grant.GroupID != nil && slices.Contains(groupIDs, *grant.GroupID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	shared := map[uint]bool{}
+	for _, grant := range grants {
+		shared[*grant.FolderID] = true
+	}
+	folders, err := r.s.folders.list(ctx, func(folder *models.Folder) bool {
+		return folder.OwnerID == userID || shared[folder.ID]
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(folders, func(i, j int) bool { return folders[i].Name < folders[j].Name })
+	return folders, nil
+}
+
+func (r *memoryFolders) Find(ctx context.Context, ownerID uint, parentID *uint, name string) (*models.Folder, error) {
+	folders, err := r.s.folders.list(ctx, func(folder *models.Folder) bool {
+		sameParent := folder.ParentID == nil && parentID == nil ||
+			folder.ParentID != nil && parentID != nil && *folder.ParentID == *parentID
+		return folder.OwnerID == ownerID && folder.Name == name && sameParent
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, ErrNotFound
+	}
+	return &folders[0], nil
+}
+
+func (r *memoryFolders) SetAllowedUploadTypes(ctx context.Context, folder *models.Folder, types string) error {
+	if err := r.s.folders.update(ctx, folder.ID, func(stored *models.Folder) error {
+		stored.AllowedUploadTypes = types
+		return nil
+	}); err != nil {
+		return err
+	}
+	folder.AllowedUploadTypes = types
+	return nil
+}
+
+type memoryGrants struct {
+	s *memoryStore
+}
+
+func (r *memoryGrants) Create(ctx context.Context, grant *models.Grant) error {
+	return r.s.grants.insert(ctx, grant)
+}
+
+func (r *memoryGrants) List(ctx context.Context, documentID, folderID *uint) ([]models.Grant, error) {
+	return r.s.grants.list(ctx, func(grant *models.Grant) bool {
+		return (documentID == nil || grant.DocumentID != nil && *grant.DocumentID == *documentID) &&
+			(folderID == nil || grant.FolderID != nil && *grant.FolderID == *folderID)
+	})
+}
+
+func (r *memoryGrants) Find(ctx context.Context, q GrantQuery) (*models.Grant, error) {
+	grants, err := r.s.grants.list(ctx, func(grant *models.Grant) bool {
+		if grant.Permission != q.Permission {
+			return false
+		}
+		if q.DocumentID != nil {
+			if grant.DocumentID == nil || *grant.DocumentID != *q.DocumentID {
+				return false
+			}
+		} else if grant.FolderID == nil || !slices.Contains(q.FolderIDs, *grant.FolderID) {
+			return false
+		}
+		return grant.UserID != nil && *grant.UserID == q.UserID ||
+			grant.GroupID != nil && slices.Contains(q.GroupIDs, *grant.GroupID)
+	})
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	return &grants[0], nil
+}
+
+func (r *memoryGrants) Delete(ctx context.Context, id uint) error {
+	removed, err := r.s.grants.remove(ctx, func(grant *models.Grant) bool { return grant.ID == id })
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type memoryPolicies struct {
+	s *memoryStore
+}
+
+func (r *memoryPolicies) Create(ctx context.Context, policy *models.Policy) error {
+	taken, err := r.NameTaken(ctx, policy.Name, 0)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicate
+	}
+	policy.UpdatedAt = time.Now()
+	return r.s.policies.insert(ctx, policy)
+}
+
+func (r *memoryPolicies) Get(ctx context.Context, id uint) (*models.Policy, error) {
+	return r.s.policies.get(ctx, id)
+}
+
+func (r *memoryPolicies) List(ctx context.Context) ([]models.Policy, error) {
+	policies, err := r.s.policies.list(ctx, func(*models.Policy) bool { return true })
+	sort.SliceStable(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, err
+}
+
+func (r *memoryPolicies) ListEnabled(ctx context.Context, organizationID uint) ([]models.Policy, error) {
+	return r.s.policies.list(ctx, func(policy *models.Policy) bool {
+		return policy.OrganizationID == organizationID && policy.Enabled
+	})
+}
+
+func (r *memoryPolicies) NameTaken(ctx context.Context, name string, exceptID uint) (bool, error) {
+	policies, err := r.s.policies.list(ctx, func(policy *models.Policy) bool {
+		return policy.Name == name && policy.ID != exceptID
+	})
+	return len(policies) > 0, err
+}
+
+func (r *memoryPolicies) Update(ctx context.Context, policy *models.Policy) error {
+	policy.UpdatedAt = time.Now()
+	return r.s.policies.update(ctx, policy.ID, func(stored *models.Policy) error {
+		policy.OrganizationID, policy.CreatedAt = stored.OrganizationID, stored.CreatedAt
+		*stored = *policy
+		return nil
+	})
+}
+
+func (r *memoryPolicies) Delete(ctx context.Context, policy *models.Policy) error {
+	removed, err := r.s.policies.remove(ctx, func(stored *models.Policy) bool { return stored.ID == policy.ID })
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"slices"
+	"time"
+)
+
+type memoryImports struct {
+	s *memoryStore
+}
+
+func (r *memoryImports) Create(ctx context.Context, job *models.ImportJob) error {
+	return r.s.imports.insert(ctx, job)
+}
+
+func (r *memoryImports) Get(ctx context.Context, id uint) (*models.ImportJob, error) {
+	return r.s.imports.get(ctx, id)
+}
+
+func (r *memoryImports) GetMany(ctx context.Context, ids []uint) ([]models.ImportJob, error) {
+	return r.s.imports.list(ctx, func(job *models.ImportJob) bool { return slices.Contains(ids, job.ID) })
+}
+
+func (r *memoryImports) UpdateProgress(ctx context.Context, job *models.ImportJob) error {
+	return r.s.imports.update(ctx, job.ID, func(stored *models.ImportJob) error {
+		stored.Status, stored.Error = job.Status, job.Error
+		stored.Total, stored.Processed = job.Total, job.Processed
+		stored.Imported, stored.Failed, stored.Skipped = job.Imported, job.Failed, job.Skipped
+		stored.StartedAt, stored.FinishedAt = job.StartedAt, job.FinishedAt
+		return nil
+	})
+}
+
+func (r *memoryImports) ListByStatus(ctx context.Context, statuses ...string) ([]models.ImportJob, error) {
+	return r.s.imports.list(ctx, func(job *models.ImportJob) bool { return slices.Contains(statuses, job.Status) })
+}
+
+func (r *memoryImports) CreateEntry(ctx context.Context, entry *models.ImportEntry) error {
+	return r.s.importEntries.insert(ctx, entry)
+}
+
+func (r *memoryImports) ListEntries(ctx context.Context, jobID uint, status string, offset, limit int) ([]models.ImportEntry, int64, error) {
+	entries, err := r.s.importEntries.list(ctx, func(entry *models.ImportEntry) bool {
+		return entry.JobID == jobID && (status == "" || entry.Status == status)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page(entries, offset, limit), int64(len(entries)), nil
+}
+
+func (r *memoryImports) ImportedDocuments(ctx context.Context, jobID uint) ([]uint, error) {
+	entries, err := r.s.importEntries.list(ctx, func(entry *models.ImportEntry) bool {
+		return entry.JobID == jobID && entry.Status == models.ImportEntryImported && entry.DocumentID != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, *entry.DocumentID)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (r *memoryImports) ImportedEntries(ctx context.Context, documentIDs []uint) ([]models.ImportEntry, error) {
+	return r.s.importEntries.list(ctx, func(entry *models.ImportEntry) bool {
+		return entry.Status == models.ImportEntryImported && entry.DocumentID != nil &&
+			slices.Contains(documentIDs, *entry.DocumentID)
+	})
+}
+
+type memoryExports struct {
+	s *memoryStore
+}
+
+func (r *memoryExports) Create(ctx context.Context, job *models.ExportJob) error {
+	return r.s.exports.insert(ctx, job)
+}
+
+func (r *memoryExports) Get(ctx context.Context, id uint) (*models.ExportJob, error) {
+	return r.s.exports.get(ctx, id)
+}
+
+func (r *memoryExports) UpdateProgress(ctx context.Context, job *models.ExportJob) error {
+	return r.s.exports.update(ctx, job.ID, func(stored *models.ExportJob) error {
+		stored.Status, stored.Error, stored.URL, stored.Encryption = job.Status, job.Error, job.URL, job.Encryption
+		stored.Total, stored.Processed, stored.Failed, stored.Size = job.Total, job.Processed, job.Failed, job.Size
+		stored.StartedAt, stored.FinishedAt, stored.ExpiresAt = job.StartedAt, job.FinishedAt, job.ExpiresAt
+		return nil
+	})
+}
+
+func (r *memoryExports) ListByStatus(ctx context.Context, statuses ...string) ([]models.ExportJob, error) {
+	return r.s.exports.list(ctx, func(job *models.ExportJob) bool { return slices.Contains(statuses, job.Status) })
+}
+
+func (r *memoryExports) ListExpired(ctx context.Context, before time.Time) ([]models.ExportJob, error) {
+	return r.s.exports.list(ctx, func(job *models.ExportJob) bool {
+		return job.Status == models.ExportCompleted && job.ExpiresAt != nil && job.ExpiresAt.Before(before)
+	})
+}
+
+type memoryPackages struct {
+	s *memoryStore
+}
+
+func (r *memoryPackages) Create(ctx context.Context, pkg *models.ArchivalPackage) error {
+	return r.s.packages.insert(ctx, pkg)
+}
+
+func (r *memoryPackages) Get(ctx context.Context, id uint) (*models.ArchivalPackage, error) {
+	return r.s.packages.get(ctx, id)
+}
+
+func (r *memoryPackages) List(ctx context.Context, offset, limit int) ([]models.ArchivalPackage, int64, error) {
+	packages, err := r.s.packages.list(ctx, func(*models.ArchivalPackage) bool { return true })
+	if err != nil {
+		return nil, 0, err
+	}
+	return page(reversed(packages), offset, limit), int64(len(packages)), nil
+}
+
+func (r *memoryPackages) UpdateProgress(ctx context.Context, pkg *models.ArchivalPackage) error {
+	return r.s.packages.update(ctx, pkg.ID, func(stored *models.ArchivalPackage) error {
+		stored.Status, stored.Error, stored.URL, stored.Encryption = pkg.Status, pkg.Error, pkg.URL, pkg.Encryption
+		stored.Files, stored.Skipped, stored.Size, stored.SHA256 = pkg.Files, pkg.Skipped, pkg.Size, pkg.SHA256
+		stored.StartedAt, stored.FinishedAt = pkg.StartedAt, pkg.FinishedAt
+		return nil
+	})
+}
+
+func (r *memoryPackages) ListByStatus(ctx context.Context, statuses ...string) ([]models.ArchivalPackage, error) {
+	return r.s.packages.list(ctx, func(pkg *models.ArchivalPackage) bool { return slices.Contains(statuses, pkg.Status) })
+}
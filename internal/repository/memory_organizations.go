@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+type memoryOrganizations struct {
+	s *memoryStore
+}
+
+func (r *memoryOrganizations) Get(ctx context.Context, id uint) (*models.Organization, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	organization, ok := r.s.organizations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &organization, nil
+}
+
+func (r *memoryOrganizations) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, organization := range r.s.organizations {
+		if organization.Slug == slug {
+			return &organization, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryOrganizations) List(ctx context.Context) ([]models.Organization, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	organizations := make([]models.Organization, 0, len(r.s.organizations))
+	for _, organization := range r.s.organizations {
+		organizations = append(organizations, organization)
+	}
+	sort.Slice(organizations, func(i, j int) bool { return organizations[i].Name < organizations[j].Name })
+	return organizations, nil
+}
+
+func (r *memoryOrganizations) Taken(ctx context.Context, name, slug string, exceptID uint) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.taken(name, slug, exceptID), nil
+}
+
+// taken is Taken with the store locked by the caller
+func (r *memoryOrganizations) taken(name, slug string, exceptID uint) bool {
+	for _, organization := range r.s.organizations {
+		if organization.ID != exceptID && (organization.Name == name || slug != "" && organization.Slug == slug) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryOrganizations) Create(ctx context.Context, organization *models.Organization, admin *models.User, adminRole string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.taken(organization.Name, organization.Slug, 0) {
+		return ErrDuplicate
+	}
+	for _, user := range r.s.users {
+		if user.Username == admin.Username {
+			return ErrDuplicate
+		}
+	}
+	organization.ID = r.s.id()
+	organization.CreatedAt = time.Now()
+	r.s.organizations[organization.ID] = *organization
+	r.s.seedRoles(organization.ID)
+
+	for _, role := range r.s.roles {
+		if role.OrganizationID == organization.ID && role.Name == adminRole {
+			admin.RoleID = role.ID
+		}
+	}
+	if admin.RoleID == 0 {
+		return ErrNotFound
+	}
+	admin.ID = r.s.id()
+	admin.OrganizationID = organization.ID
+	if admin.AuthSource == "" {
+		admin.AuthSource = models.AuthSourceLocal
+	}
+	admin.CreatedAt = time.Now()
+	stored := *admin
+	stored.Role = models.Role{}
+	r.s.users[admin.ID] = stored
+	return nil
+}
+
+func (r *memoryOrganizations) Update(ctx context.Context, organization *models.Organization, changes map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	stored, ok := r.s.organizations[organization.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	for column, value := range changes {
+		switch column {
+		case "name":
+			stored.Name = value.(string)
+		case "allow_registration":
+			stored.AllowRegistration = value.(bool)
+		default:
+			return errors.New("unsupported organization column " + column)
+		}
+	}
+	r.s.organizations[organization.ID] = stored
+	*organization = stored
+	return nil
+}
+
+func (r *memoryOrganizations) Delete(ctx context.Context, organization *models.Organization) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.organizations[organization.ID]; !ok {
+		return ErrNotFound
+	}
+
+	id := organization.ID
+	for groupID, group := range r.s.groups.rows {
+		if group.OrganizationID == id {
+			delete(r.s.members, groupID)
+			delete(r.s.groupRoles, groupID)
+		}
+	}
+	r.s.groups.purge(func(group *models.Group) bool { return group.OrganizationID == id })
+	r.s.policies.purge(func(policy *models.Policy) bool { return policy.OrganizationID == id })
+	r.s.grants.purge(func(grant *models.Grant) bool { return grant.OrganizationID == id })
+	r.s.folders.purge(func(folder *models.Folder) bool { return folder.OrganizationID == id })
+	for tagID, tag := range r.s.tags {
+		if tag.OrganizationID == id {
+			delete(r.s.tags, tagID)
+		}
+	}
+	for roleID, role := range r.s.roles {
+		if role.OrganizationID == id {
+			delete(r.s.roles, roleID)
+		}
+	}
+	delete(r.s.organizations, id)
+	return nil
+}
+
+func (r *memoryOrganizations) Usage(ctx context.Context, id uint) (int64, int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var users, documents int64
+	for _, user := range r.s.users {
+		if user.OrganizationID == id {
+			users++
+		}
+	}
+	for _, document := range r.s.documents {
+		if document.OrganizationID == id {
+			documents++
+		}
+	}
+	return users, documents, nil
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type memoryResetTokens struct {
+	s *memoryStore
+}
+
+func (r *memoryResetTokens) Replace(ctx context.Context, token *models.PasswordResetToken) error {
+	if _, err := r.s.resetTokens.remove(ctx, func(stored *models.PasswordResetToken) bool {
+		return stored.UserID == token.UserID && stored.UsedAt == nil
+	}); err != nil {
+		return err
+	}
+	return r.s.resetTokens.insert(ctx, token)
+}
+
+func (r *memoryResetTokens) GetByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error) {
+	tokens, err := r.s.resetTokens.list(ctx, func(token *models.PasswordResetToken) bool { return token.TokenHash == hash })
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (r *memoryResetTokens) Consume(ctx context.Context, id uint, at time.Time) (bool, error) {
+	consumed := false
+	err := r.s.resetTokens.update(ctx, id, func(token *models.PasswordResetToken) error {
+		if token.UsedAt == nil {
+			token.UsedAt, consumed = &at, true
+		}
+		return nil
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return consumed, err
+}
+
+type memoryAudit struct {
+	s *memoryStore
+}
+
+func (r *memoryAudit) Create(ctx context.Context, event *models.AuditEvent) error {
+	return r.s.audit.insert(ctx, event)
+}
+
+func (r *memoryAudit) List(ctx context.Context, action string, offset, limit int) ([]models.AuditEvent, int64, error) {
+	events, err := r.s.audit.list(ctx, func(event *models.AuditEvent) bool { return action == "" || event.Action == action })
+	if err != nil {
+		return nil, 0, err
+	}
+	return page(reversed(events), offset, limit), int64(len(events)), nil
+}
+
+func (r *memoryAudit) ListForTargets(ctx context.Context, targetType string, ids []uint) ([]models.AuditEvent, error) {
+	return r.s.audit.list(ctx, func(event *models.AuditEvent) bool {
+		return event.TargetType == targetType && slices.Contains(ids, event.TargetID)
+	})
+}
+
+type memoryFixityEvents struct {
+	s *memoryStore
+}
+
+func (r *memoryFixityEvents) Create(ctx context.Context, event *models.FixityEvent) error {
+	return r.s.fixityEvents.insert(ctx, event)
+}
+
+func (r *memoryFixityEvents) ListByDocument(ctx context.Context, documentID uint, limit int) ([]models.FixityEvent, error) {
+	events, err := r.s.fixityEvents.list(ctx, func(event *models.FixityEvent) bool { return event.DocumentID == documentID })
+	if err != nil {
+		return nil, err
+	}
+	return page(reversed(events), 0, limit), nil
+}
+
+func (r *memoryFixityEvents) List(ctx context.Context, offset, limit int) ([]models.FixityEvent, int64, error) {
+	events, err := r.s.fixityEvents.list(ctx, func(*models.FixityEvent) bool { return true })
+	if err != nil {
+		return nil, 0, err
+	}
+	return page(reversed(events), offset, limit), int64(len(events)), nil
+}
+
+func (r *memoryFixityEvents) ListForDocuments(ctx context.Context, documentIDs []uint) ([]models.FixityEvent, error) {
+	return r.s.fixityEvents.list(ctx, func(event *models.FixityEvent) bool { return slices.Contains(documentIDs, event.DocumentID) })
+}
+
+type memoryDerivatives struct {
+	s *memoryStore
+}
+
+func (r *memoryDerivatives) Save(ctx context.Context, derivative *models.Derivative) error {
+	existing, err := r.Get(ctx, derivative.DocumentID, derivative.Kind, derivative.Size)
+	if err == ErrNotFound {
+		return r.s.derivatives.insert(ctx, derivative)
+	}
+	if err != nil {
+		return err
+	}
+	derivative.ID, derivative.OrganizationID, derivative.CreatedAt = existing.ID, existing.OrganizationID, existing.CreatedAt
+	return r.s.derivatives.update(ctx, existing.ID, func(stored *models.Derivative) error {
+		*stored = *derivative
+		return nil
+	})
+}
+
+func (r *memoryDerivatives) Get(ctx context.Context, documentID uint, kind, size string) (*models.Derivative, error) {
+	derivatives, err := r.s.derivatives.list(ctx, func(derivative *models.Derivative) bool {
+		return derivative.DocumentID == documentID && derivative.Kind == kind && derivative.Size == size
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(derivatives) == 0 {
+		return nil, ErrNotFound
+	}
+	return &derivatives[0], nil
+}
+
+func (r *memoryDerivatives) ListByDocument(ctx context.Context, documentID uint) ([]models.Derivative, error) {
+	return r.s.derivatives.list(ctx, func(derivative *models.Derivative) bool { return derivative.DocumentID == documentID })
+}
+
+func (r *memoryDerivatives) DeleteByDocument(ctx context.Context, documentID uint) error {
+	_, err := r.s.derivatives.remove(ctx, func(derivative *models.Derivative) bool { return derivative.DocumentID == documentID })
+	return err
+}
+
+type memoryFiles struct {
+	s *memoryStore
+}
+
+func (r *memoryFiles) List(ctx context.Context, table string, afterID uint, limit int) ([]StoredFile, error) {
+	keep := func(id uint, url string) bool { return id > afterID && url != "" }
+	var files []StoredFile
+	switch table {
+	case "documents":
+		documents, err := (&memoryDocuments{r.s}).list(ctx, func(d models.Document) bool { return keep(d.ID, d.URL) })
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range documents {
+			files = append(files, StoredFile{Table: table, ID: d.ID, URL: d.URL, Encryption: d.Encryption})
+		}
+	case "derivatives":
+		derivatives, err := r.s.derivatives.list(ctx, func(d *models.Derivative) bool { return keep(d.ID, d.URL) })
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range derivatives {
+			files = append(files, StoredFile{Table: table, ID: d.ID, URL: d.URL, Encryption: d.Encryption})
+		}
+	case "export_jobs":
+		jobs, err := r.s.exports.list(ctx, func(j *models.ExportJob) bool { return keep(j.ID, j.URL) })
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range jobs {
+			files = append(files, StoredFile{Table: table, ID: j.ID, URL: j.URL, Encryption: j.Encryption})
+		}
+	case "archival_packages":
+		packages, err := r.s.packages.list(ctx, func(p *models.ArchivalPackage) bool { return keep(p.ID, p.URL) })
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range packages {
+			files = append(files, StoredFile{Table: table, ID: p.ID, URL: p.URL, Encryption: p.Encryption})
+		}
+	default:
+		return nil, fmt.Errorf("no stored files in table %s", table)
+	}
+	return page(files, 0, limit), nil
+}
+
+func (r *memoryFiles) SetEncryption(ctx context.Context, file StoredFile) error {
+	switch file.Table {
+	case "documents":
+		documents := &memoryDocuments{r.s}
+		stored, err := documents.Get(ctx, file.ID)
+		if err != nil {
+			return err
+		}
+		r.s.mu.Lock()
+		defer r.s.mu.Unlock()
+		stored.Encryption = file.Encryption
+		r.s.documents[file.ID] = copyDocument(*stored)
+		return nil
+	case "derivatives":
+		return r.s.derivatives.update(ctx, file.ID, func(d *models.Derivative) error { d.Encryption = file.Encryption; return nil })
+	case "export_jobs":
+		return r.s.exports.update(ctx, file.ID, func(j *models.ExportJob) error { j.Encryption = file.Encryption; return nil })
+	case "archival_packages":
+		return r.s.packages.update(ctx, file.ID, func(p *models.ArchivalPackage) error { p.Encryption = file.Encryption; return nil })
+	default:
+		return fmt.Errorf("no stored files in table %s", file.Table)
+	}
+}
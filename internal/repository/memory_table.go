@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// memoryTable holds the records of one type of the in-memory store and applies the tenant rules to them.
+// fields returns the ID of a record, its organization, nil for records that belong to none, and its creation time.
+type memoryTable[T any] struct {
+	s      *memoryStore
+	rows   map[uint]T
+	fields func(*T) (id *uint, organizationID *uint, createdAt *time.Time)
+}
+
+func newMemoryTable[T any](s *memoryStore, fields func(*T) (*uint, *uint, *time.Time)) *memoryTable[T] {
+	return &memoryTable[T]{s: s, rows: map[uint]T{}, fields: fields}
+}
+
+// scope returns the test of the records visible in ctx. Records without organization are always visible.
+func (tb *memoryTable[T]) scope(ctx context.Context) (func(*T) bool, error) {
+	if _, organizationID, _ := tb.fields(new(T)); organizationID == nil {
+		return func(*T) bool { return true }, nil
+	}
+	t, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(row *T) bool {
+		_, organizationID, _ := tb.fields(row)
+		return t.sees(*organizationID)
+	}, nil
+}
+
+func (tb *memoryTable[T]) insert(ctx context.Context, row *T) error {
+	id, organizationID, createdAt := tb.fields(row)
+	if organizationID != nil {
+		t, err := tenantOf(ctx)
+		if err != nil {
+			return err
+		}
+		if err := t.stamp(organizationID); err != nil {
+			return err
+		}
+	}
+	tb.s.mu.Lock()
+	defer tb.s.mu.Unlock()
+	*id = tb.s.id()
+	if createdAt != nil && createdAt.IsZero() {
+		*createdAt = time.Now()
+	}
+	tb.rows[*id] = *row
+	return nil
+}
+
+// list returns the visible records matching keep, ordered by ID
+func (tb *memoryTable[T]) list(ctx context.Context, keep func(*T) bool) ([]T, error) {
+	visible, err := tb.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tb.s.mu.RLock()
+	defer tb.s.mu.RUnlock()
+
+	rows := []T{}
+	for _, row := range tb.rows {
+		if visible(&row) && keep(&row) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, _, _ := tb.fields(&rows[i])
+		b, _, _ := tb.fields(&rows[j])
+		return *a < *b
+	})
+	return rows, nil
+}
+
+func (tb *memoryTable[T]) get(ctx context.Context, id uint) (*T, error) {
+	rows, err := tb.list(ctx, func(row *T) bool {
+		rowID, _, _ := tb.fields(row)
+		return *rowID == id
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// update applies change to a visible record
+func (tb *memoryTable[T]) update(ctx context.Context, id uint, change func(*T) error) error {
+	visible, err := tb.scope(ctx)
+	if err != nil {
+		return err
+	}
+	tb.s.mu.Lock()
+	defer tb.s.mu.Unlock()
+
+	row, ok := tb.rows[id]
+	if !ok || !visible(&row) {
+		return ErrNotFound
+	}
+	if err := change(&row); err != nil {
+		return err
+	}
+	tb.rows[id] = row
+	return nil
+}
+
+// remove deletes the visible records matching match and returns how many were deleted
+func (tb *memoryTable[T]) remove(ctx context.Context, match func(*T) bool) (int, error) {
+	visible, err := tb.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tb.s.mu.Lock()
+	defer tb.s.mu.Unlock()
+	return tb.purge(func(row *T) bool { return visible(row) && match(row) }), nil
+}
+
+// purge deletes the records matching match in every organization; the store is locked by the caller
+func (tb *memoryTable[T]) purge(match func(*T) bool) int {
+	removed := 0
+	for id, row := range tb.rows {
+		if match(&row) {
+			delete(tb.rows, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// page returns the records of a page, from offset and at most limit of them
+func page[T any](rows []T, offset, limit int) []T {
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	rows = rows[offset:]
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// reversed returns the records in the opposite order, most recent first for records ordered by ID
+func reversed[T any](rows []T) []T {
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows
+}
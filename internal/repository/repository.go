@@ -0,0 +1,323 @@
+// Package repository isolates data access behind interfaces, with a gorm implementation for production
+// and an in-memory implementation for tests. Every method takes the request context: the gorm
+// implementation restricts queries to the organization it carries, and the in-memory one does the same.
+package repository
+
+import (
+	"archiv-system/internal/models"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record does not exist in the organization
+var ErrNotFound = errors.New("record not found")
+
+// DocumentRepository stores documents. Documents are returned with their tags.
+type DocumentRepository interface {
+	Create(ctx context.Context, document *models.Document) error
+	Get(ctx context.Context, id uint) (*models.Document, error)
+	// Update saves the fields of the document and replaces its tags
+	Update(ctx context.Context, document *models.Document) error
+	Delete(ctx context.Context, document *models.Document) error
+	Count(ctx context.Context) (int64, error)
+	// OwnerUsage returns the number of documents of a user and their total size in bytes
+	OwnerUsage(ctx context.Context, ownerID uint) (count int64, size int64, err error)
+	// CountOwnersSince returns the number of users who uploaded a document since the given time
+	CountOwnersSince(ctx context.Context, since time.Time) (int64, error)
+	// TopOwners returns the users owning the most documents, with their document count
+	TopOwners(ctx context.Context, limit int) ([]OwnerCount, error)
+	// Find returns the documents matching the query, ordered by ID, from offset and at most limit of them
+	// when limit is positive
+	Find(ctx context.Context, query DocumentQuery, offset, limit int) ([]models.Document, error)
+	// CountMatching returns the number of documents matching the query
+	CountMatching(ctx context.Context, query DocumentQuery) (int64, error)
+	// SetFolder moves the document to a folder, or to the root when folderID is nil
+	SetFolder(ctx context.Context, document *models.Document, folderID *uint) error
+	// UpdateColumns applies the changes, keyed by column name, to a document without changing its update time
+	UpdateColumns(ctx context.Context, id uint, changes map[string]interface{}) error
+}
+
+// DocumentQuery selects documents; the zero value selects every document
+type DocumentQuery struct {
+	IDs          []uint   // among these documents
+	AfterID      uint     // with a greater ID, to read the documents in batches
+	OwnerID      uint     // owned by this user
+	Tags         []string // holding at least one of the tags
+	FolderIDs    []uint   // in one of the folders
+	NameContains string   // whose name contains the text, ignoring case
+	FixityStatus string   // with this outcome of the last fixity check
+	ScanStatuses []string // with one of these scan statuses, "" selecting the documents never scanned
+	// never checked for fixity or last checked before this time
+	CheckedBefore *time.Time
+}
+
+// OwnerCount is the number of documents of a user
+type OwnerCount struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	DocCount int64  `json:"doc_count"`
+}
+
+// TagRepository stores tags, unique by name within an organization
+type TagRepository interface {
+	// FindOrCreate returns the tags with the given names, creating the missing ones
+	FindOrCreate(ctx context.Context, names []string) ([]models.Tag, error)
+}
+
+// UserRepository stores users. Users are returned with their role.
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id uint) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+	// ListByAuthSource returns the users authenticated by a source, ordered by ID
+	ListByAuthSource(ctx context.Context, source string) ([]models.User, error)
+	// List returns a page of users whose username contains query, ordered by username, and the number of matches
+	List(ctx context.Context, query string, offset, limit int) ([]models.User, int64, error)
+	// Update applies the changes, keyed by column name, to the user
+	Update(ctx context.Context, user *models.User, changes map[string]interface{}) error
+	// Delete deletes the user with its memberships, grants and password records. Its documents are given to
+	// transferTo when set, otherwise deleted; the paths of the files no longer referenced are returned.
+	Delete(ctx context.Context, user *models.User, transferTo *uint) (removedFiles []string, err error)
+	Count(ctx context.Context) (int64, error)
+	CountWithRoleName(ctx context.Context, roleName string) (int64, error)
+	CountWithRole(ctx context.Context, roleID uint) (int64, error)
+	// CountEnabledWithRole counts the enabled users of a role other than exceptID
+	CountEnabledWithRole(ctx context.Context, roleID, exceptID uint) (int64, error)
+	// IncrementFailedLogins adds a failed login to the user's counter and returns the new count
+	IncrementFailedLogins(ctx context.Context, userID uint) (int, error)
+	// PasswordHistory returns the last limit previous password hashes of the user, most recent first
+	PasswordHistory(ctx context.Context, userID uint, limit int) ([]string, error)
+	// SetPassword replaces the password hash and moves the previous one to the history, keeping at most keep entries
+	SetPassword(ctx context.Context, user *models.User, hashed string, mustChange bool, keep int) error
+	// Memberships returns the user's role and the roles of their groups, and their groups
+	Memberships(ctx context.Context, userID uint) (roleIDs []uint, groupIDs []uint, err error)
+	// Usernames returns the usernames of the users with the given IDs that exist
+	Usernames(ctx context.Context, ids []uint) (map[uint]string, error)
+}
+
+// RoleRepository stores roles and their permissions. Roles are returned with their permissions.
+type RoleRepository interface {
+	Create(ctx context.Context, role *models.Role) error
+	Get(ctx context.Context, id uint) (*models.Role, error)
+	GetByName(ctx context.Context, name string) (*models.Role, error)
+	List(ctx context.Context) ([]models.Role, error)
+	NameTaken(ctx context.Context, name string, exceptID uint) (bool, error)
+	Rename(ctx context.Context, role *models.Role, name string) error
+	// SetAllowedUploadTypes replaces the comma-separated content types the role may upload
+	SetAllowedUploadTypes(ctx context.Context, role *models.Role, types string) error
+	Delete(ctx context.Context, role *models.Role) error
+	ListPermissions(ctx context.Context) ([]models.Permission, error)
+	// FindPermissions returns the permissions with the given names, ignoring unknown names
+	FindPermissions(ctx context.Context, names []string) ([]*models.Permission, error)
+	AddPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error
+	RemovePermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error
+}
+
+// OrganizationRepository stores organizations. Organizations are not restricted to the organization of the
+// context: the methods changing them are only called in unscoped contexts.
+type OrganizationRepository interface {
+	Get(ctx context.Context, id uint) (*models.Organization, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	// List returns every organization, ordered by name
+	List(ctx context.Context) ([]models.Organization, error)
+	// Taken reports whether an organization other than exceptID has the name or, when not empty, the slug
+	Taken(ctx context.Context, name, slug string, exceptID uint) (bool, error)
+	// Create creates the organization with its built-in roles, then its first user with the role named adminRole
+	Create(ctx context.Context, organization *models.Organization, admin *models.User, adminRole string) error
+	// Update applies the changes, keyed by column name, to the organization
+	Update(ctx context.Context, organization *models.Organization, changes map[string]interface{}) error
+	// Delete deletes the organization with its roles, groups, folders, grants, policies and tags.
+	// It must no longer have users nor documents.
+	Delete(ctx context.Context, organization *models.Organization) error
+	// Usage returns the number of users and of documents of the organization
+	Usage(ctx context.Context, id uint) (users int64, documents int64, err error)
+}
+
+// GroupRepository stores groups. Groups are returned with their members and roles.
+type GroupRepository interface {
+	Create(ctx context.Context, group *models.Group) error
+	Get(ctx context.Context, id uint) (*models.Group, error)
+	// List returns every group, ordered by name
+	List(ctx context.Context) ([]models.Group, error)
+	NameTaken(ctx context.Context, name string) (bool, error)
+	// Delete deletes the group with its memberships, role assignments and grants
+	Delete(ctx context.Context, group *models.Group) error
+	AddMember(ctx context.Context, group *models.Group, user *models.User) error
+	RemoveMember(ctx context.Context, group *models.Group, userID uint) error
+	AddRole(ctx context.Context, group *models.Group, role *models.Role) error
+	RemoveRole(ctx context.Context, group *models.Group, roleID uint) error
+	// NamesOf returns the names of the groups of a user, ordered by name
+	NamesOf(ctx context.Context, userID uint) ([]string, error)
+}
+
+// FolderRepository stores folders
+type FolderRepository interface {
+	Create(ctx context.Context, folder *models.Folder) error
+	Get(ctx context.Context, id uint) (*models.Folder, error)
+	List(ctx context.Context) ([]models.Folder, error)
+	// ListAccessible returns the folders owned by the user or granted to them or one of their groups, ordered by name
+	ListAccessible(ctx context.Context, userID uint, groupIDs []uint) ([]models.Folder, error)
+	// Find returns the folder of the owner with a name inside a parent folder, the root when parentID is nil
+	Find(ctx context.Context, ownerID uint, parentID *uint, name string) (*models.Folder, error)
+	// SetAllowedUploadTypes replaces the comma-separated content types accepted in the folder
+	SetAllowedUploadTypes(ctx context.Context, folder *models.Folder, types string) error
+}
+
+// GrantRepository stores the permissions given on documents and folders
+type GrantRepository interface {
+	Create(ctx context.Context, grant *models.Grant) error
+	// List returns the grants on the document and on the folder when given, ordered by ID
+	List(ctx context.Context, documentID, folderID *uint) ([]models.Grant, error)
+	// Find returns the first grant matching the query, nil when none does
+	Find(ctx context.Context, query GrantQuery) (*models.Grant, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// GrantQuery selects the grants of a permission on a document or on folders, given to a user or their groups
+type GrantQuery struct {
+	Permission string
+	DocumentID *uint  // on the document
+	FolderIDs  []uint // or on one of the folders
+	UserID     uint
+	GroupIDs   []uint
+}
+
+// PolicyRepository stores the attribute-based policies
+type PolicyRepository interface {
+	Create(ctx context.Context, policy *models.Policy) error
+	Get(ctx context.Context, id uint) (*models.Policy, error)
+	// List returns every policy, ordered by name
+	List(ctx context.Context) ([]models.Policy, error)
+	// ListEnabled returns the enabled policies of an organization, ordered by ID
+	ListEnabled(ctx context.Context, organizationID uint) ([]models.Policy, error)
+	NameTaken(ctx context.Context, name string, exceptID uint) (bool, error)
+	// Update saves every field of the policy
+	Update(ctx context.Context, policy *models.Policy) error
+	Delete(ctx context.Context, policy *models.Policy) error
+}
+
+// ResetTokenRepository stores the password reset tokens, which belong to a user rather than to an organization
+type ResetTokenRepository interface {
+	// Replace stores a new token of the user, deleting their unused ones
+	Replace(ctx context.Context, token *models.PasswordResetToken) error
+	GetByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error)
+	// Consume marks an unused token as used, and reports false when it was used in the meantime
+	Consume(ctx context.Context, id uint, at time.Time) (bool, error)
+}
+
+// AuditRepository stores the audit log
+type AuditRepository interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	// List returns a page of the events, only those of an action when given, most recent first, and the number
+	// of matches
+	List(ctx context.Context, action string, offset, limit int) ([]models.AuditEvent, int64, error)
+	// ListForTargets returns the events about the objects of a type, ordered by ID
+	ListForTargets(ctx context.Context, targetType string, ids []uint) ([]models.AuditEvent, error)
+}
+
+// FixityEventRepository stores the failed fixity checks and the backfilled checksums
+type FixityEventRepository interface {
+	Create(ctx context.Context, event *models.FixityEvent) error
+	// ListByDocument returns the last limit events of a document, most recent first
+	ListByDocument(ctx context.Context, documentID uint, limit int) ([]models.FixityEvent, error)
+	// List returns a page of the events, most recent first, and their total
+	List(ctx context.Context, offset, limit int) ([]models.FixityEvent, int64, error)
+	// ListForDocuments returns the events of the documents, ordered by ID
+	ListForDocuments(ctx context.Context, documentIDs []uint) ([]models.FixityEvent, error)
+}
+
+// DerivativeRepository stores the files generated from the documents, such as thumbnails
+type DerivativeRepository interface {
+	// Save creates the derivative, or replaces the one of the document with the same kind and size
+	Save(ctx context.Context, derivative *models.Derivative) error
+	Get(ctx context.Context, documentID uint, kind, size string) (*models.Derivative, error)
+	ListByDocument(ctx context.Context, documentID uint) ([]models.Derivative, error)
+	DeleteByDocument(ctx context.Context, documentID uint) error
+}
+
+// ImportRepository stores the archive imports and the outcome of their entries
+type ImportRepository interface {
+	Create(ctx context.Context, job *models.ImportJob) error
+	Get(ctx context.Context, id uint) (*models.ImportJob, error)
+	// GetMany returns the imports with the given IDs that exist
+	GetMany(ctx context.Context, ids []uint) ([]models.ImportJob, error)
+	// UpdateProgress saves the status, the counters, the error and the dates of the import
+	UpdateProgress(ctx context.Context, job *models.ImportJob) error
+	// ListByStatus returns the imports with one of the statuses
+	ListByStatus(ctx context.Context, statuses ...string) ([]models.ImportJob, error)
+	CreateEntry(ctx context.Context, entry *models.ImportEntry) error
+	// ListEntries returns a page of the entries of an import, only those with a status when given, ordered by ID,
+	// and the number of matches
+	ListEntries(ctx context.Context, jobID uint, status string, offset, limit int) ([]models.ImportEntry, int64, error)
+	// ImportedDocuments returns the documents created by an import, ordered by ID
+	ImportedDocuments(ctx context.Context, jobID uint) ([]uint, error)
+	// ImportedEntries returns the entries that created the documents
+	ImportedEntries(ctx context.Context, documentIDs []uint) ([]models.ImportEntry, error)
+}
+
+// ExportRepository stores the background exports
+type ExportRepository interface {
+	Create(ctx context.Context, job *models.ExportJob) error
+	Get(ctx context.Context, id uint) (*models.ExportJob, error)
+	// UpdateProgress saves the status, the counters, the archive and the dates of the export
+	UpdateProgress(ctx context.Context, job *models.ExportJob) error
+	// ListByStatus returns the exports with one of the statuses
+	ListByStatus(ctx context.Context, statuses ...string) ([]models.ExportJob, error)
+	// ListExpired returns the completed exports whose archive expired before the given time
+	ListExpired(ctx context.Context, before time.Time) ([]models.ExportJob, error)
+}
+
+// PackageRepository stores the archival packages
+type PackageRepository interface {
+	Create(ctx context.Context, pkg *models.ArchivalPackage) error
+	Get(ctx context.Context, id uint) (*models.ArchivalPackage, error)
+	// List returns a page of the packages, most recent first, and their total
+	List(ctx context.Context, offset, limit int) ([]models.ArchivalPackage, int64, error)
+	// UpdateProgress saves the status, the counters, the archive and the dates of the package
+	UpdateProgress(ctx context.Context, pkg *models.ArchivalPackage) error
+	// ListByStatus returns the packages with one of the statuses
+	ListByStatus(ctx context.Context, statuses ...string) ([]models.ArchivalPackage, error)
+}
+
+// StoredFileTables lists the tables whose records reference files of the storage
+var StoredFileTables = []string{"documents", "derivatives", "export_jobs", "archival_packages"}
+
+// StoredFile is a file of the storage, with the table and ID of the record referencing it
+type StoredFile struct {
+	Table string
+	ID    uint
+	URL   string
+	models.Encryption
+}
+
+// StoredFileRepository reads and records the encryption of the stored files, for the key rotations
+type StoredFileRepository interface {
+	// List returns the files referenced by the records of a table with an ID greater than afterID, ordered by
+	// ID, at most limit of them. Records without a file, like expired exports, are left out.
+	List(ctx context.Context, table string, afterID uint, limit int) ([]StoredFile, error)
+	// SetEncryption records the encryption of a file with its record
+	SetEncryption(ctx context.Context, file StoredFile) error
+}
+
+// Repositories groups the repositories the services are built with
+type Repositories struct {
+	Documents     DocumentRepository
+	Tags          TagRepository
+	Users         UserRepository
+	Roles         RoleRepository
+	Organizations OrganizationRepository
+	Groups        GroupRepository
+	Folders       FolderRepository
+	Grants        GrantRepository
+	Policies      PolicyRepository
+	ResetTokens   ResetTokenRepository
+	Audit         AuditRepository
+	FixityEvents  FixityEventRepository
+	Derivatives   DerivativeRepository
+	Imports       ImportRepository
+	Exports       ExportRepository
+	Packages      PackageRepository
+	Files         StoredFileRepository
+}
@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// forEachBackend runs the test on the gorm repositories over a migrated in-memory SQLite database and on the
+// in-memory repositories, which must behave alike
+func forEachBackend(t *testing.T, test func(t *testing.T, repos *Repositories)) {
+	t.Run("gorm", func(t *testing.T) {
+		db, err := database.Open(config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:"})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if _, err := database.Migrate(context.Background(), db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		test(t, NewGorm(db))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+}
+
+// tenants holds two organizations, each with its administrator
+type tenants struct {
+	ctxA, ctxB     context.Context
+	orgA, orgB     models.Organization
+	alice, bob     models.User
+	unscoped       context.Context
+	documentsOfOrg func(ctx context.Context) []string
+}
+
+func newTenants(t *testing.T, repos *Repositories) *tenants {
+	t.Helper()
+	f := &tenants{
+		unscoped: database.Unscoped(context.Background()),
+		orgA:     models.Organization{Name: "Org A", Slug: "org-a"},
+		orgB:     models.Organization{Name: "Org B", Slug: "org-b"},
+		alice:    models.User{Username: "alice", Password: "x", AuthSource: models.AuthSourceLocal},
+		bob:      models.User{Username: "bob", Password: "x", AuthSource: models.AuthSourceLDAP},
+	}
+	if err := repos.Organizations.Create(f.unscoped, &f.orgA, &f.alice, "admin"); err != nil {
+		t.Fatalf("create organization A: %v", err)
+	}
+	if err := repos.Organizations.Create(f.unscoped, &f.orgB, &f.bob, "admin"); err != nil {
+		t.Fatalf("create organization B: %v", err)
+	}
+	f.ctxA = database.WithOrganization(context.Background(), f.orgA.ID)
+	f.ctxB = database.WithOrganization(context.Background(), f.orgB.ID)
+	f.documentsOfOrg = func(ctx context.Context) []string {
+		t.Helper()
+		documents, err := repos.Documents.Find(ctx, DocumentQuery{}, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, document := range documents {
+			names = append(names, document.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	return f
+}
+
+func newDocument(t *testing.T, repos *Repositories, ctx context.Context, owner models.User, name string) *models.Document {
+	t.Helper()
+	document := &models.Document{Name: name, Type: "text/plain", URL: name, OwnerID: owner.ID, Tags: &[]models.Tag{}}
+	if err := repos.Documents.Create(ctx, document); err != nil {
+		t.Fatalf("create document %s: %v", name, err)
+	}
+	return document
+}
+
+func TestTenantIsolation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		f := newTenants(t, repos)
+
+		document := newDocument(t, repos, f.ctxA, f.alice, "a.txt")
+		if document.OrganizationID != f.orgA.ID {
+			t.Fatalf("document created in organization %d, want %d", document.OrganizationID, f.orgA.ID)
+		}
+		if _, err := repos.Documents.Get(f.ctxB, document.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("document of organization A read from B: got %v, want ErrNotFound", err)
+		}
+		if names := f.documentsOfOrg(f.ctxB); len(names) != 0 {
+			t.Fatalf("organization B lists %v", names)
+		}
+		if _, err := repos.Documents.Find(context.Background(), DocumentQuery{}, 0, 0); err == nil {
+			t.Fatal("documents listed without organization")
+		}
+
+		foreign := &models.Document{OrganizationID: f.orgB.ID, Name: "b.txt", Type: "text/plain", URL: "b.txt", OwnerID: f.alice.ID}
+		if err := repos.Documents.Create(f.ctxA, foreign); err == nil {
+			t.Fatal("document created in another organization")
+		}
+
+		// Roles are looked up by name within the organization
+		roleA, err := repos.Roles.GetByName(f.ctxA, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		roleB, err := repos.Roles.GetByName(f.ctxB, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roleA.ID == roleB.ID || roleA.OrganizationID != f.orgA.ID || f.alice.RoleID != roleA.ID {
+			t.Fatalf("admin roles %+v and %+v, alice has role %d", roleA, roleB, f.alice.RoleID)
+		}
+		if _, err := repos.Roles.Get(f.ctxB, roleA.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("role of organization A read from B: got %v, want ErrNotFound", err)
+		}
+
+		// Users are listed within the organization, and found by username across organizations when unscoped
+		users, total, err := repos.Users.List(f.ctxA, "", 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(users) != 1 || users[0].Username != "alice" || users[0].Role.Name != "admin" {
+			t.Fatalf("organization A lists %+v (total %d), want alice with her role", users, total)
+		}
+		if _, err := repos.Users.GetByUsername(f.ctxA, "bob"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("user of organization B found from A: got %v, want ErrNotFound", err)
+		}
+		user, err := repos.Users.GetByUsername(f.unscoped, "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.OrganizationID != f.orgB.ID {
+			t.Fatalf("bob belongs to organization %d, want %d", user.OrganizationID, f.orgB.ID)
+		}
+		ldapUsers, err := repos.Users.ListByAuthSource(f.unscoped, models.AuthSourceLDAP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ldapUsers) != 1 || ldapUsers[0].ID != f.bob.ID {
+			t.Fatalf("LDAP users %+v, want only bob", ldapUsers)
+		}
+
+		userCount, documentCount, err := repos.Organizations.Usage(f.unscoped, f.orgA.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userCount != 1 || documentCount != 1 {
+			t.Fatalf("organization A has %d users and %d documents, want 1 and 1", userCount, documentCount)
+		}
+	})
+}
+
+func TestUsersSearch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		f := newTenants(t, repos)
+		for _, username := range []string{"Malika", "natalie", "zoe"} {
+			user := &models.User{Username: username, Password: "x", RoleID: f.alice.RoleID}
+			if err := repos.Users.Create(f.ctxA, user); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The search ignores case, and the total counts every match beyond the page
+		users, total, err := repos.Users.List(f.ctxA, "ALI", 0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 3 || len(users) != 2 {
+			t.Fatalf("search returned %d users of %d, want 2 of 3", len(users), total)
+		}
+		users, _, err = repos.Users.List(f.ctxA, "ALI", 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 {
+			t.Fatalf("second page has %d users, want 1", len(users))
+		}
+
+		taken, err := repos.Users.UsernameTaken(f.unscoped, "bob")
+		if err != nil || !taken {
+			t.Fatalf("username of organization B taken: %v, %v", taken, err)
+		}
+	})
+}
+
+func TestDocumentsFind(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		f := newTenants(t, repos)
+		checked := newDocument(t, repos, f.ctxA, f.alice, "checked.txt")
+		stale := newDocument(t, repos, f.ctxA, f.alice, "stale.txt")
+		never := newDocument(t, repos, f.ctxB, f.bob, "never.txt")
+
+		now := time.Now()
+		old := now.Add(-48 * time.Hour)
+		if err := repos.Documents.UpdateColumns(f.ctxA, checked.ID, map[string]interface{}{
+			"fixity_status": "ok", "fixity_checked_at": now,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Documents.UpdateColumns(f.ctxA, stale.ID, map[string]interface{}{
+			"fixity_status": "mismatch", "fixity_checked_at": old,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The fixity checker reads every organization in batches of documents due for a check
+		cutoff := now.Add(-24 * time.Hour)
+		due, err := repos.Documents.Find(f.unscoped, DocumentQuery{CheckedBefore: &cutoff}, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 2 || due[0].ID != stale.ID || due[1].ID != never.ID {
+			t.Fatalf("documents due for a check %+v, want stale.txt and never.txt", due)
+		}
+		batch, err := repos.Documents.Find(f.unscoped, DocumentQuery{AfterID: checked.ID}, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 1 || batch[0].ID != stale.ID {
+			t.Fatalf("batch after the first document %+v, want stale.txt", batch)
+		}
+
+		count, err := repos.Documents.CountMatching(f.ctxA, DocumentQuery{FixityStatus: "mismatch"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("%d documents with a mismatch, want 1", count)
+		}
+		found, err := repos.Documents.Find(f.ctxA, DocumentQuery{NameContains: "CHECK"}, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].ID != checked.ID {
+			t.Fatalf("name search %+v, want checked.txt", found)
+		}
+		// A scoped query does not see the documents of another organization
+		if count, err := repos.Documents.CountMatching(f.ctxB, DocumentQuery{}); err != nil || count != 1 {
+			t.Fatalf("organization B counts %d documents, error %v", count, err)
+		}
+	})
+}
+
+func TestGroupMemberships(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		f := newTenants(t, repos)
+		userRole, err := repos.Roles.GetByName(f.ctxA, "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		group := &models.Group{Name: "editors"}
+		if err := repos.Groups.Create(f.ctxA, group); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Groups.Create(f.ctxA, &models.Group{Name: "editors"}); err == nil {
+			t.Fatal("duplicate group name accepted")
+		}
+		// Group names are unique per organization
+		if err := repos.Groups.Create(f.ctxB, &models.Group{Name: "editors"}); err != nil {
+			t.Fatalf("group of the same name in another organization: %v", err)
+		}
+		if err := repos.Groups.AddMember(f.ctxA, group, &f.alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Groups.AddRole(f.ctxA, group, userRole); err != nil {
+			t.Fatal(err)
+		}
+
+		roleIDs, groupIDs, err := repos.Users.Memberships(f.unscoped, f.alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(roleIDs, func(i, j int) bool { return roleIDs[i] < roleIDs[j] })
+		want := []uint{f.alice.RoleID, userRole.ID}
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		if len(roleIDs) != 2 || roleIDs[0] != want[0] || roleIDs[1] != want[1] {
+			t.Fatalf("roles of alice %v, want %v", roleIDs, want)
+		}
+		if len(groupIDs) != 1 || groupIDs[0] != group.ID {
+			t.Fatalf("groups of alice %v, want [%d]", groupIDs, group.ID)
+		}
+
+		loaded, err := repos.Groups.Get(f.ctxA, group.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded.Users) != 1 || len(loaded.Roles) != 1 {
+			t.Fatalf("group loaded with %d members and %d roles, want 1 and 1", len(loaded.Users), len(loaded.Roles))
+		}
+		if _, err := repos.Groups.Get(f.ctxB, group.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("group of organization A read from B: got %v, want ErrNotFound", err)
+		}
+
+		if err := repos.Groups.Delete(f.ctxA, loaded); err != nil {
+			t.Fatal(err)
+		}
+		if _, groupIDs, err = repos.Users.Memberships(f.unscoped, f.alice.ID); err != nil || len(groupIDs) != 0 {
+			t.Fatalf("groups of alice after deletion %v, error %v", groupIDs, err)
+		}
+	})
+}
+
+func TestStoredFiles(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		f := newTenants(t, repos)
+		a := newDocument(t, repos, f.ctxA, f.alice, "a.txt")
+		b := newDocument(t, repos, f.ctxB, f.bob, "b.txt")
+		export := &models.ExportJob{UserID: f.alice.ID, Status: models.ExportPending}
+		if err := repos.Exports.Create(f.ctxA, export); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every organization in an unscoped context, records without a file left out
+		files, err := repos.Files.List(f.unscoped, "documents", 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 2 || files[0].ID != a.ID || files[1].ID != b.ID || files[0].URL != "a.txt" {
+			t.Fatalf("documents %+v, want a.txt and b.txt", files)
+		}
+		if files, err = repos.Files.List(f.unscoped, "documents", a.ID, 10); err != nil || len(files) != 1 {
+			t.Fatalf("documents after %d: %+v (%v)", a.ID, files, err)
+		}
+		if files, err = repos.Files.List(f.unscoped, "export_jobs", 0, 10); err != nil || len(files) != 0 {
+			t.Fatalf("exports %+v (%v), want none without archive", files, err)
+		}
+		if files, err = repos.Files.List(f.ctxA, "documents", 0, 10); err != nil || len(files) != 1 {
+			t.Fatalf("documents of organization A %+v (%v)", files, err)
+		}
+		if _, err := repos.Files.List(f.unscoped, "users", 0, 10); err == nil {
+			t.Fatal("files listed from the users table")
+		}
+
+		file := StoredFile{Table: "documents", ID: b.ID, Encryption: models.Encryption{Encrypted: true, KeyID: "k2"}}
+		if err := repos.Files.SetEncryption(f.unscoped, file); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := repos.Documents.Get(f.ctxB, b.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Encryption != file.Encryption {
+			t.Fatalf("document recorded with %+v, want %+v", stored.Encryption, file.Encryption)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrClamd reports an error answered by clamd, such as a file over its StreamMaxLength
+var ErrClamd = errors.New("clamd error")
+
+// chunkSize is the size of the chunks streamed to clamd, well under its default StreamMaxLength
+const chunkSize = 64 << 10
+
+// Clamd scans files with the ClamAV daemon, streaming their content with the INSTREAM command so that clamd
+// needs no access to the storage
+type Clamd struct {
+	Network string // "tcp" or "unix"
+	Address string // host:port, or the path of the socket
+	Timeout time.Duration
+}
+
+// NewClamd returns the client of the clamd listening at address: "tcp://host:port", "unix:///path/to/clamd.sock",
+// or a bare host:port
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	if !strings.Contains(address, "://") {
+		return &Clamd{Network: "tcp", Address: address, Timeout: timeout}, nil
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address: %w", err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid clamd address '%s': missing host", address)
+		}
+		return &Clamd{Network: "tcp", Address: u.Host, Timeout: timeout}, nil
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid clamd address '%s': missing socket path", address)
+		}
+		return &Clamd{Network: "unix", Address: u.Path, Timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unsupported clamd address scheme '%s'", u.Scheme)
+	}
+}
+
+// Version returns the version of clamd and of its signature database, e.g. "ClamAV 1.3.1/27400/Mon Sep 2 2024"
+func (c *Clamd) Version(ctx context.Context) (string, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zVERSION\x00")); err != nil {
+		return "", fmt.Errorf("failed to send command to clamd: %w", err)
+	}
+	return readReply(conn)
+}
+
+// Scan streams the content to clamd and parses its verdict
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if err := stream(conn, r); err != nil {
+		// clamd closes the connection after answering an error, such as a stream over its size limit
+		if reply, replyErr := readReply(conn); replyErr == nil {
+			if _, parseErr := parseVerdict(reply); parseErr != nil {
+				return Result{}, parseErr
+			}
+		}
+		return Result{}, err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseVerdict(reply)
+}
+
+// dial connects to clamd; the whole exchange on the connection is bounded by the timeout and by ctx
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// stream sends the INSTREAM command followed by the content in chunks, each prefixed by its length, and the
+// zero-length chunk ending the stream
+func stream(conn net.Conn, r io.Reader) error {
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("failed to send command to clamd: %w", err)
+	}
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := w.Write(size[:]); err != nil {
+				return fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file to scan: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := w.Write(size[:]); err != nil {
+		return fmt.Errorf("failed to stream to clamd: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to stream to clamd: %w", err)
+	}
+	return nil
+}
+
+// readReply reads an answer of clamd, terminated by a null byte with the z-prefixed commands
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// parseVerdict reads an INSTREAM answer: "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseVerdict(reply string) (Result, error) {
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		signature = strings.TrimSpace(signature[strings.LastIndex(signature, ": ")+1:])
+		return Result{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, " OK"):
+		return Result{}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return Result{}, fmt.Errorf("%w: %s", ErrClamd, strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return Result{}, fmt.Errorf("%w: unexpected reply '%s'", ErrClamd, reply)
+	}
+}
@@ -0,0 +1,150 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers the zVERSION and zINSTREAM commands like clamd, finding the EICAR test file and rejecting
+// streams over maxSize
+type fakeClamd struct {
+	listener net.Listener
+	maxSize  int
+}
+
+func startFakeClamd(t *testing.T, maxSize int) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeClamd{listener: listener, maxSize: maxSize}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeClamd) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch command {
+	case "zVERSION\x00":
+		conn.Write([]byte("ClamAV 1.3.1/27400/Mon Sep  2 08:00:00 2024\x00"))
+	case "zINSTREAM\x00":
+		var content bytes.Buffer
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size[:])
+			if n == 0 {
+				break
+			}
+			if content.Len()+int(n) > f.maxSize {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				return
+			}
+			if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+				return
+			}
+		}
+		if strings.Contains(content.String(), eicar) {
+			conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		} else {
+			conn.Write([]byte("stream: OK\x00"))
+		}
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestClamdScan(t *testing.T) {
+	server := startFakeClamd(t, 1<<20)
+	clamd, err := NewClamd("tcp://"+server.listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Several chunks, to cover the framing of the stream
+	clean := bytes.Repeat([]byte("archive "), 3*chunkSize/8+1)
+	result, err := clamd.Scan(ctx, bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("clean file: %v", err)
+	}
+	if result.Infected {
+		t.Fatalf("clean file reported infected with %q", result.Signature)
+	}
+
+	result, err = clamd.Scan(ctx, strings.NewReader(eicar))
+	if err != nil {
+		t.Fatalf("infected file: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("infected file: got %+v, want Eicar-Test-Signature", result)
+	}
+
+	version, err := clamd.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(version, "ClamAV 1.3.1/27400/") {
+		t.Fatalf("unexpected version %q", version)
+	}
+}
+
+func TestClamdScanTooLarge(t *testing.T) {
+	server := startFakeClamd(t, chunkSize)
+	clamd := &Clamd{Network: "tcp", Address: server.listener.Addr().String(), Timeout: 5 * time.Second}
+
+	_, err := clamd.Scan(context.Background(), bytes.NewReader(make([]byte, 4*chunkSize)))
+	if err == nil {
+		t.Fatal("stream over the size limit was accepted")
+	}
+	if !errors.Is(err, ErrClamd) && !strings.Contains(err.Error(), "failed to stream to clamd") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestClamdUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	clamd := &Clamd{Network: "tcp", Address: address, Timeout: time.Second}
+	if _, err := clamd.Scan(context.Background(), strings.NewReader("content")); err == nil || !strings.Contains(err.Error(), "failed to connect to clamd") {
+		t.Fatalf("unreachable clamd: got %v, want a connection error", err)
+	}
+	if _, err := clamd.Version(context.Background()); err == nil {
+		t.Fatal("unreachable clamd answered its version")
+	}
+}
@@ -0,0 +1,35 @@
+// Package scan checks the uploaded files for malware before they are redistributed. The only scanner for now
+// is clamd, the ClamAV daemon, reached over TCP or a Unix socket; other engines implement the Scanner interface.
+package scan
+
+import (
+	"archiv-system/internal/config"
+	"context"
+	"io"
+)
+
+// Result is the verdict of a scanner on a file
+type Result struct {
+	Infected  bool
+	Signature string // Name of the malware found, empty when clean
+}
+
+// Scanner checks the content of a file for malware
+type Scanner interface {
+	// Scan reads the content from r and returns the verdict of the engine
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+	// Version identifies the engine and its signature database, recorded with each verdict
+	Version(ctx context.Context) (string, error)
+}
+
+// New returns the scanner of the configuration, nil when scanning is disabled
+func New(cfg config.ScanConfig) (Scanner, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	clamd, err := NewClamd(cfg.Address, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return clamd, nil
+}
@@ -0,0 +1,165 @@
+// Package server assembles the HTTP API: middleware, routes and the handlers serving them.
+package server
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
+	"archiv-system/internal/handler"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/middleware"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/services"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"gorm.io/gorm"
+)
+
+// Dependencies are what the router is built with
+type Dependencies struct {
+	Services      *services.Services
+	Users         repository.UserRepository // resolves the user of each authenticated request
+	Authenticator *auth.Authenticator
+	JWT           *utils.JWT
+	Authz         *authz.Engine
+	Store         *storage.Store
+	DB            *gorm.DB // checked by the readiness probe, nil on the in-memory repositories
+}
+
+// NewRouter registers the middleware and the routes
+func NewRouter(cfg *config.Config, deps Dependencies) *gin.Engine {
+	h := handler.New(deps.Services, deps.Authenticator, deps.JWT, deps.Authz, deps.Store, deps.DB)
+	authn := middleware.NewAuth(deps.JWT, deps.Authz, deps.Users)
+
+	r := gin.New()
+	// The client address, which login lockouts are keyed on, is only taken from X-Forwarded-For behind these
+	// proxies; the list is checked by config.Validate
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		panic("invalid trusted proxies: " + err.Error())
+	}
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName), middleware.RequestID(), middleware.AccessLog(), gin.Recovery())
+	r.Use(metrics.Middleware())
+
+	// Health probes for the load balancer and the orchestrator; metrics are served on their own listener
+	r.GET("/healthz", handler.Healthz)
+	r.GET("/readyz", h.Readyz)
+
+	// Public routes
+	r.POST("auth/register", h.Register)
+	r.POST("auth/login", h.Login)
+	r.POST("auth/password/forgot", h.ForgotPassword)
+	r.POST("auth/password/reset", h.ResetPassword)
+
+	// Apply JWT middleware globally
+	r.Use(authn.JWTAuthMiddleware())
+
+	// Group for document routes
+	documentsGroup := r.Group("/documents")
+	{
+		documentsGroup.POST("/upload", authn.AuthMiddleware("upload_document"), middleware.MaxBodySize(cfg.Upload.MaxSize()), h.UploadFile)
+		documentsGroup.GET("/viewlist", authn.ListAuthMiddleware("read_document"), h.ViewListDoc) // Permission to view list of documents
+		documentsGroup.PUT("/:id", authn.AuthMiddleware("update_document"), authn.OwnershipMiddleware("update_document"), h.UpdateDocument)
+		documentsGroup.DELETE("/:id", authn.AuthMiddleware("delete_document"), authn.OwnershipMiddleware("delete_document"), h.DeleteDocument)
+		documentsGroup.GET("/user", authn.ListAuthMiddleware("read_document"), h.GetUserDocuments) // Permission to view user's own documents
+		documentsGroup.GET("/:id/check-update", h.CheckDocumentUpdate)
+		documentsGroup.PUT("/:id/folder", authn.AuthMiddleware("update_document"), authn.OwnershipMiddleware("update_document"), h.MoveDocument)
+		documentsGroup.GET("/:id/thumbnail", authn.AuthMiddleware("read_document"), authn.OwnershipMiddleware("read_document"), h.GetThumbnail)
+		documentsGroup.POST("/import", authn.AuthMiddleware("upload_document"), middleware.MaxBodySize(cfg.Import.MaxSize()), h.ImportDocuments)
+		documentsGroup.GET("/import/:id", authn.AuthMiddleware("upload_document"), h.GetImport)
+		documentsGroup.GET("/import/:id/entries", authn.AuthMiddleware("upload_document"), h.ListImportEntries)
+		documentsGroup.POST("/export", authn.ListAuthMiddleware("read_document"), h.ExportDocuments)
+		documentsGroup.GET("/export/:id", authn.AuthMiddleware("read_document"), h.GetExport)
+		documentsGroup.GET("/export/:id/download", authn.AuthMiddleware("read_document"), h.DownloadExport)
+		documentsGroup.GET("/:id/fixity", authn.AuthMiddleware("read_document"), authn.OwnershipMiddleware("read_document"), h.GetDocumentFixity)
+	}
+
+	// Group for folder routes
+	foldersGroup := r.Group("/folders")
+	{
+		foldersGroup.GET("", authn.AuthMiddleware("read_document"), h.ListFolders)
+		foldersGroup.POST("", authn.AuthMiddleware("upload_document"), h.CreateFolder)
+		foldersGroup.PUT("/:id/upload-types", authn.AuthMiddleware("upload_document"), h.SetFolderUploadTypes)
+	}
+
+	// Group for admin routes
+	adminGroup := r.Group("/admin")
+	{
+		adminGroup.POST("/dashboard", authn.AuthMiddleware("admin:create"), h.AdminHandler)
+
+		// Role and permission administration
+		adminGroup.GET("/permissions", authn.AuthMiddleware("manage_roles"), h.ListPermissions)
+		adminGroup.GET("/roles", authn.AuthMiddleware("manage_roles"), h.ListRoles)
+		adminGroup.POST("/roles", authn.AuthMiddleware("manage_roles"), h.CreateRole)
+		adminGroup.PUT("/roles/:id", authn.AuthMiddleware("manage_roles"), h.UpdateRole)
+		adminGroup.DELETE("/roles/:id", authn.AuthMiddleware("manage_roles"), h.DeleteRole)
+		adminGroup.POST("/roles/:id/permissions", authn.AuthMiddleware("manage_roles"), h.AssignPermission)
+		adminGroup.DELETE("/roles/:id/permissions/:permission", authn.AuthMiddleware("manage_roles"), h.UnassignPermission)
+		adminGroup.PUT("/roles/:id/upload-types", authn.AuthMiddleware("manage_roles"), h.SetRoleUploadTypes)
+		adminGroup.PUT("/users/:id/role", authn.AuthMiddleware("manage_roles"), h.ChangeUserRole)
+		adminGroup.GET("/authz/explain", authn.AuthMiddleware("manage_roles"), h.ExplainPermission)
+
+		// User management
+		adminGroup.GET("/users", authn.AuthMiddleware("manage_users"), h.ListUsers)
+		adminGroup.GET("/users/:id", authn.AuthMiddleware("manage_users"), h.GetUser)
+		adminGroup.POST("/users/:id/disable", authn.AuthMiddleware("manage_users"), h.DisableUser)
+		adminGroup.POST("/users/:id/enable", authn.AuthMiddleware("manage_users"), h.EnableUser)
+		adminGroup.POST("/users/:id/reset-password", authn.AuthMiddleware("manage_users"), h.ResetUserPassword)
+		adminGroup.POST("/users/:id/unlock", authn.AuthMiddleware("manage_users"), h.UnlockUser)
+		adminGroup.DELETE("/users/:id", authn.AuthMiddleware("manage_users"), h.DeleteUser)
+
+		// Groups and grants
+		adminGroup.GET("/groups", authn.AuthMiddleware("manage_groups"), h.ListGroups)
+		adminGroup.POST("/groups", authn.AuthMiddleware("manage_groups"), h.CreateGroup)
+		adminGroup.DELETE("/groups/:id", authn.AuthMiddleware("manage_groups"), h.DeleteGroup)
+		adminGroup.POST("/groups/:id/members", authn.AuthMiddleware("manage_groups"), h.AddGroupMember)
+		adminGroup.DELETE("/groups/:id/members/:userID", authn.AuthMiddleware("manage_groups"), h.RemoveGroupMember)
+		adminGroup.POST("/groups/:id/roles", authn.AuthMiddleware("manage_groups"), h.AssignGroupRole)
+		adminGroup.DELETE("/groups/:id/roles/:roleID", authn.AuthMiddleware("manage_groups"), h.UnassignGroupRole)
+		adminGroup.GET("/grants", authn.AuthMiddleware("manage_groups"), h.ListGrants)
+		adminGroup.POST("/grants", authn.AuthMiddleware("manage_groups"), h.CreateGrant)
+		adminGroup.DELETE("/grants/:id", authn.AuthMiddleware("manage_groups"), h.DeleteGrant)
+
+		// Attribute-based policies
+		adminGroup.GET("/policies", authn.AuthMiddleware("manage_policies"), h.ListPolicies)
+		adminGroup.POST("/policies", authn.AuthMiddleware("manage_policies"), h.CreatePolicy)
+		adminGroup.PUT("/policies/:id", authn.AuthMiddleware("manage_policies"), h.UpdatePolicy)
+		adminGroup.DELETE("/policies/:id", authn.AuthMiddleware("manage_policies"), h.DeletePolicy)
+
+		// Fixity checks of the stored files
+		adminGroup.GET("/fixity", authn.AuthMiddleware("manage_fixity"), h.ListFixity)
+		adminGroup.GET("/fixity/events", authn.AuthMiddleware("manage_fixity"), h.ListFixityEvents)
+
+		// Malware scanning and audit log
+		adminGroup.GET("/quarantine", authn.AuthMiddleware("manage_quarantine"), h.ListQuarantine)
+		adminGroup.POST("/quarantine/:id/rescan", authn.AuthMiddleware("manage_quarantine"), h.RescanDocument)
+		adminGroup.GET("/audit", authn.AuthMiddleware("view_audit"), h.ListAuditEvents)
+
+		// Archival information packages (AIP)
+		adminGroup.GET("/packages", authn.AuthMiddleware("manage_preservation"), h.ListPackages)
+		adminGroup.POST("/packages", authn.AuthMiddleware("manage_preservation"), h.CreatePackage)
+		adminGroup.GET("/packages/:id", authn.AuthMiddleware("manage_preservation"), h.GetPackage)
+		adminGroup.GET("/packages/:id/download", authn.AuthMiddleware("manage_preservation"), h.DownloadPackage)
+	}
+
+	// Group for super-admin routes, managing every organization
+	superGroup := r.Group("/super", middleware.SuperAdminMiddleware())
+	{
+		superGroup.GET("/organizations", h.ListOrganizations)
+		superGroup.POST("/organizations", h.CreateOrganization)
+		superGroup.PUT("/organizations/:id", h.UpdateOrganization)
+		superGroup.DELETE("/organizations/:id", h.DeleteOrganization)
+		superGroup.GET("/organizations/:id/users", h.ListOrganizationUsers)
+	}
+
+	// Group for user routes
+	userGroup := r.Group("/user")
+	{
+		userGroup.GET("/dashboard", authn.AuthMiddleware("user:read"), h.UserHandler)
+		userGroup.PUT("/password", h.ChangePassword) // Reachable even when a password change is required
+	}
+
+	return r
+}
@@ -0,0 +1,414 @@
+package server
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/preview"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/services"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer is the router built on the in-memory repositories, with the default organization
+// holding a super-admin "admin" and a user "alice"
+type testServer struct {
+	t            *testing.T
+	router       *gin.Engine
+	repos        *repository.Repositories
+	organization *models.Organization
+}
+
+const testPassword = "Correct-Horse-1"
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	repos := repository.NewMemory()
+	s := &testServer{t: t, repos: repos, router: newRouter(t, repos)}
+
+	var err error
+	s.organization, err = repos.Organizations.GetBySlug(database.Unscoped(context.Background()), database.DefaultOrganizationSlug)
+	if err != nil {
+		t.Fatalf("default organization: %v", err)
+	}
+	s.addUser("admin", "admin", true)
+	s.addUser("alice", "user", false)
+	return s
+}
+
+// newRouter builds the router and its dependencies on the repositories, storing the files in a temporary directory
+func newRouter(t *testing.T, repos *repository.Repositories) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Storage.Path = t.TempDir()
+	cfg.JWT.Secret = "test-secret"
+	cfg.Preview.Enabled = false
+	cfg.Preservation.Enabled = false
+
+	store, err := storage.New(cfg.Storage, cfg.Encryption)
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	tokens, err := utils.NewJWT(cfg.JWT)
+	if err != nil {
+		t.Fatalf("jwt: %v", err)
+	}
+	engine := authz.NewEngine(cfg.Authz, repos)
+	authenticator, err := auth.NewAuthenticator(repos, engine, cfg)
+	if err != nil {
+		t.Fatalf("authenticator: %v", err)
+	}
+	svc := services.New(repos, services.Dependencies{
+		Store:     store,
+		Authz:     engine,
+		Passwords: authenticator.Policy(),
+		Notifier:  notify.LogNotifier{},
+		Previews:  preview.NewGenerator(cfg.Preview),
+	})
+	return NewRouter(cfg, Dependencies{
+		Services:      svc,
+		Users:         repos.Users,
+		Authenticator: authenticator,
+		JWT:           tokens,
+		Authz:         engine,
+		Store:         store,
+	})
+}
+
+// addUser creates a user of the default organization with the role and testPassword
+func (s *testServer) addUser(username, roleName string, superAdmin bool) *models.User {
+	s.t.Helper()
+	ctx := database.WithOrganization(context.Background(), s.organization.ID)
+	role, err := s.repos.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		s.t.Fatalf("role %s: %v", roleName, err)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	user := &models.User{Username: username, Password: string(hashed), RoleID: role.ID, SuperAdmin: superAdmin,
+		AuthSource: models.AuthSourceLocal}
+	if err := s.repos.Users.Create(ctx, user); err != nil {
+		s.t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+// response is the envelope written by utils.RespondJSON and utils.RespondError
+type response struct {
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do sends the request and decodes the response envelope, failing the test on an unexpected status
+func (s *testServer) do(req *http.Request, token string, want int) response {
+	s.t.Helper()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != want {
+		s.t.Fatalf("%s %s: status %d, want %d: %s", req.Method, req.URL.Path, rec.Code, want, rec.Body.String())
+	}
+	var res response
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		s.t.Fatalf("%s %s: decode response: %v", req.Method, req.URL.Path, err)
+	}
+	return res
+}
+
+func (s *testServer) json(method, path, token string, body interface{}, want int) response {
+	s.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	return s.do(req, token, want)
+}
+
+func (s *testServer) login(username, password string) string {
+	s.t.Helper()
+	res := s.json(http.MethodPost, "/auth/login", "", gin.H{"username": username, "password": password}, http.StatusOK)
+	var data struct {
+		Token string `json:"token"`
+	}
+	decode(s.t, res.Data, &data)
+	if data.Token == "" {
+		s.t.Fatalf("login %s: empty token", username)
+	}
+	return data.Token
+}
+
+// upload sends a text file and returns the ID of the new document
+func (s *testServer) upload(token, name, content, tags string) uint {
+	s.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.WriteField("tags", tags)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/documents/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	res := s.do(req, token, http.StatusOK)
+	var data struct {
+		ID uint `json:"ID"`
+	}
+	decode(s.t, res.Data, &data)
+	return data.ID
+}
+
+// documentNames lists the names of the documents the user can see
+func (s *testServer) documentNames(token string) []string {
+	s.t.Helper()
+	res := s.json(http.MethodGet, "/documents/viewlist", token, nil, http.StatusCreated)
+	var data struct {
+		Documents []models.Document `json:"documents"`
+	}
+	decode(s.t, res.Data, &data)
+	names := []string{}
+	for _, document := range data.Documents {
+		names = append(names, document.Name)
+	}
+	return names
+}
+
+func decode(t *testing.T, raw json.RawMessage, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	s.json(http.MethodPost, "/auth/login", "", gin.H{"username": "alice", "password": "wrong"}, http.StatusUnauthorized)
+	s.json(http.MethodPost, "/auth/login", "", gin.H{"username": "nobody", "password": testPassword}, http.StatusUnauthorized)
+	s.json(http.MethodGet, "/documents/viewlist", "", nil, http.StatusUnauthorized)
+	s.json(http.MethodGet, "/documents/viewlist", "not-a-token", nil, http.StatusUnauthorized)
+
+	token := s.login("alice", testPassword)
+	if names := s.documentNames(token); len(names) != 0 {
+		t.Fatalf("documents %v, want none", names)
+	}
+	// The user role does not manage users
+	s.json(http.MethodGet, "/admin/users", token, nil, http.StatusForbidden)
+}
+
+func TestRegisterAndUpload(t *testing.T) {
+	s := newTestServer(t)
+
+	s.json(http.MethodPost, "/auth/register", "", gin.H{"username": "bob", "password": "short"}, http.StatusBadRequest)
+	s.json(http.MethodPost, "/auth/register", "", gin.H{"username": "bob", "password": testPassword}, http.StatusCreated)
+	s.json(http.MethodPost, "/auth/register", "", gin.H{"username": "bob", "password": testPassword}, http.StatusConflict)
+
+	token := s.login("bob", testPassword)
+	id := s.upload(token, "notes.txt", "archived notes\n", "minutes")
+	if id == 0 {
+		t.Fatal("upload returned no document ID")
+	}
+
+	ctx := database.WithOrganization(context.Background(), s.organization.ID)
+	document, err := s.repos.Documents.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("uploaded document: %v", err)
+	}
+	if document.SHA256 == "" {
+		t.Error("no checksum recorded at upload")
+	}
+	if _, err := os.Stat(document.URL); err != nil {
+		t.Errorf("stored file: %v", err)
+	}
+
+	if names := s.documentNames(token); len(names) != 1 || names[0] != "notes.txt" {
+		t.Fatalf("documents %v, want [notes.txt]", names)
+	}
+	// Alice did not upload it and holds no grant on it
+	alice := s.login("alice", testPassword)
+	s.json(http.MethodDelete, fmt.Sprintf("/documents/%d", id), alice, nil, http.StatusForbidden)
+}
+
+func TestGroupsAndGrants(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login("admin", testPassword)
+	alice := s.login("alice", testPassword)
+
+	s.json(http.MethodGet, "/admin/groups", alice, nil, http.StatusForbidden)
+
+	id := s.upload(admin, "report.txt", "yearly report\n", "reports")
+
+	res := s.json(http.MethodPost, "/admin/groups", admin, gin.H{"name": "editors"}, http.StatusCreated)
+	var created struct {
+		Group models.Group `json:"group"`
+	}
+	decode(t, res.Data, &created)
+	groupID := created.Group.ID
+	s.json(http.MethodPost, "/admin/groups", admin, gin.H{"name": "editors"}, http.StatusConflict)
+
+	ctx := database.WithOrganization(context.Background(), s.organization.ID)
+	user, err := s.repos.Users.GetByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.json(http.MethodPost, fmt.Sprintf("/admin/groups/%d/members", groupID), admin, gin.H{"user_id": user.ID}, http.StatusOK)
+
+	// Alice holds update_document neither through her role nor her group yet
+	update := gin.H{"name": "report-2024.txt", "type": "application/x-msdownload", "tags": []string{"reports"}}
+	s.json(http.MethodPut, fmt.Sprintf("/documents/%d", id), alice, update, http.StatusForbidden)
+
+	s.json(http.MethodPost, fmt.Sprintf("/admin/groups/%d/roles", groupID), admin, gin.H{"role": "admin"}, http.StatusOK)
+	// The role of the group grants the permission, the document still belongs to the admin
+	s.json(http.MethodPut, fmt.Sprintf("/documents/%d", id), alice, update, http.StatusForbidden)
+
+	grant := gin.H{"document_id": id, "group_id": groupID, "permission": "update_document"}
+	s.json(http.MethodPost, "/admin/grants", admin, grant, http.StatusCreated)
+	s.json(http.MethodPut, fmt.Sprintf("/documents/%d", id), alice, update, http.StatusOK)
+	// The type detected at upload is kept, whatever the update declares
+	if document, err := s.repos.Documents.Get(ctx, id); err != nil || document.Type != "text/plain" {
+		t.Fatalf("document after update %+v (%v), want its detected type kept", document, err)
+	}
+
+	res = s.json(http.MethodGet, "/admin/grants", admin, nil, http.StatusOK)
+	var listed struct {
+		Grants []models.Grant `json:"grants"`
+	}
+	decode(t, res.Data, &listed)
+	if len(listed.Grants) != 1 {
+		t.Fatalf("grants %v, want one", listed.Grants)
+	}
+
+	s.json(http.MethodDelete, fmt.Sprintf("/admin/grants/%d", listed.Grants[0].ID), admin, nil, http.StatusOK)
+	s.json(http.MethodPut, fmt.Sprintf("/documents/%d", id), alice, update, http.StatusForbidden)
+}
+
+func TestPolicies(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login("admin", testPassword)
+
+	s.upload(admin, "plan.txt", "secret plan\n", "secret")
+	s.upload(admin, "menu.txt", "canteen menu\n", "public")
+
+	invalid := gin.H{"name": "broken", "permission": "read_document", "effect": "deny", "condition": `document.tags in`}
+	s.json(http.MethodPost, "/admin/policies", admin, invalid, http.StatusBadRequest)
+
+	policy := gin.H{"name": "hide-secret", "permission": "read_document", "effect": "deny",
+		"condition": `"secret" in document.tags`}
+	s.json(http.MethodPost, "/admin/policies", admin, policy, http.StatusCreated)
+
+	if names := s.documentNames(admin); len(names) != 1 || names[0] != "menu.txt" {
+		t.Fatalf("documents %v, want [menu.txt]", names)
+	}
+
+	res := s.json(http.MethodGet, "/admin/policies", admin, nil, http.StatusOK)
+	var listed struct {
+		Policies []models.Policy `json:"policies"`
+	}
+	decode(t, res.Data, &listed)
+	if len(listed.Policies) != 1 {
+		t.Fatalf("policies %v, want one", listed.Policies)
+	}
+	s.json(http.MethodDelete, fmt.Sprintf("/admin/policies/%d", listed.Policies[0].ID), admin, nil, http.StatusOK)
+
+	if names := s.documentNames(admin); len(names) != 2 {
+		t.Fatalf("documents %v, want both", names)
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login("admin", testPassword)
+	alice := s.login("alice", testPassword)
+
+	input := gin.H{"name": "City Archives", "slug": "city", "admin_username": "archivist", "admin_password": testPassword}
+	s.json(http.MethodPost, "/super/organizations", alice, input, http.StatusForbidden)
+	s.json(http.MethodPost, "/super/organizations", admin, input, http.StatusCreated)
+	s.json(http.MethodPost, "/super/organizations", admin, input, http.StatusConflict)
+
+	res := s.json(http.MethodGet, "/super/organizations", admin, nil, http.StatusOK)
+	var listed struct {
+		Organizations []services.OrganizationSummary `json:"organizations"`
+	}
+	decode(t, res.Data, &listed)
+	if len(listed.Organizations) != 2 {
+		t.Fatalf("organizations %v, want two", listed.Organizations)
+	}
+
+	// The administrator of the new organization only sees its own users and documents
+	archivist := s.login("archivist", testPassword)
+	s.upload(admin, "default.txt", "default organization\n", "")
+	if names := s.documentNames(archivist); len(names) != 0 {
+		t.Fatalf("documents %v, want none", names)
+	}
+	res = s.json(http.MethodGet, "/admin/users", archivist, nil, http.StatusOK)
+	var users struct {
+		Users []struct {
+			Username string `json:"username"`
+		} `json:"users"`
+	}
+	decode(t, res.Data, &users)
+	if len(users.Users) != 1 || users.Users[0].Username != "archivist" {
+		t.Fatalf("users %v, want only archivist", users.Users)
+	}
+}
+
+func TestQuarantinedDocumentsUnlisted(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login("admin", testPassword)
+	alice := s.login("alice", testPassword)
+
+	clean := s.upload(alice, "notes.txt", "archived notes\n", "minutes")
+	infected := s.upload(alice, "invoice.txt", "invoice\n", "minutes")
+	pending := s.upload(alice, "letter.txt", "letter\n", "minutes")
+	ctx := database.WithOrganization(context.Background(), s.organization.ID)
+	for id, status := range map[uint]string{clean: models.ScanClean, infected: models.ScanInfected, pending: models.ScanPending} {
+		if err := s.repos.Documents.UpdateColumns(ctx, id, map[string]interface{}{"scan_status": status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the released documents are listed to their owner, even on her own list
+	if names := s.documentNames(alice); len(names) != 1 || names[0] != "notes.txt" {
+		t.Fatalf("documents %v, want [notes.txt]", names)
+	}
+	res := s.json(http.MethodGet, "/documents/user", alice, nil, http.StatusOK)
+	var owned struct {
+		Documents []models.Document `json:"documents"`
+	}
+	decode(t, res.Data, &owned)
+	if len(owned.Documents) != 1 || owned.Documents[0].ID != clean {
+		t.Fatalf("own documents %v, want only the clean one", owned.Documents)
+	}
+	// The users managing the quarantine see all of them
+	if names := s.documentNames(admin); len(names) != 3 {
+		t.Fatalf("documents %v, want all three", names)
+	}
+}
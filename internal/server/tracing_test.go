@@ -0,0 +1,144 @@
+package server
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/logging"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRequestTracing(t *testing.T) {
+	// The tracer provider and the logger are installed before the database and the router pick them up
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Init(context.Background(), config.TracingConfig{ServiceName: "archiv-test", SampleRatio: 1}, exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&logs, config.LogConfig{Level: "info", Format: "json"}))
+	t.Cleanup(func() {
+		shutdown(context.Background())
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		slog.SetDefault(previous)
+	})
+
+	db, err := database.Open(config.DatabaseConfig{Driver: config.DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	repos := repository.NewGorm(db)
+	s := &testServer{t: t, repos: repos, router: newRouter(t, repos)}
+	s.organization = &models.Organization{Name: "Traced", Slug: "traced"}
+	archivist := &models.User{Username: "archivist", Password: "x"}
+	if err := repos.Organizations.Create(database.Unscoped(context.Background()), s.organization, archivist, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	s.addUser("alice", "user", false)
+	token := s.login("alice", testPassword)
+
+	exporter.Reset()
+	logs.Reset()
+	s.json(http.MethodGet, "/documents/viewlist", token, nil, http.StatusCreated)
+
+	spans := exporter.GetSpans()
+	var server *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].SpanKind == trace.SpanKindServer {
+			server = &spans[i]
+		}
+	}
+	if server == nil {
+		t.Fatalf("no server span among %d spans", len(spans))
+	}
+	if server.Name != "/documents/viewlist" {
+		t.Errorf("server span named %q, want the route", server.Name)
+	}
+	if attributeValue(server.Attributes, "http.route") != "/documents/viewlist" {
+		t.Errorf("server span attributes %v lack the route", server.Attributes)
+	}
+
+	// The queries of the request descend from the server span, preloads being children of their query
+	parents := map[trace.SpanID]trace.SpanID{}
+	for _, span := range spans {
+		parents[span.SpanContext.SpanID()] = span.Parent.SpanID()
+	}
+	queries := 0
+	for _, span := range spans {
+		if !strings.HasPrefix(span.InstrumentationScope.Name, "gorm.io/plugin/opentelemetry") {
+			continue
+		}
+		queries++
+		if span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("query span %q in trace %s, want %s", span.Name, span.SpanContext.TraceID(), server.SpanContext.TraceID())
+		}
+		ancestor := span.Parent.SpanID()
+		for ancestor.IsValid() && ancestor != server.SpanContext.SpanID() {
+			ancestor = parents[ancestor]
+		}
+		if !ancestor.IsValid() {
+			t.Errorf("query span %q (%s) does not descend from the server span",
+				span.Name, attributeValue(span.Attributes, "db.statement"))
+		}
+		if attributeValue(span.Attributes, "db.statement") == "" {
+			t.Errorf("query span %q has no statement", span.Name)
+		}
+	}
+	if queries == 0 {
+		t.Fatalf("no query span among %v", spanNames(spans))
+	}
+
+	// The access log carries the trace ID, to go from a log line to its trace
+	found := false
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("log line %s: %v", line, err)
+		}
+		if record["msg"] == "request" {
+			found = true
+			if record["trace_id"] != server.SpanContext.TraceID().String() {
+				t.Errorf("access log trace_id %v, want %s", record["trace_id"], server.SpanContext.TraceID())
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("no access log in %s", logs.String())
+	}
+}
+
+// attributeValue returns the value of the attribute, "" when it is not set
+func attributeValue(attrs []attribute.KeyValue, key string) string {
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+)
+
+// AuditService records the sensitive actions on the archive and lists them for the administrators
+type AuditService struct {
+	events repository.AuditRepository
+}
+
+func NewAuditService(events repository.AuditRepository) *AuditService {
+	return &AuditService{events: events}
+}
+
+// Record adds an event to the audit log of the organization of the context
+func (as *AuditService) Record(ctx context.Context, event *models.AuditEvent) error {
+	return as.events.Create(ctx, event)
+}
+
+// ListEvents returns a page of the audit log, optionally only one action, most recent first, and the total
+// number of matches
+func (as *AuditService) ListEvents(ctx context.Context, action string, page, pageSize int) ([]models.AuditEvent, int64, error) {
+	return as.events.List(ctx, action, (page-1)*pageSize, pageSize)
+}
@@ -0,0 +1,871 @@
+package services
+
+import (
+	"archiv-system/internal/archive"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/bagit"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/models"
+	"archiv-system/internal/oais"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/tracing"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrExportNotFound    = errors.New("export not found")
+	ErrExportUnavailable = errors.New("bulk exports are not enabled")
+	ErrInvalidExport     = errors.New("invalid export request")
+	ErrExportForbidden   = errors.New("you cannot read this document")
+	ErrExportTooLarge    = errors.New("too many documents to export at once")
+	ErrNothingToExport   = errors.New("no document to export")
+	ErrExportNotReady    = errors.New("export is not ready for download")
+	ErrExportExpired     = errors.New("export has expired")
+	ErrExportCorrupted   = errors.New("stored file is damaged")
+)
+
+// ExportDir is the directory of an organization holding the archives of the background exports
+const ExportDir = "exports"
+
+// bagMetadataDir is the directory of the tag files of a bag holding the manifest of its documents
+const bagMetadataDir = "metadata"
+
+// exportBatchSize bounds the documents loaded at once
+const exportBatchSize = 500
+
+// ExportRequest selects the documents of an export, by ID or by a query
+type ExportRequest struct {
+	DocumentIDs []uint       `json:"document_ids"`
+	Query       *ExportQuery `json:"query"`
+	Format      string       `json:"format"`     // zip (default), bagit, or dip for a bag described by a METS
+	Manifest    string       `json:"manifest"`   // json (default) or csv
+	Background  bool         `json:"background"` // build the archive in the background even when it is small
+}
+
+// ExportQuery selects the documents the user can read matching every criterion given
+type ExportQuery struct {
+	Tags      []string `json:"tags"`      // holding at least one of the tags
+	FolderID  *uint    `json:"folder_id"` // in the folder
+	Recursive bool     `json:"recursive"` // or in its sub-folders
+	Name      string   `json:"name"`      // whose name contains the text, ignoring case
+	Type      string   `json:"type"`      // whose type matches the pattern, e.g. "image/*"
+}
+
+// ExportSelection holds the documents of an export, all readable by the user and out of quarantine
+type ExportSelection struct {
+	Documents  []models.Document
+	Name       string // of the archive, and of the top-level directory of a bag
+	Format     string // models.ExportFormatZip, models.ExportFormatBagIt or models.ExportFormatDIP
+	Package    string // oais.AIP or oais.DIP for a bag described by a METS, "" otherwise
+	Manifest   string // archive.ManifestJSON or archive.ManifestCSV
+	Size       int64  // total size of the files
+	Background bool   // too large to be streamed in the response
+}
+
+// ExportService exports documents as zip archives with a manifest of their metadata, streamed in the response
+// or, when large, built in the background and kept in the storage until they expire
+type ExportService struct {
+	exports      repository.ExportRepository
+	folders      repository.FolderRepository
+	imports      repository.ImportRepository
+	fixityEvents repository.FixityEventRepository
+	audit        repository.AuditRepository
+	documents    *DocumentService
+	store        *storage.Store
+	authz        *authz.Engine
+	queue        *jobs.Queue
+	cfg          config.ExportConfig
+}
+
+// NewExportService builds the export service. The imports, fixity events and audit events are read for the
+// history of the documents of the information packages.
+func NewExportService(exports repository.ExportRepository, folders repository.FolderRepository, imports repository.ImportRepository,
+	fixityEvents repository.FixityEventRepository, audit repository.AuditRepository, documents *DocumentService,
+	store *storage.Store, engine *authz.Engine) *ExportService {
+	return &ExportService{exports: exports, folders: folders, imports: imports, fixityEvents: fixityEvents, audit: audit,
+		documents: documents, store: store, authz: engine}
+}
+
+// SetQueue enables the exports, running the large ones on the queue, with the limits of the configuration
+func (es *ExportService) SetQueue(queue *jobs.Queue, cfg config.ExportConfig) {
+	es.queue, es.cfg = queue, cfg
+}
+
+// Select resolves the documents of an export request, and tells whether it must run in the background.
+// Documents given by ID must all be readable; those found by a query are silently limited to the readable ones.
+func (es *ExportService) Select(ctx context.Context, userID uint, req ExportRequest) (*ExportSelection, error) {
+	if es.queue == nil {
+		return nil, ErrExportUnavailable
+	}
+	selection := &ExportSelection{Name: "export-" + time.Now().Format("20060102-150405")}
+	switch strings.ToLower(req.Format) {
+	case "", models.ExportFormatZip:
+		selection.Format = models.ExportFormatZip
+	case models.ExportFormatBagIt:
+		selection.Format = models.ExportFormatBagIt
+	case models.ExportFormatDIP:
+		selection.Format, selection.Package = models.ExportFormatDIP, oais.DIP
+	default:
+		return nil, fmt.Errorf("%w: unknown format '%s', expected zip, bagit or dip", ErrInvalidExport, req.Format)
+	}
+	switch strings.ToLower(req.Manifest) {
+	case "", "json":
+		selection.Manifest = archive.ManifestJSON
+	case "csv":
+		selection.Manifest = archive.ManifestCSV
+	default:
+		return nil, fmt.Errorf("%w: unknown manifest format '%s', expected json or csv", ErrInvalidExport, req.Manifest)
+	}
+	if (len(req.DocumentIDs) > 0) == (req.Query != nil) {
+		return nil, fmt.Errorf("%w: give either document_ids or query", ErrInvalidExport)
+	}
+
+	var err error
+	if req.Query != nil {
+		selection.Documents, err = es.selectQuery(ctx, userID, req.Query)
+	} else {
+		selection.Documents, err = es.selectIDs(ctx, userID, req.DocumentIDs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(selection.Documents) == 0 {
+		return nil, ErrNothingToExport
+	}
+
+	for _, document := range selection.Documents {
+		selection.Size += document.Size
+	}
+	selection.Background = req.Background || len(selection.Documents) > es.cfg.StreamDocuments ||
+		selection.Size > es.cfg.StreamSize()
+	return selection, nil
+}
+
+func (es *ExportService) selectIDs(ctx context.Context, userID uint, ids []uint) ([]models.Document, error) {
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) > es.cfg.MaxDocuments {
+		return nil, fmt.Errorf("%w: %d documents, at most %d", ErrExportTooLarge, len(ids), es.cfg.MaxDocuments)
+	}
+	documents, err := es.loadDocuments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) < len(ids) {
+		found := make(map[uint]bool, len(documents))
+		for _, document := range documents {
+			found[document.ID] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				return nil, fmt.Errorf("%w: %d", ErrDocumentNotFound, id)
+			}
+		}
+	}
+
+	policies, err := es.authz.DocumentFilter(ctx, userID, "read_document")
+	if err != nil {
+		return nil, err
+	}
+	for i := range documents {
+		document := &documents[i]
+		readable, err := es.readable(ctx, userID, policies, document)
+		if err != nil {
+			return nil, err
+		}
+		if !readable {
+			return nil, fmt.Errorf("%w: %d", ErrExportForbidden, document.ID)
+		}
+		if quarantined(document) {
+			return nil, fmt.Errorf("%w: %d", ErrDocumentQuarantined, document.ID)
+		}
+	}
+	return documents, nil
+}
+
+func (es *ExportService) selectQuery(ctx context.Context, userID uint, q *ExportQuery) ([]models.Document, error) {
+	query := repository.DocumentQuery{Tags: q.Tags, NameContains: q.Name}
+	if q.FolderID != nil {
+		folderIDs, err := es.folderIDs(ctx, *q.FolderID, q.Recursive)
+		if err != nil {
+			return nil, err
+		}
+		query.FolderIDs = folderIDs
+	}
+	var patterns []string
+	if q.Type != "" {
+		var err error
+		if patterns, err = filetype.ParsePatterns([]string{q.Type}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+	}
+
+	// Readability is decided per document, the limit can only be checked once filtered
+	policies, err := es.authz.DocumentFilter(ctx, userID, "read_document")
+	if err != nil {
+		return nil, err
+	}
+	var documents []models.Document
+	for {
+		batch, err := es.documents.documents.Find(ctx, query, 0, exportBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			document := &batch[i]
+			if quarantined(document) || (patterns != nil && !filetype.Allowed(patterns, filetype.Normalize(document.Type))) {
+				continue
+			}
+			readable, err := es.readable(ctx, userID, policies, document)
+			if err != nil {
+				return nil, err
+			}
+			if !readable {
+				continue
+			}
+			if len(documents) == es.cfg.MaxDocuments {
+				return nil, fmt.Errorf("%w: more than %d documents match", ErrExportTooLarge, es.cfg.MaxDocuments)
+			}
+			documents = append(documents, *document)
+		}
+		if len(batch) < exportBatchSize {
+			return documents, nil
+		}
+		query.AfterID = batch[len(batch)-1].ID
+	}
+}
+
+// folderIDs returns the folder and, when recursive, all the folders below it
+func (es *ExportService) folderIDs(ctx context.Context, folderID uint, recursive bool) ([]uint, error) {
+	folders, err := es.loadFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := folders[folderID]; !ok {
+		return nil, ErrFolderNotFound
+	}
+	ids := []uint{folderID}
+	if !recursive {
+		return ids, nil
+	}
+	children := make(map[uint][]uint)
+	for _, folder := range folders {
+		if folder.ParentID != nil {
+			children[*folder.ParentID] = append(children[*folder.ParentID], folder.ID)
+		}
+	}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// readable tells whether the user can read a document, as its owner or through the authorization rules, and
+// the policies of the organization let them
+func (es *ExportService) readable(ctx context.Context, userID uint, policies *authz.DocumentFilter, document *models.Document) (bool, error) {
+	if document.OwnerID != userID {
+		allowed, err := es.authz.Authorize(ctx, userID, "read_document", authz.Document(document.ID))
+		if errors.Is(err, authz.ErrResourceNotFound) {
+			return false, nil
+		}
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+	return policies.Allows(ctx, document)
+}
+
+// loadDocuments loads documents with their tags, in batches to keep the queries small
+func (es *ExportService) loadDocuments(ctx context.Context, ids []uint) ([]models.Document, error) {
+	documents := make([]models.Document, 0, len(ids))
+	for start := 0; start < len(ids); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(ids))
+		batch, err := es.documents.documents.Find(ctx, repository.DocumentQuery{IDs: ids[start:end]}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, batch...)
+	}
+	return documents, nil
+}
+
+func (es *ExportService) loadFolders(ctx context.Context) (map[uint]models.Folder, error) {
+	folders, err := es.folders.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Folder, len(folders))
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+	return byID, nil
+}
+
+// WriteArchive writes the documents of a selection and their manifest to w, as a zip archive or a BagIt bag,
+// reading the files one after the other. The bag of an information package also holds a METS document of the
+// documents, with their PREMIS metadata. In a zip archive, a file that cannot be opened is left out and its entry
+// in the manifest says why; a bag, made for preservation, must be complete and the export fails instead. An error
+// leaves the archive without its central directory, so that a truncated download cannot pass for a complete one.
+func (es *ExportService) WriteArchive(ctx context.Context, w io.Writer, selection *ExportSelection) error {
+	_, err := es.writeArchive(ctx, w, selection, nil)
+	return err
+}
+
+// writeArchive writes the archive, calling progress after each document, and returns the documents left out
+func (es *ExportService) writeArchive(ctx context.Context, w io.Writer, selection *ExportSelection, progress func(processed, failed int) error) (int, error) {
+	folders, err := es.loadFolders(ctx)
+	if err != nil {
+		return 0, err
+	}
+	paths := exportPaths(selection.Documents, folders)
+
+	var out exportWriter = &zipExport{zw: zip.NewWriter(w)}
+	var bagOut *bagExport
+	bag := selection.Format != models.ExportFormatZip
+	if bag {
+		info, err := es.bagInfo(ctx, selection)
+		if err != nil {
+			return 0, err
+		}
+		bagOut = &bagExport{bw: bagit.NewWriter(w, selection.Name), info: info}
+		out = bagOut
+	}
+
+	entries := make([]archive.ManifestEntry, 0, len(selection.Documents))
+	failed := 0
+	for i := range selection.Documents {
+		if err := ctx.Err(); err != nil {
+			return failed, err
+		}
+		document := &selection.Documents[i]
+		entry := manifestEntry(document, paths[document.ID])
+		if err := es.addDocument(ctx, out, document, entry.Path); err != nil {
+			var unavailable *unavailableError
+			if !errors.As(err, &unavailable) || bag {
+				return failed, fmt.Errorf("failed to export document %d: %w", document.ID, err)
+			}
+			slog.WarnContext(ctx, "Document left out of export", "document_id", document.ID, "error", unavailable.err)
+			entry.Error = unavailable.Error()
+			failed++
+		}
+		entries = append(entries, entry)
+		if progress != nil {
+			if err := progress(i+1, failed); err != nil {
+				return failed, err
+			}
+		}
+	}
+	if selection.Package != "" {
+		if bagOut.mets, err = es.describePackage(ctx, selection, paths); err != nil {
+			return failed, fmt.Errorf("failed to describe package: %w", err)
+		}
+	}
+	return failed, out.close(selection.Manifest, entries)
+}
+
+// bagInfo returns the fields of the bag-info.txt of an export, those of the configuration coming last
+func (es *ExportService) bagInfo(ctx context.Context, selection *ExportSelection) (bagit.Info, error) {
+	organization, err := es.documents.currentOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	description := fmt.Sprintf("Export of %d documents", len(selection.Documents))
+	switch selection.Package {
+	case oais.AIP:
+		description = fmt.Sprintf("Archival information package of %d files", len(selection.Documents))
+	case oais.DIP:
+		description = fmt.Sprintf("Dissemination information package of %d documents", len(selection.Documents))
+	}
+	info := bagit.Info{
+		{Label: "Source-Organization", Value: organization.Name},
+		{Label: "External-Description", Value: description},
+		{Label: "Internal-Sender-Identifier", Value: selection.Name},
+		{Label: "Bag-Software-Agent", Value: "archiv-system"},
+	}
+	for _, line := range es.cfg.BagInfo {
+		field, err := bagit.ParseInfoField(line)
+		if err != nil {
+			return nil, err
+		}
+		info.Set(field.Label, field.Value)
+	}
+	return info, nil
+}
+
+// unavailableError reports a document whose file cannot be added to an export
+type unavailableError struct{ err error }
+
+// Error gives the reason written in the manifest, without the location of the file in the storage
+func (e *unavailableError) Error() string {
+	switch {
+	case errors.Is(e.err, ErrDocumentQuarantined), errors.Is(e.err, ErrDocumentNotFound):
+		return e.err.Error()
+	case errors.Is(e.err, os.ErrNotExist):
+		return "file missing from the storage"
+	default:
+		return "file unreadable"
+	}
+}
+
+// addDocument copies the decrypted content of a document to the archive
+func (es *ExportService) addDocument(ctx context.Context, out exportWriter, document *models.Document, entryPath string) error {
+	// The selection may be old: a document sent back to quarantine since is not exported, and its file has moved
+	current, err := es.documents.documents.Get(ctx, document.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &unavailableError{ErrDocumentNotFound}
+	}
+	if err != nil {
+		return err
+	}
+	if quarantined(current) {
+		return &unavailableError{ErrDocumentQuarantined}
+	}
+	content, err := es.store.Open(ctx, current.URL, current.Encryption)
+	if err != nil {
+		return &unavailableError{err}
+	}
+	defer content.Close()
+	return out.add(document, entryPath, content)
+}
+
+// exportWriter receives the documents of an export, then their manifest
+type exportWriter interface {
+	add(document *models.Document, entryPath string, content io.Reader) error
+	close(manifestPath string, entries []archive.ManifestEntry) error
+}
+
+// zipExport writes the documents at the root of a zip archive, next to the manifest
+type zipExport struct {
+	zw *zip.Writer
+}
+
+func (z *zipExport) add(document *models.Document, entryPath string, content io.Reader) error {
+	file, err := z.zw.CreateHeader(&zip.FileHeader{Name: entryPath, Method: zip.Deflate, Modified: document.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	return err
+}
+
+func (z *zipExport) close(manifestPath string, entries []archive.ManifestEntry) error {
+	manifest, err := z.zw.CreateHeader(&zip.FileHeader{Name: manifestPath, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := archive.WriteManifest(manifest, manifestPath, entries); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return z.zw.Close()
+}
+
+// bagExport writes the documents as the payload of a bag, the manifest and the METS document of an information
+// package being tag files under metadata/
+type bagExport struct {
+	bw   *bagit.Writer
+	info bagit.Info
+	mets []byte // nil for a bag that is not an information package
+}
+
+func (b *bagExport) add(document *models.Document, entryPath string, content io.Reader) error {
+	sums, err := b.bw.AddFile(entryPath, document.UpdatedAt, content)
+	if err != nil {
+		return err
+	}
+	// The bag would preserve a damaged file with checksums vouching for it
+	if document.SHA256 != "" && sums[bagit.SHA256] != document.SHA256 {
+		return fmt.Errorf("%w: the SHA-256 differs from the checksum recorded at upload", ErrExportCorrupted)
+	}
+	return nil
+}
+
+func (b *bagExport) close(manifestPath string, entries []archive.ManifestEntry) error {
+	var manifest bytes.Buffer
+	if err := archive.WriteManifest(&manifest, manifestPath, entries); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := b.bw.AddTagFile(path.Join(bagMetadataDir, manifestPath), manifest.Bytes()); err != nil {
+		return err
+	}
+	if b.mets != nil {
+		if err := b.bw.AddTagFile(path.Join(bagMetadataDir, oais.METSFile), b.mets); err != nil {
+			return err
+		}
+	}
+	return b.bw.Close(b.info)
+}
+
+// manifestEntry describes a document in the manifest of an export
+func manifestEntry(document *models.Document, entryPath string) archive.ManifestEntry {
+	entry := archive.ManifestEntry{
+		Path:              entryPath,
+		Name:              document.Name,
+		Tags:              []string{},
+		ContentType:       document.Type,
+		ID:                document.ID,
+		Version:           document.Version,
+		PreviousVersionID: document.PreviousVersionID,
+		Size:              document.Size,
+		SHA256:            document.SHA256,
+		SHA512:            document.SHA512,
+		CreatedAt:         &document.CreatedAt,
+		UpdatedAt:         &document.UpdatedAt,
+	}
+	if document.Tags != nil {
+		for _, tag := range *document.Tags {
+			entry.Tags = append(entry.Tags, tag.Name)
+		}
+	}
+	return entry
+}
+
+// exportPaths places each document in the archive under the path of its folder. Names used twice in a
+// directory get the ID of the document before their extension.
+func exportPaths(documents []models.Document, folders map[uint]models.Folder) map[uint]string {
+	dirs := make(map[uint]string)
+	var dirOf func(folderID uint, depth int) string
+	dirOf = func(folderID uint, depth int) string {
+		if dir, ok := dirs[folderID]; ok {
+			return dir
+		}
+		folder, ok := folders[folderID]
+		if !ok || depth > len(folders) {
+			return ""
+		}
+		dir := sanitizeFilename(folder.Name)
+		if folder.ParentID != nil {
+			dir = path.Join(dirOf(*folder.ParentID, depth+1), dir)
+		}
+		dirs[folderID] = dir
+		return dir
+	}
+
+	paths := make(map[uint]string, len(documents))
+	used := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		dir := ""
+		if document.FolderID != nil {
+			dir = dirOf(*document.FolderID, 0)
+		}
+		name := sanitizeFilename(document.Name)
+		entryPath := path.Join(dir, name)
+		if used[entryPath] || archive.IsManifest(entryPath) {
+			ext := path.Ext(name)
+			entryPath = path.Join(dir, strings.TrimSuffix(name, ext)+"-"+strconv.FormatUint(uint64(document.ID), 10)+ext)
+		}
+		used[entryPath] = true
+		paths[document.ID] = entryPath
+	}
+	return paths
+}
+
+// StartExport records an export of the user and queues the building of its archive
+func (es *ExportService) StartExport(ctx context.Context, userID uint, selection *ExportSelection) (*models.ExportJob, error) {
+	if es.queue == nil {
+		return nil, ErrExportUnavailable
+	}
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return nil, database.ErrMissingTenant
+	}
+
+	ids := make([]string, len(selection.Documents))
+	for i, document := range selection.Documents {
+		ids[i] = strconv.FormatUint(uint64(document.ID), 10)
+	}
+	manifest := "json"
+	if selection.Manifest == archive.ManifestCSV {
+		manifest = "csv"
+	}
+	job := &models.ExportJob{
+		UserID:      userID,
+		Status:      models.ExportPending,
+		Format:      selection.Format,
+		Manifest:    manifest,
+		DocumentIDs: strings.Join(ids, ","),
+		Total:       len(ids),
+	}
+	if err := es.exports.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	jobID := job.ID
+	if err := es.queue.Enqueue(func(ctx context.Context) error {
+		return es.Run(database.WithOrganization(ctx, organizationID), jobID)
+	}); err != nil {
+		es.finish(ctx, job, err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// Run builds the archive of an export in the storage, encrypted like the documents
+func (es *ExportService) Run(ctx context.Context, jobID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "services.RunExport", attribute.Int("export.id", int(jobID)))
+	defer func() { tracing.End(span, err) }()
+
+	job, err := es.exports.Get(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+	job.Status, job.StartedAt = models.ExportRunning, &startedAt
+	if err := es.exports.UpdateProgress(ctx, job); err != nil {
+		return err
+	}
+
+	err = es.buildArchive(ctx, job)
+	es.finish(ctx, job, err)
+	span.SetAttributes(attribute.Int("export.documents", job.Processed), attribute.Int64("export.size", job.Size))
+	if err != nil {
+		return fmt.Errorf("export %d failed: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (es *ExportService) buildArchive(ctx context.Context, job *models.ExportJob) error {
+	ids, err := parseIDList(job.DocumentIDs)
+	if err != nil {
+		return err
+	}
+	// Documents deleted since the request are no longer exported
+	documents, err := es.loadDocuments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	job.Total = len(documents)
+	selection := &ExportSelection{
+		Documents: documents,
+		Name:      fmt.Sprintf("export-%d", job.ID),
+		Format:    job.Format,
+		Manifest:  archive.ManifestJSON,
+	}
+	if job.Manifest == "csv" {
+		selection.Manifest = archive.ManifestCSV
+	}
+	if job.Format == models.ExportFormatDIP {
+		selection.Package = oais.DIP
+	}
+
+	url, err := es.archivePath(ctx, ExportDir, selection.Name)
+	if err != nil {
+		return err
+	}
+	stored, err := es.storeArchive(ctx, url, func(w io.Writer) error {
+		failed, err := es.writeArchive(ctx, w, selection, func(processed, failed int) error {
+			job.Processed, job.Failed = processed, failed
+			return es.exports.UpdateProgress(ctx, job)
+		})
+		job.Failed = failed
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(es.cfg.Retention)
+	job.URL, job.Encryption, job.Size, job.ExpiresAt = url, stored.encryption, stored.size, &expiresAt
+	return nil
+}
+
+// parseIDList reads the document IDs recorded comma-separated with a background job
+func parseIDList(list string) ([]uint, error) {
+	var ids []uint
+	for _, field := range strings.Split(list, ",") {
+		id, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document list: %w", err)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// archivePath returns the location in the storage of an archive named name, in a directory of the organization
+func (es *ExportService) archivePath(ctx context.Context, dirName, name string) (string, error) {
+	organization, err := es.documents.currentOrganization(ctx)
+	if err != nil {
+		return "", err
+	}
+	dir := es.store.Path(organization.Slug, dirName)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create %s directory: %w", dirName, err)
+	}
+	return filepath.Join(dir, name+".zip"), nil
+}
+
+// storedArchive describes an archive saved in the storage
+type storedArchive struct {
+	size       int64
+	sha256     string
+	encryption models.Encryption
+}
+
+// storeArchive saves at url the archive written by write. The archive is encrypted as it is written, it never
+// lies in clear on the disk.
+func (es *ExportService) storeArchive(ctx context.Context, url string, write func(w io.Writer) error) (storedArchive, error) {
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw, h: sha256.New()}
+	done := make(chan error, 1)
+	go func() {
+		err := write(counter)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	encryption, saveErr := es.store.Save(ctx, url, pr)
+	pr.CloseWithError(saveErr) // stops the writer when the storage fails
+	if err := <-done; err != nil {
+		return storedArchive{}, err
+	}
+	if saveErr != nil {
+		return storedArchive{}, fmt.Errorf("failed to save archive: %w", saveErr)
+	}
+	return storedArchive{size: counter.n, sha256: hex.EncodeToString(counter.h.Sum(nil)), encryption: encryption}, nil
+}
+
+// countingWriter counts and hashes the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.h.Write(p[:n])
+	cw.n += int64(n)
+	return n, err
+}
+
+// finish records the end of an export, failed when err is not nil
+func (es *ExportService) finish(ctx context.Context, job *models.ExportJob, err error) {
+	finishedAt := time.Now()
+	job.Status, job.FinishedAt = models.ExportCompleted, &finishedAt
+	if err != nil {
+		job.Status, job.Error = models.ExportFailed, err.Error()
+	}
+	// Recorded even when the export was interrupted by a shutdown
+	ctx = context.WithoutCancel(ctx)
+	if saveErr := es.exports.UpdateProgress(ctx, job); saveErr != nil {
+		slog.ErrorContext(ctx, "Failed to record export status", "export_id", job.ID, "error", saveErr)
+	}
+}
+
+// FailInterrupted marks the exports left pending or running by a previous run of the server as failed.
+// Pending tasks do not survive a restart.
+func (es *ExportService) FailInterrupted(ctx context.Context) error {
+	interrupted, err := es.exports.ListByStatus(database.Unscoped(ctx), models.ExportPending, models.ExportRunning)
+	if err != nil {
+		return err
+	}
+	for i := range interrupted {
+		job := &interrupted[i]
+		es.finish(database.WithOrganization(ctx, job.OrganizationID), job, errors.New("interrupted by a restart of the server, request the export again"))
+	}
+	return nil
+}
+
+// GetExport returns an export of the user with its progress
+func (es *ExportService) GetExport(ctx context.Context, jobID, userID uint) (*models.ExportJob, error) {
+	job, err := es.exports.Get(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, ErrExportNotFound
+	}
+	return job, nil
+}
+
+// OpenExport returns a completed export of the user and the content of its archive, decrypted
+func (es *ExportService) OpenExport(ctx context.Context, jobID, userID uint) (*models.ExportJob, io.ReadCloser, error) {
+	job, err := es.GetExport(ctx, jobID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case job.Status == models.ExportExpired,
+		job.Status == models.ExportCompleted && job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt):
+		return nil, nil, ErrExportExpired
+	case job.Status != models.ExportCompleted:
+		return nil, nil, fmt.Errorf("%w: %s", ErrExportNotReady, job.Status)
+	}
+	content, err := es.store.Open(ctx, job.URL, job.Encryption)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open export: %w", err)
+	}
+	return job, content, nil
+}
+
+// RunCleanup removes the archives of the expired exports, then looks for expired ones again every hour, until
+// ctx is cancelled
+func (es *ExportService) RunCleanup(ctx context.Context) {
+	for {
+		removed, err := es.RemoveExpired(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Export cleanup failed", "error", err)
+		} else if removed > 0 {
+			slog.InfoContext(ctx, "Expired exports removed", "count", removed)
+		}
+
+		timer := time.NewTimer(time.Hour)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// RemoveExpired removes the archives of the exports past their expiration, in every organization, and returns
+// how many were removed
+func (es *ExportService) RemoveExpired(ctx context.Context) (int, error) {
+	ctx = database.Unscoped(ctx)
+	expired, err := es.exports.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i := range expired {
+		job := &expired[i]
+		if err := es.store.Remove(ctx, job.URL); err != nil {
+			slog.WarnContext(ctx, "Failed to remove expired export", "export_id", job.ID, "error", err)
+			continue
+		}
+		job.Status, job.URL = models.ExportExpired, ""
+		if err := es.exports.UpdateProgress(ctx, job); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
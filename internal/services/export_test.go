@@ -0,0 +1,238 @@
+package services
+
+import (
+	"archiv-system/internal/archive"
+	"archiv-system/internal/models"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// readZip returns the content of the entries of a zip archive by name
+func readZip(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = content
+	}
+	return files
+}
+
+func manifestEntries(t *testing.T, files map[string][]byte) map[string]archive.ManifestEntry {
+	t.Helper()
+	var entries []archive.ManifestEntry
+	if err := json.Unmarshal(files[archive.ManifestJSON], &entries); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	byName := map[string]archive.ManifestEntry{}
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+	return byName
+}
+
+func documentNames(documents []models.Document) []string {
+	names := []string{}
+	for _, document := range documents {
+		names = append(names, document.Name)
+	}
+	return names
+}
+
+func TestExportSelection(t *testing.T) {
+	f := newFixture(t)
+	exports := f.services.Exports
+	notes := f.upload(f.alice, "notes.txt", "archived notes\n", "minutes")
+	infected := f.upload(f.alice, "invoice.txt", "invoice\n", "minutes")
+	f.setColumns(infected, map[string]interface{}{"scan_status": models.ScanInfected})
+	// Alice neither owns it nor holds a grant on it
+	private := f.upload(f.admin, "salaries.txt", "salaries\n", "minutes")
+
+	selection, err := exports.Select(f.ctx, f.alice.ID, ExportRequest{Query: &ExportQuery{Tags: []string{"minutes"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := documentNames(selection.Documents); len(names) != 1 || names[0] != "notes.txt" {
+		t.Fatalf("selected %v, want only the readable document out of quarantine", names)
+	}
+	if selection.Background || selection.Size != notes.Size {
+		t.Fatalf("selection of %d bytes in the background %v, want streamed", selection.Size, selection.Background)
+	}
+
+	// Documents asked for by ID must all be exportable
+	if _, err := exports.Select(f.ctx, f.alice.ID, ExportRequest{DocumentIDs: []uint{notes.ID, private.ID}}); !errors.Is(err, ErrExportForbidden) {
+		t.Fatalf("unreadable document: got %v, want ErrExportForbidden", err)
+	}
+	if _, err := exports.Select(f.ctx, f.alice.ID, ExportRequest{DocumentIDs: []uint{infected.ID}}); !errors.Is(err, ErrDocumentQuarantined) {
+		t.Fatalf("quarantined document: got %v, want ErrDocumentQuarantined", err)
+	}
+	if _, err := exports.Select(f.ctx, f.alice.ID, ExportRequest{DocumentIDs: []uint{notes.ID + 100}}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("missing document: got %v, want ErrDocumentNotFound", err)
+	}
+	if _, err := exports.Select(f.ctx, f.alice.ID, ExportRequest{Query: &ExportQuery{Tags: []string{"none"}}}); !errors.Is(err, ErrNothingToExport) {
+		t.Fatalf("empty selection: got %v, want ErrNothingToExport", err)
+	}
+}
+
+func TestExportStreamSizeCutoff(t *testing.T) {
+	f := newFixture(t)
+	cfg := f.cfg.Export
+	cfg.StreamSizeMB = 1
+	f.services.Exports.SetQueue(f.queue, cfg)
+
+	// Exports up to the limit are streamed, larger ones run in the background
+	f.upload(f.alice, "small.txt", "small\n", "small")
+	f.upload(f.alice, "limit.txt", strings.Repeat("a", int(cfg.StreamSize())), "limit")
+	f.upload(f.alice, "large.txt", strings.Repeat("a", int(cfg.StreamSize())+1), "large")
+	tests := map[string]bool{"small": false, "limit": false, "large": true}
+	for tag, background := range tests {
+		selection, err := f.services.Exports.Select(f.ctx, f.alice.ID, ExportRequest{Query: &ExportQuery{Tags: []string{tag}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selection.Background != background {
+			t.Errorf("%s export of %d bytes: background %v, want %v", tag, selection.Size, selection.Background, background)
+		}
+	}
+	selection, err := f.services.Exports.Select(f.ctx, f.alice.ID, ExportRequest{Query: &ExportQuery{Tags: []string{"small"}}, Background: true})
+	if err != nil || !selection.Background {
+		t.Fatalf("export asked in the background: %v", err)
+	}
+}
+
+func TestExportLeavesOutUnavailableDocuments(t *testing.T) {
+	f := newFixture(t)
+	notes := f.upload(f.alice, "notes.txt", "archived notes\n", "minutes")
+	missing := f.upload(f.alice, "missing.txt", "lost\n", "minutes")
+	recalled := f.upload(f.alice, "recalled.txt", "recalled\n", "minutes")
+	selection, err := f.services.Exports.Select(f.ctx, f.alice.ID, ExportRequest{Query: &ExportQuery{Tags: []string{"minutes"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.Documents) != 3 {
+		t.Fatalf("selected %v, want three documents", documentNames(selection.Documents))
+	}
+
+	// Between the selection and the writing, a file is lost and a document is sent back to quarantine
+	if err := os.Remove(missing.URL); err != nil {
+		t.Fatal(err)
+	}
+	f.setColumns(recalled, map[string]interface{}{"scan_status": models.ScanPending})
+
+	var out bytes.Buffer
+	if err := f.services.Exports.WriteArchive(f.ctx, &out, selection); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, out.Bytes())
+	if got := string(files["notes.txt"]); got != "archived notes\n" {
+		t.Errorf("notes.txt holds %q", got)
+	}
+	for _, name := range []string{"missing.txt", "recalled.txt"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("%s exported", name)
+		}
+	}
+
+	entries := manifestEntries(t, files)
+	if entry := entries["notes.txt"]; entry.Error != "" || entry.SHA256 != notes.SHA256 || entry.ID != notes.ID {
+		t.Errorf("manifest entry of notes.txt %+v", entry)
+	}
+	if got := entries["missing.txt"].Error; got != "file missing from the storage" {
+		t.Errorf("missing.txt reported as %q", got)
+	}
+	if got := entries["recalled.txt"].Error; got != ErrDocumentQuarantined.Error() {
+		t.Errorf("recalled.txt reported as %q", got)
+	}
+	// The reason never gives the location of the file in the storage
+	if strings.Contains(string(files[archive.ManifestJSON]), f.cfg.Storage.Path) {
+		t.Error("storage path written in the manifest")
+	}
+
+	// A bag is made for preservation, it fails instead of leaving documents out
+	selection.Format = models.ExportFormatBagIt
+	if err := f.services.Exports.WriteArchive(f.ctx, io.Discard, selection); err == nil {
+		t.Fatal("bag written without the missing document")
+	}
+}
+
+func TestUnavailableErrorReasons(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{ErrDocumentQuarantined, ErrDocumentQuarantined.Error()},
+		{ErrDocumentNotFound, ErrDocumentNotFound.Error()},
+		{&os.PathError{Op: "open", Path: "/srv/archives/default/1-secret.txt", Err: os.ErrNotExist}, "file missing from the storage"},
+		{&os.PathError{Op: "open", Path: "/srv/archives/default/1-secret.txt", Err: os.ErrPermission}, "file unreadable"},
+	}
+	for _, tt := range tests {
+		if got := (&unavailableError{tt.err}).Error(); got != tt.want {
+			t.Errorf("reason of %v: %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackgroundExport(t *testing.T) {
+	f := newFixture(t)
+	f.upload(f.alice, "notes.txt", "archived notes\n", "minutes")
+	quarantined := f.upload(f.alice, "letter.txt", "letter\n", "minutes")
+	selection, err := f.services.Exports.Select(f.ctx, f.alice.ID, ExportRequest{Query: &ExportQuery{Tags: []string{"minutes"}}, Background: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := f.services.Exports.StartExport(f.ctx, f.alice.ID, selection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.queue.Depth() != 1 {
+		t.Fatalf("%d queued tasks, want the export", f.queue.Depth())
+	}
+	if _, _, err := f.services.Exports.OpenExport(f.ctx, job.ID, f.alice.ID); !errors.Is(err, ErrExportNotReady) {
+		t.Fatalf("pending export: got %v, want ErrExportNotReady", err)
+	}
+
+	f.setColumns(quarantined, map[string]interface{}{"scan_status": models.ScanInfected})
+	if err := f.services.Exports.Run(f.ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.services.Exports.OpenExport(f.ctx, job.ID, f.admin.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Fatalf("export of another user: got %v, want ErrExportNotFound", err)
+	}
+	job, content, err := f.services.Exports.OpenExport(f.ctx, job.ID, f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if job.Status != models.ExportCompleted || job.Processed != 2 || job.Failed != 1 {
+		t.Fatalf("export %s, %d processed, %d failed, want completed with one document left out", job.Status, job.Processed, job.Failed)
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != job.Size {
+		t.Errorf("archive of %d bytes, %d recorded", len(data), job.Size)
+	}
+	entries := manifestEntries(t, readZip(t, data))
+	if entries["notes.txt"].Error != "" || entries["letter.txt"].Error != ErrDocumentQuarantined.Error() {
+		t.Errorf("manifest entries %+v", entries)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidFixityStatus is returned when filtering on an unknown fixity outcome
+var ErrInvalidFixityStatus = errors.New("invalid fixity status")
+
+// recentFixityEvents is the number of events returned with the fixity of a document
+const recentFixityEvents = 20
+
+// FixityReport is the outcome of the last fixity check of a document
+type FixityReport struct {
+	DocumentID uint                 `json:"document_id"`
+	Name       string               `json:"name"`
+	SHA256     string               `json:"sha256"`
+	SHA512     string               `json:"sha512,omitempty"`
+	Status     string               `json:"status"` // empty when never checked
+	CheckedAt  *time.Time           `json:"checked_at"`
+	Events     []models.FixityEvent `json:"events,omitempty"` // most recent first
+}
+
+// FixityService reports the checksums of the documents and the outcome of their fixity checks
+type FixityService struct {
+	documents repository.DocumentRepository
+	events    repository.FixityEventRepository
+}
+
+func NewFixityService(documents repository.DocumentRepository, events repository.FixityEventRepository) *FixityService {
+	return &FixityService{documents: documents, events: events}
+}
+
+// DocumentFixity returns the fixity of a document with its most recent events
+func (fs *FixityService) DocumentFixity(ctx context.Context, docID uint) (*FixityReport, error) {
+	document, err := fs.documents.Get(ctx, docID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	report := fixityReport(*document)
+	if report.Events, err = fs.events.ListByDocument(ctx, docID, recentFixityEvents); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListFixity returns a page of the fixity of the documents, optionally only those with a given outcome,
+// and the total number of matches
+func (fs *FixityService) ListFixity(ctx context.Context, status string, page, pageSize int) ([]FixityReport, int64, error) {
+	switch status {
+	case "", models.FixityOK, models.FixityMismatch, models.FixityMissing, models.FixityError:
+	default:
+		return nil, 0, fmt.Errorf("%w '%s'", ErrInvalidFixityStatus, status)
+	}
+
+	query := repository.DocumentQuery{FixityStatus: status}
+	total, err := fs.documents.CountMatching(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	documents, err := fs.documents.Find(ctx, query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reports := make([]FixityReport, 0, len(documents))
+	for _, document := range documents {
+		reports = append(reports, fixityReport(document))
+	}
+	return reports, total, nil
+}
+
+// ListEvents returns a page of the fixity events of the organization (failures and backfilled checksums),
+// most recent first
+func (fs *FixityService) ListEvents(ctx context.Context, page, pageSize int) ([]models.FixityEvent, int64, error) {
+	return fs.events.List(ctx, (page-1)*pageSize, pageSize)
+}
+
+func fixityReport(document models.Document) FixityReport {
+	return FixityReport{
+		DocumentID: document.ID,
+		Name:       document.Name,
+		SHA256:     document.SHA256,
+		SHA512:     document.SHA512,
+		Status:     document.FixityStatus,
+		CheckedAt:  document.FixityCheckedAt,
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrFolderNotFound  = errors.New("folder not found")
+	ErrFolderForbidden = errors.New("you cannot add content to this folder")
+	ErrFolderNotOwner  = errors.New("only the owner of the folder can change it")
+)
+
+// FolderService manages folders and the placement of documents in them
+type FolderService struct {
+	folders   repository.FolderRepository
+	documents repository.DocumentRepository
+	authz     *authz.Engine
+}
+
+func NewFolderService(folders repository.FolderRepository, documents repository.DocumentRepository, engine *authz.Engine) *FolderService {
+	return &FolderService{folders: folders, documents: documents, authz: engine}
+}
+
+// ListFolders returns the folders owned by the user or shared with them or their groups
+func (fs *FolderService) ListFolders(ctx context.Context, userID uint) ([]models.Folder, error) {
+	groupIDs, err := fs.authz.GroupIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return fs.folders.ListAccessible(ctx, userID, groupIDs)
+}
+
+// CreateFolder creates a folder, optionally inside a parent folder the user can write to, and optionally
+// accepting only some content types
+func (fs *FolderService) CreateFolder(ctx context.Context, name string, parentID *uint, allowedTypes []string, userID uint) (*models.Folder, error) {
+	patterns, err := filetype.ParsePatterns(allowedTypes)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if err := fs.checkWritable(ctx, *parentID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	folder := models.Folder{Name: name, ParentID: parentID, OwnerID: userID, AllowedUploadTypes: strings.Join(patterns, ",")}
+	if err := fs.folders.Create(ctx, &folder); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	return &folder, nil
+}
+
+// findOrCreateFolder returns the folder of the user with a name inside a parent folder (the root when parentID
+// is nil), creating it when missing. A new folder accepts the same content types as its parent.
+func (fs *FolderService) findOrCreateFolder(ctx context.Context, name string, parentID *uint, userID uint) (uint, error) {
+	folder, err := fs.folders.Find(ctx, userID, parentID, name)
+	if err == nil {
+		return folder.ID, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return 0, err
+	}
+
+	var allowedTypes []string
+	if parentID != nil {
+		parent, err := fs.getFolder(ctx, *parentID)
+		if err != nil {
+			return 0, err
+		}
+		allowedTypes = filetype.Split(parent.AllowedUploadTypes)
+	}
+	created, err := fs.CreateFolder(ctx, name, parentID, allowedTypes, userID)
+	if err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// MoveDocument puts a document in a folder, or at the root when folderID is nil
+func (fs *FolderService) MoveDocument(ctx context.Context, docID string, folderID *uint, userID uint) (*models.Document, error) {
+	id, err := strconv.ParseUint(docID, 10, 64)
+	if err != nil {
+		return nil, errors.New("document not found")
+	}
+	document, err := fs.documents.Get(ctx, uint(id))
+	if err != nil {
+		return nil, errors.New("document not found")
+	}
+	if folderID != nil {
+		if err := fs.checkUpload(ctx, *folderID, userID, document.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fs.documents.SetFolder(ctx, document, folderID); err != nil {
+		return nil, fmt.Errorf("failed to move document: %w", err)
+	}
+	return document, nil
+}
+
+// SetFolderUploadTypes restricts the content types accepted in a folder; an empty list lifts the restriction.
+// Documents already in the folder are kept.
+func (fs *FolderService) SetFolderUploadTypes(ctx context.Context, folderID uint, types []string, userID uint) (*models.Folder, error) {
+	patterns, err := filetype.ParsePatterns(types)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := fs.getFolder(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.OwnerID != userID {
+		return nil, ErrFolderNotOwner
+	}
+
+	if err := fs.folders.SetAllowedUploadTypes(ctx, folder, strings.Join(patterns, ",")); err != nil {
+		return nil, fmt.Errorf("failed to update folder: %w", err)
+	}
+	return folder, nil
+}
+
+func (fs *FolderService) getFolder(ctx context.Context, folderID uint) (*models.Folder, error) {
+	folder, err := fs.folders.Get(ctx, folderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+	return folder, nil
+}
+
+// checkUpload verifies that the user can add content to the folder and that the folder accepts the content type
+func (fs *FolderService) checkUpload(ctx context.Context, folderID, userID uint, contentType string) error {
+	if err := fs.checkWritable(ctx, folderID, userID); err != nil {
+		return err
+	}
+	folder, err := fs.getFolder(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	mediaType := filetype.Normalize(contentType)
+	if !filetype.Allowed(filetype.Split(folder.AllowedUploadTypes), mediaType) {
+		return fmt.Errorf("%w: the folder does not accept %s", ErrTypeNotAllowed, mediaType)
+	}
+	return nil
+}
+
+// checkWritable verifies that the user owns the folder or was granted upload_document on it or a parent
+func (fs *FolderService) checkWritable(ctx context.Context, folderID, userID uint) error {
+	allowed, err := fs.authz.Authorize(ctx, userID, "upload_document", authz.Folder(folderID))
+	if err != nil {
+		if errors.Is(err, authz.ErrResourceNotFound) {
+			return ErrFolderNotFound
+		}
+		return err
+	}
+	if !allowed {
+		return ErrFolderForbidden
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrGroupExists    = errors.New("a group with this name already exists")
+	ErrGrantNotFound  = errors.New("grant not found")
+	ErrInvalidGrant   = errors.New("a grant needs exactly one of document_id or folder_id and one of user_id or group_id")
+	ErrTargetNotFound = errors.New("document or folder not found")
+)
+
+// GrantInput describes a permission given on a document or folder to a user or group
+type GrantInput struct {
+	DocumentID *uint  `json:"document_id"`
+	FolderID   *uint  `json:"folder_id"`
+	UserID     *uint  `json:"user_id"`
+	GroupID    *uint  `json:"group_id"`
+	Permission string `json:"permission" binding:"required"`
+}
+
+// GroupService manages groups, their members and roles, and grants
+type GroupService struct {
+	groups    repository.GroupRepository
+	grants    repository.GrantRepository
+	documents repository.DocumentRepository
+	folders   repository.FolderRepository
+	users     repository.UserRepository
+	roles     repository.RoleRepository
+	authz     *authz.Engine
+}
+
+func NewGroupService(groups repository.GroupRepository, grants repository.GrantRepository, documents repository.DocumentRepository,
+	folders repository.FolderRepository, users repository.UserRepository, roles repository.RoleRepository,
+	engine *authz.Engine) *GroupService {
+	return &GroupService{groups: groups, grants: grants, documents: documents, folders: folders, users: users, roles: roles,
+		authz: engine}
+}
+
+// ListGroups returns every group with its members and roles
+func (gs *GroupService) ListGroups(ctx context.Context) ([]models.Group, error) {
+	return gs.groups.List(ctx)
+}
+
+// GetGroup loads a group with its members and roles
+func (gs *GroupService) GetGroup(ctx context.Context, groupID uint) (*models.Group, error) {
+	group, err := gs.groups.Get(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// CreateGroup creates an empty group
+func (gs *GroupService) CreateGroup(ctx context.Context, name string) (*models.Group, error) {
+	taken, err := gs.groups.NameTaken(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrGroupExists
+	}
+
+	group := models.Group{Name: name}
+	if err := gs.groups.Create(ctx, &group); err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+	return &group, nil
+}
+
+// DeleteGroup deletes a group, its memberships, role assignments and grants
+func (gs *GroupService) DeleteGroup(ctx context.Context, groupID uint) error {
+	group, err := gs.GetGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	err = gs.groups.Delete(ctx, group)
+	gs.authz.InvalidateUser(memberIDs(group)...)
+	return err
+}
+
+// AddMember adds a user to a group
+func (gs *GroupService) AddMember(ctx context.Context, groupID, userID uint) (*models.Group, error) {
+	group, err := gs.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := loadUser(ctx, gs.users, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gs.groups.AddMember(ctx, group, user); err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	gs.authz.InvalidateUser(userID)
+	return gs.GetGroup(ctx, groupID)
+}
+
+// RemoveMember removes a user from a group
+func (gs *GroupService) RemoveMember(ctx context.Context, groupID, userID uint) (*models.Group, error) {
+	group, err := gs.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gs.groups.RemoveMember(ctx, group, userID); err != nil {
+		return nil, fmt.Errorf("failed to remove member: %w", err)
+	}
+	gs.authz.InvalidateUser(userID)
+	return gs.GetGroup(ctx, groupID)
+}
+
+// AssignRole gives the permissions of a role to every member of the group
+func (gs *GroupService) AssignRole(ctx context.Context, groupID uint, roleName string) (*models.Group, error) {
+	group, err := gs.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := gs.roles.GetByName(ctx, roleName)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	if err := gs.groups.AddRole(ctx, group, role); err != nil {
+		return nil, fmt.Errorf("failed to assign role: %w", err)
+	}
+	gs.authz.InvalidateUser(memberIDs(group)...)
+	return gs.GetGroup(ctx, groupID)
+}
+
+// UnassignRole removes a role from a group
+func (gs *GroupService) UnassignRole(ctx context.Context, groupID, roleID uint) (*models.Group, error) {
+	group, err := gs.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gs.groups.RemoveRole(ctx, group, roleID); err != nil {
+		return nil, fmt.Errorf("failed to unassign role: %w", err)
+	}
+	gs.authz.InvalidateUser(memberIDs(group)...)
+	return gs.GetGroup(ctx, groupID)
+}
+
+// ListGrants returns the grants on a document or a folder, or every grant when neither is given
+func (gs *GroupService) ListGrants(ctx context.Context, documentID, folderID *uint) ([]models.Grant, error) {
+	return gs.grants.List(ctx, documentID, folderID)
+}
+
+// CreateGrant gives a permission on a document or folder to a user or group
+func (gs *GroupService) CreateGrant(ctx context.Context, input GrantInput) (*models.Grant, error) {
+	if (input.DocumentID == nil) == (input.FolderID == nil) || (input.UserID == nil) == (input.GroupID == nil) {
+		return nil, ErrInvalidGrant
+	}
+	if _, err := findPermissions(ctx, gs.roles, []string{input.Permission}); err != nil {
+		return nil, err
+	}
+
+	// Check that the target and the grantee exist
+	var err error
+	if input.DocumentID != nil {
+		_, err = gs.documents.Get(ctx, *input.DocumentID)
+	} else {
+		_, err = gs.folders.Get(ctx, *input.FolderID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTargetNotFound
+		}
+		return nil, err
+	}
+	if input.UserID != nil {
+		if _, err := loadUser(ctx, gs.users, *input.UserID); err != nil {
+			return nil, err
+		}
+	} else if _, err := gs.GetGroup(ctx, *input.GroupID); err != nil {
+		return nil, err
+	}
+
+	grant := models.Grant{
+		DocumentID: input.DocumentID,
+		FolderID:   input.FolderID,
+		UserID:     input.UserID,
+		GroupID:    input.GroupID,
+		Permission: input.Permission,
+	}
+	if err := gs.grants.Create(ctx, &grant); err != nil {
+		return nil, fmt.Errorf("failed to create grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// DeleteGrant revokes a grant
+func (gs *GroupService) DeleteGrant(ctx context.Context, grantID uint) error {
+	if err := gs.grants.Delete(ctx, grantID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrGrantNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func memberIDs(group *models.Group) []uint {
+	ids := make([]uint, 0, len(group.Users))
+	for _, user := range group.Users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
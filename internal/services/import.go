@@ -0,0 +1,410 @@
+package services
+
+import (
+	"archiv-system/internal/archive"
+	"archiv-system/internal/bagit"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrImportNotFound      = errors.New("import not found")
+	ErrImportUnavailable   = errors.New("bulk imports are not enabled")
+	ErrInvalidImportStatus = errors.New("invalid import entry status")
+)
+
+// ImportService imports the files of zip and tar archives as documents in the background, recreating their
+// directories as folders
+type ImportService struct {
+	imports      repository.ImportRepository
+	documents    *DocumentService
+	folders      *FolderService
+	preservation *PreservationService // packages the documents of the imports, the submission packages (SIP)
+	queue        *jobs.Queue
+	cfg          config.ImportConfig
+}
+
+func NewImportService(imports repository.ImportRepository, documents *DocumentService, folders *FolderService) *ImportService {
+	return &ImportService{imports: imports, documents: documents, folders: folders}
+}
+
+// SetQueue enables the imports on the queue, with the limits of the configuration
+func (is *ImportService) SetQueue(queue *jobs.Queue, cfg config.ImportConfig) {
+	is.queue, is.cfg = queue, cfg
+}
+
+// StartImport keeps a copy of the archive read from r and queues its import into a folder (the root when
+// folderID is nil). The documents belong to the user, each one being checked as an upload. A BagIt bag is only
+// imported when valid, its payload directory being the root of the import.
+func (is *ImportService) StartImport(ctx context.Context, userID uint, folderID *uint, filename string, bag bool, r io.Reader) (*models.ImportJob, error) {
+	if is.queue == nil {
+		return nil, ErrImportUnavailable
+	}
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return nil, database.ErrMissingTenant
+	}
+	if folderID != nil {
+		if err := is.folders.checkWritable(ctx, *folderID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	archivePath, format, err := is.saveArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	job := &models.ImportJob{
+		UserID:      userID,
+		FolderID:    folderID,
+		Filename:    sanitizeFilename(filename),
+		Format:      format,
+		Bag:         bag,
+		Status:      models.ImportPending,
+		ArchivePath: archivePath,
+	}
+	if err := is.imports.Create(ctx, job); err != nil {
+		os.Remove(archivePath)
+		return nil, fmt.Errorf("failed to create import: %w", err)
+	}
+
+	jobID := job.ID
+	if err := is.queue.Enqueue(func(ctx context.Context) error {
+		return is.Run(database.WithOrganization(ctx, organizationID), jobID)
+	}); err != nil {
+		os.Remove(archivePath)
+		is.finish(ctx, job, err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// saveArchive copies the archive to the temporary directory and returns its path and format
+func (is *ImportService) saveArchive(r io.Reader) (string, string, error) {
+	file, err := os.CreateTemp(is.cfg.TempDir, "archiv-import-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary archive: %w", err)
+	}
+	name := file.Name()
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+		return "", "", fmt.Errorf("failed to save archive: %w", err)
+	}
+	format, err := archive.DetectFormat(name)
+	if err != nil {
+		os.Remove(name)
+		return "", "", err
+	}
+	return name, format, nil
+}
+
+// Run imports the entries of an archive, recording the outcome of each one. An entry that fails does not stop
+// the import; an unreadable archive does.
+func (is *ImportService) Run(ctx context.Context, jobID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "services.RunImport", attribute.Int("import.id", int(jobID)))
+	defer func() { tracing.End(span, err) }()
+
+	job, err := is.imports.Get(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(job.ArchivePath)
+
+	startedAt := time.Now()
+	job.Status, job.StartedAt = models.ImportRunning, &startedAt
+	if err := is.imports.UpdateProgress(ctx, job); err != nil {
+		return err
+	}
+
+	err = is.importArchive(ctx, job)
+	is.finish(ctx, job, err)
+	span.SetAttributes(attribute.Int("import.imported", job.Imported), attribute.Int("import.failed", job.Failed))
+	if err != nil {
+		return fmt.Errorf("import %d failed: %w", job.ID, err)
+	}
+	is.preservation.PackageIngest(ctx, job)
+	return nil
+}
+
+func (is *ImportService) importArchive(ctx context.Context, job *models.ImportJob) error {
+	// First pass: count the files and read the manifest or, for a bag, validate it
+	var (
+		manifest archive.Manifest
+		prefix   string
+		err      error
+	)
+	if job.Bag {
+		manifest, prefix, err = is.validateBag(job)
+	} else {
+		manifest, err = is.readManifest(job)
+	}
+	if err != nil {
+		return err
+	}
+	if job.Total > is.cfg.MaxEntries {
+		return fmt.Errorf("the archive holds %d files, at most %d are accepted", job.Total, is.cfg.MaxEntries)
+	}
+	if err := is.imports.UpdateProgress(ctx, job); err != nil {
+		return err
+	}
+	return is.importEntries(ctx, job, manifest, prefix)
+}
+
+// readManifest counts the files of the archive and reads its manifest, wherever it is in the archive
+func (is *ImportService) readManifest(job *models.ImportJob) (archive.Manifest, error) {
+	var manifest archive.Manifest
+	err := archive.Walk(job.ArchivePath, func(entry archive.Entry) error {
+		if !archive.IsManifest(entry.Path) || !entry.Regular {
+			if !entry.Dir {
+				job.Total++
+			}
+			return nil
+		}
+		if manifest != nil {
+			return fmt.Errorf("%w: both %s and %s found", archive.ErrInvalidManifest, archive.ManifestCSV, archive.ManifestJSON)
+		}
+		content, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		manifest, err = archive.ParseManifest(content, entry.Path)
+		return err
+	})
+	return manifest, err
+}
+
+// validateBag verifies the checksums of a bag and returns the manifest of its documents, when it has one in
+// its metadata (as the BagIt exports do), and the path of its payload directory in the archive
+func (is *ImportService) validateBag(job *models.ImportJob) (archive.Manifest, string, error) {
+	bag, err := bagit.ValidateArchive(job.ArchivePath)
+	if err != nil {
+		return nil, "", err
+	}
+	job.Total = len(bag.Payload)
+
+	var manifest archive.Manifest
+	for _, name := range []string{archive.ManifestJSON, archive.ManifestCSV} {
+		content, ok := bag.TagFile(path.Join(bagMetadataDir, name))
+		if !ok {
+			continue
+		}
+		if manifest != nil {
+			return nil, "", fmt.Errorf("%w: both %s and %s found", archive.ErrInvalidManifest, archive.ManifestCSV, archive.ManifestJSON)
+		}
+		if manifest, err = archive.ParseManifest(bytes.NewReader(content), name); err != nil {
+			return nil, "", err
+		}
+	}
+	return manifest, bag.Root + bagit.PayloadDir + "/", nil
+}
+
+// importEntries imports the files of the archive, or only those under prefix with their path relative to it
+func (is *ImportService) importEntries(ctx context.Context, job *models.ImportJob, manifest archive.Manifest, prefix string) error {
+	// Second pass: import the files, creating the folders of their directories
+	folders := map[string]*uint{"": job.FolderID}
+	seen := make(map[string]bool)
+	err := archive.Walk(job.ArchivePath, func(entry archive.Entry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if prefix != "" {
+			// Tag files of a bag are not imported
+			rel, inPayload := strings.CutPrefix(entry.Path, prefix)
+			if !inPayload {
+				return nil
+			}
+			entry.Path = rel
+		} else if archive.IsManifest(entry.Path) {
+			return nil
+		}
+		if entry.Dir {
+			// Empty directories are kept too; when the folder cannot be created, the files inside report it
+			if _, err := is.folderOf(ctx, job, folders, entry.Path); err != nil {
+				slog.WarnContext(ctx, "Failed to create folder of import", "import_id", job.ID, "path", entry.Path, "error", err)
+			}
+			return nil
+		}
+		if !entry.Regular {
+			return is.recordEntry(ctx, job, &models.ImportEntry{Path: entry.Path, Status: models.ImportEntrySkipped, Error: "not a regular file"})
+		}
+
+		seen[entry.Path] = true
+		document, err := is.importEntry(ctx, job, folders, entry, manifest[entry.Path])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return is.recordEntry(ctx, job, &models.ImportEntry{Path: entry.Path, Status: models.ImportEntryFailed, Error: err.Error()})
+		}
+		return is.recordEntry(ctx, job, &models.ImportEntry{Path: entry.Path, Status: models.ImportEntryImported, DocumentID: &document.ID})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files of the manifest missing from the archive are reported, most likely a mistake in the manifest
+	missing := make([]string, 0)
+	for entryPath := range manifest {
+		if !seen[entryPath] {
+			missing = append(missing, entryPath)
+		}
+	}
+	sort.Strings(missing)
+	job.Total += len(missing)
+	for _, entryPath := range missing {
+		if err := is.recordEntry(ctx, job, &models.ImportEntry{
+			Path:   entryPath,
+			Status: models.ImportEntryFailed,
+			Error:  "listed in the manifest but not found in the archive",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importEntry uploads a file of the archive into the folder of its directory
+func (is *ImportService) importEntry(ctx context.Context, job *models.ImportJob, folders map[string]*uint,
+	entry archive.Entry, meta archive.ManifestEntry) (*models.Document, error) {
+	if limit := is.documents.uploadRules.MaxSize(); limit > 0 && entry.Size > limit {
+		return nil, fmt.Errorf("%w: files are limited to %d MB", ErrFileTooLarge, is.documents.uploadRules.MaxSizeMB)
+	}
+	folderID, err := is.folderOf(ctx, job, folders, path.Dir(entry.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	name := meta.Name
+	if name == "" {
+		name = path.Base(entry.Path)
+	}
+	return is.documents.ProcessFileUpload(ctx, UploadFileInput{
+		UserID: job.UserID,
+		File: &models.UploadedFile{
+			Filename:    name,
+			ContentType: meta.ContentType, // archives declare no type, only the manifest can
+			Size:        entry.Size,
+			Open:        entry.Open,
+		},
+		Tags:     &models.Tag{Name: strings.Join(meta.Tags, ",")},
+		FolderID: folderID,
+	})
+}
+
+// folderOf returns the folder of a directory of the archive, creating it and its parents when missing
+func (is *ImportService) folderOf(ctx context.Context, job *models.ImportJob, folders map[string]*uint, dir string) (*uint, error) {
+	if dir == "." {
+		dir = ""
+	}
+	if folderID, ok := folders[dir]; ok {
+		return folderID, nil
+	}
+	parentID, err := is.folderOf(ctx, job, folders, path.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	folderID, err := is.folders.findOrCreateFolder(ctx, path.Base(dir), parentID, job.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create folder %s: %w", dir, err)
+	}
+	folders[dir] = &folderID
+	return &folderID, nil
+}
+
+// recordEntry saves the outcome of an entry and the progress of its import
+func (is *ImportService) recordEntry(ctx context.Context, job *models.ImportJob, entry *models.ImportEntry) error {
+	entry.JobID = job.ID
+	if err := is.imports.CreateEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record import entry: %w", err)
+	}
+	switch entry.Status {
+	case models.ImportEntryImported:
+		job.Imported++
+	case models.ImportEntryFailed:
+		job.Failed++
+	case models.ImportEntrySkipped:
+		job.Skipped++
+	}
+	job.Processed++
+	return is.imports.UpdateProgress(ctx, job)
+}
+
+// finish records the end of an import, failed when err is not nil
+func (is *ImportService) finish(ctx context.Context, job *models.ImportJob, err error) {
+	finishedAt := time.Now()
+	job.Status, job.FinishedAt = models.ImportCompleted, &finishedAt
+	if err != nil {
+		job.Status, job.Error = models.ImportFailed, err.Error()
+	}
+	// Recorded even when the import was interrupted by a shutdown
+	ctx = context.WithoutCancel(ctx)
+	if saveErr := is.imports.UpdateProgress(ctx, job); saveErr != nil {
+		slog.ErrorContext(ctx, "Failed to record import status", "import_id", job.ID, "error", saveErr)
+	}
+}
+
+// FailInterrupted marks the imports left pending or running by a previous run of the server as failed, and
+// removes their archives. Pending tasks do not survive a restart.
+func (is *ImportService) FailInterrupted(ctx context.Context) error {
+	interrupted, err := is.imports.ListByStatus(database.Unscoped(ctx), models.ImportPending, models.ImportRunning)
+	if err != nil {
+		return err
+	}
+	for i := range interrupted {
+		job := &interrupted[i]
+		os.Remove(job.ArchivePath)
+		is.finish(database.WithOrganization(ctx, job.OrganizationID), job, errors.New("interrupted by a restart of the server, import the archive again"))
+	}
+	return nil
+}
+
+// GetImport returns an import of the user with its progress
+func (is *ImportService) GetImport(ctx context.Context, jobID, userID uint) (*models.ImportJob, error) {
+	job, err := is.imports.Get(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, ErrImportNotFound
+	}
+	return job, nil
+}
+
+// ListEntries returns a page of the entries of an import of the user, optionally only those with a status,
+// and the total number of matches
+func (is *ImportService) ListEntries(ctx context.Context, jobID, userID uint, status string, page, pageSize int) ([]models.ImportEntry, int64, error) {
+	if _, err := is.GetImport(ctx, jobID, userID); err != nil {
+		return nil, 0, err
+	}
+	switch status {
+	case "", models.ImportEntryImported, models.ImportEntryFailed, models.ImportEntrySkipped:
+	default:
+		return nil, 0, fmt.Errorf("%w '%s'", ErrInvalidImportStatus, status)
+	}
+	return is.imports.ListEntries(ctx, jobID, status, (page-1)*pageSize, pageSize)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"archiv-system/internal/models"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// zipEntry is an entry of a test archive: a directory when its name ends with a slash, a symbolic link when
+// link is set, a regular file otherwise
+type zipEntry struct {
+	name, content, link string
+}
+
+func zipArchive(t *testing.T, entries ...zipEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		content := entry.content
+		switch {
+		case strings.HasSuffix(entry.name, "/"):
+			header.SetMode(os.ModeDir | 0o755)
+		case entry.link != "":
+			header.SetMode(os.ModeSymlink | 0o777)
+			content = entry.link
+		default:
+			header.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// runImport imports an archive for alice and returns its job once finished, with its entries by path
+func (f *fixture) runImport(archive *bytes.Buffer) (*models.ImportJob, map[string]models.ImportEntry) {
+	f.t.Helper()
+	imports := f.services.Imports
+	job, err := imports.StartImport(f.ctx, f.alice.ID, nil, "archive.zip", false, archive)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	runErr := imports.Run(f.ctx, job.ID)
+	job, err = imports.GetImport(f.ctx, job.ID, f.alice.ID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if (runErr != nil) != (job.Status == models.ImportFailed) {
+		f.t.Fatalf("import %s, run error %v", job.Status, runErr)
+	}
+	list, _, err := imports.ListEntries(f.ctx, job.ID, f.alice.ID, "", 1, 100)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	entries := make(map[string]models.ImportEntry, len(list))
+	for _, entry := range list {
+		entries[entry.Path] = entry
+	}
+	return job, entries
+}
+
+func newImportFixture(t *testing.T) *fixture {
+	f := newFixture(t)
+	f.cfg.Import.TempDir = t.TempDir()
+	f.services.Imports.SetQueue(f.queue, f.cfg.Import)
+	upload := f.cfg.Upload
+	upload.MaxSizeMB = 1
+	f.services.Documents.SetUploadRules(upload)
+	return f
+}
+
+func TestImportArchive(t *testing.T) {
+	f := newImportFixture(t)
+	if _, err := f.services.Imports.StartImport(f.ctx, f.alice.ID, nil, "notes.txt", false, strings.NewReader("not an archive")); err == nil {
+		t.Fatal("import of a text file started")
+	}
+
+	// The manifest comes last: the first pass reads it before any file is imported
+	job, entries := f.runImport(zipArchive(t,
+		zipEntry{name: "reports/"},
+		zipEntry{name: "reports/2024/budget.csv", content: "year,amount\n2024,100\n"},
+		zipEntry{name: "minutes.txt", content: "minutes of the board\n"},
+		zipEntry{name: "scans/large.txt", content: strings.Repeat("a", 1<<20+1)},
+		zipEntry{name: "reports/latest", link: "2024/budget.csv"},
+		zipEntry{name: "empty/"},
+		zipEntry{name: "manifest.csv", content: "path,name,tags\n" +
+			"reports/2024/budget.csv,Budget 2024,\"finance,2024\"\n" +
+			"minutes.txt,,board\n" +
+			"reports/2023/budget.csv,,finance\n"},
+	))
+	if job.Status != models.ImportCompleted || job.Error != "" {
+		t.Fatalf("import %s: %s", job.Status, job.Error)
+	}
+	if job.Total != 5 || job.Processed != 5 || job.Imported != 2 || job.Failed != 2 || job.Skipped != 1 {
+		t.Fatalf("import of %d entries: %d processed, %d imported, %d failed, %d skipped",
+			job.Total, job.Processed, job.Imported, job.Failed, job.Skipped)
+	}
+
+	// Each entry reports its outcome
+	want := map[string]struct{ status, error string }{
+		"reports/2024/budget.csv": {models.ImportEntryImported, ""},
+		"minutes.txt":             {models.ImportEntryImported, ""},
+		"scans/large.txt":         {models.ImportEntryFailed, "files are limited to 1 MB"},
+		"reports/latest":          {models.ImportEntrySkipped, "not a regular file"},
+		"reports/2023/budget.csv": {models.ImportEntryFailed, "listed in the manifest but not found in the archive"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries recorded, want %d", len(entries), len(want))
+	}
+	for entryPath, want := range want {
+		entry := entries[entryPath]
+		if entry.Status != want.status || !strings.Contains(entry.Error, want.error) || (entry.DocumentID != nil) != (want.status == models.ImportEntryImported) {
+			t.Errorf("%s: %+v, want %s %q", entryPath, entry, want.status, want.error)
+		}
+	}
+	failed, total, err := f.services.Imports.ListEntries(f.ctx, job.ID, f.alice.ID, models.ImportEntryFailed, 1, 10)
+	if err != nil || total != 2 || len(failed) != 2 {
+		t.Fatalf("%d failed entries: %v", total, err)
+	}
+	if _, _, err := f.services.Imports.ListEntries(f.ctx, job.ID, f.alice.ID, "lost", 1, 10); !errors.Is(err, ErrInvalidImportStatus) {
+		t.Fatalf("unknown status: got %v, want ErrInvalidImportStatus", err)
+	}
+	if _, err := f.services.Imports.GetImport(f.ctx, job.ID, f.admin.ID); !errors.Is(err, ErrImportNotFound) {
+		t.Fatalf("import of another user: got %v, want ErrImportNotFound", err)
+	}
+
+	// The manifest names and tags the documents, the directories become folders
+	budget, err := f.services.Documents.GetDocument(f.ctx, *entries["reports/2024/budget.csv"].DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, tag := range *budget.Tags {
+		tags = append(tags, tag.Name)
+	}
+	if budget.Name != "Budget 2024" || budget.OwnerID != f.alice.ID || strings.Join(tags, ",") != "finance,2024" {
+		t.Errorf("budget %s of %d tagged %v", budget.Name, budget.OwnerID, tags)
+	}
+	reports, err := f.repos.Folders.Find(f.ctx, f.alice.ID, nil, "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	year, err := f.repos.Folders.Find(f.ctx, f.alice.ID, &reports.ID, "2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.FolderID == nil || *budget.FolderID != year.ID {
+		t.Errorf("budget in folder %v, want reports/2024 (%d)", budget.FolderID, year.ID)
+	}
+	if _, err := f.repos.Folders.Find(f.ctx, f.alice.ID, nil, "empty"); err != nil {
+		t.Errorf("empty directory: %v", err)
+	}
+	minutes, err := f.services.Documents.GetDocument(f.ctx, *entries["minutes.txt"].DocumentID)
+	if err != nil || minutes.Name != "minutes.txt" || minutes.FolderID != nil {
+		t.Errorf("minutes %+v: %v", minutes, err)
+	}
+	if _, err := os.Stat(job.ArchivePath); !os.IsNotExist(err) {
+		t.Errorf("archive kept after its import: %v", err)
+	}
+}
+
+func TestImportStopsBeforeImporting(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) *bytes.Buffer
+		want    string
+	}{
+		{"too many files", func(t *testing.T) *bytes.Buffer {
+			return zipArchive(t, zipEntry{name: "a.txt", content: "a"}, zipEntry{name: "b.txt", content: "b"}, zipEntry{name: "c.txt", content: "c"})
+		}, "the archive holds 3 files, at most 2 are accepted"},
+		{"invalid manifest", func(t *testing.T) *bytes.Buffer {
+			return zipArchive(t, zipEntry{name: "a.txt", content: "a"}, zipEntry{name: "manifest.json", content: `[{"path": "../a.txt"}]`})
+		}, "invalid manifest: entry 1: invalid path '../a.txt'"},
+		{"two manifests", func(t *testing.T) *bytes.Buffer {
+			return zipArchive(t, zipEntry{name: "a.txt", content: "a"}, zipEntry{name: "manifest.csv", content: "path\na.txt\n"},
+				zipEntry{name: "manifest.json", content: `[{"path": "a.txt"}]`})
+		}, "invalid manifest: both manifest.csv and manifest.json found"},
+		{"path leaving the archive", func(t *testing.T) *bytes.Buffer {
+			return zipArchive(t, zipEntry{name: "a.txt", content: "a"}, zipEntry{name: "../../etc/cron.d/job", content: "* * * * * root true"})
+		}, "entry path leaves the archive: ../../etc/cron.d/job"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newImportFixture(t)
+			f.cfg.Import.MaxEntries = 2
+			f.services.Imports.SetQueue(f.queue, f.cfg.Import)
+			job, entries := f.runImport(tt.archive(t))
+			if job.Status != models.ImportFailed || job.Error != tt.want {
+				t.Fatalf("import %s: %q, want failed with %q", job.Status, job.Error, tt.want)
+			}
+			// The first pass found the problem: no file was imported
+			if job.Processed != 0 || len(entries) != 0 {
+				t.Fatalf("%d entries processed", job.Processed)
+			}
+			documents, err := f.services.Documents.ListUserDocuments(f.ctx, f.alice.ID)
+			if err != nil || len(documents) != 0 {
+				t.Fatalf("%d documents imported: %v", len(documents), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationExists   = errors.New("an organization with this name or slug already exists")
+	ErrOrganizationNotEmpty = errors.New("organization still has users or documents")
+	ErrInvalidSlug          = errors.New("slug must contain only lowercase letters, digits and dashes")
+	ErrUsernameTaken        = errors.New("username already taken")
+	ErrDefaultOrganization  = errors.New("the default organization cannot be deleted")
+)
+
+// slugPattern keeps slugs safe to use as a storage prefix
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// OrganizationInput describes a new organization and its first administrator
+type OrganizationInput struct {
+	Name              string `json:"name" binding:"required"`
+	Slug              string `json:"slug" binding:"required"`
+	AllowRegistration bool   `json:"allow_registration"`
+	AdminUsername     string `json:"admin_username" binding:"required"`
+	AdminPassword     string `json:"admin_password" binding:"required"`
+}
+
+// OrganizationSummary adds usage counters to an organization
+type OrganizationSummary struct {
+	models.Organization
+	UserCount     int64 `json:"user_count"`
+	DocumentCount int64 `json:"document_count"`
+}
+
+// OrganizationService manages tenants. Its methods expect an unscoped context (super-admin endpoints).
+type OrganizationService struct {
+	organizations repository.OrganizationRepository
+	users         repository.UserRepository
+	authz         *authz.Engine
+	policy        auth.PasswordPolicy
+}
+
+func NewOrganizationService(organizations repository.OrganizationRepository, users repository.UserRepository,
+	engine *authz.Engine, policy auth.PasswordPolicy) *OrganizationService {
+	return &OrganizationService{organizations: organizations, users: users, authz: engine, policy: policy}
+}
+
+// ListOrganizations returns every organization with its user and document counts
+func (orgs *OrganizationService) ListOrganizations(ctx context.Context) ([]OrganizationSummary, error) {
+	organizations, err := orgs.organizations.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]OrganizationSummary, 0, len(organizations))
+	for _, organization := range organizations {
+		summary := OrganizationSummary{Organization: organization}
+		summary.UserCount, summary.DocumentCount, err = orgs.organizations.Usage(ctx, organization.ID)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// CreateOrganization creates an organization, seeds its roles and creates its first administrator
+func (orgs *OrganizationService) CreateOrganization(ctx context.Context, input OrganizationInput) (*models.Organization, error) {
+	if !slugPattern.MatchString(input.Slug) {
+		return nil, ErrInvalidSlug
+	}
+
+	taken, err := orgs.organizations.Taken(ctx, input.Name, input.Slug, 0)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrOrganizationExists
+	}
+	if taken, err = orgs.users.UsernameTaken(ctx, input.AdminUsername); err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrUsernameTaken
+	}
+	if err := orgs.policy.Validate(input.AdminUsername, input.AdminPassword); err != nil {
+		return nil, err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.AdminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	organization := models.Organization{
+		Name:              input.Name,
+		Slug:              input.Slug,
+		AllowRegistration: input.AllowRegistration,
+	}
+	admin := models.User{
+		Username: input.AdminUsername,
+		Password: string(hashed),
+	}
+	if err := orgs.organizations.Create(ctx, &organization, &admin, AdminRoleName); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// UpdateOrganization renames an organization and opens or closes public registration.
+// The slug cannot change since it prefixes the stored files.
+func (orgs *OrganizationService) UpdateOrganization(ctx context.Context, organizationID uint, name string, allowRegistration bool) (*models.Organization, error) {
+	organization, err := orgs.loadOrganization(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := orgs.organizations.Taken(ctx, name, "", organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrOrganizationExists
+	}
+
+	if err := orgs.organizations.Update(ctx, organization, map[string]interface{}{
+		"name":               name,
+		"allow_registration": allowRegistration,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+	return orgs.loadOrganization(ctx, organizationID)
+}
+
+// DeleteOrganization deletes an organization that no longer has users or documents
+func (orgs *OrganizationService) DeleteOrganization(ctx context.Context, organizationID uint) error {
+	organization, err := orgs.loadOrganization(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+	if organization.Slug == database.DefaultOrganizationSlug {
+		return ErrDefaultOrganization
+	}
+
+	users, documents, err := orgs.organizations.Usage(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+	if users > 0 || documents > 0 {
+		return ErrOrganizationNotEmpty
+	}
+
+	defer orgs.authz.InvalidateAll()
+	return orgs.organizations.Delete(ctx, organization)
+}
+
+func (orgs *OrganizationService) loadOrganization(ctx context.Context, organizationID uint) (*models.Organization, error) {
+	organization, err := orgs.organizations.Get(ctx, organizationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return organization, nil
+}
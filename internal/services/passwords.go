@@ -0,0 +1,225 @@
+package services
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/models"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordReused    = errors.New("this password was used recently, choose another one")
+	ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+)
+
+// resetTokenTTL is the lifetime of a password reset token
+const resetTokenTTL = time.Hour
+
+// PasswordService handles self-service password resets
+type PasswordService struct {
+	tokens   repository.ResetTokenRepository
+	users    repository.UserRepository
+	policy   auth.PasswordPolicy
+	notifier notify.Notifier // delivers the reset links
+	queue    *jobs.Queue
+	resetURL string
+}
+
+func NewPasswordService(tokens repository.ResetTokenRepository, users repository.UserRepository, policy auth.PasswordPolicy,
+	notifier notify.Notifier) *PasswordService {
+	return &PasswordService{tokens: tokens, users: users, policy: policy, notifier: notifier}
+}
+
+// SetResetURL makes the reset messages link to a front-end page, {token} in url being replaced by the token.
+// Without it, the raw token is sent.
+func (ps *PasswordService) SetResetURL(url string) {
+	ps.resetURL = url
+}
+
+// SetQueue makes reset requests send their link on the queue. Without queue, they are handled in the request.
+func (ps *PasswordService) SetQueue(queue *jobs.Queue) {
+	ps.queue = queue
+}
+
+// RequestReset creates a single-use reset token for a local account and sends it through the notifier.
+// Unknown users, directory accounts and accounts without e-mail are ignored so that the caller cannot
+// tell which usernames exist; the work is done in the background, for the response time not to tell either.
+func (ps *PasswordService) RequestReset(ctx context.Context, username string) error {
+	if ps.queue == nil {
+		return ps.sendReset(ctx, username)
+	}
+	return ps.queue.Enqueue(func(ctx context.Context) error {
+		return ps.sendReset(ctx, username)
+	})
+}
+
+// sendReset creates the reset token of a user and sends it
+func (ps *PasswordService) sendReset(ctx context.Context, username string) error {
+	user, err := ps.users.GetByUsername(database.Unscoped(ctx), username)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.AuthSource != models.AuthSourceLocal || user.Disabled || user.Email == "" {
+		slog.InfoContext(ctx, "Password reset requested for a user who cannot receive a reset link", "user_id", user.ID)
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	// Only the latest token stays usable
+	err = ps.tokens.Replace(database.WithOrganization(ctx, user.OrganizationID), &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(resetTokenTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	return ps.notifier.Notify(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body:    ps.resetMessage(user.Username, token),
+	})
+}
+
+// ResetWithToken sets a new password with a reset token, which can only be used once.
+// A successful reset also lifts a login lockout.
+func (ps *PasswordService) ResetWithToken(ctx context.Context, token, newPassword string) error {
+	resetToken, err := ps.tokens.GetByHash(database.Unscoped(ctx), hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := ps.users.Get(database.Unscoped(ctx), resetToken.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if user.AuthSource != models.AuthSourceLocal || user.Disabled {
+		return ErrInvalidResetToken
+	}
+
+	userCtx := database.WithOrganization(ctx, user.OrganizationID)
+
+	// A rejected password must not consume the token
+	if err := validatePassword(userCtx, ps.users, ps.policy, user, newPassword); err != nil {
+		return err
+	}
+
+	// Consuming the token first makes a concurrent second use fail
+	consumed, err := ps.tokens.Consume(userCtx, resetToken.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidResetToken
+	}
+
+	if err := setPassword(userCtx, ps.users, ps.policy, user, newPassword, false); err != nil {
+		return err
+	}
+	return ps.users.Update(userCtx, user, map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	})
+}
+
+// setPassword validates a new password against the policy and the password history, then stores it.
+// The replaced hash is kept in the history.
+func setPassword(ctx context.Context, users repository.UserRepository, policy auth.PasswordPolicy, user *models.User,
+	password string, mustChange bool) error {
+	if err := validatePassword(ctx, users, policy, user, password); err != nil {
+		return err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	return storePassword(ctx, users, policy, user, string(hashed), mustChange)
+}
+
+// validatePassword checks a new password against the policy and the password history
+func validatePassword(ctx context.Context, users repository.UserRepository, policy auth.PasswordPolicy, user *models.User, password string) error {
+	if err := policy.Validate(user.Username, password); err != nil {
+		return err
+	}
+	return checkPasswordReuse(ctx, users, policy, user, password)
+}
+
+// checkPasswordReuse fails when the password matches the current one or one of the remembered ones
+func checkPasswordReuse(ctx context.Context, users repository.UserRepository, policy auth.PasswordPolicy, user *models.User, password string) error {
+	history := policy.History
+	if history == 0 {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return ErrPasswordReused
+	}
+
+	previous, err := users.PasswordHistory(ctx, user.ID, history)
+	if err != nil {
+		return err
+	}
+	for _, hash := range previous {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// storePassword replaces the password hash, moves the previous one to the history and trims it
+func storePassword(ctx context.Context, users repository.UserRepository, policy auth.PasswordPolicy, user *models.User,
+	hashed string, mustChange bool) error {
+	if err := users.SetPassword(ctx, user, hashed, mustChange, policy.History); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// resetMessage builds the body of the reset notification, with a link to the reset page when one is set
+func (ps *PasswordService) resetMessage(username, token string) string {
+	instructions := "Use this token to choose a new password: " + token
+	if ps.resetURL != "" {
+		instructions = "Open this link to choose a new password: " + strings.ReplaceAll(ps.resetURL, "{token}", token)
+	}
+	return fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account.\n%s\n\n"+
+		"The token expires in %s and can only be used once. If you did not request it, ignore this message.\n",
+		username, instructions, resetTokenTTL)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/config"
+	"archiv-system/internal/models"
+	"archiv-system/internal/notify"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recordingNotifier keeps the messages sent instead of delivering them
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notify.Message
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+var resetTokenPattern = regexp.MustCompile(`choose a new password: (\S+)`)
+
+// passwordFixture holds a password service remembering two previous passwords, and a local user "bob" whose
+// password is "initial passphrase"
+type passwordFixture struct {
+	*fixture
+	passwords *PasswordService
+	notifier  *recordingNotifier
+	bob       *models.User
+}
+
+func newPasswordFixture(t *testing.T) *passwordFixture {
+	f := newFixture(t)
+	policy, err := auth.NewPasswordPolicy(config.PasswordConfig{MinLength: 12, History: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf := &passwordFixture{fixture: f, notifier: &recordingNotifier{}}
+	pf.passwords = NewPasswordService(f.repos.ResetTokens, f.repos.Users, policy, pf.notifier)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("initial passphrase"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, err := f.repos.Roles.GetByName(f.ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf.bob = &models.User{Username: "bob", Password: string(hashed), Email: "bob@example.org", RoleID: role.ID}
+	if err := f.repos.Users.Create(f.ctx, pf.bob); err != nil {
+		t.Fatal(err)
+	}
+	return pf
+}
+
+// requestToken asks for a reset of the user and returns the token sent
+func (pf *passwordFixture) requestToken(username string) string {
+	pf.t.Helper()
+	sent := len(pf.notifier.messages)
+	if err := pf.passwords.RequestReset(pf.ctx, username); err != nil {
+		pf.t.Fatal(err)
+	}
+	if len(pf.notifier.messages) != sent+1 {
+		pf.t.Fatalf("%d messages sent for %s", len(pf.notifier.messages)-sent, username)
+	}
+	match := resetTokenPattern.FindStringSubmatch(pf.notifier.messages[sent].Body)
+	if match == nil {
+		pf.t.Fatalf("no token in %q", pf.notifier.messages[sent].Body)
+	}
+	return match[1]
+}
+
+// password reports whether the stored password of bob is the given one
+func (pf *passwordFixture) password(password string) bool {
+	pf.t.Helper()
+	user, err := pf.repos.Users.Get(pf.ctx, pf.bob.ID)
+	if err != nil {
+		pf.t.Fatal(err)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+}
+
+func TestResetRequests(t *testing.T) {
+	pf := newPasswordFixture(t)
+	ldap := &models.User{Username: "carol", Email: "carol@example.org", AuthSource: models.AuthSourceLDAP, RoleID: pf.bob.RoleID}
+	if err := pf.repos.Users.Create(pf.ctx, ldap); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown users, directory accounts and accounts without e-mail get nothing, without the caller knowing it
+	for _, username := range []string{"nobody", "carol", "alice"} {
+		if err := pf.passwords.RequestReset(pf.ctx, username); err != nil {
+			t.Fatalf("%s: %v", username, err)
+		}
+	}
+	if len(pf.notifier.messages) != 0 {
+		t.Fatalf("messages sent %+v", pf.notifier.messages)
+	}
+
+	pf.requestToken("bob")
+	message := pf.notifier.messages[0]
+	if message.To != "bob@example.org" || !strings.Contains(message.Body, "expires in 1h0m0s and can only be used once") {
+		t.Fatalf("message %+v", message)
+	}
+	pf.passwords.SetResetURL("https://archives.example.org/reset?token={token}")
+	if err := pf.passwords.RequestReset(pf.ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if body := pf.notifier.messages[1].Body; !regexp.MustCompile(`https://archives\.example\.org/reset\?token=\S+\n`).MatchString(body) {
+		t.Fatalf("reset link missing from %q", body)
+	}
+}
+
+func TestResetWithToken(t *testing.T) {
+	pf := newPasswordFixture(t)
+	lockedUntil := time.Now().Add(time.Hour)
+	if err := pf.repos.Users.Update(pf.ctx, pf.bob, map[string]interface{}{"failed_logins": 5, "locked_until": &lockedUntil}); err != nil {
+		t.Fatal(err)
+	}
+	first := pf.requestToken("bob")
+	token := pf.requestToken("bob")
+
+	// Only the latest token is usable
+	if err := pf.passwords.ResetWithToken(pf.ctx, first, "a new passphrase"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("replaced token: got %v, want ErrInvalidResetToken", err)
+	}
+	if err := pf.passwords.ResetWithToken(pf.ctx, "made-up-token", "a new passphrase"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("unknown token: got %v, want ErrInvalidResetToken", err)
+	}
+
+	// A rejected password does not consume the token
+	if err := pf.passwords.ResetWithToken(pf.ctx, token, "too short"); !errors.Is(err, auth.ErrWeakPassword) {
+		t.Fatalf("weak password: got %v, want ErrWeakPassword", err)
+	}
+	if err := pf.passwords.ResetWithToken(pf.ctx, token, "initial passphrase"); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("current password: got %v, want ErrPasswordReused", err)
+	}
+	if !pf.password("initial passphrase") {
+		t.Fatal("password changed by a rejected reset")
+	}
+	if err := pf.passwords.ResetWithToken(pf.ctx, token, "a new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if !pf.password("a new passphrase") {
+		t.Fatal("password not changed")
+	}
+	user, err := pf.repos.Users.Get(pf.ctx, pf.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FailedLogins != 0 || user.LockedUntil != nil {
+		t.Errorf("lockout kept after the reset: %d failures, locked until %v", user.FailedLogins, user.LockedUntil)
+	}
+
+	// The token is single-use
+	if err := pf.passwords.ResetWithToken(pf.ctx, token, "another new passphrase"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("used token: got %v, want ErrInvalidResetToken", err)
+	}
+	if !pf.password("a new passphrase") {
+		t.Fatal("password changed by a used token")
+	}
+}
+
+func TestResetWithExpiredToken(t *testing.T) {
+	pf := newPasswordFixture(t)
+	if err := pf.repos.ResetTokens.Replace(pf.ctx, &models.PasswordResetToken{
+		UserID:    pf.bob.ID,
+		TokenHash: hashToken("expired-token"),
+		ExpiresAt: time.Now().Add(-time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pf.passwords.ResetWithToken(pf.ctx, "expired-token", "a new passphrase"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expired token: got %v, want ErrInvalidResetToken", err)
+	}
+
+	// A token of an account disabled since its request is refused too
+	token := pf.requestToken("bob")
+	if err := pf.repos.Users.Update(pf.ctx, pf.bob, map[string]interface{}{"disabled": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pf.passwords.ResetWithToken(pf.ctx, token, "a new passphrase"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("disabled account: got %v, want ErrInvalidResetToken", err)
+	}
+	if !pf.password("initial passphrase") {
+		t.Fatal("password changed")
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	pf := newPasswordFixture(t)
+	reset := func(password string) error {
+		return pf.passwords.ResetWithToken(pf.ctx, pf.requestToken("bob"), password)
+	}
+	for _, password := range []string{"first passphrase", "second passphrase", "third passphrase"} {
+		if err := reset(password); err != nil {
+			t.Fatalf("%s: %v", password, err)
+		}
+	}
+
+	// The current password and the two previous ones cannot be reused, older ones can
+	for _, password := range []string{"third passphrase", "second passphrase", "first passphrase"} {
+		if err := reset(password); !errors.Is(err, ErrPasswordReused) {
+			t.Errorf("%s: got %v, want ErrPasswordReused", password, err)
+		}
+	}
+	if err := reset("initial passphrase"); err != nil {
+		t.Fatalf("password older than the history: %v", err)
+	}
+	if !pf.password("initial passphrase") {
+		t.Fatal("password not changed")
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrPolicyExists   = errors.New("a policy with this name already exists")
+	ErrInvalidPolicy  = errors.New("invalid policy")
+)
+
+// PolicyInput describes an attribute-based policy written by an administrator
+type PolicyInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Permission  string `json:"permission" binding:"required"` // permission name, or "*" for every permission
+	Effect      string `json:"effect" binding:"required"`     // "allow" or "deny"
+	Condition   string `json:"condition" binding:"required"`
+	Enabled     *bool  `json:"enabled"` // defaults to true
+	DryRun      bool   `json:"dry_run"`
+}
+
+// PolicyService manages the attribute-based policies of the organization
+type PolicyService struct {
+	policies repository.PolicyRepository
+	roles    repository.RoleRepository
+	authz    *authz.Engine
+}
+
+func NewPolicyService(policies repository.PolicyRepository, roles repository.RoleRepository, engine *authz.Engine) *PolicyService {
+	return &PolicyService{policies: policies, roles: roles, authz: engine}
+}
+
+// ListPolicies returns the policies of the organization
+func (ps *PolicyService) ListPolicies(ctx context.Context) ([]models.Policy, error) {
+	return ps.policies.List(ctx)
+}
+
+// CreatePolicy validates and stores a new policy
+func (ps *PolicyService) CreatePolicy(ctx context.Context, input PolicyInput) (*models.Policy, error) {
+	if err := ps.validatePolicy(ctx, input); err != nil {
+		return nil, err
+	}
+	if err := ps.ensurePolicyNameFree(ctx, input.Name, 0); err != nil {
+		return nil, err
+	}
+
+	policy := models.Policy{}
+	applyPolicyInput(&policy, input)
+	if err := ps.policies.Create(ctx, &policy); err != nil {
+		return nil, fmt.Errorf("failed to create policy: %w", err)
+	}
+	ps.authz.InvalidatePolicies(policy.OrganizationID)
+	return &policy, nil
+}
+
+// UpdatePolicy replaces the definition of a policy
+func (ps *PolicyService) UpdatePolicy(ctx context.Context, policyID uint, input PolicyInput) (*models.Policy, error) {
+	policy, err := ps.loadPolicy(ctx, policyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.validatePolicy(ctx, input); err != nil {
+		return nil, err
+	}
+	if err := ps.ensurePolicyNameFree(ctx, input.Name, policyID); err != nil {
+		return nil, err
+	}
+
+	applyPolicyInput(policy, input)
+	if err := ps.policies.Update(ctx, policy); err != nil {
+		return nil, fmt.Errorf("failed to update policy: %w", err)
+	}
+	ps.authz.InvalidatePolicies(policy.OrganizationID)
+	return policy, nil
+}
+
+// DeletePolicy deletes a policy
+func (ps *PolicyService) DeletePolicy(ctx context.Context, policyID uint) error {
+	policy, err := ps.loadPolicy(ctx, policyID)
+	if err != nil {
+		return err
+	}
+	if err := ps.policies.Delete(ctx, policy); err != nil {
+		return fmt.Errorf("failed to delete policy: %w", err)
+	}
+	ps.authz.InvalidatePolicies(policy.OrganizationID)
+	return nil
+}
+
+// validatePolicy checks the effect, the permission and compiles the condition
+func (ps *PolicyService) validatePolicy(ctx context.Context, input PolicyInput) error {
+	if input.Effect != models.PolicyAllow && input.Effect != models.PolicyDeny {
+		return fmt.Errorf("%w: effect must be '%s' or '%s'", ErrInvalidPolicy, models.PolicyAllow, models.PolicyDeny)
+	}
+	if input.Permission != "*" {
+		if _, err := findPermissions(ctx, ps.roles, []string{input.Permission}); err != nil {
+			return err
+		}
+	}
+	if _, err := authz.CompileCondition(input.Condition); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return nil
+}
+
+func applyPolicyInput(policy *models.Policy, input PolicyInput) {
+	policy.Name = input.Name
+	policy.Description = input.Description
+	policy.Permission = input.Permission
+	policy.Effect = input.Effect
+	policy.Condition = input.Condition
+	policy.Enabled = input.Enabled == nil || *input.Enabled
+	policy.DryRun = input.DryRun
+}
+
+func (ps *PolicyService) ensurePolicyNameFree(ctx context.Context, name string, exceptID uint) error {
+	taken, err := ps.policies.NameTaken(ctx, name, exceptID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrPolicyExists
+	}
+	return nil
+}
+
+func (ps *PolicyService) loadPolicy(ctx context.Context, policyID uint) (*models.Policy, error) {
+	policy, err := ps.policies.Get(ctx, policyID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, err
+	}
+	return policy, nil
+}
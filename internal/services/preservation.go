@@ -0,0 +1,767 @@
+package services
+
+import (
+	"archiv-system/internal/archive"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/models"
+	"archiv-system/internal/oais"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrPackageNotFound         = errors.New("archival package not found")
+	ErrPreservationUnavailable = errors.New("archival packages are not enabled")
+	ErrInvalidPackage          = errors.New("invalid archival package request")
+	ErrPackageTooLarge         = errors.New("too many documents to package at once")
+	ErrNothingToPackage        = errors.New("no document to package")
+	ErrPackageNotReady         = errors.New("archival package is not ready for download")
+)
+
+// PackageDir is the directory of an organization holding its archival packages
+const PackageDir = "packages"
+
+// scanPollInterval is how often a package waiting for the scans of its documents looks at them again
+const scanPollInterval = 10 * time.Second
+
+// systemAgent is the PREMIS agent of the events performed by the archive itself
+var systemAgent = oais.Agent{ID: "archiv-system", Name: "archiv-system", Type: oais.AgentSoftware}
+
+// PackageRequest selects the documents of an archival package, by ID or as those ingested by an import
+type PackageRequest struct {
+	DocumentIDs []uint `json:"document_ids"`
+	ImportID    *uint  `json:"import_id"`
+}
+
+// PreservationService builds the archival information packages (AIP) of the OAIS model: BagIt bags of documents
+// and of all their previous versions, described by a METS document holding their PREMIS metadata, and kept in the
+// storage. The archives and bags imported are the submission packages (SIP), each one being packaged once
+// imported when the configuration asks for it; dissemination packages (DIP) are exports, see ExportService.
+type PreservationService struct {
+	packages repository.PackageRepository
+	exports  *ExportService
+	audit    *AuditService
+	queue    *jobs.Queue
+	cfg      config.PreservationConfig
+}
+
+func NewPreservationService(packages repository.PackageRepository, exports *ExportService) *PreservationService {
+	return &PreservationService{packages: packages, exports: exports}
+}
+
+// SetQueue enables the archival packages, built on the queue with the limits of the configuration
+func (ps *PreservationService) SetQueue(queue *jobs.Queue, cfg config.PreservationConfig) {
+	ps.queue, ps.cfg = queue, cfg
+}
+
+// StartPackage records an archival package and queues its building. userID is the administrator asking for it,
+// nil for the package of an import made at ingest. Documents given by ID must exist and be out of quarantine.
+func (ps *PreservationService) StartPackage(ctx context.Context, userID *uint, req PackageRequest) (*models.ArchivalPackage, error) {
+	if ps.queue == nil {
+		return nil, ErrPreservationUnavailable
+	}
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return nil, database.ErrMissingTenant
+	}
+	if (len(req.DocumentIDs) > 0) == (req.ImportID != nil) {
+		return nil, fmt.Errorf("%w: give either document_ids or import_id", ErrInvalidPackage)
+	}
+
+	var (
+		ids []uint
+		err error
+	)
+	if req.ImportID != nil {
+		ids, err = ps.importedDocuments(ctx, *req.ImportID)
+	} else {
+		ids, err = ps.requestedDocuments(ctx, req.DocumentIDs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrNothingToPackage
+	}
+
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	pkg := &models.ArchivalPackage{
+		UserID:      userID,
+		ImportID:    req.ImportID,
+		Status:      models.PackagePending,
+		DocumentIDs: strings.Join(list, ","),
+	}
+	if err := ps.packages.Create(ctx, pkg); err != nil {
+		return nil, fmt.Errorf("failed to create archival package: %w", err)
+	}
+
+	pkgID := pkg.ID
+	if err := ps.queue.Enqueue(func(ctx context.Context) error {
+		return ps.Run(database.WithOrganization(ctx, organizationID), pkgID)
+	}); err != nil {
+		ps.finish(ctx, pkg, err)
+		return nil, err
+	}
+	return pkg, nil
+}
+
+func (ps *PreservationService) requestedDocuments(ctx context.Context, ids []uint) ([]uint, error) {
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) > ps.cfg.MaxDocuments {
+		return nil, fmt.Errorf("%w: %d documents, at most %d", ErrPackageTooLarge, len(ids), ps.cfg.MaxDocuments)
+	}
+	documents, err := ps.exports.loadDocuments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[uint]bool, len(documents))
+	for i := range documents {
+		if quarantined(&documents[i]) {
+			return nil, fmt.Errorf("%w: %d", ErrDocumentQuarantined, documents[i].ID)
+		}
+		found[documents[i].ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: %d", ErrDocumentNotFound, id)
+		}
+	}
+	return ids, nil
+}
+
+// importedDocuments returns the documents created by a completed import
+func (ps *PreservationService) importedDocuments(ctx context.Context, importID uint) ([]uint, error) {
+	job, err := ps.exports.imports.Get(ctx, importID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+	if job.Status != models.ImportCompleted {
+		return nil, fmt.Errorf("%w: import %d is %s", ErrInvalidPackage, job.ID, job.Status)
+	}
+	ids, err := ps.exports.imports.ImportedDocuments(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > ps.cfg.MaxDocuments {
+		return nil, fmt.Errorf("%w: %d documents, at most %d", ErrPackageTooLarge, len(ids), ps.cfg.MaxDocuments)
+	}
+	return ids, nil
+}
+
+// PackageIngest packages the documents of an import once completed, when the configuration asks for it. A
+// failure is logged: the import itself succeeded.
+func (ps *PreservationService) PackageIngest(ctx context.Context, job *models.ImportJob) {
+	if ps.queue == nil || !ps.cfg.OnIngest || job.Status != models.ImportCompleted || job.Imported == 0 {
+		return
+	}
+	pkg, err := ps.StartPackage(ctx, nil, PackageRequest{ImportID: &job.ID})
+	if err != nil {
+		if !errors.Is(err, ErrNothingToPackage) {
+			slog.ErrorContext(ctx, "Failed to start the archival package of an import", "import_id", job.ID, "error", err)
+		}
+		return
+	}
+	slog.InfoContext(ctx, "Archival package of import started", "import_id", job.ID, "package_id", pkg.ID)
+}
+
+// Run builds the bag of an archival package in the storage, encrypted like the documents
+func (ps *PreservationService) Run(ctx context.Context, pkgID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "services.RunArchivalPackage", attribute.Int("package.id", int(pkgID)))
+	defer func() { tracing.End(span, err) }()
+
+	pkg, err := ps.packages.Get(ctx, pkgID)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+	pkg.Status, pkg.StartedAt = models.PackageRunning, &startedAt
+	if err := ps.packages.UpdateProgress(ctx, pkg); err != nil {
+		return err
+	}
+
+	err = ps.buildPackage(ctx, pkg)
+	ps.finish(ctx, pkg, err)
+	span.SetAttributes(attribute.Int("package.files", pkg.Files), attribute.Int64("package.size", pkg.Size))
+	if err != nil {
+		return fmt.Errorf("archival package %d failed: %w", pkg.ID, err)
+	}
+	return nil
+}
+
+func (ps *PreservationService) buildPackage(ctx context.Context, pkg *models.ArchivalPackage) error {
+	ids, err := parseIDList(pkg.DocumentIDs)
+	if err != nil {
+		return err
+	}
+	if err := ps.waitForScans(ctx, ids); err != nil {
+		return err
+	}
+
+	// Documents deleted since the request are no longer packaged, those in quarantine are left out
+	loaded, err := ps.exports.loadDocuments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	documents := make([]models.Document, 0, len(loaded))
+	for i := range loaded {
+		if quarantined(&loaded[i]) {
+			slog.WarnContext(ctx, "Document in quarantine left out of archival package", "package_id", pkg.ID, "document_id", loaded[i].ID)
+			pkg.Skipped++
+			continue
+		}
+		documents = append(documents, loaded[i])
+	}
+	documents, err = ps.withVersions(ctx, pkg, documents)
+	if err != nil {
+		return err
+	}
+	if len(documents) == 0 {
+		return ErrNothingToPackage
+	}
+
+	selection := &ExportSelection{
+		Documents: documents,
+		Name:      fmt.Sprintf("aip-%d", pkg.ID),
+		Format:    models.ExportFormatBagIt,
+		Package:   oais.AIP,
+		Manifest:  archive.ManifestJSON,
+	}
+	url, err := ps.exports.archivePath(ctx, PackageDir, selection.Name)
+	if err != nil {
+		return err
+	}
+	stored, err := ps.exports.storeArchive(ctx, url, func(w io.Writer) error {
+		_, err := ps.exports.writeArchive(ctx, w, selection, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	pkg.URL, pkg.Encryption, pkg.Size, pkg.SHA256, pkg.Files = url, stored.encryption, stored.size, stored.sha256, len(documents)
+
+	if ps.audit != nil {
+		if err := ps.audit.Record(ctx, &models.AuditEvent{
+			ActorID:    pkg.UserID,
+			Action:     models.AuditPackageCreated,
+			TargetType: "archival_package",
+			TargetID:   pkg.ID,
+			Detail:     fmt.Sprintf("%d files, %d bytes, sha256 %s", pkg.Files, pkg.Size, pkg.SHA256),
+		}); err != nil {
+			slog.WarnContext(ctx, "Failed to record archival package in the audit log", "package_id", pkg.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// waitForScans waits, up to the limit of the configuration, until none of the documents is waiting for its
+// malware scan. Documents imported just before their package are usually still being scanned.
+func (ps *PreservationService) waitForScans(ctx context.Context, ids []uint) error {
+	deadline := time.Now().Add(ps.cfg.ScanWait)
+	for {
+		var pending int64
+		for start := 0; start < len(ids); start += exportBatchSize {
+			count, err := ps.exports.documents.documents.CountMatching(ctx, repository.DocumentQuery{
+				IDs:          ids[start:min(start+exportBatchSize, len(ids))],
+				ScanStatuses: []string{models.ScanPending},
+			})
+			if err != nil {
+				return err
+			}
+			pending += count
+		}
+		if pending == 0 || !time.Now().Before(deadline) {
+			return nil
+		}
+
+		timer := time.NewTimer(min(scanPollInterval, time.Until(deadline)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// withVersions adds the previous versions of the documents, the package preserving the whole history of each
+// one. Versions in quarantine are left out.
+func (ps *PreservationService) withVersions(ctx context.Context, pkg *models.ArchivalPackage, documents []models.Document) ([]models.Document, error) {
+	seen := make(map[uint]bool, len(documents))
+	var previous []uint
+	for _, document := range documents {
+		seen[document.ID] = true
+	}
+	for _, document := range documents {
+		if document.PreviousVersionID != 0 && !seen[document.PreviousVersionID] {
+			previous = append(previous, document.PreviousVersionID)
+			seen[document.PreviousVersionID] = true
+		}
+	}
+
+	for len(previous) > 0 {
+		versions, err := ps.exports.loadDocuments(ctx, previous)
+		if err != nil {
+			return nil, err
+		}
+		previous = nil
+		for i := range versions {
+			version := &versions[i]
+			if quarantined(version) {
+				pkg.Skipped++
+			} else {
+				documents = append(documents, *version)
+			}
+			if version.PreviousVersionID != 0 && !seen[version.PreviousVersionID] {
+				previous = append(previous, version.PreviousVersionID)
+				seen[version.PreviousVersionID] = true
+			}
+		}
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].ID < documents[j].ID })
+	return documents, nil
+}
+
+// finish records the end of a package, failed when err is not nil
+func (ps *PreservationService) finish(ctx context.Context, pkg *models.ArchivalPackage, err error) {
+	finishedAt := time.Now()
+	pkg.Status, pkg.FinishedAt = models.PackageCompleted, &finishedAt
+	if err != nil {
+		pkg.Status, pkg.Error = models.PackageFailed, err.Error()
+	}
+	// Recorded even when the package was interrupted by a shutdown
+	ctx = context.WithoutCancel(ctx)
+	if saveErr := ps.packages.UpdateProgress(ctx, pkg); saveErr != nil {
+		slog.ErrorContext(ctx, "Failed to record archival package status", "package_id", pkg.ID, "error", saveErr)
+	}
+}
+
+// FailInterrupted marks the packages left pending or running by a previous run of the server as failed.
+// Pending tasks do not survive a restart.
+func (ps *PreservationService) FailInterrupted(ctx context.Context) error {
+	interrupted, err := ps.packages.ListByStatus(database.Unscoped(ctx), models.PackagePending, models.PackageRunning)
+	if err != nil {
+		return err
+	}
+	for i := range interrupted {
+		pkg := &interrupted[i]
+		ps.finish(database.WithOrganization(ctx, pkg.OrganizationID), pkg, errors.New("interrupted by a restart of the server, request the package again"))
+	}
+	return nil
+}
+
+// ListPackages returns a page of the archival packages of the organization, most recent first, and their total
+func (ps *PreservationService) ListPackages(ctx context.Context, page, pageSize int) ([]models.ArchivalPackage, int64, error) {
+	return ps.packages.List(ctx, (page-1)*pageSize, pageSize)
+}
+
+// GetPackage returns an archival package of the organization
+func (ps *PreservationService) GetPackage(ctx context.Context, pkgID uint) (*models.ArchivalPackage, error) {
+	pkg, err := ps.packages.Get(ctx, pkgID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPackageNotFound
+		}
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// OpenPackage returns a completed archival package and the content of its bag, decrypted
+func (ps *PreservationService) OpenPackage(ctx context.Context, pkgID uint) (*models.ArchivalPackage, io.ReadCloser, error) {
+	pkg, err := ps.GetPackage(ctx, pkgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pkg.Status != models.PackageCompleted {
+		return nil, nil, fmt.Errorf("%w: %s", ErrPackageNotReady, pkg.Status)
+	}
+	content, err := ps.exports.store.Open(ctx, pkg.URL, pkg.Encryption)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archival package: %w", err)
+	}
+	return pkg, content, nil
+}
+
+// describePackage writes the METS document of an information package, with the PREMIS metadata of its
+// documents: their fixity and format, and their history gathered from the uploads and imports, the versions,
+// the malware scans, the fixity checks and the audit log
+func (es *ExportService) describePackage(ctx context.Context, selection *ExportSelection, paths map[uint]string) ([]byte, error) {
+	organization, err := es.documents.currentOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, err := es.loadHistory(ctx, selection.Documents)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &oais.Package{
+		ID:      selection.Name,
+		Type:    selection.Package,
+		Label:   fmt.Sprintf("%s of %d documents of %s", selection.Package, len(selection.Documents), organization.Name),
+		Creator: organization.Name,
+		Created: time.Now(),
+		Agents:  []oais.Agent{systemAgent},
+	}
+	agents := &packageAgents{pkg: pkg, users: history.users, ids: make(map[string]string)}
+
+	packaged := make(map[uint]*models.Document, len(selection.Documents))
+	for i := range selection.Documents {
+		packaged[selection.Documents[i].ID] = &selection.Documents[i]
+	}
+	// The versions of a document are grouped under its first version in the package
+	itemOf := func(document *models.Document) string {
+		for depth := 0; document.PreviousVersionID != 0 && depth < len(packaged); depth++ {
+			previous, ok := packaged[document.PreviousVersionID]
+			if !ok {
+				break
+			}
+			document = previous
+		}
+		return oais.FileID(document.ID)
+	}
+
+	for i := range selection.Documents {
+		document := &selection.Documents[i]
+		entryPath := paths[document.ID]
+		dir := path.Dir(entryPath)
+		if dir == "." {
+			dir = ""
+		}
+		file := oais.File{
+			ID:        oais.FileID(document.ID),
+			Item:      itemOf(document),
+			Dir:       dir,
+			Path:      path.Join("data", entryPath),
+			Name:      document.Name,
+			MimeType:  document.Type,
+			Size:      document.Size,
+			Created:   document.CreatedAt,
+			Checksums: []oais.Checksum{{Algorithm: oais.SHA256, Digest: document.SHA256}},
+		}
+		if document.SHA512 != "" {
+			file.Checksums = append(file.Checksums, oais.Checksum{Algorithm: oais.SHA512, Digest: document.SHA512})
+		}
+		if document.PreviousVersionID != 0 {
+			file.Source = oais.FileID(document.PreviousVersionID)
+		}
+		if document.Tags != nil {
+			for _, tag := range *document.Tags {
+				file.Subjects = append(file.Subjects, tag.Name)
+			}
+		}
+		file.Events = documentEvents(document, history, agents)
+
+		// The package itself is the last event of the history of its files
+		event := oais.Event{
+			Type:    oais.EventPackageCreation,
+			Date:    pkg.Created,
+			Detail:  "archival information package " + pkg.ID,
+			Outcome: oais.OutcomeSuccess,
+			Agents:  []oais.AgentLink{{AgentID: systemAgent.ID, Role: oais.RoleExecutingProgram}},
+		}
+		if pkg.Type == oais.DIP {
+			event.Type, event.Detail = oais.EventDissemination, "dissemination information package "+pkg.ID
+		}
+		file.Events = append(file.Events, event)
+		pkg.Files = append(pkg.Files, file)
+	}
+	return pkg.METS()
+}
+
+// packageAgents adds the agents of the events to a package, once each
+type packageAgents struct {
+	pkg   *oais.Package
+	users map[uint]string   // usernames by ID
+	ids   map[string]string // IDs of the agents added, by user or scanner
+}
+
+// user returns the agent of a user
+func (pa *packageAgents) user(userID uint) string {
+	name, ok := pa.users[userID]
+	if !ok {
+		name = fmt.Sprintf("user %d", userID)
+	}
+	return pa.add("user:"+strconv.FormatUint(uint64(userID), 10), fmt.Sprintf("user-%d", userID), name, oais.AgentPerson)
+}
+
+// scanner returns the agent of a version of the malware scanner, with its signatures
+func (pa *packageAgents) scanner(engine string) string {
+	return pa.add("scanner:"+engine, fmt.Sprintf("scanner-%d", len(pa.ids)+1), engine, oais.AgentSoftware)
+}
+
+func (pa *packageAgents) add(key, id, name, agentType string) string {
+	if existing, ok := pa.ids[key]; ok {
+		return existing
+	}
+	pa.ids[key] = id
+	pa.pkg.Agents = append(pa.pkg.Agents, oais.Agent{ID: id, Name: name, Type: agentType})
+	return id
+}
+
+// documentHistory holds the records the events of the documents of a package are made of
+type documentHistory struct {
+	users         map[uint]string // usernames by ID
+	imports       map[uint]*models.ImportJob
+	importOf      map[uint]uint // import of each imported document
+	fixity        map[uint][]models.FixityEvent
+	audit         map[uint][]models.AuditEvent
+	previousTypes map[uint]string // types of the previous versions, packaged or not
+}
+
+// loadHistory loads the records about the documents, in batches to keep the queries small
+func (es *ExportService) loadHistory(ctx context.Context, documents []models.Document) (*documentHistory, error) {
+	history := &documentHistory{
+		users:         make(map[uint]string),
+		imports:       make(map[uint]*models.ImportJob),
+		importOf:      make(map[uint]uint),
+		fixity:        make(map[uint][]models.FixityEvent),
+		audit:         make(map[uint][]models.AuditEvent),
+		previousTypes: make(map[uint]string),
+	}
+	ids := make([]uint, 0, len(documents))
+	userIDs := make(map[uint]bool)
+	var previousIDs []uint
+	for _, document := range documents {
+		ids = append(ids, document.ID)
+		userIDs[document.OwnerID] = true
+		if document.PreviousVersionID != 0 {
+			previousIDs = append(previousIDs, document.PreviousVersionID)
+		}
+	}
+
+	var importIDs []uint
+	for start := 0; start < len(ids); start += exportBatchSize {
+		batch := ids[start:min(start+exportBatchSize, len(ids))]
+
+		entries, err := es.imports.ImportedEntries(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			history.importOf[*entry.DocumentID] = entry.JobID
+			importIDs = append(importIDs, entry.JobID)
+		}
+
+		fixityEvents, err := es.fixityEvents.ListForDocuments(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range fixityEvents {
+			history.fixity[event.DocumentID] = append(history.fixity[event.DocumentID], event)
+		}
+
+		auditEvents, err := es.audit.ListForTargets(ctx, "document", batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range auditEvents {
+			history.audit[event.TargetID] = append(history.audit[event.TargetID], event)
+			if event.ActorID != nil {
+				userIDs[*event.ActorID] = true
+			}
+		}
+	}
+
+	slices.Sort(importIDs)
+	importIDs = slices.Compact(importIDs)
+	for start := 0; start < len(importIDs); start += exportBatchSize {
+		found, err := es.imports.GetMany(ctx, importIDs[start:min(start+exportBatchSize, len(importIDs))])
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			history.imports[found[i].ID] = &found[i]
+		}
+	}
+
+	for start := 0; start < len(previousIDs); start += exportBatchSize {
+		previous, err := es.documents.documents.Find(ctx, repository.DocumentQuery{IDs: previousIDs[start:min(start+exportBatchSize, len(previousIDs))]}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, document := range previous {
+			history.previousTypes[document.ID] = document.Type
+		}
+	}
+
+	users := make([]uint, 0, len(userIDs))
+	for id := range userIDs {
+		users = append(users, id)
+	}
+	for start := 0; start < len(users); start += exportBatchSize {
+		found, err := es.documents.users.Usernames(ctx, users[start:min(start+exportBatchSize, len(users))])
+		if err != nil {
+			return nil, err
+		}
+		for id, username := range found {
+			history.users[id] = username
+		}
+	}
+	return history, nil
+}
+
+// auditEventTypes gives the PREMIS event of the actions of the audit log about documents
+var auditEventTypes = map[string]string{
+	models.AuditMalwareHeld:   oais.EventQuarantine,
+	models.AuditScanRequested: oais.EventVirusCheck,
+}
+
+// documentEvents returns the history of a document, in chronological order
+func documentEvents(document *models.Document, history *documentHistory, agents *packageAgents) []oais.Event {
+	system := []oais.AgentLink{{AgentID: systemAgent.ID, Role: oais.RoleExecutingProgram}}
+	owner := oais.AgentLink{AgentID: agents.user(document.OwnerID), Role: oais.RoleImplementer}
+
+	ingestion := oais.Event{
+		Type:    oais.EventIngestion,
+		Date:    document.CreatedAt,
+		Detail:  "uploaded",
+		Outcome: oais.OutcomeSuccess,
+		Agents:  append([]oais.AgentLink{owner}, system...),
+	}
+	if job, ok := history.imports[history.importOf[document.ID]]; ok {
+		kind := "archive"
+		if job.Bag {
+			kind = "BagIt bag"
+		}
+		ingestion.Detail = fmt.Sprintf("imported from the %s %s (import %d)", kind, job.Filename, job.ID)
+	}
+	events := []oais.Event{ingestion}
+
+	// Checksums backfilled by a fixity check are described by their fixity event instead
+	backfilled := slices.ContainsFunc(history.fixity[document.ID], func(event models.FixityEvent) bool {
+		return event.Outcome == models.FixityBackfilled
+	})
+	if document.SHA256 != "" && !backfilled {
+		algorithms := oais.SHA256
+		if document.SHA512 != "" {
+			algorithms += " and " + oais.SHA512
+		}
+		events = append(events, oais.Event{
+			Type:    oais.EventMessageDigest,
+			Date:    document.CreatedAt,
+			Detail:  algorithms + " computed at upload",
+			Outcome: oais.OutcomeSuccess,
+			Agents:  system,
+		})
+	}
+
+	identified := oais.Event{
+		Type:          oais.EventFormatIdentification,
+		Date:          document.CreatedAt,
+		Detail:        "identified from the content of the file",
+		Outcome:       oais.OutcomeSuccess,
+		OutcomeDetail: document.Type,
+		Agents:        system,
+	}
+	if document.DeclaredType != "" && document.DeclaredType != document.Type {
+		identified.OutcomeDetail += ", declared as " + document.DeclaredType
+	}
+	events = append(events, identified)
+
+	if document.PreviousVersionID != 0 {
+		version := oais.Event{
+			Type:    oais.EventModification,
+			Date:    document.CreatedAt,
+			Detail:  fmt.Sprintf("version %d, replacing document %d", document.Version, document.PreviousVersionID),
+			Outcome: oais.OutcomeSuccess,
+			Agents:  []oais.AgentLink{owner},
+		}
+		if previousType, ok := history.previousTypes[document.PreviousVersionID]; ok && previousType != document.Type {
+			version.Type = oais.EventMigration
+			version.Detail += fmt.Sprintf(", from %s to %s", previousType, document.Type)
+		}
+		events = append(events, version)
+	}
+
+	if document.ScannedAt != nil && document.ScanStatus != models.ScanPending {
+		scan := oais.Event{Type: oais.EventVirusCheck, Date: *document.ScannedAt, Detail: "malware scan", Agents: system}
+		if document.ScanEngine != "" {
+			scan.Agents = []oais.AgentLink{{AgentID: agents.scanner(document.ScanEngine), Role: oais.RoleExecutingProgram}}
+		}
+		switch document.ScanStatus {
+		case models.ScanClean:
+			scan.Outcome, scan.OutcomeDetail = oais.OutcomeSuccess, "no malware found"
+		case models.ScanInfected:
+			scan.Outcome, scan.OutcomeDetail = oais.OutcomeFailure, document.ScanSignature+" found"
+		default:
+			scan.Outcome, scan.OutcomeDetail = oais.OutcomeFailure, "the scan did not complete"
+		}
+		events = append(events, scan)
+	}
+
+	for _, record := range history.audit[document.ID] {
+		eventType, ok := auditEventTypes[record.Action]
+		if !ok {
+			continue
+		}
+		event := oais.Event{Type: eventType, Date: record.CreatedAt, Detail: record.Action + ": " + record.Detail, Agents: system}
+		if record.ActorID != nil {
+			event.Agents = []oais.AgentLink{{AgentID: agents.user(*record.ActorID), Role: oais.RoleAuthorizer}}
+		}
+		events = append(events, event)
+	}
+
+	for _, record := range history.fixity[document.ID] {
+		if record.Outcome == models.FixityBackfilled {
+			events = append(events, oais.Event{
+				Type:    oais.EventMessageDigest,
+				Date:    record.CreatedAt,
+				Detail:  record.Detail,
+				Outcome: oais.OutcomeSuccess,
+				Agents:  system,
+			})
+			continue
+		}
+		outcome := record.Outcome
+		if record.Detail != "" {
+			outcome += ": " + record.Detail
+		}
+		events = append(events, oais.Event{
+			Type:          oais.EventFixityCheck,
+			Date:          record.CreatedAt,
+			Detail:        "checksums compared to those recorded at upload",
+			Outcome:       oais.OutcomeFailure,
+			OutcomeDetail: outcome,
+			Agents:        system,
+		})
+	}
+	// Only failed checks are recorded, the latest one is known when it passed. The checksums computed at upload
+	// count as a check, already described by the message digest calculation.
+	if document.FixityStatus == models.FixityOK && document.FixityCheckedAt != nil &&
+		document.FixityCheckedAt.After(document.CreatedAt.Add(time.Second)) {
+		events = append(events, oais.Event{
+			Type:          oais.EventFixityCheck,
+			Date:          *document.FixityCheckedAt,
+			Detail:        "checksums compared to those recorded at upload",
+			Outcome:       oais.OutcomeSuccess,
+			OutcomeDetail: "the file matches its checksums",
+			Agents:        system,
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+	return events
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"archiv-system/internal/bagit"
+	"archiv-system/internal/models"
+	"archiv-system/internal/oais"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// packageDescription is the part of a METS document checked by the tests
+type packageDescription struct {
+	ObjID string `xml:"OBJID,attr"`
+	Type  string `xml:"TYPE,attr"`
+	Files []struct {
+		ID       string `xml:"ID,attr"`
+		Checksum string `xml:"CHECKSUM,attr"`
+	} `xml:"fileSec>fileGrp>file"`
+	Objects []struct {
+		ID       string `xml:"techMD>mdWrap>xmlData>object>objectIdentifier>objectIdentifierValue"`
+		Fixities []struct {
+			Algorithm string `xml:"messageDigestAlgorithm"`
+			Digest    string `xml:"messageDigest"`
+		} `xml:"techMD>mdWrap>xmlData>object>objectCharacteristics>fixity"`
+		Source string `xml:"techMD>mdWrap>xmlData>object>relationship>relatedObjectIdentifier>relatedObjectIdentifierValue"`
+		Events []struct {
+			Type   string `xml:"eventType"`
+			Detail string `xml:"eventDetailInformation>eventDetail"`
+		} `xml:"digiprovMD>mdWrap>xmlData>event"`
+	} `xml:"amdSec"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readPackage validates a bag written as a zip archive and returns its METS description
+func readPackage(t *testing.T, data []byte) (*bagit.Bag, *packageDescription) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "package.zip")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bag, err := bagit.ValidateArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mets, ok := bag.TagFile("metadata/" + oais.METSFile)
+	if !ok {
+		t.Fatal("no METS document in the bag")
+	}
+	var description packageDescription
+	if err := xml.Unmarshal(mets, &description); err != nil {
+		t.Fatalf("METS: %v", err)
+	}
+	return bag, &description
+}
+
+func (d *packageDescription) eventTypes(object int) []string {
+	var types []string
+	for _, event := range d.Objects[object].Events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestArchivalPackage(t *testing.T) {
+	f := newFixture(t)
+	preservation := f.services.Preservation
+	if _, err := preservation.StartPackage(f.ctx, &f.admin.ID, PackageRequest{DocumentIDs: []uint{1}}); !errors.Is(err, ErrPreservationUnavailable) {
+		t.Fatalf("preservation disabled: got %v, want ErrPreservationUnavailable", err)
+	}
+	preservation.SetQueue(f.queue, f.cfg.Preservation)
+
+	first := f.upload(f.alice, "budget.csv", "year,amount\n2024,100\n", "finance")
+	second := f.upload(f.alice, "budget-v2.csv", "year,amount\n2024,120\n", "finance")
+	second.PreviousVersionID, second.Version = first.ID, 2
+	if err := f.repos.Documents.Update(f.ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	infected := f.upload(f.alice, "invoice.txt", "invoice\n", "finance")
+	if _, err := preservation.StartPackage(f.ctx, &f.admin.ID, PackageRequest{DocumentIDs: []uint{second.ID, infected.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	f.setColumns(infected, map[string]interface{}{"scan_status": models.ScanInfected})
+	if _, err := preservation.StartPackage(f.ctx, &f.admin.ID, PackageRequest{DocumentIDs: []uint{infected.ID}}); !errors.Is(err, ErrDocumentQuarantined) {
+		t.Fatalf("quarantined document: got %v, want ErrDocumentQuarantined", err)
+	}
+
+	// Asked for the second version, the package holds the first one too, and leaves out the document sent to
+	// quarantine since the request
+	pkgs, _, err := preservation.ListPackages(f.ctx, 1, 10)
+	if err != nil || len(pkgs) != 1 {
+		t.Fatalf("packages %v: %v", pkgs, err)
+	}
+	if _, _, err := preservation.OpenPackage(f.ctx, pkgs[0].ID); !errors.Is(err, ErrPackageNotReady) {
+		t.Fatalf("pending package: got %v, want ErrPackageNotReady", err)
+	}
+	if err := preservation.Run(f.ctx, pkgs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	pkg, content, err := preservation.OpenPackage(f.ctx, pkgs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if pkg.Status != models.PackageCompleted || pkg.Files != 2 || pkg.Skipped != 1 {
+		t.Fatalf("package %s of %d files, %d skipped, want completed with both versions", pkg.Status, pkg.Files, pkg.Skipped)
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != pkg.Size || sha256Hex(data) != pkg.SHA256 {
+		t.Errorf("archive of %d bytes, %d and its checksum recorded", len(data), pkg.Size)
+	}
+
+	bag, description := readPackage(t, data)
+	if len(bag.Payload) != 2 || description.Type != oais.AIP || !strings.HasPrefix(description.ObjID, "aip-") {
+		t.Fatalf("package %s %s of %d files", description.Type, description.ObjID, len(bag.Payload))
+	}
+	// The checksums computed at upload are those of the files and the fixity of the PREMIS objects
+	payloadChecksums := map[string]bool{}
+	for _, payload := range bag.Payload {
+		payloadChecksums[payload.Checksums[bagit.SHA256]] = true
+	}
+	for i, document := range []*models.Document{first, second} {
+		object := description.Objects[i]
+		if description.Files[i].Checksum != document.SHA256 || len(object.Fixities) == 0 ||
+			object.Fixities[0].Algorithm != oais.SHA256 || object.Fixities[0].Digest != document.SHA256 {
+			t.Errorf("%s: file %+v, object %+v", document.Name, description.Files[i], object)
+		}
+		if !payloadChecksums[document.SHA256] {
+			t.Errorf("%s: not in the bag payload", document.Name)
+		}
+	}
+	if description.Objects[0].Source != "" || description.Objects[1].Source != description.Objects[0].ID {
+		t.Errorf("second version derived from %q", description.Objects[1].Source)
+	}
+	for i := range description.Objects {
+		types := description.eventTypes(i)
+		if len(types) < 3 || types[0] != oais.EventIngestion || types[len(types)-1] != oais.EventPackageCreation {
+			t.Errorf("events of %s: %v", description.Objects[i].ID, types)
+		}
+	}
+}
+
+func TestDisseminationPackage(t *testing.T) {
+	f := newFixture(t)
+	notes := f.upload(f.alice, "notes.txt", "archived notes\n", "minutes")
+	selection, err := f.services.Exports.Select(f.ctx, f.alice.ID, ExportRequest{DocumentIDs: []uint{notes.ID}, Format: models.ExportFormatDIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := f.services.Exports.WriteArchive(f.ctx, &out, selection); err != nil {
+		t.Fatal(err)
+	}
+	_, description := readPackage(t, out.Bytes())
+	if description.Type != oais.DIP || len(description.Objects) != 1 {
+		t.Fatalf("package %s of %d objects", description.Type, len(description.Objects))
+	}
+	object := description.Objects[0]
+	if len(object.Fixities) == 0 || object.Fixities[0].Digest != notes.SHA256 {
+		t.Errorf("fixity %+v, want %s", object.Fixities, notes.SHA256)
+	}
+	if types := description.eventTypes(0); types[len(types)-1] != oais.EventDissemination {
+		t.Errorf("events %v", types)
+	}
+}
+
+func TestSubmissionPackagedAtIngest(t *testing.T) {
+	f := newFixture(t)
+	f.cfg.Import.TempDir = t.TempDir()
+	f.services.Imports.SetQueue(f.queue, f.cfg.Import)
+	cfg := f.cfg.Preservation
+	cfg.OnIngest, cfg.ScanWait = true, time.Millisecond
+	f.services.Preservation.SetQueue(f.queue, cfg)
+
+	var sip bytes.Buffer
+	bw := bagit.NewWriter(&sip, "sip")
+	if _, err := bw.AddFile("minutes.txt", time.Now(), strings.NewReader("minutes of the board\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Close(bagit.Info{{Label: "Source-Organization", Value: "Archives"}}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := f.services.Imports.StartImport(f.ctx, f.alice.ID, nil, "sip.zip", true, &sip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.services.Imports.Run(f.ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The import queued the package of its documents
+	pkgs, _, err := f.services.Preservation.ListPackages(f.ctx, 1, 10)
+	if err != nil || len(pkgs) != 1 || pkgs[0].ImportID == nil || *pkgs[0].ImportID != job.ID || pkgs[0].UserID != nil {
+		t.Fatalf("packages %+v: %v", pkgs, err)
+	}
+	if err := f.services.Preservation.Run(f.ctx, pkgs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	_, content, err := f.services.Preservation.OpenPackage(f.ctx, pkgs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, description := readPackage(t, data)
+	if len(description.Objects) != 1 || len(description.Objects[0].Events) == 0 {
+		t.Fatalf("package of %d objects", len(description.Objects))
+	}
+	ingestion := description.Objects[0].Events[0]
+	if ingestion.Type != oais.EventIngestion || !strings.Contains(ingestion.Detail, "imported from the BagIt bag sip.zip") {
+		t.Errorf("ingestion event %+v", ingestion)
+	}
+	if fixities := description.Objects[0].Fixities; len(fixities) == 0 || fixities[0].Digest != sha256Hex([]byte("minutes of the board\n")) {
+		t.Errorf("fixity %+v", fixities)
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/models"
+	"archiv-system/internal/preview"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrInvalidPreviewSize = errors.New("invalid preview size")
+	ErrPreviewPending     = errors.New("preview is being generated")
+	ErrPreviewUnavailable = errors.New("no preview available for this document")
+)
+
+// PreviewService generates the thumbnails of the documents in the background and serves them
+type PreviewService struct {
+	documents   repository.DocumentRepository
+	derivatives repository.DerivativeRepository
+	store       *storage.Store
+	generator   *preview.Generator
+	queue       *jobs.Queue
+	timeout     time.Duration
+}
+
+func NewPreviewService(documents repository.DocumentRepository, derivatives repository.DerivativeRepository,
+	store *storage.Store, generator *preview.Generator) *PreviewService {
+	return &PreviewService{documents: documents, derivatives: derivatives, store: store, generator: generator}
+}
+
+// SetQueue enables the generation of thumbnails on the queue, each generation being limited to timeout.
+// Without queue, existing thumbnails are served but no new ones are generated.
+func (ps *PreviewService) SetQueue(queue *jobs.Queue, timeout time.Duration) {
+	ps.queue, ps.timeout = queue, timeout
+}
+
+// Schedule queues the generation of the thumbnails of a document, or marks it unsupported
+func (ps *PreviewService) Schedule(ctx context.Context, document *models.Document) error {
+	if ps.queue == nil {
+		return nil
+	}
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return database.ErrMissingTenant
+	}
+	if !ps.generator.Supported(document.Type) {
+		return ps.setStatus(ctx, document.ID, models.PreviewUnsupported)
+	}
+	if err := ps.setStatus(ctx, document.ID, models.PreviewPending); err != nil {
+		return err
+	}
+
+	docID, timeout := document.ID, ps.timeout
+	err := ps.queue.Enqueue(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(database.WithOrganization(ctx, organizationID), timeout)
+		defer cancel()
+		return ps.Generate(ctx, docID)
+	})
+	if err != nil {
+		// Left failed rather than pending forever
+		if statusErr := ps.setStatus(ctx, document.ID, models.PreviewFailed); statusErr != nil {
+			slog.ErrorContext(ctx, "Failed to record preview status", "document_id", document.ID, "error", statusErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Generate renders the thumbnails of a document in every size and records them as its derivatives
+func (ps *PreviewService) Generate(ctx context.Context, docID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "services.GeneratePreview", attribute.Int("document.id", int(docID)))
+	defer func() { tracing.End(span, err) }()
+
+	document, err := ps.documents.Get(ctx, docID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Deleted before its turn came
+			return nil
+		}
+		return err
+	}
+
+	thumbnails, err := ps.render(ctx, document)
+	if err != nil {
+		status := models.PreviewFailed
+		if errors.Is(err, preview.ErrUnsupported) {
+			status = models.PreviewUnsupported
+		}
+		metrics.ObservePreview(status)
+		if statusErr := ps.setStatus(ctx, docID, status); statusErr != nil {
+			slog.ErrorContext(ctx, "Failed to record preview status", "document_id", docID, "error", statusErr)
+		}
+		if status == models.PreviewUnsupported {
+			return nil
+		}
+		return fmt.Errorf("failed to generate preview of document %d: %w", docID, err)
+	}
+
+	dir := filepath.Join(filepath.Dir(document.URL), "previews")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create preview directory: %w", err)
+	}
+	for _, thumbnail := range thumbnails {
+		path := filepath.Join(dir, fmt.Sprintf("%d-%s.jpg", document.ID, thumbnail.Size))
+		encryption, err := ps.store.Save(ctx, path, bytes.NewReader(thumbnail.Data))
+		if err != nil {
+			return fmt.Errorf("failed to save thumbnail: %w", err)
+		}
+		if err := ps.derivatives.Save(ctx, &models.Derivative{
+			DocumentID:  document.ID,
+			Kind:        models.DerivativeThumbnail,
+			Size:        thumbnail.Size,
+			ContentType: preview.ContentType,
+			URL:         path,
+			Encryption:  encryption,
+			Width:       thumbnail.Width,
+			Height:      thumbnail.Height,
+			Bytes:       int64(len(thumbnail.Data)),
+		}); err != nil {
+			return fmt.Errorf("failed to record thumbnail: %w", err)
+		}
+	}
+
+	metrics.ObservePreview(models.PreviewReady)
+	return ps.setStatus(ctx, docID, models.PreviewReady)
+}
+
+func (ps *PreviewService) render(ctx context.Context, document *models.Document) ([]preview.Thumbnail, error) {
+	if !ps.generator.Supported(document.Type) {
+		return nil, preview.ErrUnsupported
+	}
+	content, err := ps.store.Open(ctx, document.URL, document.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return ps.generator.Generate(ctx, content, document.Type)
+}
+
+// Thumbnail returns a thumbnail of a document and its content, to be closed by the caller. Thumbnails
+// of documents uploaded before previews existed are scheduled on first request.
+func (ps *PreviewService) Thumbnail(ctx context.Context, docID uint, size string) (*models.Derivative, io.ReadCloser, error) {
+	if _, ok := preview.Sizes[size]; !ok {
+		return nil, nil, ErrInvalidPreviewSize
+	}
+	document, err := ps.documents.Get(ctx, docID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrDocumentNotFound
+		}
+		return nil, nil, err
+	}
+
+	// Nothing is rendered nor served from a file that may be infected
+	if quarantined(document) {
+		if document.ScanStatus == models.ScanPending {
+			return nil, nil, ErrPreviewPending
+		}
+		return nil, nil, ErrDocumentQuarantined
+	}
+
+	switch document.PreviewStatus {
+	case models.PreviewReady:
+	case models.PreviewPending:
+		return nil, nil, ErrPreviewPending
+	case "":
+		if ps.queue == nil {
+			return nil, nil, ErrPreviewUnavailable
+		}
+		if err := ps.Schedule(ctx, document); err != nil {
+			return nil, nil, err
+		}
+		if !ps.generator.Supported(document.Type) {
+			return nil, nil, ErrPreviewUnavailable
+		}
+		return nil, nil, ErrPreviewPending
+	default:
+		return nil, nil, ErrPreviewUnavailable
+	}
+
+	derivative, err := ps.derivatives.Get(ctx, docID, models.DerivativeThumbnail, size)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrPreviewUnavailable
+		}
+		return nil, nil, err
+	}
+	content, err := ps.store.Open(ctx, derivative.URL, derivative.Encryption)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+	return derivative, content, nil
+}
+
+// RemovePreviews deletes the derivatives of a document and their files
+func (ps *PreviewService) RemovePreviews(ctx context.Context, docID uint) error {
+	derivatives, err := ps.derivatives.ListByDocument(ctx, docID)
+	if err != nil {
+		return err
+	}
+	if len(derivatives) == 0 {
+		return nil
+	}
+	if err := ps.derivatives.DeleteByDocument(ctx, docID); err != nil {
+		return err
+	}
+	// Files are removed once the database no longer references them
+	for _, derivative := range derivatives {
+		if err := ps.store.Remove(ctx, derivative.URL); err != nil {
+			slog.WarnContext(ctx, "Failed to remove preview file", "path", derivative.URL, "document_id", docID, "error", err)
+		}
+	}
+	return nil
+}
+
+// setStatus records the preview status of a document without changing its update time
+func (ps *PreviewService) setStatus(ctx context.Context, docID uint, status string) error {
+	return ps.documents.UpdateColumns(ctx, docID, map[string]interface{}{"preview_status": status})
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/database"
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("a role with this name already exists")
+	ErrRoleInUse          = errors.New("role is still assigned to users")
+	ErrProtectedRole      = errors.New("this change would lock administrators out")
+	ErrBuiltinRole        = errors.New("built-in roles cannot be renamed or deleted")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+// AdminRoleName is the built-in role that must keep the right to manage roles
+const AdminRoleName = "admin"
+
+// RoleService manages roles, their permissions and the role of each user
+type RoleService struct {
+	roles repository.RoleRepository
+	users repository.UserRepository
+	authz *authz.Engine
+}
+
+func NewRoleService(roles repository.RoleRepository, users repository.UserRepository, engine *authz.Engine) *RoleService {
+	return &RoleService{roles: roles, users: users, authz: engine}
+}
+
+// ListPermissions returns every known permission
+func (rs *RoleService) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	return rs.roles.ListPermissions(ctx)
+}
+
+// ListRoles returns every role with its permissions
+func (rs *RoleService) ListRoles(ctx context.Context) ([]models.Role, error) {
+	return rs.roles.List(ctx)
+}
+
+// GetRole loads a role with its permissions
+func (rs *RoleService) GetRole(ctx context.Context, roleID uint) (*models.Role, error) {
+	role, err := rs.roles.Get(ctx, roleID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// CreateRole creates a role with the given permissions
+func (rs *RoleService) CreateRole(ctx context.Context, name string, permissionNames []string) (*models.Role, error) {
+	if err := rs.ensureRoleNameFree(ctx, name, 0); err != nil {
+		return nil, err
+	}
+
+	permissions, err := findPermissions(ctx, rs.roles, permissionNames)
+	if err != nil {
+		return nil, err
+	}
+
+	role := models.Role{Name: name, Permissions: permissions}
+	if err := rs.roles.Create(ctx, &role); err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	return &role, nil
+}
+
+// RenameRole changes the name of a role
+func (rs *RoleService) RenameRole(ctx context.Context, roleID uint, name string) (*models.Role, error) {
+	role, err := rs.GetRole(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if isBuiltinRole(role.Name) && name != role.Name {
+		return nil, ErrBuiltinRole
+	}
+	if err := rs.ensureRoleNameFree(ctx, name, roleID); err != nil {
+		return nil, err
+	}
+
+	if err := rs.roles.Rename(ctx, role, name); err != nil {
+		return nil, fmt.Errorf("failed to rename role: %w", err)
+	}
+	rs.authz.InvalidateRole(roleID)
+	return role, nil
+}
+
+// SetRoleUploadTypes restricts the content types the role may upload; an empty list lifts the restriction.
+// A user with several roles may upload the types allowed by any of them.
+func (rs *RoleService) SetRoleUploadTypes(ctx context.Context, roleID uint, types []string) (*models.Role, error) {
+	patterns, err := filetype.ParsePatterns(types)
+	if err != nil {
+		return nil, err
+	}
+	role, err := rs.GetRole(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.roles.SetAllowedUploadTypes(ctx, role, strings.Join(patterns, ",")); err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+	return role, nil
+}
+
+// DeleteRole deletes a role that is no longer assigned to any user
+func (rs *RoleService) DeleteRole(ctx context.Context, roleID uint) error {
+	role, err := rs.GetRole(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if isBuiltinRole(role.Name) {
+		return ErrBuiltinRole
+	}
+
+	users, err := rs.users.CountWithRole(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if users > 0 {
+		return ErrRoleInUse
+	}
+
+	err = rs.roles.Delete(ctx, role)
+	// The role may still be cached as the role of a group
+	rs.authz.InvalidateAll()
+	return err
+}
+
+// AssignPermission grants a permission to a role
+func (rs *RoleService) AssignPermission(ctx context.Context, roleID uint, permissionName string) (*models.Role, error) {
+	role, err := rs.GetRole(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := findPermissions(ctx, rs.roles, []string{permissionName})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rs.roles.AddPermissions(ctx, role, permissions); err != nil {
+		return nil, fmt.Errorf("failed to assign permission: %w", err)
+	}
+	rs.authz.InvalidateRole(roleID)
+	return rs.GetRole(ctx, roleID)
+}
+
+// UnassignPermission removes a permission from a role
+func (rs *RoleService) UnassignPermission(ctx context.Context, roleID uint, permissionName string) (*models.Role, error) {
+	role, err := rs.GetRole(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == AdminRoleName && permissionName == "manage_roles" {
+		return nil, ErrProtectedRole
+	}
+	permissions, err := findPermissions(ctx, rs.roles, []string{permissionName})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rs.roles.RemovePermissions(ctx, role, permissions); err != nil {
+		return nil, fmt.Errorf("failed to unassign permission: %w", err)
+	}
+	rs.authz.InvalidateRole(roleID)
+	return rs.GetRole(ctx, roleID)
+}
+
+// ChangeUserRole assigns another role to a user. The change applies on the user's next request.
+func (rs *RoleService) ChangeUserRole(ctx context.Context, userID uint, roleName string) (*models.User, error) {
+	user, err := loadUser(ctx, rs.users, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := rs.roles.GetByName(ctx, roleName)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	// Keep at least one administrator
+	if role.Name != AdminRoleName {
+		if err := ensureNotLastAdmin(ctx, rs.users, user); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rs.users.Update(ctx, user, map[string]interface{}{"role_id": role.ID}); err != nil {
+		return nil, fmt.Errorf("failed to change user role: %w", err)
+	}
+	rs.authz.InvalidateUser(userID)
+	role.Permissions = nil
+	user.RoleID = role.ID
+	user.Role = *role
+	return user, nil
+}
+
+// isBuiltinRole reports whether a role is seeded in every organization. Seeded grants are keyed by role name,
+// and registration gives new users the "user" role by name, so these roles keep their names.
+func isBuiltinRole(name string) bool {
+	_, builtin := database.DefaultRolePermissions[name]
+	return builtin
+}
+
+func (rs *RoleService) ensureRoleNameFree(ctx context.Context, name string, exceptID uint) error {
+	taken, err := rs.roles.NameTaken(ctx, name, exceptID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrRoleExists
+	}
+	return nil
+}
+
+// findPermissions loads permissions by name and fails if one of them does not exist
+func findPermissions(ctx context.Context, roles repository.RoleRepository, names []string) ([]*models.Permission, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	permissions, err := roles.FindPermissions(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(permissions) != len(uniqueStrings(names)) {
+		return nil, ErrPermissionNotFound
+	}
+	return permissions, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/metrics"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/scan"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrDocumentQuarantined = errors.New("document is in quarantine until it is found clean")
+	ErrScanUnavailable     = errors.New("malware scanning is not enabled")
+)
+
+// QuarantineDir is the directory of an organization holding the uploads until they are found clean
+const QuarantineDir = "quarantine"
+
+// ScanService scans the uploaded files for malware in the background and releases them from quarantine
+type ScanService struct {
+	documents  repository.DocumentRepository
+	store      *storage.Store
+	scanner    scan.Scanner // nil when scanning is disabled
+	audit      *AuditService
+	previews   *PreviewService
+	queue      *jobs.Queue
+	timeout    time.Duration
+	onInfected string
+}
+
+func NewScanService(documents repository.DocumentRepository, store *storage.Store, scanner scan.Scanner) *ScanService {
+	return &ScanService{documents: documents, store: store, scanner: scanner, onInfected: config.OnInfectedReject}
+}
+
+// SetQueue enables the scanning of the uploads on the queue, each scan being limited to timeout, and infected
+// files being handled as onInfected says (config.OnInfectedReject or config.OnInfectedHold)
+func (ss *ScanService) SetQueue(queue *jobs.Queue, timeout time.Duration, onInfected string) {
+	ss.queue, ss.timeout, ss.onInfected = queue, timeout, onInfected
+}
+
+// Enabled reports whether new uploads must be quarantined until scanned
+func (ss *ScanService) Enabled() bool {
+	return ss.queue != nil && ss.scanner != nil
+}
+
+// Schedule queues the scan of a document; it stays in quarantine, in error, when the queue is full
+func (ss *ScanService) Schedule(ctx context.Context, docID uint) error {
+	if !ss.Enabled() {
+		return ErrScanUnavailable
+	}
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return database.ErrMissingTenant
+	}
+
+	timeout := ss.timeout
+	err := ss.queue.Enqueue(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(database.WithOrganization(ctx, organizationID), timeout)
+		defer cancel()
+		return ss.Scan(ctx, docID)
+	})
+	if err != nil {
+		// Left in error rather than pending forever, an administrator can scan it again
+		if statusErr := ss.setColumns(ctx, docID, map[string]interface{}{"scan_status": models.ScanError}); statusErr != nil {
+			slog.ErrorContext(ctx, "Failed to record scan status", "document_id", docID, "error", statusErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// RequeuePending queues again the scans of the documents left pending by a stop of the server, in every
+// organization, and returns how many were queued. Those that do not fit in the queue are left in error.
+func (ss *ScanService) RequeuePending(ctx context.Context) (int, error) {
+	if !ss.Enabled() {
+		return 0, ErrScanUnavailable
+	}
+	documents, err := ss.documents.Find(database.Unscoped(ctx), repository.DocumentQuery{ScanStatuses: []string{models.ScanPending}}, 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending scans: %w", err)
+	}
+
+	queued := 0
+	for _, document := range documents {
+		if err := ss.Schedule(database.WithOrganization(ctx, document.OrganizationID), document.ID); err != nil {
+			slog.WarnContext(ctx, "Failed to queue pending scan, the document is left in error", "document_id", document.ID, "error", err)
+			continue
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// Scan checks a document for malware. A clean file leaves the quarantine and gets its previews; an infected one
+// is deleted or held in quarantine, as configured, and recorded in the audit log.
+func (ss *ScanService) Scan(ctx context.Context, docID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "services.ScanDocument", attribute.Int("document.id", int(docID)))
+	defer func() { tracing.End(span, err) }()
+
+	scanner := ss.scanner
+	if scanner == nil {
+		return ErrScanUnavailable
+	}
+	document, err := ss.documents.Get(ctx, docID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Deleted before its turn came
+			return nil
+		}
+		return err
+	}
+
+	result, err := ss.scanFile(ctx, scanner, document)
+	scannedAt := time.Now()
+	if err != nil {
+		metrics.ObserveScan(models.ScanError)
+		if statusErr := ss.setColumns(ctx, docID, map[string]interface{}{
+			"scan_status": models.ScanError,
+			"scanned_at":  scannedAt,
+		}); statusErr != nil {
+			slog.ErrorContext(ctx, "Failed to record scan status", "document_id", docID, "error", statusErr)
+		}
+		return fmt.Errorf("failed to scan document %d: %w", docID, err)
+	}
+
+	// The engine version is informative, a scan is not failed for lack of it
+	engine, err := scanner.Version(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read the version of the scanner", "error", err)
+	}
+	span.SetAttributes(attribute.Bool("scan.infected", result.Infected), attribute.String("scan.engine", engine))
+
+	if result.Infected {
+		metrics.ObserveScan(models.ScanInfected)
+		return ss.infected(ctx, document, result.Signature, engine, scannedAt)
+	}
+
+	metrics.ObserveScan(models.ScanClean)
+	url := releasedPath(document.URL)
+	if url != document.URL {
+		if err := ss.store.Move(ctx, document.URL, url); err != nil {
+			return fmt.Errorf("failed to release document %d from quarantine: %w", docID, err)
+		}
+	}
+	if err := ss.setColumns(ctx, docID, map[string]interface{}{
+		"scan_status":    models.ScanClean,
+		"scan_engine":    engine,
+		"scan_signature": "",
+		"scanned_at":     scannedAt,
+		"url":            url,
+	}); err != nil {
+		return err
+	}
+
+	if document.PreviewStatus == "" {
+		document.URL = url
+		if err := ss.previews.Schedule(ctx, document); err != nil {
+			slog.WarnContext(ctx, "Failed to schedule preview generation", "document_id", docID, "error", err)
+		}
+	}
+	return nil
+}
+
+// scanFile streams the stored file of a document, decrypted, to the scanner
+func (ss *ScanService) scanFile(ctx context.Context, scanner scan.Scanner, document *models.Document) (scan.Result, error) {
+	content, err := ss.store.Open(ctx, document.URL, document.Encryption)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	defer content.Close()
+	return scanner.Scan(ctx, content)
+}
+
+// infected deletes or holds an infected document, and records it in the audit log
+func (ss *ScanService) infected(ctx context.Context, document *models.Document, signature, engine string, scannedAt time.Time) error {
+	slog.WarnContext(ctx, "Malware found in uploaded file", "document_id", document.ID, "owner_id", document.OwnerID,
+		"signature", signature, "action", ss.onInfected)
+
+	event := &models.AuditEvent{
+		TargetType: "document",
+		TargetID:   document.ID,
+		Detail: fmt.Sprintf("%s found in '%s' uploaded by user %d (sha256 %s), scanned by %s",
+			signature, document.Name, document.OwnerID, document.SHA256, engine),
+	}
+
+	if ss.onInfected == config.OnInfectedHold {
+		event.Action = models.AuditMalwareHeld
+		if err := ss.audit.Record(ctx, event); err != nil {
+			return fmt.Errorf("failed to record audit event: %w", err)
+		}
+		return ss.setColumns(ctx, document.ID, map[string]interface{}{
+			"scan_status":    models.ScanInfected,
+			"scan_engine":    engine,
+			"scan_signature": signature,
+			"scanned_at":     scannedAt,
+		})
+	}
+
+	event.Action = models.AuditMalwareRejected
+	if err := ss.audit.Record(ctx, event); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	if err := ss.documents.Delete(ctx, document); err != nil {
+		return fmt.Errorf("failed to delete infected document %d: %w", document.ID, err)
+	}
+	// Previews exist when a document already released is found infected by a later scan
+	if err := ss.previews.RemovePreviews(ctx, document.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to remove previews of infected document", "document_id", document.ID, "error", err)
+	}
+	// The file is removed once the database no longer references it
+	if err := ss.store.Remove(ctx, document.URL); err != nil {
+		return fmt.Errorf("failed to remove infected file: %w", err)
+	}
+	return nil
+}
+
+// Rescan puts a document back in quarantine and queues a new scan, e.g. after a scan error or an update of the
+// signatures. It is recorded in the audit log with the administrator asking for it.
+func (ss *ScanService) Rescan(ctx context.Context, docID, actorID uint) (*models.Document, error) {
+	if !ss.Enabled() {
+		return nil, ErrScanUnavailable
+	}
+	document, err := ss.documents.Get(ctx, docID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	// A released file goes back to the quarantine directory, which the previews and downloads refuse to read
+	url := quarantinedPath(document.URL)
+	if url != document.URL {
+		if err := ss.store.Move(ctx, document.URL, url); err != nil {
+			return nil, fmt.Errorf("failed to move document %d back to quarantine: %w", docID, err)
+		}
+	}
+	if err := ss.setColumns(ctx, docID, map[string]interface{}{"scan_status": models.ScanPending, "url": url}); err != nil {
+		if url != document.URL {
+			if moveErr := ss.store.Move(context.WithoutCancel(ctx), url, document.URL); moveErr != nil {
+				slog.ErrorContext(ctx, "Failed to move document out of quarantine after a failed rescan", "document_id", docID, "path", url, "error", moveErr)
+			}
+		}
+		return nil, err
+	}
+	document.URL = url
+	if err := ss.audit.Record(ctx, &models.AuditEvent{
+		ActorID:    &actorID,
+		Action:     models.AuditScanRequested,
+		TargetType: "document",
+		TargetID:   docID,
+		Detail:     fmt.Sprintf("previous status '%s'", document.ScanStatus),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record audit event: %w", err)
+	}
+	if err := ss.Schedule(ctx, docID); err != nil {
+		return nil, err
+	}
+	document.ScanStatus = models.ScanPending
+	return document, nil
+}
+
+// ListQuarantine returns a page of the documents in quarantine (pending, infected or in error) and their total
+func (ss *ScanService) ListQuarantine(ctx context.Context, page, pageSize int) ([]models.Document, int64, error) {
+	query := repository.DocumentQuery{ScanStatuses: []string{models.ScanPending, models.ScanInfected, models.ScanError}}
+	total, err := ss.documents.CountMatching(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	documents, err := ss.documents.Find(ctx, query, (page-1)*pageSize, pageSize)
+	return documents, total, err
+}
+
+// setColumns records scan results on a document without changing its update time. The update is detached
+// from the cancellation of ctx, so that the outcome of a scan which timed out is still recorded.
+func (ss *ScanService) setColumns(ctx context.Context, docID uint, columns map[string]interface{}) error {
+	return ss.documents.UpdateColumns(context.WithoutCancel(ctx), docID, columns)
+}
+
+// releasedScanStatuses are the scan statuses of the documents out of quarantine, "" being the documents uploaded
+// while scanning was disabled
+var releasedScanStatuses = []string{models.ScanClean, ""}
+
+// quarantined reports whether a document must not be served nor processed until found clean
+func quarantined(document *models.Document) bool {
+	switch document.ScanStatus {
+	case models.ScanPending, models.ScanInfected, models.ScanError:
+		return true
+	}
+	return false
+}
+
+// quarantinedPath is the location of a released file once put back in quarantine
+func quarantinedPath(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Base(dir) == QuarantineDir {
+		return path
+	}
+	return filepath.Join(dir, QuarantineDir, filepath.Base(path))
+}
+
+// releasedPath is the location of a file once out of quarantine, next to the quarantine directory
+func releasedPath(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Base(dir) != QuarantineDir {
+		return path
+	}
+	return filepath.Join(filepath.Dir(dir), filepath.Base(path))
+}
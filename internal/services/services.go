@@ -0,0 +1,71 @@
+package services
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/preview"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/scan"
+	"archiv-system/internal/storage"
+)
+
+// Services groups the services the HTTP handlers delegate to
+type Services struct {
+	Documents     *DocumentService
+	Users         *UserService
+	Roles         *RoleService
+	Passwords     *PasswordService
+	Groups        *GroupService
+	Folders       *FolderService
+	Policies      *PolicyService
+	Organizations *OrganizationService
+	Fixity        *FixityService
+	Previews      *PreviewService
+	Audit         *AuditService
+	Scans         *ScanService
+	Imports       *ImportService
+	Exports       *ExportService
+	Preservation  *PreservationService
+}
+
+// Dependencies are what the services share besides the repositories
+type Dependencies struct {
+	Store     *storage.Store
+	Authz     *authz.Engine
+	Passwords auth.PasswordPolicy
+	Notifier  notify.Notifier // delivers the password reset links
+	Previews  *preview.Generator
+	Scanner   scan.Scanner // nil when scanning is disabled
+	SHA512    bool         // a SHA-512 checksum is recorded at upload next to the SHA-256 one
+}
+
+// New builds every service on the repositories and wires the services that depend on each other
+func New(repos *repository.Repositories, deps Dependencies) *Services {
+	s := &Services{
+		Documents: NewDocumentService(repos.Documents, repos.Tags, repos.Organizations, repos.Users, repos.Roles,
+			deps.Store, deps.Authz, deps.SHA512),
+		Users:     NewUserService(repos.Users, repos.Documents, repos.Roles, repos.Organizations, deps.Store, deps.Authz, deps.Passwords),
+		Roles:     NewRoleService(repos.Roles, repos.Users, deps.Authz),
+		Passwords: NewPasswordService(repos.ResetTokens, repos.Users, deps.Passwords, deps.Notifier),
+		Groups: NewGroupService(repos.Groups, repos.Grants, repos.Documents, repos.Folders, repos.Users, repos.Roles,
+			deps.Authz),
+		Folders:       NewFolderService(repos.Folders, repos.Documents, deps.Authz),
+		Policies:      NewPolicyService(repos.Policies, repos.Roles, deps.Authz),
+		Organizations: NewOrganizationService(repos.Organizations, repos.Users, deps.Authz, deps.Passwords),
+		Fixity:        NewFixityService(repos.Documents, repos.FixityEvents),
+		Previews:      NewPreviewService(repos.Documents, repos.Derivatives, deps.Store, deps.Previews),
+		Audit:         NewAuditService(repos.Audit),
+		Scans:         NewScanService(repos.Documents, deps.Store, deps.Scanner),
+	}
+	s.Scans.audit, s.Scans.previews = s.Audit, s.Previews
+	s.Documents.folders, s.Documents.previews, s.Documents.scans = s.Folders, s.Previews, s.Scans
+
+	s.Imports = NewImportService(repos.Imports, s.Documents, s.Folders)
+	s.Exports = NewExportService(repos.Exports, repos.Folders, repos.Imports, repos.FixityEvents, repos.Audit, s.Documents,
+		deps.Store, deps.Authz)
+	s.Preservation = NewPreservationService(repos.Packages, s.Exports)
+	s.Preservation.audit = s.Audit
+	s.Imports.preservation = s.Preservation
+	return s
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/jobs"
+	"archiv-system/internal/models"
+	"archiv-system/internal/notify"
+	"archiv-system/internal/preview"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// fixture holds the services built on the in-memory repositories, with the default organization holding an
+// "admin" and a user "alice". Its queue has no worker: the tests run the background tasks themselves.
+type fixture struct {
+	t            *testing.T
+	cfg          *config.Config
+	repos        *repository.Repositories
+	store        *storage.Store
+	engine       *authz.Engine
+	services     *Services
+	queue        *jobs.Queue
+	ctx          context.Context
+	organization *models.Organization
+	admin        *models.User
+	alice        *models.User
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Storage.Path = t.TempDir()
+	repos := repository.NewMemory()
+
+	store, err := storage.New(cfg.Storage, cfg.Encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords, err := auth.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := authz.NewEngine(cfg.Authz, repos)
+	f := &fixture{
+		t:      t,
+		cfg:    cfg,
+		repos:  repos,
+		store:  store,
+		engine: engine,
+		services: New(repos, Dependencies{
+			Store:     store,
+			Authz:     engine,
+			Passwords: passwords,
+			Notifier:  notify.LogNotifier{},
+			Previews:  preview.NewGenerator(cfg.Preview),
+		}),
+	}
+
+	runner := jobs.NewRunner()
+	f.queue = runner.NewQueue("test-"+t.Name(), 0, 10)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		runner.Shutdown(ctx)
+	})
+	f.services.Exports.SetQueue(f.queue, cfg.Export)
+
+	f.organization, err = repos.Organizations.GetBySlug(database.Unscoped(context.Background()), database.DefaultOrganizationSlug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ctx = database.WithOrganization(context.Background(), f.organization.ID)
+	f.admin = f.addUser("admin", "admin")
+	f.alice = f.addUser("alice", "user")
+	return f
+}
+
+// addUser creates a user of the default organization with the role
+func (f *fixture) addUser(username, roleName string) *models.User {
+	f.t.Helper()
+	role, err := f.repos.Roles.GetByName(f.ctx, roleName)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	user := &models.User{Username: username, Password: "x", RoleID: role.ID}
+	if err := f.repos.Users.Create(f.ctx, user); err != nil {
+		f.t.Fatal(err)
+	}
+	return user
+}
+
+// upload stores a text file of the user, with the comma-separated tags
+func (f *fixture) upload(user *models.User, name, content, tags string) *models.Document {
+	f.t.Helper()
+	document, err := f.services.Documents.ProcessFileUpload(f.ctx, UploadFileInput{
+		UserID: user.ID,
+		File: &models.UploadedFile{
+			Filename:    name,
+			ContentType: "text/plain",
+			Size:        int64(len(content)),
+			Open:        func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader([]byte(content))), nil },
+		},
+		Tags: &models.Tag{Name: tags},
+	})
+	if err != nil {
+		f.t.Fatalf("upload %s: %v", name, err)
+	}
+	return document
+}
+
+// setColumns changes columns of a document behind the services' back
+func (f *fixture) setColumns(document *models.Document, columns map[string]interface{}) {
+	f.t.Helper()
+	if err := f.repos.Documents.UpdateColumns(f.ctx, document.ID, columns); err != nil {
+		f.t.Fatal(err)
+	}
+}
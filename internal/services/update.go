@@ -1,28 +1,33 @@
 package services
 
 import (
-	"archiv-system/internal/database"
 	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/tracing"
+	"context"
 	"errors"
 	"fmt"
-)
+	"log/slog"
+	"time"
 
-type DocumentService struct{}
+	"go.opentelemetry.io/otel/attribute"
+)
 
-func (ds *DocumentService) ProcessFileUpdate(docID string, updateRequest models.UpdateRequest) (*models.Document, error) {
-	var document models.Document
+func (ds *DocumentService) ProcessFileUpdate(ctx context.Context, docID uint, updateRequest models.UpdateRequest) (_ *models.Document, err error) {
+	ctx, span := tracing.Start(ctx, "services.ProcessFileUpdate", attribute.Int("document.id", int(docID)))
+	defer func() { tracing.End(span, err) }()
 
 	// Charger le document
-	if err := database.DB.First(&document, docID).Error; err != nil {
-		return nil, errors.New("document not found")
+	document, err := ds.GetDocument(ctx, docID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Appliquer les modifications
 	document.Name = updateRequest.Name
-	document.Type = updateRequest.Type
 
 	// Convertir les noms de tags en modèles de tags
-	tags, err := findOrCreateTags(updateRequest.Tags)
+	tags, err := ds.findOrCreateTags(ctx, updateRequest.Tags)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process tags: %w", err)
 	}
@@ -30,9 +35,81 @@ func (ds *DocumentService) ProcessFileUpdate(docID string, updateRequest models.
 	document.Tags = &tags
 
 	// Sauvegarder dans la base
-	if err := database.DB.Save(&document).Error; err != nil {
+	if err := ds.documents.Update(ctx, document); err != nil {
 		return nil, errors.New("failed to save document")
 	}
 
-	return &document, nil
+	return document, nil
+}
+
+// GetDocument loads a document with its tags
+func (ds *DocumentService) GetDocument(ctx context.Context, docID uint) (*models.Document, error) {
+	document, err := ds.documents.Get(ctx, docID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	return document, nil
+}
+
+// ListDocuments returns the documents of the organization the user can read
+func (ds *DocumentService) ListDocuments(ctx context.Context, userID uint) ([]models.Document, error) {
+	return ds.listReadable(ctx, userID, repository.DocumentQuery{})
+}
+
+// ListUserDocuments returns the documents owned by a user, those the policies let them read
+func (ds *DocumentService) ListUserDocuments(ctx context.Context, ownerID uint) ([]models.Document, error) {
+	return ds.listReadable(ctx, ownerID, repository.DocumentQuery{OwnerID: ownerID})
+}
+
+// ListDocumentsByTags returns the documents holding at least one of the tags that the user can read
+func (ds *DocumentService) ListDocumentsByTags(ctx context.Context, userID uint, tagNames []string) ([]models.Document, error) {
+	return ds.listReadable(ctx, userID, repository.DocumentQuery{Tags: tagNames})
+}
+
+// listReadable returns the documents of the query the policies of the organization let the user read. Documents
+// in quarantine are only listed to the users managing it, the others never learn their name nor their location.
+func (ds *DocumentService) listReadable(ctx context.Context, userID uint, query repository.DocumentQuery) ([]models.Document, error) {
+	managesQuarantine, err := ds.authz.HasPermission(ctx, userID, "manage_quarantine")
+	if err != nil {
+		return nil, err
+	}
+	if !managesQuarantine {
+		query.ScanStatuses = releasedScanStatuses
+	}
+	documents, err := ds.documents.Find(ctx, query, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := ds.authz.DocumentFilter(ctx, userID, "read_document")
+	if err != nil {
+		return nil, err
+	}
+	return filter.Filter(ctx, documents)
+}
+
+// DeleteDocument deletes a document and returns it
+func (ds *DocumentService) DeleteDocument(ctx context.Context, docID uint) (*models.Document, error) {
+	document, err := ds.GetDocument(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.documents.Delete(ctx, document); err != nil {
+		return nil, err
+	}
+	if err := ds.previews.RemovePreviews(ctx, docID); err != nil {
+		slog.WarnContext(ctx, "Failed to remove previews of deleted document", "document_id", docID, "error", err)
+	}
+	return document, nil
+}
+
+// DocumentUpdatedAt returns the time of the last change of a document
+func (ds *DocumentService) DocumentUpdatedAt(ctx context.Context, docID uint) (time.Time, error) {
+	document, err := ds.GetDocument(ctx, docID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return document.UpdatedAt, nil
 }
@@ -1,82 +1,289 @@
 package services
 
 import (
+	"archiv-system/internal/authz"
+	"archiv-system/internal/config"
 	"archiv-system/internal/database"
+	"archiv-system/internal/filetype"
+	"archiv-system/internal/fixity"
 	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"archiv-system/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+	ErrTypeMismatch     = errors.New("the content of the file does not match its declared type")
+	ErrTypeNotAllowed   = errors.New("this type of file is not allowed")
+	ErrFileTooLarge     = errors.New("file too large")
 )
 
+// maxFilenameLength bounds the stored file names, in bytes
+const maxFilenameLength = 200
+
 type UploadFileInput struct {
-	UserID uint
-	File   *models.UploadedFile
-	Tags   *models.Tag
+	UserID   uint
+	File     *models.UploadedFile
+	Tags     *models.Tag
+	FolderID *uint // Dossier de destination, nil pour la racine
+}
+
+// DocumentService manages documents and their tags
+type DocumentService struct {
+	documents     repository.DocumentRepository
+	tags          repository.TagRepository
+	organizations repository.OrganizationRepository
+	users         repository.UserRepository
+	roles         repository.RoleRepository
+	folders       *FolderService
+	previews      *PreviewService
+	scans         *ScanService
+	store         *storage.Store
+	authz         *authz.Engine
+	withSHA512    bool // a SHA-512 checksum is recorded at upload next to the SHA-256 one
+	uploadRules   config.UploadConfig
+}
+
+func NewDocumentService(documents repository.DocumentRepository, tags repository.TagRepository,
+	organizations repository.OrganizationRepository, users repository.UserRepository,
+	roles repository.RoleRepository, store *storage.Store, engine *authz.Engine, withSHA512 bool) *DocumentService {
+	return &DocumentService{documents: documents, tags: tags, organizations: organizations, users: users, roles: roles,
+		store: store, authz: engine, withSHA512: withSHA512}
+}
+
+// SetUploadRules applies the content types accepted at upload and their size limits
+func (ds *DocumentService) SetUploadRules(rules config.UploadConfig) {
+	ds.uploadRules = rules
 }
 
 // ProcessFileUpload handles the business logic for uploading a file
-func ProcessFileUpload(input UploadFileInput) (*models.Document, error) {
-	// Ensure the upload directory exists
-	uploadDir := "uploads"
+func (ds *DocumentService) ProcessFileUpload(ctx context.Context, input UploadFileInput) (document *models.Document, err error) {
+	ctx, span := tracing.Start(ctx, "services.ProcessFileUpload",
+		attribute.String("file.name", input.File.Filename), attribute.Int64("file.size", input.File.Size))
+	defer func() { tracing.End(span, err) }()
+
+	// Each organization stores its files under its own prefix
+	organization, err := ds.currentOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the upload directory exists; files wait in quarantine for their malware scan
+	quarantine := ds.scans.Enabled()
+	uploadDir := ds.store.Path(organization.Slug)
+	if quarantine {
+		uploadDir = ds.store.Path(organization.Slug, QuarantineDir)
+	}
 	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
 			return nil, fmt.Errorf("failed to create upload directory: %w", err)
 		}
 	}
 
+	// The client-supplied name must not choose where the file is written
+	filename := sanitizeFilename(input.File.Filename)
+
+	// Detect the real type from the bytes, the declared one is only kept for reference
+	content, err := input.File.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	defer content.Close()
+	detected, head, err := filetype.Detect(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	contentType := filetype.MediaType(detected)
+	span.SetAttributes(attribute.String("file.declared_type", input.File.ContentType), attribute.String("file.detected_type", contentType))
+	if !filetype.DeclaredMatches(input.File.ContentType, detected) {
+		return nil, fmt.Errorf("%w: declared %s, detected %s", ErrTypeMismatch, filetype.Normalize(input.File.ContentType), contentType)
+	}
+	if err := ds.checkUploadType(ctx, input, contentType); err != nil {
+		return nil, err
+	}
+
 	// Generate a unique filename
-	uniqueFilename := fmt.Sprintf("%d-%s", time.Now().UnixNano(), input.File.Filename)
+	uniqueFilename := fmt.Sprintf("%d-%s", time.Now().UnixNano(), filename)
 	filePath := filepath.Join(uploadDir, uniqueFilename)
 
-	// Save the file on the server
-	if err := input.File.Save(filePath); err != nil {
+	// Save the file on the server, encrypted when encryption at rest is enabled
+	encryption, err := ds.store.Save(ctx, filePath, io.MultiReader(bytes.NewReader(head), content))
+	if err != nil {
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
+	// Until the document is created nothing references the file: remove it when the upload fails,
+	// even when the failure is the request being cancelled
+	defer func() {
+		if err == nil {
+			return
+		}
+		if removeErr := ds.store.Remove(context.WithoutCancel(ctx), filePath); removeErr != nil {
+			slog.WarnContext(ctx, "Failed to remove the file of a failed upload", "path", filePath, "error", removeErr)
+		}
+	}()
+
+	// Checksums of the stored copy (decrypted), the reference of the fixity checks
+	digests, err := fixity.Compute(ctx, ds.store, filePath, encryption, ds.withSHA512)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	checkedAt := time.Now()
 
 	// Process tags
 	if input.Tags == nil || input.Tags.Name == "" {
 		input.Tags = &models.Tag{Name: "untagged"} // Tag par défaut
 	}
 
-	tagList, err := findOrCreateTags(strings.Split(input.Tags.Name, ","))
+	tagList, err := ds.findOrCreateTags(ctx, strings.Split(input.Tags.Name, ","))
 	if err != nil {
 		return nil, fmt.Errorf("failed to process tags: %w", err)
 	}
 
 	// Create the document
-	document := models.Document{
-		Name:    input.File.Filename,
-		Type:    input.File.ContentType,
-		URL:     filePath,
-		OwnerID: input.UserID,
-		Tags:    &tagList,
+	document = &models.Document{
+		Name:         filename,
+		Type:         contentType,
+		DeclaredType: input.File.ContentType,
+		URL:          filePath,
+		Encryption:   encryption,
+		Size:         input.File.Size,
+		OwnerID:      input.UserID,
+		FolderID:     input.FolderID,
+		Tags:         &tagList,
+
+		SHA256:          digests.SHA256,
+		SHA512:          digests.SHA512,
+		FixityStatus:    models.FixityOK,
+		FixityCheckedAt: &checkedAt,
+	}
+	if quarantine {
+		document.ScanStatus = models.ScanPending
 	}
 
 	// Save the document to the database
-	if err := database.DB.Create(&document).Error; err != nil {
+	if err := ds.documents.Create(ctx, document); err != nil {
 		return nil, fmt.Errorf("failed to create document record: %w", err)
 	}
 
-	return &document, nil
+	// The scan runs in the background, thumbnails are generated once the file is found clean
+	if quarantine {
+		if err := ds.scans.Schedule(ctx, document.ID); err != nil {
+			slog.WarnContext(ctx, "Failed to schedule malware scan, the document stays in quarantine", "document_id", document.ID, "error", err)
+		}
+		return document, nil
+	}
+
+	// Thumbnails are generated in the background, the upload does not wait nor fail for them
+	if err := ds.previews.Schedule(ctx, document); err != nil {
+		slog.WarnContext(ctx, "Failed to schedule preview generation", "document_id", document.ID, "error", err)
+	}
+
+	return document, nil
 }
 
-// findOrCreateTags searches for or creates tags based on their names
-func findOrCreateTags(tagNames []string) ([]models.Tag, error) {
-	var tagList []models.Tag
-
-	for _, tagName := range tagNames {
-		tag := models.Tag{}
-		if err := database.DB.Where("name = ?", tagName).First(&tag).Error; err != nil {
-			// If the tag does not exist, create it
-			tag = models.Tag{Name: tagName}
-			if err := database.DB.Create(&tag).Error; err != nil {
-				return nil, fmt.Errorf("failed to create tag '%s': %w", tagName, err)
+// checkUploadType applies the allow-lists of the configuration, of the user's roles and of the destination folder
+// to the detected content type, and its size limit
+func (ds *DocumentService) checkUploadType(ctx context.Context, input UploadFileInput, contentType string) error {
+	if !filetype.Allowed(ds.uploadRules.AllowedTypes, contentType) {
+		return fmt.Errorf("%w: %s", ErrTypeNotAllowed, contentType)
+	}
+	if limitMB, ok := filetype.Limit(ds.uploadRules.MaxSizeMBByType, contentType); ok && input.File.Size > limitMB<<20 {
+		return fmt.Errorf("%w: %s files are limited to %d MB", ErrFileTooLarge, contentType, limitMB)
+	}
+
+	// Allowed when any role of the user, directly or through a group, allows the type
+	roleIDs, _, err := ds.users.Memberships(ctx, input.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	allowed := len(roleIDs) == 0
+	for _, roleID := range roleIDs {
+		role, err := ds.roles.Get(ctx, roleID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
 			}
+			return fmt.Errorf("failed to load role: %w", err)
 		}
-		tagList = append(tagList, tag)
+		if filetype.Allowed(filetype.Split(role.AllowedUploadTypes), contentType) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: your role cannot upload %s", ErrTypeNotAllowed, contentType)
 	}
 
-	return tagList, nil
+	if input.FolderID != nil {
+		return ds.folders.checkUpload(ctx, *input.FolderID, input.UserID, contentType)
+	}
+	return nil
+}
+
+// sanitizeFilename keeps the last element of a client-supplied file name, so that it cannot leave the upload
+// directory ("../../etc/passwd" gives "passwd"), without control characters nor leading dots
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+
+	if len(name) > maxFilenameLength {
+		// Keep the extension, cutting the name on a character boundary
+		ext := path.Ext(name)
+		if len(ext) > maxFilenameLength/4 {
+			ext = ""
+		}
+		base := name[:maxFilenameLength-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+	if name == "" || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// findOrCreateTags searches for or creates tags based on their names
+func (ds *DocumentService) findOrCreateTags(ctx context.Context, tagNames []string) (tags []models.Tag, err error) {
+	ctx, span := tracing.Start(ctx, "services.findOrCreateTags", attribute.Int("tags.count", len(tagNames)))
+	defer func() { tracing.End(span, err) }()
+
+	return ds.tags.FindOrCreate(ctx, tagNames)
+}
+
+// currentOrganization loads the organization the context is restricted to
+func (ds *DocumentService) currentOrganization(ctx context.Context) (*models.Organization, error) {
+	organizationID, ok := database.OrganizationFromContext(ctx)
+	if !ok {
+		return nil, database.ErrMissingTenant
+	}
+
+	organization, err := ds.organizations.Get(ctx, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load organization: %w", err)
+	}
+	return organization, nil
 }
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"archiv-system/internal/auth"
+	"archiv-system/internal/authz"
+	"archiv-system/internal/database"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/storage"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrSelfAction         = errors.New("administrators cannot perform this action on their own account")
+	ErrLastAdmin          = errors.New("the last administrator cannot be removed or disabled")
+	ErrExternalAccount    = errors.New("the password of a directory account is managed by the directory")
+	ErrInvalidPassword    = errors.New("current password is incorrect")
+	ErrTransferNotFound   = errors.New("user receiving the documents not found")
+	ErrRegistrationClosed = errors.New("registration is not open for this organization")
+)
+
+// DefaultRoleName is the role given to users who register themselves
+const DefaultRoleName = "user"
+
+// activeUserWindow is the period in which a user must have uploaded a document to count as active
+const activeUserWindow = 30 * 24 * time.Hour
+
+// RegisterInput describes a user registering themselves
+type RegisterInput struct {
+	Username     string
+	Password     string
+	Email        string
+	Organization string // slug, the default organization when empty
+}
+
+// DashboardStats summarizes the activity of an organization
+type DashboardStats struct {
+	TotalUsers        int64                   `json:"total_users"`
+	TotalAdmins       int64                   `json:"total_admins"`
+	TotalDocuments    int64                   `json:"total_documents"`
+	ActiveUsers       int64                   `json:"active_users"`
+	UserDocumentStats []repository.OwnerCount `json:"user_document_stats"`
+}
+
+// UserSummary is the representation of a user in listings
+type UserSummary struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	AuthSource  string     `json:"auth_source"`
+	Disabled    bool       `json:"disabled"`
+	LockedUntil *time.Time `json:"locked_until"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// UserDetail adds usage statistics to UserSummary
+type UserDetail struct {
+	UserSummary
+	Email              string `json:"email"`
+	MustChangePassword bool   `json:"must_change_password"`
+	FailedLogins       int    `json:"failed_logins"`
+	DocumentCount      int64  `json:"document_count"`
+	StorageUsed        int64  `json:"storage_used"` // in bytes
+}
+
+// UserService manages accounts
+type UserService struct {
+	users         repository.UserRepository
+	documents     repository.DocumentRepository
+	roles         repository.RoleRepository
+	organizations repository.OrganizationRepository
+	store         *storage.Store
+	authz         *authz.Engine
+	policy        auth.PasswordPolicy
+}
+
+func NewUserService(users repository.UserRepository, documents repository.DocumentRepository,
+	roles repository.RoleRepository, organizations repository.OrganizationRepository, store *storage.Store,
+	engine *authz.Engine, policy auth.PasswordPolicy) *UserService {
+	return &UserService{users: users, documents: documents, roles: roles, organizations: organizations, store: store,
+		authz: engine, policy: policy}
+}
+
+// Register creates a local account with the default role in an organization open to registration
+func (us *UserService) Register(ctx context.Context, input RegisterInput) (*models.User, error) {
+	if input.Organization == "" {
+		input.Organization = database.DefaultOrganizationSlug
+	}
+	if err := us.policy.Validate(input.Username, input.Password); err != nil {
+		return nil, err
+	}
+
+	// Usernames are unique across organizations
+	system := database.Unscoped(ctx)
+	organization, err := us.organizations.GetBySlug(system, input.Organization)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRegistrationClosed
+		}
+		return nil, err
+	}
+	if !organization.AllowRegistration {
+		return nil, ErrRegistrationClosed
+	}
+	taken, err := us.users.UsernameTaken(system, input.Username)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrUsernameTaken
+	}
+
+	ctx = database.WithOrganization(ctx, organization.ID)
+	role, err := us.roles.GetByName(ctx, DefaultRoleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch default role: %w", err)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	user := models.User{
+		Username: input.Username,
+		Email:    input.Email,
+		Password: string(hashed),
+		RoleID:   role.ID,
+	}
+	if err := us.users.Create(ctx, &user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &user, nil
+}
+
+// Dashboard returns the statistics of the organization
+func (us *UserService) Dashboard(ctx context.Context) (*DashboardStats, error) {
+	var stats DashboardStats
+	var err error
+	if stats.TotalUsers, err = us.users.Count(ctx); err != nil {
+		return nil, err
+	}
+	if stats.TotalAdmins, err = us.users.CountWithRoleName(ctx, AdminRoleName); err != nil {
+		return nil, err
+	}
+	if stats.TotalDocuments, err = us.documents.Count(ctx); err != nil {
+		return nil, err
+	}
+	// Active users uploaded a document recently
+	if stats.ActiveUsers, err = us.documents.CountOwnersSince(ctx, time.Now().Add(-activeUserWindow)); err != nil {
+		return nil, err
+	}
+	if stats.UserDocumentStats, err = us.documents.TopOwners(ctx, 10); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ListUsers returns a page of users whose username contains the query, and the total number of matches
+func (us *UserService) ListUsers(ctx context.Context, query string, page, pageSize int) ([]UserSummary, int64, error) {
+	users, total, err := us.users.List(ctx, query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	summaries := make([]UserSummary, 0, len(users))
+	for _, user := range users {
+		summaries = append(summaries, summarize(user))
+	}
+	return summaries, total, nil
+}
+
+// GetUser loads a user of the organization
+func (us *UserService) GetUser(ctx context.Context, userID uint) (*models.User, error) {
+	return loadUser(ctx, us.users, userID)
+}
+
+// GetUserDetail returns a user with its document count and storage usage
+func (us *UserService) GetUserDetail(ctx context.Context, userID uint) (*UserDetail, error) {
+	user, err := loadUser(ctx, us.users, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := UserDetail{
+		UserSummary:        summarize(*user),
+		Email:              user.Email,
+		MustChangePassword: user.MustChangePassword,
+		FailedLogins:       user.FailedLogins,
+	}
+	if detail.DocumentCount, detail.StorageUsed, err = us.documents.OwnerUsage(ctx, userID); err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabled accounts are rejected on their next request.
+func (us *UserService) SetDisabled(ctx context.Context, userID, actorID uint, disabled bool) (*models.User, error) {
+	if userID == actorID && disabled {
+		return nil, ErrSelfAction
+	}
+	user, err := loadUser(ctx, us.users, userID)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		if err := ensureNotLastAdmin(ctx, us.users, user); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := us.users.Update(ctx, user, map[string]interface{}{"disabled": disabled}); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return user, nil
+}
+
+// ResetPassword replaces the password of a local account by a random temporary password,
+// which the user must change at the next login. The temporary password is returned once.
+func (us *UserService) ResetPassword(ctx context.Context, userID uint) (string, error) {
+	user, err := loadUser(ctx, us.users, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.AuthSource != models.AuthSourceLocal {
+		return "", ErrExternalAccount
+	}
+
+	temporary, err := randomPassword()
+	if err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(temporary), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := storePassword(ctx, us.users, us.policy, user, string(hashed), true); err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+	return temporary, nil
+}
+
+// ChangePassword lets a user replace their own password
+func (us *UserService) ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string) error {
+	user, err := loadUser(ctx, us.users, userID)
+	if err != nil {
+		return err
+	}
+	if user.AuthSource != models.AuthSourceLocal {
+		return ErrExternalAccount
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return ErrInvalidPassword
+	}
+	return setPassword(ctx, us.users, us.policy, user, newPassword, false)
+}
+
+// Unlock lifts the login lockout of an account and resets its failure counter
+func (us *UserService) Unlock(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := loadUser(ctx, us.users, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := us.users.Update(ctx, user, map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to unlock user: %w", err)
+	}
+	return user, nil
+}
+
+// DeleteUser deletes an account. When transferTo is set, the user's documents are given to that user,
+// otherwise they are deleted along with their files.
+func (us *UserService) DeleteUser(ctx context.Context, userID, actorID uint, transferTo *uint) error {
+	if userID == actorID {
+		return ErrSelfAction
+	}
+	user, err := loadUser(ctx, us.users, userID)
+	if err != nil {
+		return err
+	}
+	if err := ensureNotLastAdmin(ctx, us.users, user); err != nil {
+		return err
+	}
+	if transferTo != nil {
+		if *transferTo == userID {
+			return ErrTransferNotFound
+		}
+		if _, err := loadUser(ctx, us.users, *transferTo); err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				return ErrTransferNotFound
+			}
+			return err
+		}
+	}
+
+	removedFiles, err := us.users.Delete(ctx, user, transferTo)
+	if err != nil {
+		return err
+	}
+	us.authz.InvalidateUser(userID)
+
+	// Files are removed once the database no longer references them
+	for _, path := range removedFiles {
+		if err := us.store.Remove(ctx, path); err != nil {
+			slog.WarnContext(ctx, "Failed to remove file of deleted user", "path", path, "user_id", userID, "error", err)
+		}
+	}
+	return nil
+}
+
+// RecordLogin stores the time of a successful login
+func (us *UserService) RecordLogin(ctx context.Context, userID uint) error {
+	return us.users.Update(ctx, &models.User{ID: userID}, map[string]interface{}{"last_login_at": time.Now()})
+}
+
+func loadUser(ctx context.Context, users repository.UserRepository, userID uint) (*models.User, error) {
+	user, err := users.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// ensureNotLastAdmin fails when the user is the only enabled administrator
+func ensureNotLastAdmin(ctx context.Context, users repository.UserRepository, user *models.User) error {
+	if user.Role.Name != AdminRoleName {
+		return nil
+	}
+	admins, err := users.CountEnabledWithRole(ctx, user.RoleID, user.ID)
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func summarize(user models.User) UserSummary {
+	return UserSummary{
+		ID:          user.ID,
+		Username:    user.Username,
+		Role:        user.Role.Name,
+		AuthSource:  user.AuthSource,
+		Disabled:    user.Disabled,
+		LockedUntil: user.LockedUntil,
+		LastLoginAt: user.LastLoginAt,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
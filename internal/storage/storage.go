@@ -0,0 +1,442 @@
+package storage
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/encryption"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"archiv-system/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Store holds the uploaded files in a directory, one sub-directory per organization
+type Store struct {
+	root    string
+	backend string
+	keys    encryption.KeyProvider // nil when no master key is configured
+	encrypt bool                   // new files are encrypted
+}
+
+// New creates the storage directory and loads the master keys of the configuration. Files already encrypted
+// stay readable while the keyfile is configured, even when encryption of new files is disabled.
+func New(cfg config.StorageConfig, encryptionCfg config.EncryptionConfig) (*Store, error) {
+	if cfg.Backend != "local" {
+		return nil, fmt.Errorf("unsupported storage backend '%s'", cfg.Backend)
+	}
+	if err := os.MkdirAll(cfg.Path, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	store := &Store{root: cfg.Path, backend: cfg.Backend}
+	if encryptionCfg.KeyFile != "" {
+		keys, err := encryption.NewKeyProvider(encryptionCfg)
+		if err != nil {
+			return nil, err
+		}
+		store.keys, store.encrypt = keys, encryptionCfg.Enabled
+	}
+	return store, nil
+}
+
+// Backend returns the name of the storage backend
+func (s *Store) Backend() string {
+	return s.backend
+}
+
+// Root returns the storage directory
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Keys returns the key provider, nil when no master key is configured
+func (s *Store) Keys() encryption.KeyProvider {
+	return s.keys
+}
+
+// Path returns the location of a file or directory inside the storage directory
+func (s *Store) Path(elem ...string) string {
+	return filepath.Join(append([]string{s.root}, elem...)...)
+}
+
+// CheckWritable verifies that files can be created in the storage directory
+func (s *Store) CheckWritable() error {
+	file, err := os.CreateTemp(s.root, ".writecheck-*")
+	if err != nil {
+		return err
+	}
+	name := file.Name()
+	_, writeErr := file.Write([]byte("ok"))
+	closeErr := file.Close()
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return closeErr
+}
+
+// partialSuffix marks the files being written, renamed once complete
+const partialSuffix = ".partial"
+
+// headerSuffix marks the copy of the header of an encrypted file kept while a key rotation rewrites it
+const headerSuffix = ".header"
+
+// Save writes the content read from r to a new file at path, encrypted when encryption at rest is enabled,
+// inside a trace span, and returns the encryption to record with the file. The file only appears at path once
+// completely written.
+func (s *Store) Save(ctx context.Context, path string, r io.Reader) (_ models.Encryption, err error) {
+	ctx, span := tracing.Start(ctx, "storage.Save",
+		attribute.String("storage.backend", s.backend), attribute.String("storage.path", path),
+		attribute.Bool("storage.encrypted", s.encrypt))
+	defer func() { tracing.End(span, err) }()
+
+	partial := path + partialSuffix
+	file, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return models.Encryption{}, err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(partial)
+		}
+	}()
+
+	var encrypted models.Encryption
+	w := io.WriteCloser(nopCloser{file})
+	if s.encrypt {
+		if w, err = encryption.NewWriter(ctx, file, s.keys); err != nil {
+			return models.Encryption{}, fmt.Errorf("failed to encrypt file: %w", err)
+		}
+		encrypted = models.Encryption{Encrypted: true, KeyID: s.keys.KeyID()}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return models.Encryption{}, err
+	}
+	if err := w.Close(); err != nil {
+		return models.Encryption{}, err
+	}
+	if err := file.Sync(); err != nil {
+		return models.Encryption{}, err
+	}
+	if err := file.Close(); err != nil {
+		return models.Encryption{}, err
+	}
+	return encrypted, os.Rename(partial, path)
+}
+
+// Open returns the content of a stored file, decrypted when its record says it is encrypted. A missing file
+// gives an error matching os.ErrNotExist, an altered encrypted file gives read errors matching
+// encryption.ErrCorrupted.
+func (s *Store) Open(ctx context.Context, path string, enc models.Encryption) (rc io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "storage.Open",
+		attribute.String("storage.backend", s.backend), attribute.String("storage.path", path),
+		attribute.Bool("storage.encrypted", enc.Encrypted))
+	defer func() { tracing.End(span, err) }()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !enc.Encrypted {
+		return file, nil
+	}
+
+	// While a rotation rewrites the header, its copy is read instead
+	content := io.Reader(file)
+	if header := s.headerCopy(ctx, path); header != nil {
+		if _, err := file.Seek(encryption.HeaderSize, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		content = io.MultiReader(bytes.NewReader(header), file)
+	}
+	decrypted, err := encryption.NewReader(ctx, content, s.keys)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return readCloser{Reader: decrypted, Closer: file}, nil
+}
+
+// RotationSummary counts the files seen by a key rotation
+type RotationSummary struct {
+	Encrypted int // encrypted files found
+	Rewrapped int // files whose data key was wrapped again with the current master key
+	Missing   int // encrypted files missing from the storage
+}
+
+// fileBatchSize is the number of records read at once by the rotations and backfills
+const fileBatchSize = 500
+
+// RotateKeys wraps the data key of every encrypted file recorded in files with the current master key, and
+// records the new key id. The content of the files is not re-encrypted, only their header is rewritten. Files
+// already using the current key are left alone, so an interrupted rotation can simply be run again.
+func (s *Store) RotateKeys(ctx context.Context, files repository.StoredFileRepository) (summary RotationSummary, err error) {
+	ctx, span := tracing.Start(ctx, "storage.RotateKeys", attribute.String("storage.backend", s.backend))
+	defer func() {
+		span.SetAttributes(attribute.Int("storage.encrypted", summary.Encrypted), attribute.Int("storage.rewrapped", summary.Rewrapped))
+		tracing.End(span, err)
+	}()
+
+	if s.keys == nil {
+		return summary, encryption.ErrNoKeyProvider
+	}
+	err = eachStoredFile(ctx, files, func(file repository.StoredFile) error {
+		if !file.Encrypted {
+			return nil
+		}
+		summary.Encrypted++
+		keyID, rewrapped, err := s.rewrap(ctx, file.URL)
+		if errors.Is(err, fs.ErrNotExist) {
+			summary.Missing++
+			slog.WarnContext(ctx, "Encrypted file missing from the storage", "table", file.Table, "id", file.ID, "path", file.URL)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to rewrap %s: %w", file.URL, err)
+		}
+		if rewrapped {
+			summary.Rewrapped++
+			slog.DebugContext(ctx, "Rewrapped data key", "path", file.URL, "key_id", keyID)
+		}
+		if keyID != file.KeyID {
+			file.KeyID = keyID
+			return files.SetEncryption(ctx, file)
+		}
+		return nil
+	})
+	return summary, err
+}
+
+// Backfill records the encryption of the files stored before it was recorded with them, and returns how many
+// were found encrypted. A file is only recorded as encrypted when the master keys unwrap the data key of its
+// header, so that a plaintext file starting like an encrypted one is left alone.
+func (s *Store) Backfill(ctx context.Context, files repository.StoredFileRepository) (recorded int, err error) {
+	ctx, span := tracing.Start(ctx, "storage.Backfill", attribute.String("storage.backend", s.backend))
+	defer func() {
+		span.SetAttributes(attribute.Int("storage.recorded", recorded))
+		tracing.End(span, err)
+	}()
+
+	if s.keys == nil {
+		return 0, encryption.ErrNoKeyProvider
+	}
+	err = eachStoredFile(ctx, files, func(file repository.StoredFile) error {
+		if file.Encrypted {
+			return nil
+		}
+		header, err := readHeader(file.URL)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		keyID, err := encryption.KeyID(ctx, header, s.keys)
+		if err != nil {
+			// Plaintext, whatever its first bytes
+			return nil
+		}
+		file.Encryption = models.Encryption{Encrypted: true, KeyID: keyID}
+		if err := files.SetEncryption(ctx, file); err != nil {
+			return err
+		}
+		recorded++
+		return nil
+	})
+	return recorded, err
+}
+
+// eachStoredFile calls fn with every file recorded in files, until it fails or ctx is done
+func eachStoredFile(ctx context.Context, files repository.StoredFileRepository, fn func(repository.StoredFile) error) error {
+	for _, table := range repository.StoredFileTables {
+		var afterID uint
+		for {
+			batch, err := files.List(ctx, table, afterID, fileBatchSize)
+			if err != nil {
+				return err
+			}
+			for _, file := range batch {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err := fn(file); err != nil {
+					return err
+				}
+			}
+			if len(batch) < fileBatchSize {
+				break
+			}
+			afterID = batch[len(batch)-1].ID
+		}
+	}
+	return nil
+}
+
+// readHeader returns the first bytes of a file, as many as an encryption header, fewer for shorter files
+func readHeader(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header := make([]byte, encryption.HeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// rewrap wraps the data key of an encrypted file with the current master key, and returns the id of the key now
+// wrapping it. The old header is first copied next to the file and synced: a rewrite interrupted by a crash is
+// undone by the next rotation, and readers use the copy meanwhile.
+func (s *Store) rewrap(ctx context.Context, path string) (keyID string, rewrapped bool, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", false, err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	backup := path + headerSuffix
+	if err := s.restoreHeader(ctx, file, path); err != nil {
+		return "", false, fmt.Errorf("failed to restore the header of an interrupted rotation: %w", err)
+	}
+
+	header := make([]byte, encryption.HeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", false, fmt.Errorf("%w: truncated header", encryption.ErrCorrupted)
+		}
+		return "", false, err
+	}
+	rewritten, rewrapped, err := encryption.Rewrap(ctx, header, s.keys)
+	if err != nil {
+		return "", false, err
+	}
+	if !rewrapped {
+		keyID, err := encryption.KeyID(ctx, header, s.keys)
+		return keyID, false, err
+	}
+
+	if err := writeSynced(backup, header); err != nil {
+		return "", false, err
+	}
+	if _, err := file.WriteAt(rewritten, 0); err != nil {
+		return "", false, err
+	}
+	if err := file.Sync(); err != nil {
+		return "", false, err
+	}
+	if err := os.Remove(backup); err != nil {
+		return "", false, err
+	}
+	return s.keys.KeyID(), true, nil
+}
+
+// headerCopy returns the header of an encrypted file copied by a rotation, nil when there is none or when the
+// copy was itself interrupted, in which case the file was not touched
+func (s *Store) headerCopy(ctx context.Context, path string) []byte {
+	if s.keys == nil {
+		return nil
+	}
+	header, err := os.ReadFile(path + headerSuffix)
+	if err != nil || len(header) != encryption.HeaderSize {
+		return nil
+	}
+	if _, err := encryption.KeyID(ctx, header, s.keys); err != nil {
+		return nil
+	}
+	return header
+}
+
+// restoreHeader writes back the header copied by an interrupted rotation, if any
+func (s *Store) restoreHeader(ctx context.Context, file *os.File, path string) error {
+	if header := s.headerCopy(ctx, path); header != nil {
+		if _, err := file.WriteAt(header, 0); err != nil {
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path + headerSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// writeSynced writes data to a new file at path and syncs it with its directory
+func writeSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Remove deletes a stored file, ignoring files that no longer exist
+func (s *Store) Remove(ctx context.Context, path string) (err error) {
+	_, span := tracing.Start(ctx, "storage.Remove",
+		attribute.String("storage.backend", s.backend), attribute.String("storage.path", path))
+	defer func() { tracing.End(span, err) }()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Move renames a stored file, creating the directory of its new location
+func (s *Store) Move(ctx context.Context, from, to string) (err error) {
+	_, span := tracing.Start(ctx, "storage.Move",
+		attribute.String("storage.backend", s.backend), attribute.String("storage.path", to))
+	defer func() { tracing.End(span, err) }()
+
+	if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"archiv-system/internal/config"
+	"archiv-system/internal/database"
+	"archiv-system/internal/encryption"
+	"archiv-system/internal/models"
+	"archiv-system/internal/repository"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKeyfile writes a keyfile holding the lines, the last one being the current key
+func writeKeyfile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func generateKey(t *testing.T, id string) string {
+	t.Helper()
+	line, err := encryption.GenerateKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func newStore(t *testing.T, root, keyfile string, encrypt bool) *Store {
+	t.Helper()
+	store, err := New(config.StorageConfig{Backend: "local", Path: root},
+		config.EncryptionConfig{Enabled: encrypt, Provider: config.KeyProviderLocal, KeyFile: keyfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func save(t *testing.T, store *Store, name string, content []byte) (string, models.Encryption) {
+	t.Helper()
+	path := store.Path(name)
+	enc, err := store.Save(context.Background(), path, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, enc
+}
+
+func read(store *Store, path string, enc models.Encryption) ([]byte, error) {
+	rc, err := store.Open(context.Background(), path, enc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// storageFixture holds documents recorded in the in-memory repositories, their files in a storage encrypted
+// with the key k1
+type storageFixture struct {
+	root  string
+	first string // keyfile line of k1
+	repos *repository.Repositories
+	ctx   context.Context
+}
+
+func newStorageFixture(t *testing.T) *storageFixture {
+	t.Helper()
+	repos := repository.NewMemory()
+	organization, err := repos.Organizations.GetBySlug(database.Unscoped(context.Background()), database.DefaultOrganizationSlug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &storageFixture{
+		root:  t.TempDir(),
+		first: generateKey(t, "k1"),
+		repos: repos,
+		ctx:   database.WithOrganization(context.Background(), organization.ID),
+	}
+}
+
+// addDocument stores content and records the document referencing it
+func (f *storageFixture) addDocument(t *testing.T, store *Store, name string, content []byte) *models.Document {
+	t.Helper()
+	path, enc := save(t, store, name, content)
+	document := &models.Document{Name: name, Type: "text/plain", URL: path, Encryption: enc, OwnerID: 1}
+	if err := f.repos.Documents.Create(f.ctx, document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func (f *storageFixture) document(t *testing.T, id uint) *models.Document {
+	t.Helper()
+	document, err := f.repos.Documents.Get(f.ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestSaveRecordsEncryption(t *testing.T) {
+	keyfile := writeKeyfile(t, generateKey(t, "k1"))
+	root := t.TempDir()
+	encrypted := newStore(t, root, keyfile, true)
+	// Encryption disabled, files already encrypted stay readable
+	plain := newStore(t, root, keyfile, false)
+
+	content := []byte("minutes of the board")
+	path, enc := save(t, encrypted, "minutes.txt", content)
+	if !enc.Encrypted || enc.KeyID != "k1" {
+		t.Fatalf("encryption %+v, want encrypted with k1", enc)
+	}
+	if raw, _ := os.ReadFile(path); bytes.Contains(raw, content) {
+		t.Error("plaintext found in the stored file")
+	}
+	for _, store := range []*Store{encrypted, plain} {
+		if got, err := read(store, path, enc); err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("read %q (%v)", got, err)
+		}
+	}
+
+	// A plaintext upload starting like an encrypted file is read as it is
+	lookalike := append([]byte(encryption.Magic), "not encrypted at all"...)
+	path, enc = save(t, plain, "lookalike.txt", lookalike)
+	if enc.Encrypted {
+		t.Fatal("plaintext file recorded as encrypted")
+	}
+	if got, err := read(encrypted, path, enc); err != nil || !bytes.Equal(got, lookalike) {
+		t.Fatalf("read %q (%v), want the plaintext", got, err)
+	}
+
+	if _, err := read(plain, filepath.Join(root, "missing"), enc); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	f := newStorageFixture(t)
+	before := newStore(t, f.root, writeKeyfile(t, f.first), true)
+	contents := map[uint][]byte{}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		document := f.addDocument(t, before, name, []byte("content of "+name))
+		contents[document.ID] = []byte("content of " + name)
+	}
+	lookalike := append([]byte(encryption.Magic), "plaintext"...)
+	plain := f.addDocument(t, newStore(t, f.root, "", false), "lookalike.txt", lookalike)
+
+	second := generateKey(t, "k2")
+	rotated := newStore(t, f.root, writeKeyfile(t, f.first, second), true)
+	summary, err := rotated.RotateKeys(f.ctx, f.repos.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Encrypted != 2 || summary.Rewrapped != 2 || summary.Missing != 0 {
+		t.Fatalf("summary %+v, want 2 files rewrapped", summary)
+	}
+
+	// The old key is no longer needed, the new key id is recorded
+	after := newStore(t, f.root, writeKeyfile(t, second), true)
+	for id, content := range contents {
+		document := f.document(t, id)
+		if document.KeyID != "k2" {
+			t.Errorf("document %d recorded with key %q, want k2", id, document.KeyID)
+		}
+		if got, err := read(after, document.URL, document.Encryption); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("document %d: read %q (%v)", id, got, err)
+		}
+		if _, err := os.Stat(document.URL + headerSuffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("document %d: header copy left after the rotation", id)
+		}
+	}
+	if got, err := read(after, plain.URL, f.document(t, plain.ID).Encryption); err != nil || !bytes.Equal(got, lookalike) {
+		t.Errorf("plaintext document: read %q (%v)", got, err)
+	}
+
+	// Running it again changes nothing
+	if summary, err = rotated.RotateKeys(f.ctx, f.repos.Files); err != nil || summary.Rewrapped != 0 {
+		t.Fatalf("second rotation: %+v, %v", summary, err)
+	}
+}
+
+func TestInterruptedRewrap(t *testing.T) {
+	f := newStorageFixture(t)
+	before := newStore(t, f.root, writeKeyfile(t, f.first), true)
+	content := bytes.Repeat([]byte("archive "), 10000)
+	document := f.addDocument(t, before, "report.txt", content)
+
+	// A crash while the header was being rewritten: its copy is synced, the header in the file is torn
+	header, err := readHeader(document.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(document.URL+headerSuffix, header, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(document.URL, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt(bytes.Repeat([]byte{0xff}, 100), 0); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// Readers use the copy until the rotation is run again
+	if got, err := read(before, document.URL, document.Encryption); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("read during the rotation: %v", err)
+	}
+
+	second := generateKey(t, "k2")
+	rotated := newStore(t, f.root, writeKeyfile(t, f.first, second), true)
+	if _, err := rotated.RotateKeys(f.ctx, f.repos.Files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(document.URL + headerSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Error("header copy left after the rotation")
+	}
+	after := newStore(t, f.root, writeKeyfile(t, second), true)
+	if got, err := read(after, document.URL, f.document(t, document.ID).Encryption); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("read after the rotation: %v", err)
+	}
+
+	// A copy torn before the file was touched is discarded
+	if err := os.WriteFile(document.URL+headerSuffix, make([]byte, encryption.HeaderSize), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := read(after, document.URL, f.document(t, document.ID).Encryption); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("read with a torn copy: %v", err)
+	}
+	if _, err := after.RotateKeys(f.ctx, f.repos.Files); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := read(after, document.URL, f.document(t, document.ID).Encryption); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("read after discarding a torn copy: %v", err)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	f := newStorageFixture(t)
+	store := newStore(t, f.root, writeKeyfile(t, f.first), true)
+	legacy := f.addDocument(t, store, "legacy.txt", []byte("encrypted before the flag was recorded"))
+	if err := f.repos.Files.SetEncryption(f.ctx, repository.StoredFile{Table: "documents", ID: legacy.ID}); err != nil {
+		t.Fatal(err)
+	}
+	lookalike := f.addDocument(t, newStore(t, f.root, "", false), "lookalike.txt",
+		append([]byte(encryption.Magic), bytes.Repeat([]byte{1}, encryption.HeaderSize)...))
+
+	recorded, err := store.Backfill(f.ctx, f.repos.Files)
+	if err != nil || recorded != 1 {
+		t.Fatalf("recorded %d (%v), want 1", recorded, err)
+	}
+	if enc := f.document(t, legacy.ID).Encryption; !enc.Encrypted || enc.KeyID != "k1" {
+		t.Errorf("legacy document recorded as %+v", enc)
+	}
+	if enc := f.document(t, lookalike.ID).Encryption; enc.Encrypted {
+		t.Error("plaintext document recorded as encrypted")
+	}
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"archiv-system/internal/config"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// newTracedRouter installs an in-memory exporter and returns a router traced like the application's,
+// with a route opening a child span that fails when asked to
+func newTracedRouter(t *testing.T) (*gin.Engine, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := Init(context.Background(), config.TracingConfig{ServiceName: "archiv-test", SampleRatio: 1}, exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		shutdown(context.Background())
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(otelgin.Middleware("archiv-test"))
+	r.GET("/documents/:id", func(c *gin.Context) {
+		_, span := Start(c.Request.Context(), "documents.Get", attribute.String("document.id", c.Param("id")))
+		var err error
+		if c.Query("fail") != "" {
+			err = errors.New("document not found")
+		}
+		End(span, err)
+		c.Status(http.StatusNoContent)
+	})
+	return r, exporter
+}
+
+// spanNamed returns the span of that name, failing the test when there is none
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span %q among %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func TestRequestSpans(t *testing.T) {
+	r, exporter := newTracedRouter(t)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/documents/7", nil))
+
+	spans := exporter.GetSpans()
+	server := spanNamed(t, spans, "/documents/:id")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("route span of kind %v, want a server span", server.SpanKind)
+	}
+	child := spanNamed(t, spans, "documents.Get")
+	if child.SpanContext.TraceID() != server.SpanContext.TraceID() || child.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("service span is not a child of the route span")
+	}
+	if child.Status.Code == codes.Error {
+		t.Errorf("successful span has status %v", child.Status)
+	}
+	found := false
+	for _, attr := range child.Attributes {
+		found = found || (attr.Key == "document.id" && attr.Value.AsString() == "7")
+	}
+	if !found {
+		t.Errorf("service span attributes %v lack the document", child.Attributes)
+	}
+}
+
+func TestRequestSpansJoinIncomingTrace(t *testing.T) {
+	r, exporter := newTracedRouter(t)
+	req := httptest.NewRequest(http.MethodGet, "/documents/7?fail=1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	server := spanNamed(t, spans, "/documents/:id")
+	if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("route span in trace %s, want the trace of the traceparent header", got)
+	}
+	if got := server.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("route span parent %s, want the caller's span", got)
+	}
+
+	// End records the error of the operation on its span
+	child := spanNamed(t, spans, "documents.Get")
+	if child.Status.Code != codes.Error || child.Status.Description != "document not found" {
+		t.Errorf("failed span has status %+v", child.Status)
+	}
+	if len(child.Events) == 0 || child.Events[0].Name != "exception" {
+		t.Errorf("failed span records no error event: %+v", child.Events)
+	}
+}
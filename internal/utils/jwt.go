@@ -1,57 +1,45 @@
 package utils
 
 import (
+	"archiv-system/internal/config"
 	"errors"
-	"os"
+	"log/slog"
 	"strings"
-	"sync"
 	"time"
 
-	"log"
-
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Global variable with restricted access
-var (
-	jwtKey []byte
-	once   sync.Once
-)
-
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	RoleName string `json:"roleName"`
+	UserID         uint   `json:"user_id"`
+	OrganizationID uint   `json:"organization_id"`
+	RoleName       string `json:"roleName"`
 	jwt.RegisteredClaims
 }
 
-// InitJWTKey initializes the jwtKey only once
-func InitJWTKey() error {
-	var initErr error
-	once.Do(func() {
-		// Load JWT_SECRET from environment variables
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			initErr = errors.New("JWT_SECRET is not set in environment variables")
-			return
-		}
-		jwtKey = []byte(secret)
-	})
-	return initErr
+// JWT signs and verifies the tokens of the users
+type JWT struct {
+	key        []byte
+	expiration time.Duration
 }
 
-// GenerateToken generates a JWT token for the user with the specified ID and role.
-func GenerateToken(userID uint, roleName string) (string, error) {
-	// Ensure jwtKey is initialized
-	if err := InitJWTKey(); err != nil {
-		return "", err
+// NewJWT takes the signing key and the token lifetime from the configuration
+func NewJWT(cfg config.JWTConfig) (*JWT, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("JWT secret is not configured")
 	}
+	return &JWT{key: []byte(cfg.Secret), expiration: cfg.Expiration}, nil
+}
 
+// GenerateToken generates a JWT token for the user with the specified ID, organization and role.
+func (j *JWT) GenerateToken(userID, organizationID uint, roleName string) (string, error) {
 	// Set expiration
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(j.expiration)
 	claims := &Claims{
-		UserID:   userID,
-		RoleName: roleName,
+		UserID:         userID,
+		OrganizationID: organizationID,
+		RoleName:       roleName,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
@@ -59,27 +47,23 @@ func GenerateToken(userID uint, roleName string) (string, error) {
 
 	// Generate token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := token.SignedString(j.key)
 	if err != nil {
 		return "", err
 	}
 
-	// Log token information
-	log.Printf("Generated token for user ID: %d, Role: %s", userID, roleName)
+	slog.Debug("Generated token", "user_id", userID, "organization_id", organizationID, "role", roleName)
 
 	return tokenString, nil
 }
 
-func ParseToken(tokenString string) (*Claims, error) {
+func (j *JWT) ParseToken(tokenString string) (*Claims, error) {
 	// Remove "Bearer " prefix if present
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-	// Load the secret key
-	jwtKey := []byte(os.Getenv("JWT_SECRET"))
-
 	// Parse the token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
+		return j.key, nil
 	})
 	if err != nil {
 		return nil, err
@@ -91,22 +75,14 @@ func ParseToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token claims")
 	}
 
-	// Log token information
-	log.Printf("Parsed token for user ID: %d, Role: %s", claims.UserID, claims.RoleName)
-
 	return claims, nil
 }
 
 // ValidateToken verifies and extracts claims from the token
-func ValidateToken(tokenStr string) (*Claims, error) {
+func (j *JWT) ValidateToken(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		// Ensure jwtKey is initialized
-		if err := InitJWTKey(); err != nil {
-			return nil, err
-		}
-
-		return jwtKey, nil
+		return j.key, nil
 	})
 	if err != nil {
 		return nil, err
@@ -115,9 +91,6 @@ func ValidateToken(tokenStr string) (*Claims, error) {
 		return nil, jwt.ErrSignatureInvalid
 	}
 
-	// Log token information
-	log.Printf("Validated token for user ID: %d, Role: %s", claims.UserID, claims.RoleName)
-
 	return claims, nil
 }
 